@@ -0,0 +1,423 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"arkham-cli/apiv1"
+	"arkham-cli/budget"
+	"arkham-cli/daemon"
+	"arkham-cli/node"
+	ap "arkham-cli/solana"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// apiHandler handles a v1 request. The result is written as JSON; errors are written as
+// the v1 error envelope.
+type apiHandler func(r *http.Request) (any, error)
+
+// apiRouter registers v1 routes on a mux. Each route is registered with its method, and
+// every path also gets a method-less fallback answering 405 with an Allow header.
+type apiRouter struct {
+	mux *http.ServeMux
+	// methods lists the allowed methods of each route path, relative to apiv1.Prefix.
+	methods map[string][]string
+}
+
+// newAPIv1Router registers the /api/v1 routes on mux.
+func newAPIv1Router(mux *http.ServeMux) *apiRouter {
+	rt := &apiRouter{mux: mux, methods: make(map[string][]string)}
+
+	rt.handle(http.MethodGet, "/openapi.json", func(r *http.Request) (any, error) {
+		return json.RawMessage(apiv1.OpenAPI), nil
+	})
+
+	rt.handle(http.MethodGet, "/node", func(r *http.Request) (any, error) {
+		return p2pNode.Status(), nil
+	})
+	rt.handle(http.MethodPost, "/node/start", func(r *http.Request) (any, error) {
+		return arkhamd.StartNode()
+	})
+	rt.handle(http.MethodPost, "/node/stop", func(r *http.Request) (any, error) {
+		return arkhamd.StopNode()
+	})
+	rt.handle(http.MethodGet, "/node/config", func(r *http.Request) (any, error) {
+		return apiv1.NodeConfig(p2pNode.Config()), nil
+	})
+	rt.handle(http.MethodPut, "/node/config", apiSetNodeConfig)
+	rt.handle(http.MethodGet, "/node/location", apiNodeLocation)
+	rt.handle(http.MethodGet, "/peers", func(r *http.Request) (any, error) {
+		return p2pNode.Peers(), nil
+	})
+
+	rt.handle(http.MethodGet, "/profiles", apiListProfiles)
+	rt.handle(http.MethodPost, "/profiles", apiCreateProfile)
+	rt.handle(http.MethodGet, "/profiles/{profile}/balance", apiBalance)
+	rt.handle(http.MethodGet, "/profiles/{profile}/token-balance", apiTokenBalance)
+	rt.handle(http.MethodGet, "/profiles/{profile}/history", apiHistory)
+	rt.handle(http.MethodGet, "/profiles/{profile}/warden", apiWardenStatus)
+	rt.handle(http.MethodPost, "/profiles/{profile}/warden", apiRegisterWarden)
+	rt.handle(http.MethodGet, "/profiles/{profile}/seeker", apiSeekerStatus)
+	rt.handle(http.MethodGet, "/profiles/{profile}/budget", apiBudget)
+	rt.handle(http.MethodPut, "/profiles/{profile}/budget", apiSetBudget)
+	rt.handle(http.MethodPost, "/profiles/{profile}/escrow", apiDepositEscrow)
+	rt.handle(http.MethodPost, "/profiles/{profile}/claim", apiClaimEarnings)
+	rt.handle(http.MethodGet, "/profiles/{profile}/private", apiPrivateActivity)
+	rt.handle(http.MethodGet, "/profiles/{profile}/stake-preview", apiStakePreview)
+
+	rt.handle(http.MethodGet, "/wardens", func(r *http.Request) (any, error) {
+		return listWardens()
+	})
+	rt.handle(http.MethodGet, "/quote", apiQuote)
+
+	rt.handle(http.MethodGet, "/circuit", apiCircuit)
+	rt.handle(http.MethodPost, "/circuit", apiConnect)
+	rt.handle(http.MethodDelete, "/circuit", apiDisconnect)
+
+	mux.HandleFunc(apiv1.Prefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, apiv1.Errorf(http.StatusNotFound, apiv1.CodeNotFound, "No route for %s", r.URL.Path))
+	})
+	return rt
+}
+
+func (rt *apiRouter) handle(method, path string, h apiHandler) {
+	pattern := apiv1.Prefix + path
+	if _, ok := rt.methods[path]; !ok {
+		rt.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Allow", strings.Join(rt.methods[path], ", "))
+			writeAPIError(w, apiv1.Errorf(http.StatusMethodNotAllowed, apiv1.CodeMethodNotAllowed, "Method %s is not allowed on %s", r.Method, r.URL.Path))
+		})
+	}
+	rt.methods[path] = append(rt.methods[path], method)
+
+	rt.mux.HandleFunc(method+" "+pattern, func(w http.ResponseWriter, r *http.Request) {
+		result, err := h(r)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		writeAPIResult(w, result)
+	})
+}
+
+func writeAPIResult(w http.ResponseWriter, result any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Failed to write API response: %v", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, err error) {
+	apiErr := apiv1.AsError(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(apiErr)
+}
+
+// decodeRequest decodes a JSON body into req, rejecting unknown fields, and validates it.
+func decodeRequest(r *http.Request, req apiv1.Validator) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(req); err != nil {
+		return apiv1.Errorf(http.StatusBadRequest, apiv1.CodeInvalidRequest, "Invalid request body: %v", err)
+	}
+	return apiv1.Validate(req)
+}
+
+func apiSetNodeConfig(r *http.Request) (any, error) {
+	var req apiv1.NodeConfig
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+	if err := arkhamd.SetNodeConfig(node.Config(req)); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func apiNodeLocation(r *http.Request) (any, error) {
+	loc, err := wardenLocation()
+	if err != nil {
+		return nil, err
+	}
+	protocolConfig, err := readOnlyClient.FetchProtocolConfig()
+	if err != nil {
+		return nil, apiv1.Errorf(http.StatusBadGateway, apiv1.CodeUpstream, "Failed to fetch protocol config: %v", err)
+	}
+	return apiv1.NewLocation(loc, protocolConfig), nil
+}
+
+// profileClient returns the client for the {profile} path parameter.
+func profileClient(r *http.Request) (*ap.Client, error) {
+	name := r.PathValue("profile")
+	if fields := apiv1.ValidateProfileName("profile", name); len(fields) > 0 {
+		return nil, apiv1.InvalidParam("profile", fields[0].Message)
+	}
+	client, err := clientForProfile(name)
+	if err != nil {
+		return nil, apiv1.Errorf(http.StatusNotFound, apiv1.CodeNotFound, "Profile '%s' not found", name)
+	}
+	return client, nil
+}
+
+func apiListProfiles(r *http.Request) (any, error) {
+	wallets, err := walletStore.GetAllWallets()
+	if err != nil {
+		return nil, err
+	}
+	profiles := make([]apiv1.Profile, 0, len(wallets))
+	for name, key := range wallets {
+		profiles = append(profiles, apiv1.Profile{Profile: name, PublicKey: key.PublicKey().String()})
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Profile < profiles[j].Profile })
+	return profiles, nil
+}
+
+func apiCreateProfile(r *http.Request) (any, error) {
+	var req apiv1.CreateProfileRequest
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+	publicKey, err := createProfile(req.Profile)
+	if err != nil {
+		return nil, err
+	}
+	return apiv1.Profile{Profile: req.Profile, PublicKey: publicKey.String()}, nil
+}
+
+func apiBalance(r *http.Request) (any, error) {
+	client, err := profileClient(r)
+	if err != nil {
+		return nil, err
+	}
+	balance, err := client.GetBalance(client.Signer.PublicKey())
+	if err != nil {
+		return nil, apiv1.Errorf(http.StatusBadGateway, apiv1.CodeUpstream, "Failed to get balance: %v", err)
+	}
+	return apiv1.Balance{Lamports: balance}, nil
+}
+
+func apiTokenBalance(r *http.Request) (any, error) {
+	client, err := profileClient(r)
+	if err != nil {
+		return nil, err
+	}
+	mint, err := solana.PublicKeyFromBase58(r.URL.Query().Get("mint"))
+	if err != nil {
+		return nil, apiv1.InvalidParam("mint", "must be a base58 public key")
+	}
+	balance, err := client.GetTokenBalance(client.Signer.PublicKey(), mint)
+	if err != nil {
+		return nil, apiv1.Errorf(http.StatusBadGateway, apiv1.CodeUpstream, "Failed to get token balance: %v", err)
+	}
+	return apiv1.TokenBalance{UiAmount: balance}, nil
+}
+
+func apiHistory(r *http.Request) (any, error) {
+	client, err := profileClient(r)
+	if err != nil {
+		return nil, err
+	}
+	history, err := client.GetHistory(client.Signer.PublicKey())
+	if err != nil {
+		return nil, apiv1.Errorf(http.StatusBadGateway, apiv1.CodeUpstream, "Failed to get transaction history: %v", err)
+	}
+	return history, nil
+}
+
+func apiWardenStatus(r *http.Request) (any, error) {
+	client, err := profileClient(r)
+	if err != nil {
+		return nil, err
+	}
+	warden, err := lookupWarden(client)
+	if err != nil {
+		return nil, apiv1.Errorf(http.StatusBadGateway, apiv1.CodeUpstream, "Failed to fetch warden account: %v", err)
+	}
+	if warden == nil {
+		return apiv1.WardenStatus{}, nil
+	}
+	return apiv1.WardenStatus{IsRegistered: true, Warden: apiv1.NewWarden(warden)}, nil
+}
+
+func apiRegisterWarden(r *http.Request) (any, error) {
+	client, err := profileClient(r)
+	if err != nil {
+		return nil, err
+	}
+	var req apiv1.RegisterWardenRequest
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+	sig, err := registerWarden(client, req)
+	if err != nil {
+		return nil, err
+	}
+	return apiv1.Transaction{TransactionSignature: sig.String()}, nil
+}
+
+func apiSeekerStatus(r *http.Request) (any, error) {
+	client, err := profileClient(r)
+	if err != nil {
+		return nil, err
+	}
+	seeker, err := lookupSeeker(client)
+	if err != nil {
+		return nil, apiv1.Errorf(http.StatusBadGateway, apiv1.CodeUpstream, "Failed to fetch seeker account: %v", err)
+	}
+	if seeker == nil {
+		return apiv1.SeekerStatus{}, nil
+	}
+	status := apiv1.SeekerStatus{IsRegistered: true, Seeker: apiv1.NewSeeker(seeker)}
+	if o, err := arkhamd.Orchestrator(r.PathValue("profile")); err == nil {
+		status.Budget, _ = o.Budget()
+	}
+	return status, nil
+}
+
+// profileOrchestrator returns the session orchestrator of the request's profile.
+func profileOrchestrator(r *http.Request) (*daemon.Orchestrator, error) {
+	if _, err := profileClient(r); err != nil {
+		return nil, err
+	}
+	return arkhamd.Orchestrator(r.PathValue("profile"))
+}
+
+func apiBudget(r *http.Request) (any, error) {
+	o, err := profileOrchestrator(r)
+	if err != nil {
+		return nil, err
+	}
+	status, err := o.Budget()
+	if err != nil {
+		return nil, apiv1.Errorf(http.StatusBadGateway, apiv1.CodeUpstream, "Failed to compute budget: %v", err)
+	}
+	return status, nil
+}
+
+func apiSetBudget(r *http.Request) (any, error) {
+	o, err := profileOrchestrator(r)
+	if err != nil {
+		return nil, err
+	}
+	var req apiv1.BudgetPolicy
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+	if err := o.SetBudget(budget.Policy(req)); err != nil {
+		return nil, err
+	}
+	return apiBudget(r)
+}
+
+func apiDepositEscrow(r *http.Request) (any, error) {
+	client, err := profileClient(r)
+	if err != nil {
+		return nil, err
+	}
+	var req apiv1.DepositRequest
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+	sig, err := client.DepositEscrow(req.Amount, req.Private)
+	if err != nil {
+		return nil, apiv1.Errorf(http.StatusBadGateway, apiv1.CodeUpstream, "Escrow deposit failed: %v", err)
+	}
+	return apiv1.Transaction{TransactionSignature: sig.String()}, nil
+}
+
+func apiClaimEarnings(r *http.Request) (any, error) {
+	client, err := profileClient(r)
+	if err != nil {
+		return nil, err
+	}
+	var req apiv1.ClaimRequest
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+	sig, err := client.ClaimEarnings(req.Private)
+	if err != nil {
+		return nil, apiv1.Errorf(http.StatusBadGateway, apiv1.CodeUpstream, "Failed to claim earnings: %v", err)
+	}
+	return apiv1.Transaction{TransactionSignature: sig.String()}, nil
+}
+
+func apiPrivateActivity(r *http.Request) (any, error) {
+	client, err := profileClient(r)
+	if err != nil {
+		return nil, err
+	}
+	activity, err := daemon.FetchPrivateActivity(client)
+	if err != nil {
+		return nil, apiv1.Errorf(http.StatusBadGateway, apiv1.CodeUpstream, "Failed to fetch private activity: %v", err)
+	}
+	return activity, nil
+}
+
+func apiStakePreview(r *http.Request) (any, error) {
+	client, err := profileClient(r)
+	if err != nil {
+		return nil, err
+	}
+	query := r.URL.Query()
+	req := apiv1.RegisterWardenRequest{StakeToken: query.Get("stakeToken")}
+	req.StakeAmount, _ = strconv.ParseFloat(query.Get("amount"), 64)
+	if fields := req.Validate(); len(fields) > 0 {
+		field := fields[0].Field
+		if field == "stakeAmount" {
+			field = "amount"
+		}
+		return nil, apiv1.InvalidParam(field, fields[0].Message)
+	}
+	preflight, err := previewWardenStake(client, req.StakeToken, req.StakeAmount)
+	if err != nil {
+		return nil, apiv1.Errorf(http.StatusBadRequest, apiv1.CodeInvalidRequest, "Failed to preview stake: %v", err)
+	}
+	return newStakePreviewView(preflight), nil
+}
+
+func apiQuote(r *http.Request) (any, error) {
+	query := r.URL.Query()
+	wardenAuthority, err := solana.PublicKeyFromBase58(query.Get("warden"))
+	if err != nil {
+		return nil, apiv1.InvalidParam("warden", "must be a base58 public key")
+	}
+	mb, err := strconv.ParseUint(query.Get("mb"), 10, 64)
+	if err != nil || mb == 0 {
+		return nil, apiv1.InvalidParam("mb", "must be a positive integer")
+	}
+	return quoteConnection(wardenAuthority, mb)
+}
+
+func apiCircuit(r *http.Request) (any, error) {
+	sessions := arkhamd.Sessions()
+	if len(sessions) == 0 {
+		return nil, apiv1.NewError(http.StatusNotFound, apiv1.CodeNotFound, daemon.ErrNoSession.Error())
+	}
+	return sessions[0], nil
+}
+
+func apiConnect(r *http.Request) (any, error) {
+	var req apiv1.CircuitRequest
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+	result, err := arkhamd.Connect(daemon.ConnectRequest{Profile: req.Profile, Hops: req.Hops, Mb: req.Mb})
+	if err != nil {
+		return nil, circuitError(err)
+	}
+	return result, nil
+}
+
+func apiDisconnect(r *http.Request) (any, error) {
+	settlements, err := arkhamd.Disconnect()
+	if err != nil {
+		return nil, circuitError(err)
+	}
+	return apiv1.CircuitSettlement{Hops: settlements}, nil
+}
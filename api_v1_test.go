@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"arkham-cli/apiv1"
+	"arkham-cli/internal/solanatest"
+	ap "arkham-cli/solana"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	rt := newAPIv1Router(http.NewServeMux())
+
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(apiv1.OpenAPI, &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Fatalf("expected an OpenAPI 3 document, got %q", spec.OpenAPI)
+	}
+
+	for path, methods := range rt.methods {
+		documented := spec.Paths[path]
+		for _, method := range methods {
+			if _, ok := documented[strings.ToLower(method)]; !ok {
+				t.Errorf("route %s %s is missing from openapi.json", method, path)
+			}
+		}
+	}
+	for path, operations := range spec.Paths {
+		var documented []string
+		for method := range operations {
+			documented = append(documented, strings.ToUpper(method))
+		}
+		routed := append([]string(nil), rt.methods[path]...)
+		sort.Strings(documented)
+		sort.Strings(routed)
+		if strings.Join(documented, ",") != strings.Join(routed, ",") {
+			t.Errorf("openapi.json documents %s as %v but the router serves %v", path, documented, routed)
+		}
+	}
+}
+
+func decodeAPIError(t *testing.T, w *httptest.ResponseRecorder) apiv1.Error {
+	t.Helper()
+	var apiErr apiv1.Error
+	if err := json.NewDecoder(w.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("expected a JSON error envelope: %v", err)
+	}
+	return apiErr
+}
+
+func TestAPIv1Routing(t *testing.T) {
+	mux := http.NewServeMux()
+	newAPIv1Router(mux)
+
+	w := serve(mux, httptest.NewRequest(http.MethodPut, "/api/v1/circuit", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, POST, DELETE" {
+		t.Fatalf("expected 405 with an Allow header, got %d %q", w.Code, w.Header().Get("Allow"))
+	}
+	if apiErr := decodeAPIError(t, w); apiErr.Code != apiv1.CodeMethodNotAllowed {
+		t.Fatalf("expected code %q, got %q", apiv1.CodeMethodNotAllowed, apiErr.Code)
+	}
+
+	w = serve(mux, httptest.NewRequest(http.MethodGet, "/api/v1/nope", nil))
+	if apiErr := decodeAPIError(t, w); w.Code != http.StatusNotFound || apiErr.Code != apiv1.CodeNotFound {
+		t.Fatalf("expected a not_found envelope, got %d %q", w.Code, apiErr.Code)
+	}
+
+	w = serve(mux, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	if w.Code != http.StatusOK || !json.Valid(w.Body.Bytes()) {
+		t.Fatalf("expected the OpenAPI document, got %d", w.Code)
+	}
+
+	w = serve(mux, httptest.NewRequest(http.MethodGet, "/api/v1/profiles/bad%20name/balance", nil))
+	if apiErr := decodeAPIError(t, w); w.Code != http.StatusBadRequest || apiErr.Code != apiv1.CodeValidationFailed {
+		t.Fatalf("expected an invalid profile parameter to fail validation, got %d %q", w.Code, apiErr.Code)
+	}
+}
+
+func TestAPIv1ValidatesRequests(t *testing.T) {
+	server := httptest.NewServer(newAPIv1Router(http.NewServeMux()).mux)
+	defer server.Close()
+	client := apiv1.NewClient(server.URL, "")
+
+	_, err := client.CreateProfile(context.Background(), "")
+	var apiErr *apiv1.Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest || apiErr.Code != apiv1.CodeValidationFailed {
+		t.Fatalf("expected an empty profile name to fail validation, got %v", err)
+	}
+	if fields, ok := apiErr.Details.([]any); !ok || len(fields) != 1 {
+		t.Fatalf("expected one field error, got %#v", apiErr.Details)
+	}
+
+	_, err = client.Connect(context.Background(), apiv1.CircuitRequest{Profile: "seeker", Hops: 9})
+	if !errors.As(err, &apiErr) || apiErr.Code != apiv1.CodeValidationFailed {
+		t.Fatalf("expected too many hops to fail validation, got %v", err)
+	}
+
+	_, err = client.SetNodeConfig(context.Background(), apiv1.NodeConfig{ConnLowWater: 10})
+	if !errors.As(err, &apiErr) || apiErr.Code != apiv1.CodeValidationFailed {
+		t.Fatalf("expected a lone watermark to fail validation, got %v", err)
+	}
+	if fields, ok := apiErr.Details.([]any); !ok || len(fields) != 1 || fields[0].(map[string]any)["field"] != "connHighWater" {
+		t.Fatalf("expected a connHighWater field error, got %#v", apiErr.Details)
+	}
+
+	resp, err := http.Post(server.URL+"/api/v1/profiles", "application/json", strings.NewReader(`{"profile":"a","admin":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected unknown fields to be rejected, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIv1PrivateDepositsAndClaims(t *testing.T) {
+	chain := solanatest.NewServer(t)
+	signer := solana.NewWallet().PrivateKey
+	escrow := solana.NewWallet().PublicKey()
+	seekerPDA, _, _ := ap.GetSeekerPDA(signer.PublicKey())
+	chain.SetProgramAccount(seekerPDA, ap.Account_Seeker, ap.Seeker{Authority: signer.PublicKey(), PrivateEscrow: &escrow})
+
+	defer func(f func(string) (*ap.Client, error)) { clientForProfile = f }(clientForProfile)
+	clientForProfile = func(profile string) (*ap.Client, error) {
+		if profile != "seeker" {
+			return nil, errors.New("unknown profile")
+		}
+		return chain.Client(signer), nil
+	}
+
+	server := httptest.NewServer(newAPIv1Router(http.NewServeMux()).mux)
+	defer server.Close()
+	client := apiv1.NewClient(server.URL, "")
+	ctx := context.Background()
+
+	if _, err := client.DepositEscrow(ctx, "seeker", apiv1.DepositRequest{Amount: 1500, Private: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ClaimEarnings(ctx, "seeker", apiv1.ClaimRequest{Private: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.DepositEscrow(ctx, "seeker", apiv1.DepositRequest{Amount: 700}); err != nil {
+		t.Fatal(err)
+	}
+
+	instructions := chain.ProgramInstructions()
+	if len(instructions) != 3 {
+		t.Fatalf("sent %d instructions, want 3", len(instructions))
+	}
+	for i, want := range []struct {
+		discriminator [8]byte
+		args          []byte
+	}{
+		{ap.Instruction_DepositEscrow, []byte{0xdc, 0x05, 0, 0, 0, 0, 0, 0, 1}},
+		{ap.Instruction_ClaimEarnings, []byte{1}},
+		{ap.Instruction_DepositEscrow, []byte{0xbc, 0x02, 0, 0, 0, 0, 0, 0, 0}},
+	} {
+		ix := instructions[i]
+		if !ix.Is(want.discriminator) || !bytes.Equal(ix.Data[8:], want.args) {
+			t.Errorf("instruction %d = %x, want %x%x", i, ix.Data, want.discriminator, want.args)
+		}
+	}
+	if !instructions[0].Accounts[0].Equals(seekerPDA) {
+		t.Errorf("deposit went to %s, want the seeker account %s", instructions[0].Accounts[0], seekerPDA)
+	}
+
+	activity, err := client.PrivateActivity(ctx, "seeker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if activity.Escrow == nil || *activity.Escrow != escrow.String() {
+		t.Fatalf("private escrow = %v, want %s", activity.Escrow, escrow)
+	}
+
+	var apiErr *apiv1.Error
+	_, err = client.DepositEscrow(ctx, "seeker", apiv1.DepositRequest{Private: true})
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest {
+		t.Fatalf("expected a zero deposit to fail validation, got %v", err)
+	}
+	_, err = client.PrivateActivity(ctx, "nobody")
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound {
+		t.Fatalf("expected an unknown profile to be 404, got %v", err)
+	}
+	if n := len(chain.Transactions()); n != 3 {
+		t.Fatalf("rejected requests sent transactions: %d in total", n)
+	}
+}
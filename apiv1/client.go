@@ -0,0 +1,295 @@
+package apiv1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// TokenHeader carries the GUI session token.
+const TokenHeader = "X-Arkham-Token"
+
+// Client talks to a GUI server's v1 API. Its methods mirror the operations in OpenAPI.
+type Client struct {
+	// BaseURL is the server's address, such as http://127.0.0.1:8088.
+	BaseURL string
+	// Token is the session token printed by `arkham-cli gui`.
+	Token string
+	HTTP  *http.Client
+}
+
+// NewClient creates a client for the server at baseURL.
+func NewClient(baseURL, token string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/"), Token: token, HTTP: http.DefaultClient}
+}
+
+// do sends a request and decodes the JSON response into out. Failed requests return the
+// server's *Error.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	u := c.BaseURL + Prefix + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set(TokenHeader, c.Token)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &Error{Status: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil || apiErr.Code == "" {
+			return Errorf(resp.StatusCode, CodeInternal, "%s %s: %s", method, path, resp.Status)
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s %s response: %w", method, path, err)
+	}
+	return nil
+}
+
+func profilePath(profile, rest string) string {
+	return "/profiles/" + url.PathEscape(profile) + rest
+}
+
+// NodeStatus returns the P2P node status.
+func (c *Client) NodeStatus(ctx context.Context) (NodeStatus, error) {
+	var status NodeStatus
+	err := c.do(ctx, http.MethodGet, "/node", nil, nil, &status)
+	return status, err
+}
+
+// StartNode starts the P2P node.
+func (c *Client) StartNode(ctx context.Context) (NodeStatus, error) {
+	var status NodeStatus
+	err := c.do(ctx, http.MethodPost, "/node/start", nil, nil, &status)
+	return status, err
+}
+
+// StopNode stops the P2P node.
+func (c *Client) StopNode(ctx context.Context) (NodeStatus, error) {
+	var status NodeStatus
+	err := c.do(ctx, http.MethodPost, "/node/stop", nil, nil, &status)
+	return status, err
+}
+
+// NodeConfig returns the node's networking config.
+func (c *Client) NodeConfig(ctx context.Context) (NodeConfig, error) {
+	var cfg NodeConfig
+	err := c.do(ctx, http.MethodGet, "/node/config", nil, nil, &cfg)
+	return cfg, err
+}
+
+// SetNodeConfig saves the node's networking config, which applies the next time the node
+// starts.
+func (c *Client) SetNodeConfig(ctx context.Context, cfg NodeConfig) (NodeConfig, error) {
+	var saved NodeConfig
+	err := c.do(ctx, http.MethodPut, "/node/config", nil, cfg, &saved)
+	return saved, err
+}
+
+// Location returns the egress IP, region and IP hash warden registration would publish.
+func (c *Client) Location(ctx context.Context) (Location, error) {
+	var loc Location
+	err := c.do(ctx, http.MethodGet, "/node/location", nil, nil, &loc)
+	return loc, err
+}
+
+// Peers lists the peers the node knows.
+func (c *Client) Peers(ctx context.Context) ([]PeerInfo, error) {
+	var peers []PeerInfo
+	err := c.do(ctx, http.MethodGet, "/peers", nil, nil, &peers)
+	return peers, err
+}
+
+// Profiles lists the wallet profiles.
+func (c *Client) Profiles(ctx context.Context) ([]Profile, error) {
+	var profiles []Profile
+	err := c.do(ctx, http.MethodGet, "/profiles", nil, nil, &profiles)
+	return profiles, err
+}
+
+// CreateProfile creates a wallet profile.
+func (c *Client) CreateProfile(ctx context.Context, name string) (*Profile, error) {
+	var profile Profile
+	if err := c.do(ctx, http.MethodPost, "/profiles", nil, CreateProfileRequest{Profile: name}, &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// Balance returns a profile's SOL balance in lamports.
+func (c *Client) Balance(ctx context.Context, profile string) (uint64, error) {
+	var balance Balance
+	err := c.do(ctx, http.MethodGet, profilePath(profile, "/balance"), nil, nil, &balance)
+	return balance.Lamports, err
+}
+
+// TokenBalance returns a profile's balance of an SPL token.
+func (c *Client) TokenBalance(ctx context.Context, profile, mint string) (uint64, error) {
+	var balance TokenBalance
+	err := c.do(ctx, http.MethodGet, profilePath(profile, "/token-balance"), url.Values{"mint": {mint}}, nil, &balance)
+	return balance.UiAmount, err
+}
+
+// History returns a profile's transaction history.
+func (c *Client) History(ctx context.Context, profile string) (*History, error) {
+	var history History
+	if err := c.do(ctx, http.MethodGet, profilePath(profile, "/history"), nil, nil, &history); err != nil {
+		return nil, err
+	}
+	return &history, nil
+}
+
+// WardenStatus reports whether a profile is registered as a warden.
+func (c *Client) WardenStatus(ctx context.Context, profile string) (*WardenStatus, error) {
+	var status WardenStatus
+	if err := c.do(ctx, http.MethodGet, profilePath(profile, "/warden"), nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// RegisterWarden registers a profile as a warden and returns the transaction signature.
+func (c *Client) RegisterWarden(ctx context.Context, profile string, req RegisterWardenRequest) (string, error) {
+	var tx Transaction
+	err := c.do(ctx, http.MethodPost, profilePath(profile, "/warden"), nil, req, &tx)
+	return tx.TransactionSignature, err
+}
+
+// SeekerStatus reports whether a profile is registered as a seeker.
+func (c *Client) SeekerStatus(ctx context.Context, profile string) (*SeekerStatus, error) {
+	var status SeekerStatus
+	if err := c.do(ctx, http.MethodGet, profilePath(profile, "/seeker"), nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Budget returns a profile's escrow budget.
+func (c *Client) Budget(ctx context.Context, profile string) (*Budget, error) {
+	var b Budget
+	if err := c.do(ctx, http.MethodGet, profilePath(profile, "/budget"), nil, nil, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// SetBudget replaces a profile's escrow budget policy.
+func (c *Client) SetBudget(ctx context.Context, profile string, p BudgetPolicy) (*Budget, error) {
+	var b Budget
+	if err := c.do(ctx, http.MethodPut, profilePath(profile, "/budget"), nil, p, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// DepositEscrow deposits into a profile's seeker escrow.
+func (c *Client) DepositEscrow(ctx context.Context, profile string, req DepositRequest) (string, error) {
+	var tx Transaction
+	err := c.do(ctx, http.MethodPost, profilePath(profile, "/escrow"), nil, req, &tx)
+	return tx.TransactionSignature, err
+}
+
+// PrivateActivity returns a profile's private escrow and its private deposit and claim
+// totals.
+func (c *Client) PrivateActivity(ctx context.Context, profile string) (*PrivateActivity, error) {
+	var activity PrivateActivity
+	if err := c.do(ctx, http.MethodGet, profilePath(profile, "/private"), nil, nil, &activity); err != nil {
+		return nil, err
+	}
+	return &activity, nil
+}
+
+// ClaimEarnings claims a profile's pending warden earnings.
+func (c *Client) ClaimEarnings(ctx context.Context, profile string, req ClaimRequest) (string, error) {
+	var tx Transaction
+	err := c.do(ctx, http.MethodPost, profilePath(profile, "/claim"), nil, req, &tx)
+	return tx.TransactionSignature, err
+}
+
+// StakePreview checks a warden stake before registering.
+func (c *Client) StakePreview(ctx context.Context, profile, stakeToken string, amount float64) (*StakePreview, error) {
+	query := url.Values{
+		"stakeToken": {stakeToken},
+		"amount":     {strconv.FormatFloat(amount, 'f', -1, 64)},
+	}
+	var preview StakePreview
+	if err := c.do(ctx, http.MethodGet, profilePath(profile, "/stake-preview"), query, nil, &preview); err != nil {
+		return nil, err
+	}
+	return &preview, nil
+}
+
+// Wardens lists the registered wardens with their prices.
+func (c *Client) Wardens(ctx context.Context) ([]WardenListing, error) {
+	var wardens []WardenListing
+	err := c.do(ctx, http.MethodGet, "/wardens", nil, nil, &wardens)
+	return wardens, err
+}
+
+// Quote quotes mb MB through the warden with the given authority.
+func (c *Client) Quote(ctx context.Context, warden string, mb uint64) (*Quote, error) {
+	query := url.Values{"warden": {warden}, "mb": {strconv.FormatUint(mb, 10)}}
+	var quote Quote
+	if err := c.do(ctx, http.MethodGet, "/quote", query, nil, &quote); err != nil {
+		return nil, err
+	}
+	return &quote, nil
+}
+
+// Circuit returns the active circuit.
+func (c *Client) Circuit(ctx context.Context) (*Session, error) {
+	var session Session
+	if err := c.do(ctx, http.MethodGet, "/circuit", nil, nil, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Connect builds a circuit.
+func (c *Client) Connect(ctx context.Context, req CircuitRequest) (*Circuit, error) {
+	var circuit Circuit
+	if err := c.do(ctx, http.MethodPost, "/circuit", nil, req, &circuit); err != nil {
+		return nil, err
+	}
+	return &circuit, nil
+}
+
+// Disconnect tears down the active circuit.
+func (c *Client) Disconnect(ctx context.Context) (*CircuitSettlement, error) {
+	var settlement CircuitSettlement
+	if err := c.do(ctx, http.MethodDelete, "/circuit", nil, nil, &settlement); err != nil {
+		return nil, err
+	}
+	return &settlement, nil
+}
@@ -0,0 +1,100 @@
+package apiv1
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// Error codes used in the error envelope.
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeUpstream         = "upstream_error"
+	CodeInternal         = "internal_error"
+)
+
+// Error is the envelope every failed v1 request returns.
+type Error struct {
+	// Status is the HTTP status the error is served with.
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// FieldError describes one invalid field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// NewError creates an error envelope.
+func NewError(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Errorf creates an error envelope with a formatted message.
+func Errorf(status int, code, format string, args ...any) *Error {
+	return NewError(status, code, fmt.Sprintf(format, args...))
+}
+
+// InvalidParam reports a missing or malformed query or path parameter.
+func InvalidParam(name, message string) *Error {
+	return &Error{
+		Status:  http.StatusBadRequest,
+		Code:    CodeValidationFailed,
+		Message: fmt.Sprintf("Invalid '%s' parameter", name),
+		Details: []FieldError{{Field: name, Message: message}},
+	}
+}
+
+// AsError converts any error into an envelope. Errors that are not envelopes become
+// internal errors.
+func AsError(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return NewError(http.StatusInternalServerError, CodeInternal, err.Error())
+}
+
+// Validator is implemented by request bodies that check their own fields.
+type Validator interface {
+	Validate() []FieldError
+}
+
+// Validate runs v.Validate and wraps any field errors in a validation envelope.
+func Validate(v Validator) error {
+	if fields := v.Validate(); len(fields) > 0 {
+		return &Error{
+			Status:  http.StatusBadRequest,
+			Code:    CodeValidationFailed,
+			Message: "Request validation failed",
+			Details: fields,
+		}
+	}
+	return nil
+}
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// ValidateProfileName checks a wallet profile name: 1-32 letters, digits, '-' or '_'.
+func ValidateProfileName(field, name string) []FieldError {
+	switch {
+	case name == "":
+		return []FieldError{{Field: field, Message: "is required"}}
+	case !profileNamePattern.MatchString(name):
+		return []FieldError{{Field: field, Message: "must be 1-32 letters, digits, '-' or '_'"}}
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+package apiv1
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI 3 document describing the v1 API.
+//
+//go:embed openapi.json
+var OpenAPI []byte
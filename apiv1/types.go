@@ -0,0 +1,338 @@
+// Package apiv1 defines the GUI server's versioned REST API: the request and response
+// types, the error envelope, the OpenAPI document served at /api/v1/openapi.json and a Go
+// client for other tools.
+package apiv1
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"arkham-cli/budget"
+	"arkham-cli/daemon"
+	"arkham-cli/geo"
+	"arkham-cli/node"
+	"arkham-cli/pricing"
+	ap "arkham-cli/solana"
+)
+
+// Prefix is the path every v1 route lives under.
+const Prefix = "/api/v1"
+
+type (
+	NodeStatus    = node.NodeStatus
+	PeerInfo      = node.PeerInfo
+	Capabilities  = node.Capabilities
+	History       = ap.HistoryResult
+	Circuit       = daemon.ConnectResult
+	HopSettlement = daemon.HopSettlement
+	Session       = daemon.SessionInfo
+	// PrivateActivity is a profile's private escrow and private deposit and claim totals.
+	PrivateActivity = daemon.PrivateActivity
+)
+
+// CreateProfileRequest creates a new wallet profile.
+type CreateProfileRequest struct {
+	Profile string `json:"profile"`
+}
+
+// Validate implements Validator.
+func (r CreateProfileRequest) Validate() []FieldError {
+	return ValidateProfileName("profile", r.Profile)
+}
+
+// Profile is a wallet profile and its address.
+type Profile struct {
+	Profile   string `json:"profile"`
+	PublicKey string `json:"publicKey"`
+}
+
+// Balance is a SOL balance.
+type Balance struct {
+	Lamports uint64 `json:"lamports"`
+}
+
+// TokenBalance is an SPL token balance.
+type TokenBalance struct {
+	UiAmount uint64 `json:"uiAmount"`
+}
+
+// Warden is a registered warden account.
+type Warden struct {
+	Authority             string  `json:"authority"`
+	PeerId                string  `json:"peerId"`
+	StakeToken            string  `json:"stakeToken"`
+	StakeAmount           uint64  `json:"stakeAmount"`
+	StakeValueUsd         uint64  `json:"stakeValueUsd"`
+	Tier                  string  `json:"tier"`
+	StakedAt              int64   `json:"stakedAt"`
+	UnstakeRequestedAt    *int64  `json:"unstakeRequestedAt,omitempty"`
+	TotalBandwidthServed  uint64  `json:"totalBandwidthServed"`
+	TotalEarnings         uint64  `json:"totalEarnings"`
+	PendingClaims         uint64  `json:"pendingClaims"`
+	ArkhamTokensEarned    uint64  `json:"arkhamTokensEarned"`
+	ReputationScore       uint32  `json:"reputationScore"`
+	SuccessfulConnections uint64  `json:"successfulConnections"`
+	FailedConnections     uint64  `json:"failedConnections"`
+	UptimePercentage      uint16  `json:"uptimePercentage"`
+	LastActive            int64   `json:"lastActive"`
+	RegionCode            uint8   `json:"regionCode"`
+	PremiumPoolRank       *uint16 `json:"premiumPoolRank,omitempty"`
+	ActiveConnections     uint8   `json:"activeConnections"`
+}
+
+// NewWarden converts an on-chain warden account.
+func NewWarden(w *ap.Warden) *Warden {
+	return &Warden{
+		Authority:             w.Authority.String(),
+		PeerId:                w.PeerId,
+		StakeToken:            strings.ToLower(w.StakeToken.String()),
+		StakeAmount:           w.StakeAmount,
+		StakeValueUsd:         w.StakeValueUsd,
+		Tier:                  strings.ToLower(w.Tier.String()),
+		StakedAt:              w.StakedAt,
+		UnstakeRequestedAt:    w.UnstakeRequestedAt,
+		TotalBandwidthServed:  w.TotalBandwidthServed,
+		TotalEarnings:         w.TotalEarnings,
+		PendingClaims:         w.PendingClaims,
+		ArkhamTokensEarned:    w.ArkhamTokensEarned,
+		ReputationScore:       w.ReputationScore,
+		SuccessfulConnections: w.SuccessfulConnections,
+		FailedConnections:     w.FailedConnections,
+		UptimePercentage:      w.UptimePercentage,
+		LastActive:            w.LastActive,
+		RegionCode:            w.RegionCode,
+		PremiumPoolRank:       w.PremiumPoolRank,
+		ActiveConnections:     w.ActiveConnections,
+	}
+}
+
+// WardenStatus reports whether a profile is registered as a warden.
+type WardenStatus struct {
+	IsRegistered bool    `json:"isRegistered"`
+	Warden       *Warden `json:"warden"`
+}
+
+// Seeker is a registered seeker account.
+type Seeker struct {
+	Authority              string  `json:"authority"`
+	EscrowBalance          uint64  `json:"escrowBalance"`
+	PrivateEscrow          *string `json:"privateEscrow,omitempty"`
+	TotalBandwidthConsumed uint64  `json:"totalBandwidthConsumed"`
+	TotalSpent             uint64  `json:"totalSpent"`
+	ActiveConnections      uint8   `json:"activeConnections"`
+	PremiumExpiresAt       *int64  `json:"premiumExpiresAt,omitempty"`
+}
+
+// NewSeeker converts an on-chain seeker account.
+func NewSeeker(s *ap.Seeker) *Seeker {
+	seeker := &Seeker{
+		Authority:              s.Authority.String(),
+		EscrowBalance:          s.EscrowBalance,
+		TotalBandwidthConsumed: s.TotalBandwidthConsumed,
+		TotalSpent:             s.TotalSpent,
+		ActiveConnections:      s.ActiveConnections,
+		PremiumExpiresAt:       s.PremiumExpiresAt,
+	}
+	if s.PrivateEscrow != nil {
+		escrow := s.PrivateEscrow.String()
+		seeker.PrivateEscrow = &escrow
+	}
+	return seeker
+}
+
+// SeekerStatus reports whether a profile is registered as a seeker.
+type SeekerStatus struct {
+	IsRegistered bool    `json:"isRegistered"`
+	Seeker       *Seeker `json:"seeker"`
+	// Budget is the profile's escrow budget, if it could be computed.
+	Budget *Budget `json:"budget,omitempty"`
+}
+
+// Budget is a seeker's escrow budget and its standing this month.
+type Budget = daemon.BudgetStatus
+
+// BudgetPolicy is a seeker's escrow budget policy. Amounts are in lamports; zero disables
+// a rule.
+type BudgetPolicy budget.Policy
+
+// Validate implements Validator.
+func (p BudgetPolicy) Validate() []FieldError {
+	if err := budget.Policy(p).Validate(); err != nil {
+		return []FieldError{{Field: "escrowFloor", Message: err.Error()}}
+	}
+	return nil
+}
+
+// Warden availability, as learned by asking the warden's node for its capabilities.
+const (
+	WardenOnline     = "online"
+	WardenOffline    = "offline"
+	WardenAtCapacity = "at-capacity"
+	// WardenUnknown is reported while the local node is not running to ask.
+	WardenUnknown = "unknown"
+)
+
+// WardenListing is a warden as shown in the warden list.
+type WardenListing struct {
+	PeerId        string  `json:"peerId"`
+	Authority     string  `json:"authority"`
+	Nickname      string  `json:"nickname"`
+	Location      string  `json:"location"`
+	Reputation    float64 `json:"reputation"` // 0-5
+	PricePerGbUsd float64 `json:"pricePerGbUsd"`
+	// Status is WardenOnline, WardenOffline, WardenAtCapacity or WardenUnknown.
+	Status string `json:"status"`
+	// Capabilities is the document the warden's node advertised, if it answered.
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+}
+
+// WardenStatusOf returns a warden's availability from its capability document, or from
+// the error asking for it.
+func WardenStatusOf(caps *Capabilities, err error) string {
+	switch {
+	case err != nil:
+		return WardenOffline
+	case caps.AtCapacity():
+		return WardenAtCapacity
+	}
+	return WardenOnline
+}
+
+// Quote is a connection quote with the USD equivalent of its cost.
+type Quote struct {
+	*pricing.Quote
+	CostUsd float64 `json:"costUsd"`
+}
+
+// StakePreview is the balance check and valuation shown before registering as a warden.
+type StakePreview struct {
+	StakeToken    string `json:"stakeToken"`
+	Mint          string `json:"mint,omitempty"`
+	Account       string `json:"account"`
+	AccountExists bool   `json:"accountExists"`
+	Decimals      uint8  `json:"decimals"`
+	Balance       string `json:"balance"`
+	Amount        string `json:"amount"`
+	Sufficient    bool   `json:"sufficient"`
+	StakeValueUsd uint64 `json:"stakeValueUsd"` // micro-USD
+	Tier          string `json:"tier,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// RegisterWardenRequest registers a profile as a warden.
+type RegisterWardenRequest struct {
+	StakeToken  string  `json:"stakeToken"`
+	StakeAmount float64 `json:"stakeAmount"`
+	// CreateTokenAccount creates a missing stake token account before registering.
+	CreateTokenAccount bool `json:"createTokenAccount"`
+}
+
+// Validate implements Validator.
+func (r RegisterWardenRequest) Validate() []FieldError {
+	var fields []FieldError
+	if _, err := ap.ParseStakeToken(r.StakeToken); err != nil {
+		fields = append(fields, FieldError{Field: "stakeToken", Message: err.Error()})
+	}
+	if r.StakeAmount <= 0 {
+		fields = append(fields, FieldError{Field: "stakeAmount", Message: "must be greater than zero"})
+	}
+	return fields
+}
+
+// DepositRequest deposits into a seeker's escrow.
+type DepositRequest struct {
+	// Amount is in lamports.
+	Amount uint64 `json:"amount"`
+	// Private deposits into the private escrow.
+	Private bool `json:"private"`
+}
+
+// Validate implements Validator.
+func (r DepositRequest) Validate() []FieldError {
+	if r.Amount == 0 {
+		return []FieldError{{Field: "amount", Message: "must be greater than zero"}}
+	}
+	return nil
+}
+
+// ClaimRequest claims a warden's pending SOL earnings.
+type ClaimRequest struct {
+	// Private claims the earnings privately.
+	Private bool `json:"private"`
+}
+
+// Validate implements Validator.
+func (r ClaimRequest) Validate() []FieldError {
+	return nil
+}
+
+// Transaction is the signature of a submitted transaction.
+type Transaction struct {
+	TransactionSignature string `json:"transactionSignature"`
+}
+
+// MaxHops is the longest circuit the API builds.
+const MaxHops = daemon.MaxHops
+
+// CircuitRequest builds a seeker circuit.
+type CircuitRequest struct {
+	Profile string `json:"profile"`
+	Hops    int    `json:"hops"`
+	// Mb is the estimated MB per hop. Zero splits the escrow balance evenly across hops.
+	Mb uint64 `json:"mb"`
+}
+
+// Validate implements Validator.
+func (r CircuitRequest) Validate() []FieldError {
+	fields := ValidateProfileName("profile", r.Profile)
+	if r.Hops < 1 || r.Hops > MaxHops {
+		fields = append(fields, FieldError{Field: "hops", Message: fmt.Sprintf("must be between 1 and %d", MaxHops)})
+	}
+	return fields
+}
+
+// NodeConfig is the node's networking config. Changes apply the next time the node
+// starts.
+type NodeConfig node.Config
+
+// Validate implements Validator.
+func (c NodeConfig) Validate() []FieldError {
+	err := node.Config(c).Validate()
+	if err == nil {
+		return nil
+	}
+	var cfgErr *node.ConfigError
+	if errors.As(err, &cfgErr) {
+		return []FieldError{{Field: cfgErr.Field, Message: cfgErr.Err.Error()}}
+	}
+	return []FieldError{{Field: "config", Message: err.Error()}}
+}
+
+// Location is the egress IP, region and IP hash a warden registers, shown for confirmation
+// before registering.
+type Location struct {
+	PublicIp      string `json:"publicIp"`
+	RegionCode    uint8  `json:"regionCode"`
+	Region        string `json:"region"`
+	GeoPremiumBps uint16 `json:"geoPremiumBps"`
+	IpHash        string `json:"ipHash"` // hex
+}
+
+// NewLocation converts a resolved location, pricing its region with the protocol's geo
+// premiums.
+func NewLocation(loc geo.Location, config *ap.ProtocolConfig) Location {
+	return Location{
+		PublicIp:      loc.IP.String(),
+		RegionCode:    loc.RegionCode,
+		Region:        loc.Region(),
+		GeoPremiumBps: pricing.GeoPremiumBps(config, loc.RegionCode),
+		IpHash:        hex.EncodeToString(loc.IPHash[:]),
+	}
+}
+
+// CircuitSettlement is the result of tearing down a circuit.
+type CircuitSettlement struct {
+	Hops []HopSettlement `json:"hops"`
+}
@@ -0,0 +1,183 @@
+// Package budget implements the seeker's escrow budget: how much may be spent on
+// connections each calendar month, the escrow balance to keep topped up, and the wallet
+// balance that deposits never touch. A profile's budget is a JSON file that also records
+// where the current month's spending started.
+package budget
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DepositFee is set aside in the wallet for the fee of a deposit transaction.
+const DepositFee = 5000
+
+var (
+	ErrOverBudget = errors.New("connection would exceed the monthly budget")
+	ErrReserve    = errors.New("deposit would take the wallet below its reserve")
+)
+
+// Policy is a seeker's budget policy. All amounts are in lamports; zero disables a rule.
+type Policy struct {
+	// MonthlyCap limits what connections may cost in a calendar month (UTC), counting
+	// what was paid and what open connections still hold in escrow.
+	MonthlyCap uint64 `json:"monthlyCap"`
+	// EscrowFloor is the escrow balance below which the escrow is topped up.
+	EscrowFloor uint64 `json:"escrowFloor"`
+	// TopUp is how much each automatic deposit adds. Zero deposits just what is missing.
+	TopUp uint64 `json:"topUp"`
+	// WalletReserve is the wallet balance that deposits never go below.
+	WalletReserve uint64 `json:"walletReserve"`
+}
+
+// Budget is a profile's policy and the state of its current month.
+type Budget struct {
+	Policy
+	// Month is the month being counted, as "2006-01", and MonthStartSpent the seeker's
+	// on-chain TotalSpent when it began.
+	Month           string `json:"month,omitempty"`
+	MonthStartSpent uint64 `json:"monthStartSpent,omitempty"`
+}
+
+// Usage is a budget's standing in the current month.
+type Usage struct {
+	Month string `json:"month"`
+	// Spent is what connections paid this month, and Committed what open connections
+	// still hold in escrow.
+	Spent     uint64 `json:"spent"`
+	Committed uint64 `json:"committed"`
+	// Remaining is what the monthly cap leaves. It is omitted without a cap.
+	Remaining *uint64 `json:"remaining,omitempty"`
+}
+
+// Path is the budget file of a profile.
+func Path(dir, profile string) string {
+	return filepath.Join(dir, profile+".json")
+}
+
+// Load reads a profile's budget. A missing file is a budget with every rule disabled.
+func Load(dir, profile string) (*Budget, error) {
+	data, err := os.ReadFile(Path(dir, profile))
+	if errors.Is(err, os.ErrNotExist) {
+		return &Budget{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read budget: %w", err)
+	}
+	var b Budget
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("failed to parse budget %s: %w", Path(dir, profile), err)
+	}
+	return &b, nil
+}
+
+// Save writes the budget to a temporary file and renames it into place.
+func (b *Budget) Save(dir, profile string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to save budget: %w", err)
+	}
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".budget-*")
+	if err != nil {
+		return fmt.Errorf("failed to save budget: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save budget: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save budget: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), Path(dir, profile)); err != nil {
+		return fmt.Errorf("failed to save budget: %w", err)
+	}
+	return nil
+}
+
+// Enabled reports whether any rule of the policy is set.
+func (p Policy) Enabled() bool {
+	return p != Policy{}
+}
+
+// Validate checks that the policy's rules fit together.
+func (p Policy) Validate() error {
+	if p.MonthlyCap > 0 && p.EscrowFloor > p.MonthlyCap {
+		return fmt.Errorf("escrow floor exceeds the monthly cap")
+	}
+	return nil
+}
+
+// Roll starts a new month when now is past the one being counted. totalSpent is the
+// seeker's on-chain TotalSpent. It reports whether the budget changed and should be saved.
+func (b *Budget) Roll(now time.Time, totalSpent uint64) bool {
+	month := now.UTC().Format("2006-01")
+	if b.Month == month && totalSpent >= b.MonthStartSpent {
+		return false
+	}
+	b.Month = month
+	b.MonthStartSpent = totalSpent
+	return true
+}
+
+// Usage reports the month's spending from the seeker's TotalSpent and the escrow its open
+// connections still hold. Call Roll first.
+func (b *Budget) Usage(totalSpent, committed uint64) Usage {
+	u := Usage{
+		Month:     b.Month,
+		Spent:     totalSpent - min(b.MonthStartSpent, totalSpent),
+		Committed: committed,
+	}
+	if b.MonthlyCap > 0 {
+		remaining := b.MonthlyCap - min(u.Spent+u.Committed, b.MonthlyCap)
+		u.Remaining = &remaining
+	}
+	return u
+}
+
+// Allow checks that a connection projected to cost cost lamports fits in the month.
+func (b *Budget) Allow(u Usage, cost uint64) error {
+	if u.Remaining != nil && cost > *u.Remaining {
+		return fmt.Errorf("%w: it may cost %d lamports but %d of %d remain for %s", ErrOverBudget, cost, *u.Remaining, b.MonthlyCap, u.Month)
+	}
+	return nil
+}
+
+// Deposit decides how much to deposit into an escrow holding escrow lamports, from a
+// wallet holding wallet lamports, so that it covers need more lamports and stays above
+// the floor. It returns zero when no deposit is due, and ErrReserve when the deposit
+// would take the wallet below its reserve.
+func (p Policy) Deposit(escrow, wallet, need uint64) (uint64, error) {
+	shortfall := need - min(escrow, need)
+	low := p.EscrowFloor > 0 && escrow < p.EscrowFloor
+	if shortfall == 0 && !low {
+		return 0, nil
+	}
+	amount := shortfall
+	if low {
+		if p.TopUp > 0 {
+			amount = max(amount, p.TopUp)
+		} else {
+			amount = max(amount, p.EscrowFloor-escrow)
+		}
+	}
+	if fits(wallet, p.WalletReserve, amount) {
+		return amount, nil
+	}
+	// A top-up the wallet cannot afford may still leave room for what is needed now.
+	if shortfall > 0 && shortfall < amount && fits(wallet, p.WalletReserve, shortfall) {
+		return shortfall, nil
+	}
+	return 0, fmt.Errorf("%w: depositing %d lamports from %d leaves less than %d", ErrReserve, amount, wallet, p.WalletReserve)
+}
+
+func fits(wallet, reserve, amount uint64) bool {
+	return wallet >= reserve && wallet-reserve >= amount+DepositFee
+}
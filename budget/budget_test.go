@@ -0,0 +1,84 @@
+package budget
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBudgetCountsTheMonth(t *testing.T) {
+	b := &Budget{Policy: Policy{MonthlyCap: 1000}}
+	october := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	if !b.Roll(october, 5000) || b.Month != "2026-10" {
+		t.Fatalf("first roll = %+v", b)
+	}
+	if b.Roll(october.Add(time.Hour), 5600) {
+		t.Fatal("rolled within the month")
+	}
+
+	u := b.Usage(5600, 300)
+	if u.Spent != 600 || u.Committed != 300 || u.Remaining == nil || *u.Remaining != 100 {
+		t.Fatalf("usage = %+v", u)
+	}
+	if err := b.Allow(u, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Allow(u, 101); !errors.Is(err, ErrOverBudget) {
+		t.Fatalf("over-budget connection allowed: %v", err)
+	}
+
+	// A new month starts from what was spent by then.
+	if !b.Roll(october.AddDate(0, 1, 0), 5600) {
+		t.Fatal("did not roll into November")
+	}
+	if u := b.Usage(5600, 0); u.Spent != 0 || *u.Remaining != 1000 {
+		t.Fatalf("November usage = %+v", u)
+	}
+}
+
+func TestBudgetWithoutCapAllowsAnything(t *testing.T) {
+	b := &Budget{}
+	b.Roll(time.Now(), 0)
+	u := b.Usage(1<<40, 1<<40)
+	if u.Remaining != nil || b.Allow(u, 1<<50) != nil {
+		t.Fatalf("uncapped usage = %+v", u)
+	}
+}
+
+func TestDeposit(t *testing.T) {
+	p := Policy{EscrowFloor: 1000, TopUp: 5000, WalletReserve: 10_000}
+	for _, tc := range []struct {
+		name                 string
+		escrow, wallet, need uint64
+		want                 uint64
+		err                  error
+	}{
+		{"above floor", 2000, 100_000, 0, 0, nil},
+		{"covered", 2000, 100_000, 1500, 0, nil},
+		{"below floor", 500, 100_000, 0, 5000, nil},
+		{"need exceeds top-up", 500, 100_000, 8000, 7500, nil},
+		{"need above floor", 2000, 100_000, 2500, 500, nil},
+		{"reserve limits top-up to need", 500, 10_000 + DepositFee + 600, 1000, 500, nil},
+		{"reserve", 500, 10_000 + DepositFee + 100, 0, 0, ErrReserve},
+	} {
+		got, err := p.Deposit(tc.escrow, tc.wallet, tc.need)
+		if got != tc.want || !errors.Is(err, tc.err) {
+			t.Errorf("%s: Deposit = %d, %v; want %d, %v", tc.name, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestLoadSave(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Load(dir, "seeker")
+	if err != nil || b.Enabled() {
+		t.Fatalf("missing budget = %+v, %v", b, err)
+	}
+	b.MonthlyCap = 42
+	if err := b.Save(dir, "seeker"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = Load(dir, "seeker"); err != nil || b.MonthlyCap != 42 {
+		t.Fatalf("loaded %+v, %v", b, err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"arkham-cli/apiv1"
+	"arkham-cli/budget"
+	"arkham-cli/daemon"
+)
+
+type ConnectResponse struct {
+	Status       string   `json:"status"`
+	Message      string   `json:"message"`
+	WardenPeerID string   `json:"warden_peer_id"`
+	Path         []string `json:"path"`
+	Wardens      []string `json:"wardens"`
+}
+
+// circuitError maps daemon circuit errors to API errors.
+func circuitError(err error) *apiv1.Error {
+	switch {
+	case errors.Is(err, daemon.ErrNodeNotRunning),
+		errors.Is(err, daemon.ErrSessionActive),
+		errors.Is(err, daemon.ErrSessionElsewhere),
+		errors.Is(err, daemon.ErrNoSession),
+		errors.Is(err, daemon.ErrNotEnoughWardens),
+		errors.Is(err, budget.ErrOverBudget),
+		errors.Is(err, budget.ErrReserve):
+		return apiv1.NewError(http.StatusConflict, apiv1.CodeConflict, err.Error())
+	case errors.Is(err, daemon.ErrTooManyHops):
+		return apiv1.NewError(http.StatusBadRequest, apiv1.CodeInvalidRequest, err.Error())
+	case errors.Is(err, daemon.ErrUnknownProfile):
+		return apiv1.NewError(http.StatusNotFound, apiv1.CodeNotFound, err.Error())
+	default:
+		return apiv1.NewError(http.StatusInternalServerError, apiv1.CodeInternal, err.Error())
+	}
+}
+
+func handleConnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req daemon.ConnectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := arkhamd.Connect(req)
+	if err != nil {
+		httpError(w, circuitError(err))
+		return
+	}
+
+	resp := ConnectResponse{
+		Status:       "success",
+		Message:      fmt.Sprintf("Circuit built through %d wardens.", len(result.Path)),
+		WardenPeerID: result.Path[len(result.Path)-1],
+		Path:         result.Path,
+		Wardens:      result.Wardens,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func handleDisconnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	settlements, err := arkhamd.Disconnect()
+	if err != nil {
+		httpError(w, circuitError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"message": "Circuit torn down.",
+		"hops":    settlements,
+	})
+}
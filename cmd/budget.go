@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+
+	"arkham-cli/budget"
+	"arkham-cli/daemon"
+	arkham_protocol "arkham-cli/solana"
+	"arkham-cli/storage"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	budgetProfile     string
+	budgetMonthlyCap  string
+	budgetEscrowFloor string
+	budgetTopUp       string
+	budgetReserve     string
+)
+
+var seekerBudgetCmd = &cobra.Command{
+	Use:   "budget",
+	Short: "Show or set the seeker's escrow budget.",
+	Long: `Shows the budget of a seeker profile and how much of it this month used. With any of
+--monthly-cap, --escrow-floor, --top-up or --reserve, those rules are changed first; the
+others keep their value. Amounts are in SOL, and 0 disables a rule.
+
+Sessions refuse connections that would take the month's spending, counting what open
+connections still hold in escrow, above --monthly-cap. When the escrow falls below
+--escrow-floor the daemon deposits --top-up, and no deposit takes the wallet below
+--reserve.`,
+	RunE: runSeekerBudget,
+}
+
+func init() {
+	seekerBudgetCmd.Flags().StringVar(&budgetProfile, "profile", "seeker", "wallet profile whose budget to show or set")
+	seekerBudgetCmd.Flags().StringVar(&budgetMonthlyCap, "monthly-cap", "", "most SOL connections may cost in a calendar month")
+	seekerBudgetCmd.Flags().StringVar(&budgetEscrowFloor, "escrow-floor", "", "escrow balance in SOL below which to top up")
+	seekerBudgetCmd.Flags().StringVar(&budgetTopUp, "top-up", "", "SOL each automatic deposit adds (0: what the floor is missing)")
+	seekerBudgetCmd.Flags().StringVar(&budgetReserve, "reserve", "", "wallet balance in SOL that deposits never touch")
+
+	seekerCmd.AddCommand(seekerBudgetCmd)
+}
+
+func runSeekerBudget(cmd *cobra.Command, args []string) error {
+	db, err := storage.NewWalletStorage()
+	if err != nil {
+		return fmt.Errorf("failed to open wallet storage: %w", err)
+	}
+	signer, err := db.GetWallet(budgetProfile)
+	if err != nil {
+		return fmt.Errorf("failed to load profile '%s': %w", budgetProfile, err)
+	}
+	client, err := arkham_protocol.NewClient(GetRpcEndpoint(), signer)
+	if err != nil {
+		return fmt.Errorf("failed to create Solana client: %w", err)
+	}
+	orchestrator := &daemon.Orchestrator{Client: client, Profile: budgetProfile}
+
+	status, err := orchestrator.Budget()
+	if err != nil {
+		return err
+	}
+	policy := status.Policy
+	changed := false
+	for _, f := range []struct {
+		name  string
+		value string
+		field *uint64
+	}{
+		{"monthly-cap", budgetMonthlyCap, &policy.MonthlyCap},
+		{"escrow-floor", budgetEscrowFloor, &policy.EscrowFloor},
+		{"top-up", budgetTopUp, &policy.TopUp},
+		{"reserve", budgetReserve, &policy.WalletReserve},
+	} {
+		if !cmd.Flags().Changed(f.name) {
+			continue
+		}
+		lamports, err := arkham_protocol.ParseTokenAmount(f.value, arkham_protocol.SolDecimals)
+		if err != nil {
+			return fmt.Errorf("invalid --%s: %w", f.name, err)
+		}
+		*f.field = lamports
+		changed = true
+	}
+	if changed {
+		if err := orchestrator.SetBudget(policy); err != nil {
+			return err
+		}
+		if status, err = orchestrator.Budget(); err != nil {
+			return err
+		}
+		fmt.Println(titleStyle.Render("\n✅ Budget updated"))
+	}
+
+	fmt.Println(titleStyle.Render(fmt.Sprintf("\n📊 Budget of %s", budgetProfile)))
+	printBudget(status)
+	return nil
+}
+
+func printBudget(status *daemon.BudgetStatus) {
+	if !status.Policy.Enabled() {
+		fmt.Println(infoStyle.Render("  No budget is set; see \"arkham-cli seeker budget --help\"."))
+	}
+	fmt.Printf("  %s %s\n", promptStyle.Render("Monthly Cap:"), formatRule(status.Policy.MonthlyCap))
+	fmt.Printf("  %s %s\n", promptStyle.Render("Escrow Floor:"), formatRule(status.Policy.EscrowFloor))
+	fmt.Printf("  %s %s\n", promptStyle.Render("Top-up:"), formatTopUp(status.Policy))
+	fmt.Printf("  %s %s\n", promptStyle.Render("Wallet Reserve:"), formatRule(status.Policy.WalletReserve))
+	fmt.Printf("  %s %s\n", promptStyle.Render(fmt.Sprintf("Spent in %s:", status.Usage.Month)), formatSol(status.Usage.Spent))
+	fmt.Printf("  %s %s\n", promptStyle.Render("Held by Open Connections:"), formatSol(status.Usage.Committed))
+	if status.Usage.Remaining != nil {
+		fmt.Printf("  %s %s\n", promptStyle.Render("Remaining:"), formatSol(*status.Usage.Remaining))
+	}
+	fmt.Printf("  %s %s\n", promptStyle.Render("Escrow:"), formatSol(status.Escrow))
+	fmt.Printf("  %s %s\n", promptStyle.Render("Wallet:"), formatSol(status.Wallet))
+}
+
+func formatRule(lamports uint64) string {
+	if lamports == 0 {
+		return "off"
+	}
+	return formatSol(lamports)
+}
+
+func formatTopUp(p budget.Policy) string {
+	if p.EscrowFloor == 0 {
+		return "off"
+	}
+	if p.TopUp == 0 {
+		return "up to the floor"
+	}
+	return formatSol(p.TopUp)
+}
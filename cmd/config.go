@@ -3,7 +3,11 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
+	"strings"
+
+	"arkham-cli/logging"
 
 	"github.com/joho/godotenv"
 )
@@ -28,3 +32,102 @@ func GetRpcEndpoint() string {
 	}
 	return rpcEndpoint
 }
+
+// GetWsEndpoint returns the websocket endpoint that pairs with GetRpcEndpoint.
+func GetWsEndpoint() string {
+	endpoint := GetRpcEndpoint()
+	switch {
+	case strings.HasPrefix(endpoint, "https://"):
+		return "wss://" + strings.TrimPrefix(endpoint, "https://")
+	case strings.HasPrefix(endpoint, "http://"):
+		return "ws://" + strings.TrimPrefix(endpoint, "http://")
+	default:
+		return endpoint
+	}
+}
+
+// GetCoinGeckoURL returns the CoinGecko API base URL, overridable with COINGECKO_API_URL.
+func GetCoinGeckoURL() string {
+	if url := os.Getenv("COINGECKO_API_URL"); url != "" {
+		return strings.TrimSuffix(url, "/")
+	}
+	return "https://api.coingecko.com/api/v3"
+}
+
+// GetExitPolicyPath returns the warden exit policy file set by ARKHAM_EXIT_POLICY, or "" when
+// wardens should run without one.
+func GetExitPolicyPath() string {
+	GetRpcEndpoint() // loads .env
+	return os.Getenv("ARKHAM_EXIT_POLICY")
+}
+
+// GetLogOptions reads the log level and format from ARKHAM_LOG_LEVEL (debug, info, warn or
+// error; default info) and ARKHAM_LOG_FORMAT (text or json; default text).
+func GetLogOptions() (logging.Options, error) {
+	GetRpcEndpoint() // loads .env
+	level, err := logging.ParseLevel(os.Getenv("ARKHAM_LOG_LEVEL"))
+	if err != nil {
+		return logging.Options{}, err
+	}
+	return logging.Options{Level: level, Format: os.Getenv("ARKHAM_LOG_FORMAT")}, nil
+}
+
+// InitLogging installs the configured logger as the slog and log default, which the
+// library packages fall back to.
+func InitLogging() error {
+	opts, err := GetLogOptions()
+	if err != nil {
+		return err
+	}
+	logger, err := logging.New(opts)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// GetMetricsListen returns the address set by ARKHAM_METRICS_LISTEN to serve Prometheus
+// metrics on, or "" when metrics are disabled.
+func GetMetricsListen() string {
+	GetRpcEndpoint() // loads .env
+	return os.Getenv("ARKHAM_METRICS_LISTEN")
+}
+
+// GetReputationProfile returns the wallet profile set by ARKHAM_REPUTATION_PROFILE that
+// reports wardens' link quality on chain, or "" when the node does not report.
+func GetReputationProfile() string {
+	GetRpcEndpoint() // loads .env
+	return os.Getenv("ARKHAM_REPUTATION_PROFILE")
+}
+
+// GuiConfig controls how the GUI server is exposed.
+type GuiConfig struct {
+	// Listen is the address to bind. Empty means 127.0.0.1 on the first free port from 8088.
+	Listen string
+	// Password enables password login, which remote access requires.
+	Password string
+	// TLSCert and TLSKey enable HTTPS, which remote access requires.
+	TLSCert string
+	TLSKey  string
+	// AllowedHosts are extra Host header values accepted besides the loopback names.
+	AllowedHosts []string
+}
+
+// GetGuiConfig reads the GUI server settings from ARKHAM_GUI_LISTEN, ARKHAM_GUI_PASSWORD,
+// ARKHAM_GUI_TLS_CERT, ARKHAM_GUI_TLS_KEY and ARKHAM_GUI_ALLOWED_HOSTS.
+func GetGuiConfig() GuiConfig {
+	GetRpcEndpoint() // loads .env
+	cfg := GuiConfig{
+		Listen:   os.Getenv("ARKHAM_GUI_LISTEN"),
+		Password: os.Getenv("ARKHAM_GUI_PASSWORD"),
+		TLSCert:  os.Getenv("ARKHAM_GUI_TLS_CERT"),
+		TLSKey:   os.Getenv("ARKHAM_GUI_TLS_KEY"),
+	}
+	for _, host := range strings.Split(os.Getenv("ARKHAM_GUI_ALLOWED_HOSTS"), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			cfg.AllowedHosts = append(cfg.AllowedHosts, host)
+		}
+	}
+	return cfg
+}
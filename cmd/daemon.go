@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"arkham-cli/daemon"
+	"arkham-cli/node"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	daemonSocket        string
+	daemonWardenProfile string
+	daemonNoNode        bool
+	daemonNodeFlags     *nodeFlags
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run the Arkham node headlessly with a local control socket.",
+	Long: `Runs the P2P node, seeker sessions, bandwidth proof submission and the on-chain account
+watchers in the foreground, and serves the ` + daemon.ServiceName + ` JSON-RPC API on a unix socket
+that only the current user can open.
+
+"node status", "peers" and "sessions" are clients of that socket.`,
+	RunE: runDaemon,
+}
+
+var nodeCmd = &cobra.Command{
+	Use:   "node",
+	Short: "Control the daemon's P2P node.",
+}
+
+var nodeStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the daemon's node is running.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withDaemon(func(c *daemon.Client) error {
+			status, err := c.Status()
+			if err != nil {
+				return err
+			}
+			printNodeStatus(status)
+			return nil
+		})
+	},
+}
+
+var nodeStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start the daemon's P2P node.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withDaemon(func(c *daemon.Client) error {
+			status, err := c.StartNode()
+			if err != nil {
+				return err
+			}
+			printNodeStatus(status)
+			return nil
+		})
+	},
+}
+
+var nodeStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the daemon's P2P node.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withDaemon(func(c *daemon.Client) error {
+			status, err := c.StopNode()
+			if err != nil {
+				return err
+			}
+			printNodeStatus(status)
+			return nil
+		})
+	},
+}
+
+var peersCmd = &cobra.Command{
+	Use:   "peers",
+	Short: "List the peers known to the daemon.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withDaemon(func(c *daemon.Client) error {
+			peers, err := c.Peers()
+			if err != nil {
+				return err
+			}
+			if len(peers) == 0 {
+				fmt.Println(infoStyle.Render("No peers discovered yet."))
+				return nil
+			}
+			fmt.Println(titleStyle.Render(fmt.Sprintf("🌐 %d peers", len(peers))))
+			for _, p := range peers {
+				latency := "-"
+				if p.LastSeen != nil {
+					latency = fmt.Sprintf("%dms ±%dms, %.0f%% loss, seen %s ago",
+						p.Latency, p.Jitter, p.Loss*100, time.Since(*p.LastSeen).Round(time.Second))
+				}
+				fmt.Printf("   %s  %s\n", p.ID, latency)
+			}
+			return nil
+		})
+	},
+}
+
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "List the daemon's seeker circuits and the traffic it relays.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withDaemon(func(c *daemon.Client) error {
+			sessions, err := c.Sessions()
+			if err != nil {
+				return err
+			}
+			fmt.Println(titleStyle.Render("🔐 Seeker circuits"))
+			if len(sessions.Circuits) == 0 {
+				fmt.Println("   none")
+			}
+			for _, s := range sessions.Circuits {
+				fmt.Printf("   %s: %d hops, %d bytes, up %s\n", s.Profile, len(s.Path), s.Bytes, time.Since(s.Started).Round(time.Second))
+				for i, warden := range s.Wardens {
+					fmt.Printf("      %d. %s\n", i+1, warden)
+				}
+			}
+			fmt.Println(titleStyle.Render("\n🛡️ Served sessions"))
+			if len(sessions.Served) == 0 {
+				fmt.Println("   none")
+			}
+			for _, s := range sessions.Served {
+				fmt.Printf("   %-7s %s: %d streams, %d bytes, up %s\n", s.Kind, s.Peer, s.Streams, s.Bytes, time.Since(s.Since).Round(time.Second))
+			}
+			return nil
+		})
+	},
+}
+
+func init() {
+	daemonCmd.Flags().StringVar(&daemonWardenProfile, "warden-profile", "warden", "wallet profile that submits proofs for relayed traffic")
+	daemonCmd.Flags().BoolVar(&daemonNoNode, "no-node", false, "do not start the P2P node until asked with \"node start\"")
+	daemonNodeFlags = addNodeFlags(daemonCmd.Flags())
+
+	for _, c := range []*cobra.Command{daemonCmd, nodeCmd, peersCmd, sessionsCmd} {
+		c.PersistentFlags().StringVar(&daemonSocket, "socket", daemon.DefaultSocketPath(), "daemon control socket")
+	}
+
+	nodeCmd.AddCommand(nodeStatusCmd, nodeStartCmd, nodeStopCmd)
+	rootCmd.AddCommand(daemonCmd, nodeCmd, peersCmd, sessionsCmd)
+}
+
+func runDaemon(cmd *cobra.Command, args []string) error {
+	nodeCfg, err := daemon.LoadNodeConfig()
+	if err != nil {
+		return err
+	}
+	nodeCfg = daemonNodeFlags.apply(nodeCfg)
+	d, err := daemon.New(daemon.Config{
+		RpcEndpoint:       GetRpcEndpoint(),
+		WsEndpoint:        GetWsEndpoint(),
+		ExitPolicyPath:    GetExitPolicyPath(),
+		WardenProfile:     daemonWardenProfile,
+		MetricsListen:     GetMetricsListen(),
+		ReputationProfile: GetReputationProfile(),
+		Node:              &nodeCfg,
+	})
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	if !daemonNoNode {
+		if _, err := d.StartNode(); err != nil {
+			return err
+		}
+	}
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- d.Serve(daemonSocket) }()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	select {
+	case err := <-serveErr:
+		return err
+	case <-stop:
+		fmt.Println(infoStyle.Render("\nShutting down..."))
+		return nil
+	}
+}
+
+// withDaemon connects to the daemon's control socket for the duration of fn.
+func withDaemon(fn func(c *daemon.Client) error) error {
+	c, err := daemon.Dial(daemonSocket)
+	if err != nil {
+		return fmt.Errorf("%w\nStart it with: arkham-cli daemon", err)
+	}
+	defer c.Close()
+	return fn(c)
+}
+
+func printNodeStatus(status node.NodeStatus) {
+	if !status.IsRunning {
+		fmt.Println(warningStyle.Render("Node is stopped."))
+		return
+	}
+	fmt.Println(infoStyle.Render("Node is running."))
+	fmt.Printf("   Peer ID: %s\n", status.PeerID)
+	for _, addr := range status.Addresses {
+		fmt.Printf("   %s\n", addr)
+	}
+}
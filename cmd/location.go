@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"arkham-cli/geo"
+	"arkham-cli/logging"
+	arkham_protocol "arkham-cli/solana"
+
+	"github.com/AlecAivazis/survey/v2"
+)
+
+const publicIPDiscoveryTimeout = 30 * time.Second
+
+// discoverLocation resolves the location a warden registers. The IP is the saved publicIp
+// override, or else the one peers observe when a short-lived node joins the network. If
+// neither gives an IP, the user is asked for it.
+func discoverLocation(client *arkham_protocol.Client) (geo.Location, error) {
+	p2pNode, err := newEphemeralNode(client)
+	if err != nil {
+		return geo.Location{}, err
+	}
+	p2pNode.Logger = logging.Discard()
+	ip, ok := p2pNode.PublicIP()
+	if !ok {
+		fmt.Println(promptStyle.Render("\nDiscovering your public IP through the Arkham network..."))
+		if err := p2pNode.Start(); err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), publicIPDiscoveryTimeout)
+			ip, _ = p2pNode.WaitPublicIP(ctx)
+			cancel()
+			p2pNode.Stop()
+		}
+	}
+	if !ip.IsValid() {
+		input := ""
+		err := survey.AskOne(&survey.Input{
+			Message: "Could not observe your public IP. Enter it:",
+		}, &input, survey.WithValidator(func(ans interface{}) error {
+			_, err := netip.ParseAddr(ans.(string))
+			return err
+		}))
+		if err != nil {
+			return geo.Location{}, err
+		}
+		ip = netip.MustParseAddr(input)
+	}
+	return geo.Locate(ip)
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"log/slog"
+	"path/filepath"
+
+	"arkham-cli/daemon"
+	"arkham-cli/node"
+	arkham_protocol "arkham-cli/solana"
+	"arkham-cli/storage"
+)
+
+// newEphemeralNode creates a short-lived node for a CLI command. It uses the saved node
+// config on ephemeral ports, so it can run next to the daemon, and bootstraps the DHT from
+// the registered wardens and the daemon's address book.
+func newEphemeralNode(client *arkham_protocol.Client) (*node.P2PNode, error) {
+	cfg, err := daemon.LoadNodeConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg.ListenAddrs, cfg.AnnounceAddrs = nil, nil
+
+	p2pNode := node.NewP2PNode()
+	if err := p2pNode.SetConfig(cfg); err != nil {
+		return nil, err
+	}
+	p2pNode.ChainPeers = daemon.WardenPeers(client, slog.Default())
+	p2pNode.AddrBook = filepath.Join(storage.ConfigDir(), daemon.AddrBookFile)
+	return p2pNode, nil
+}
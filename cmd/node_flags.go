@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"arkham-cli/node"
+
+	"github.com/spf13/pflag"
+)
+
+// nodeFlags override the saved node config for one run.
+type nodeFlags struct {
+	flags *pflag.FlagSet
+	cfg   node.Config
+}
+
+// addNodeFlags registers the node networking flags on fs.
+func addNodeFlags(fs *pflag.FlagSet) *nodeFlags {
+	f := &nodeFlags{flags: fs}
+	fs.StringSliceVar(&f.cfg.ListenAddrs, "listen", nil, "multiaddrs to listen on, e.g. /ip4/0.0.0.0/tcp/4001")
+	fs.StringSliceVar(&f.cfg.AnnounceAddrs, "announce", nil, "multiaddrs to advertise instead of the listen addresses")
+	fs.StringSliceVar(&f.cfg.NoAnnounceAddrs, "no-announce", nil, "multiaddrs or CIDR ranges never to advertise")
+	fs.StringSliceVar(&f.cfg.BootstrapPeers, "bootstrap", nil, "/p2p multiaddrs of DHT bootstrap peers")
+	fs.BoolVar(&f.cfg.DisableChainBootstrap, "no-chain-bootstrap", false, "do not bootstrap the DHT from the registered wardens")
+	fs.StringVar(&f.cfg.DHTMode, "dht-mode", "", "DHT mode: auto, server or client (default: server for wardens)")
+	fs.BoolVar(&f.cfg.DisableRelay, "no-relay", false, "disable circuit relay transport")
+	fs.BoolVar(&f.cfg.DisableHolePunching, "no-hole-punching", false, "disable NAT hole punching")
+	fs.IntVar(&f.cfg.ConnLowWater, "conn-low", 0, "connection manager low watermark")
+	fs.IntVar(&f.cfg.ConnHighWater, "conn-high", 0, "connection manager high watermark")
+	fs.StringVar(&f.cfg.PublicIP, "public-ip", "", "public egress IP to use instead of the one peers observe")
+	return f
+}
+
+// apply returns base with every flag that was set on the command line replacing its field.
+func (f *nodeFlags) apply(base node.Config) node.Config {
+	set := func(name string) bool { return f.flags.Changed(name) }
+	if set("listen") {
+		base.ListenAddrs = f.cfg.ListenAddrs
+	}
+	if set("announce") {
+		base.AnnounceAddrs = f.cfg.AnnounceAddrs
+	}
+	if set("no-announce") {
+		base.NoAnnounceAddrs = f.cfg.NoAnnounceAddrs
+	}
+	if set("bootstrap") {
+		base.BootstrapPeers = f.cfg.BootstrapPeers
+	}
+	if set("no-chain-bootstrap") {
+		base.DisableChainBootstrap = f.cfg.DisableChainBootstrap
+	}
+	if set("dht-mode") {
+		base.DHTMode = f.cfg.DHTMode
+	}
+	if set("no-relay") {
+		base.DisableRelay = f.cfg.DisableRelay
+	}
+	if set("no-hole-punching") {
+		base.DisableHolePunching = f.cfg.DisableHolePunching
+	}
+	if set("conn-low") {
+		base.ConnLowWater = f.cfg.ConnLowWater
+	}
+	if set("conn-high") {
+		base.ConnHighWater = f.cfg.ConnHighWater
+	}
+	if set("public-ip") {
+		base.PublicIP = f.cfg.PublicIP
+	}
+	return base
+}
@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"arkham-cli/oracle"
+	arkham_protocol "arkham-cli/solana"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/spf13/cobra"
+)
+
+var (
+	oracleKeypairPath string
+	oracleListenAddr  string
+	oraclePriceTable  string
+	oracleFeedURL     string
+	oracleTrustedKeys string
+	oracleAuditPath   string
+	oracleKeygenOut   string
+
+	adminKeypairPath string
+)
+
+var oracleCmd = &cobra.Command{
+	Use:   "oracle",
+	Short: "Run a self-hosted price oracle for localnet and testing.",
+}
+
+var oracleServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve signed price quotes in the format InitializeWarden expects.",
+	Long: `Serves GET /api/price?token=<solana|usd-coin|tether>&trustedClientKey=<key>.
+
+Point clients at it with ARKHAM_ORACLE_URL=http://<listen>/api/price and make the
+on-chain OracleAuthority match the oracle key with 'arkham-cli admin set-oracle-authority'.`,
+	RunE: runOracleServe,
+}
+
+var oracleKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate a new oracle keypair file.",
+	RunE:  runOracleKeygen,
+}
+
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Protocol administration commands (requires the protocol authority keypair).",
+}
+
+var adminSetOracleCmd = &cobra.Command{
+	Use:   "set-oracle-authority <oracle-pubkey>",
+	Short: "Point ProtocolConfig.OracleAuthority at a new oracle key.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runAdminSetOracle,
+}
+
+func init() {
+	oracleServeCmd.Flags().StringVar(&oracleKeypairPath, "keypair", "oracle-keypair.json", "oracle keypair file (solana-keygen format)")
+	oracleServeCmd.Flags().StringVar(&oracleListenAddr, "listen", "127.0.0.1:8787", "address to listen on")
+	oracleServeCmd.Flags().StringVar(&oraclePriceTable, "prices", "", "fixed price table in micro-USD, e.g. sol=150000000,usdc=1000000")
+	oracleServeCmd.Flags().StringVar(&oracleFeedURL, "feed", "", "CoinGecko-compatible feed base URL (default: COINGECKO_API_URL or CoinGecko)")
+	oracleServeCmd.Flags().StringVar(&oracleTrustedKeys, "trusted-keys", "", "comma-separated trusted client keys (default: ORACLE_TRUSTED_CLIENT_KEYS)")
+	oracleServeCmd.Flags().StringVar(&oracleAuditPath, "audit-log", "oracle-audit.jsonl", "file that records every signed quote")
+
+	oracleKeygenCmd.Flags().StringVar(&oracleKeygenOut, "out", "oracle-keypair.json", "where to write the new keypair")
+
+	adminSetOracleCmd.Flags().StringVar(&adminKeypairPath, "keypair", "", "protocol authority keypair file (solana-keygen format)")
+	adminSetOracleCmd.MarkFlagRequired("keypair")
+
+	oracleCmd.AddCommand(oracleServeCmd, oracleKeygenCmd)
+	adminCmd.AddCommand(adminSetOracleCmd)
+	rootCmd.AddCommand(oracleCmd, adminCmd)
+}
+
+func runOracleServe(cmd *cobra.Command, args []string) error {
+	GetRpcEndpoint() // loads .env
+
+	key, err := solana.PrivateKeyFromSolanaKeygenFile(oracleKeypairPath)
+	if err != nil {
+		return fmt.Errorf("failed to load oracle keypair: %w", err)
+	}
+
+	trusted := oracleTrustedKeys
+	if trusted == "" {
+		trusted = os.Getenv("ORACLE_TRUSTED_CLIENT_KEYS")
+	}
+	var trustedKeys []string
+	for _, k := range strings.Split(trusted, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			trustedKeys = append(trustedKeys, k)
+		}
+	}
+	if len(trustedKeys) == 0 {
+		return fmt.Errorf("no trusted client keys configured; use --trusted-keys or ORACLE_TRUSTED_CLIENT_KEYS")
+	}
+
+	var feed oracle.Feed
+	if oraclePriceTable != "" {
+		prices, err := arkham_protocol.ParsePriceTable(oraclePriceTable)
+		if err != nil {
+			return err
+		}
+		feed = oracle.StaticFeed(prices)
+	} else {
+		feedURL := oracleFeedURL
+		if feedURL == "" {
+			feedURL = GetCoinGeckoURL()
+		}
+		feed = oracle.NewCoinGeckoFeed(strings.TrimSuffix(feedURL, "/"))
+	}
+
+	audit, err := oracle.OpenAuditLog(oracleAuditPath)
+	if err != nil {
+		return err
+	}
+	defer audit.Close()
+
+	server := &oracle.Server{
+		Key:         key,
+		Feed:        feed,
+		TrustedKeys: trustedKeys,
+		Audit:       audit,
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/price", server)
+
+	fmt.Println(titleStyle.Render("🔮 Arkham price oracle"))
+	fmt.Println(promptStyle.Render(fmt.Sprintf("   Oracle authority: %s", key.PublicKey())))
+	fmt.Println(promptStyle.Render(fmt.Sprintf("   Serving:          http://%s/api/price", oracleListenAddr)))
+	fmt.Println(promptStyle.Render(fmt.Sprintf("   Audit log:        %s", oracleAuditPath)))
+
+	return http.ListenAndServe(oracleListenAddr, mux)
+}
+
+func runOracleKeygen(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(oracleKeygenOut); err == nil {
+		return fmt.Errorf("%s already exists, refusing to overwrite", oracleKeygenOut)
+	}
+
+	wallet := solana.NewWallet()
+	keyBytes := make([]int, len(wallet.PrivateKey))
+	for i, b := range wallet.PrivateKey {
+		keyBytes[i] = int(b)
+	}
+	data, err := json.Marshal(keyBytes)
+	if err != nil {
+		return fmt.Errorf("failed to encode keypair: %w", err)
+	}
+	if err := os.WriteFile(oracleKeygenOut, data, 0600); err != nil {
+		return fmt.Errorf("failed to write keypair: %w", err)
+	}
+
+	fmt.Println(titleStyle.Render("✅ Oracle keypair created"))
+	fmt.Printf("   File:       %s\n", oracleKeygenOut)
+	fmt.Printf("   Public key: %s\n", wallet.PublicKey())
+	return nil
+}
+
+func runAdminSetOracle(cmd *cobra.Command, args []string) error {
+	oracleAuthority, err := solana.PublicKeyFromBase58(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid oracle public key: %w", err)
+	}
+	signer, err := solana.PrivateKeyFromSolanaKeygenFile(adminKeypairPath)
+	if err != nil {
+		return fmt.Errorf("failed to load authority keypair: %w", err)
+	}
+
+	client, err := arkham_protocol.NewClient(GetRpcEndpoint(), signer)
+	if err != nil {
+		return fmt.Errorf("failed to create Solana client: %w", err)
+	}
+
+	fmt.Println(promptStyle.Render(fmt.Sprintf("\nSetting oracle authority to %s...", oracleAuthority)))
+	sig, err := client.SetOracleAuthority(oracleAuthority)
+	if err != nil {
+		return fmt.Errorf("failed to update protocol config: %w", err)
+	}
+
+	fmt.Println(titleStyle.Render("\n✅ Oracle Authority Updated!"))
+	fmt.Printf("   Transaction Signature: %s\n", sig.String())
+	return nil
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+
+	"arkham-cli/daemon"
+	arkham_protocol "arkham-cli/solana"
+	"arkham-cli/storage"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	depositProfile string
+	depositAmount  string
+	depositPrivate bool
+
+	claimProfile string
+	claimPrivate bool
+)
+
+var seekerDepositCmd = &cobra.Command{
+	Use:   "deposit",
+	Short: "Deposit SOL into the seeker's escrow.",
+	Long: `Deposits --amount SOL into the seeker's escrow. With --private the deposit is made with
+the program's use_private flag, and the program routes it to the seeker's private escrow.`,
+	RunE: runSeekerDeposit,
+}
+
+var wardenCmd = &cobra.Command{
+	Use:   "warden",
+	Short: "Warden commands.",
+}
+
+var wardenClaimCmd = &cobra.Command{
+	Use:   "claim",
+	Short: "Claim the warden's pending SOL earnings.",
+	Long: `Claims the warden's pending SOL earnings. With --private the claim is made with the
+program's use_private flag.`,
+	RunE: runWardenClaim,
+}
+
+func init() {
+	seekerDepositCmd.Flags().StringVar(&depositProfile, "profile", "seeker", "wallet profile to deposit from")
+	seekerDepositCmd.Flags().StringVar(&depositAmount, "amount", "", "SOL to deposit")
+	seekerDepositCmd.Flags().BoolVar(&depositPrivate, "private", false, "deposit into the private escrow")
+	seekerDepositCmd.MarkFlagRequired("amount")
+
+	wardenClaimCmd.Flags().StringVar(&claimProfile, "profile", "warden", "warden wallet profile")
+	wardenClaimCmd.Flags().BoolVar(&claimPrivate, "private", false, "claim the earnings privately")
+
+	seekerCmd.AddCommand(seekerDepositCmd)
+	wardenCmd.AddCommand(wardenClaimCmd)
+	rootCmd.AddCommand(wardenCmd)
+}
+
+// profileClient returns a client signing with a wallet profile.
+func profileClient(profile string) (*arkham_protocol.Client, error) {
+	db, err := storage.NewWalletStorage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open wallet storage: %w", err)
+	}
+	signer, err := db.GetWallet(profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load profile '%s': %w", profile, err)
+	}
+	client, err := arkham_protocol.NewClient(GetRpcEndpoint(), signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Solana client: %w", err)
+	}
+	return client, nil
+}
+
+func runSeekerDeposit(cmd *cobra.Command, args []string) error {
+	amount, err := arkham_protocol.ParseTokenAmount(depositAmount, arkham_protocol.SolDecimals)
+	if err != nil {
+		return fmt.Errorf("invalid --amount: %w", err)
+	}
+	if amount == 0 {
+		return fmt.Errorf("--amount must be greater than zero")
+	}
+	client, err := profileClient(depositProfile)
+	if err != nil {
+		return err
+	}
+
+	escrow := "escrow"
+	if depositPrivate {
+		escrow = "private escrow"
+	}
+	fmt.Println(promptStyle.Render(fmt.Sprintf("Depositing %s into the %s...", formatSol(amount), escrow)))
+	sig, err := client.DepositEscrow(amount, depositPrivate)
+	if err != nil {
+		return fmt.Errorf("escrow deposit failed: %w", err)
+	}
+	fmt.Println(titleStyle.Render("\n✅ Escrow Deposit Successful!"))
+	fmt.Printf("   Transaction Signature: %s\n", sig.String())
+	return nil
+}
+
+func runWardenClaim(cmd *cobra.Command, args []string) error {
+	client, err := profileClient(claimProfile)
+	if err != nil {
+		return err
+	}
+	warden, err := client.FetchWardenAccount()
+	if err != nil {
+		return fmt.Errorf("could not fetch warden data: %w", err)
+	}
+	if warden.PendingClaims == 0 {
+		fmt.Println(infoStyle.Render("You have no SOL earnings to claim at this time."))
+		return nil
+	}
+
+	fmt.Println(promptStyle.Render(fmt.Sprintf("Claiming %s of earnings...", formatSol(warden.PendingClaims))))
+	sig, err := client.ClaimEarnings(claimPrivate)
+	if err != nil {
+		return fmt.Errorf("failed to claim earnings: %w", err)
+	}
+	fmt.Println(titleStyle.Render("\n✅ Earnings Claimed Successfully!"))
+	fmt.Printf("   Transaction Signature: %s\n", sig.String())
+	return nil
+}
+
+// printPrivateActivity prints the private deposits and claims recorded on chain.
+func printPrivateActivity(client *arkham_protocol.Client) {
+	activity, err := daemon.FetchPrivateActivity(client)
+	if err != nil {
+		fmt.Println(warningStyle.Render(fmt.Sprintf("Warning: Could not fetch private activity: %v", err)))
+		return
+	}
+	fmt.Printf("  %s %s\n", promptStyle.Render("Private Deposits:"), formatSol(activity.Deposited))
+	fmt.Printf("  %s %s\n", promptStyle.Render("Private Claims:"), formatSol(activity.Claimed))
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+
+	"arkham-cli/pricing"
+	arkham_protocol "arkham-cli/solana"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/spf13/cobra"
+)
+
+var (
+	quoteWarden string
+	quoteMb     uint64
+)
+
+var quoteCmd = &cobra.Command{
+	Use:   "quote",
+	Short: "Quote the cost of a connection to a warden.",
+	RunE:  runQuote,
+}
+
+func init() {
+	quoteCmd.Flags().StringVar(&quoteWarden, "warden", "", "warden authority public key")
+	quoteCmd.Flags().Uint64Var(&quoteMb, "mb", 1024, "megabytes to quote")
+	quoteCmd.MarkFlagRequired("warden")
+
+	rootCmd.AddCommand(quoteCmd)
+}
+
+func runQuote(cmd *cobra.Command, args []string) error {
+	wardenAuthority, err := solana.PublicKeyFromBase58(quoteWarden)
+	if err != nil {
+		return fmt.Errorf("invalid warden public key: %w", err)
+	}
+	if quoteMb == 0 {
+		return fmt.Errorf("--mb must be greater than zero")
+	}
+
+	client, err := arkham_protocol.NewReadOnlyClient(GetRpcEndpoint())
+	if err != nil {
+		return fmt.Errorf("failed to create Solana client: %w", err)
+	}
+	protocolConfig, err := client.FetchProtocolConfig()
+	if err != nil {
+		return err
+	}
+	warden, err := client.FetchWardenByAuthority(wardenAuthority)
+	if err != nil {
+		return err
+	}
+
+	quote, err := pricing.QuoteConnection(protocolConfig, warden, quoteMb)
+	if err != nil {
+		return err
+	}
+	printQuote(quote)
+	return nil
+}
+
+func formatSol(lamports uint64) string {
+	return arkham_protocol.FormatTokenAmount(lamports, arkham_protocol.SolDecimals) + " SOL"
+}
+
+func printQuote(quote *pricing.Quote) {
+	fmt.Println(titleStyle.Render(fmt.Sprintf("\n💰 Quote for %d MB", quote.Mb)))
+	fmt.Printf("   Warden:          %s (%s, region %d)\n", quote.Warden, quote.Tier, quote.RegionCode)
+	fmt.Printf("   Rate:            %d lamports/MB (base %d, geo +%d bps, tier x%d bps)\n",
+		quote.RatePerMb, quote.BaseRatePerMb, quote.GeoPremiumBps, quote.TierMultiplierBps)
+	fmt.Printf("   Cost:            %s\n", formatSol(quote.Cost))
+	fmt.Printf("   Protocol fee:    %s (%d bps)\n", formatSol(quote.ProtocolFee), quote.ProtocolFeeBps)
+	fmt.Printf("   Warden earnings: %s\n", formatSol(quote.WardenEarnings))
+	fmt.Printf("   Escrow required: %s\n", formatSol(quote.EscrowRequired))
+}
@@ -1,8 +1,9 @@
 package cmd
 
 import (
+	"arkham-cli/daemon"
 	"arkham-cli/storage"
-	"crypto/sha256"
+	"context"
 	"encoding/hex"
 	"fmt"
 	"os"
@@ -11,6 +12,7 @@ import (
 	"strconv"
 	"time"
 
+	"arkham-cli/pricing"
 	arkham_protocol "arkham-cli/solana"
 
 	"github.com/AlecAivazis/survey/v2"
@@ -172,11 +174,11 @@ func runInteractive(signer solana.PrivateKey, profileName string) {
 		handleClaimArkhamTokens(signer)
 	// Seeker actions
 	case "View Seeker Dashboard":
-		fmt.Println(titleStyle.Render("\n📊 Seeker Dashboard (Coming Soon)"))
+		handleViewSeekerDashboard(signer, profileName)
 	case "Deposit Escrow":
 		handleDepositEscrow(signer)
 	case "Start Connection":
-		handleStartConnection(signer)
+		handleStartConnection(signer, profileName)
 	case "Generate Signature for Proof":
 		handleGenerateSignature(signer)
 	case "End Connection":
@@ -255,6 +257,47 @@ totalEarningsSol := float64(wardenAccount.TotalEarnings) / float64(solana.LAMPOR
 	fmt.Printf("  %s %s\n", promptStyle.Render("Total Lifetime Earnings:"), titleStyle.Render(fmt.Sprintf("%.9f SOL", totalEarningsSol)))
 	fmt.Println(infoStyle.Render("---"))
 	fmt.Printf("  %s %s\n", promptStyle.Render("Claimable ARKHAM Tokens:"), titleStyle.Render(fmt.Sprintf("%.9f ARKHAM", arkhamTokensEarned)))
+	printPrivateActivity(client)
+	fmt.Println(infoStyle.Render("----------------------------------------"))
+}
+
+func handleViewSeekerDashboard(signer solana.PrivateKey, profileName string) {
+	client, err := arkham_protocol.NewClient(GetRpcEndpoint(), signer)
+	if err != nil {
+		fmt.Println(warningStyle.Render(fmt.Sprintf("Failed to create Solana client: %v", err)))
+		return
+	}
+
+	fmt.Println(promptStyle.Render("\nFetching Seeker dashboard data..."))
+
+	seekerAccount, err := client.FetchSeekerAccount()
+	if err != nil {
+		fmt.Println(warningStyle.Render(fmt.Sprintf("\n❌ Could not fetch Seeker data: %v", err)))
+		return
+	}
+	orchestrator := &daemon.Orchestrator{Client: client, Profile: profileName}
+	status, err := orchestrator.Budget()
+	if err != nil {
+		fmt.Println(warningStyle.Render(fmt.Sprintf("\nWarning: Could not compute budget usage: %v", err)))
+	}
+
+	fmt.Println(titleStyle.Render("\n📊 Seeker Dashboard"))
+	fmt.Println(infoStyle.Render("----------------------------------------"))
+	fmt.Printf("  %s %s\n", promptStyle.Render("Escrow Balance:"), titleStyle.Render(formatSol(seekerAccount.EscrowBalance)))
+	if seekerAccount.PrivateEscrow != nil {
+		fmt.Printf("  %s %s\n", promptStyle.Render("Private Escrow:"), seekerAccount.PrivateEscrow.String())
+	}
+	printPrivateActivity(client)
+	fmt.Printf("  %s %s\n", promptStyle.Render("Total Bandwidth Consumed:"), titleStyle.Render(fmt.Sprintf("%d MB", seekerAccount.TotalBandwidthConsumed)))
+	fmt.Printf("  %s %s\n", promptStyle.Render("Total Spent:"), titleStyle.Render(formatSol(seekerAccount.TotalSpent)))
+	fmt.Printf("  %s %d\n", promptStyle.Render("Active Connections:"), seekerAccount.ActiveConnections)
+	if seekerAccount.PremiumExpiresAt != nil {
+		fmt.Printf("  %s %s\n", promptStyle.Render("Premium Until:"), time.Unix(*seekerAccount.PremiumExpiresAt, 0).Format(time.RFC1123))
+	}
+	if status != nil {
+		fmt.Println(infoStyle.Render("---"))
+		printBudget(status)
+	}
 	fmt.Println(infoStyle.Render("----------------------------------------"))
 }
 
@@ -267,11 +310,12 @@ func handleViewMyConnections(signer solana.PrivateKey, profileName string) {
 
 	fmt.Println(promptStyle.Render("\nFetching your connection accounts..."))
 
-	connections, err := client.FetchMyConnections(profileName)
+	connections, warnings, err := client.FetchMyConnections(profileName)
 	if err != nil {
 		fmt.Println(warningStyle.Render(fmt.Sprintf("\n❌ Could not fetch connections: %v", err)))
 		return
 	}
+	printWarnings(warnings)
 
 	if len(connections) == 0 {
 		fmt.Println(infoStyle.Render("No connection accounts found for your profile."))
@@ -403,10 +447,10 @@ func handleClaimEarnings(signer solana.PrivateKey) {
 		return
 	}
 
-	fmt.Println(promptStyle.Render("\nClaiming accumulated earnings..."))
-	// For now, private claims are not implemented in the CLI.
 	usePrivate := false
+	survey.AskOne(&survey.Confirm{Message: "Claim privately?", Default: false}, &usePrivate)
 
+	fmt.Println(promptStyle.Render("\nClaiming accumulated earnings..."))
 	sig, err := client.ClaimEarnings(usePrivate)
 	if err != nil {
 		fmt.Println(warningStyle.Render(fmt.Sprintf("\n❌ Failed to claim earnings: %v", err)))
@@ -470,8 +514,11 @@ func handleDepositEscrow(signer solana.PrivateKey) {
 	}
 	amountLamports := uint64(amountFloat * float64(solana.LAMPORTS_PER_SOL))
 
+	usePrivate := false
+	survey.AskOne(&survey.Confirm{Message: "Deposit into the private escrow?", Default: false}, &usePrivate)
+
 	fmt.Println(promptStyle.Render(fmt.Sprintf("\nDepositing %f SOL into escrow...", amountFloat)))
-	sig, err := client.DepositEscrow(amountLamports)
+	sig, err := client.DepositEscrow(amountLamports, usePrivate)
 	if err != nil {
 		fmt.Println(warningStyle.Render(fmt.Sprintf("\n❌ Escrow deposit failed: %v", err)))
 		return
@@ -481,7 +528,7 @@ func handleDepositEscrow(signer solana.PrivateKey) {
 	fmt.Printf("   Transaction Signature: %s\n", sig.String())
 }
 
-func handleStartConnection(signer solana.PrivateKey) {
+func handleStartConnection(signer solana.PrivateKey, profileName string) {
 	client, err := arkham_protocol.NewClient(GetRpcEndpoint(), signer)
 	if err != nil {
 		fmt.Println(warningStyle.Render(fmt.Sprintf("Failed to create Solana client: %v", err)))
@@ -502,25 +549,16 @@ func handleStartConnection(signer solana.PrivateKey) {
 	fmt.Println(promptStyle.Render("Calculating suggestion for estimated MB..."))
 	var suggestedMb uint64 = 100 // Default suggestion
 
-	seekerAccount, err := client.FetchSeekerAccount()
+	var protocolConfig *arkham_protocol.ProtocolConfig
+	warden, err := client.FetchWardenByAuthority(wardenPubkey)
 	if err != nil {
+		fmt.Println(warningStyle.Render(fmt.Sprintf("\nWarning: Could not fetch warden account to calculate suggestion: %v", err)))
+	} else if protocolConfig, err = client.FetchProtocolConfig(); err != nil {
+		fmt.Println(warningStyle.Render(fmt.Sprintf("\nWarning: Could not fetch protocol config to calculate suggestion: %v", err)))
+	} else if seekerAccount, err := client.FetchSeekerAccount(); err != nil {
 		fmt.Println(warningStyle.Render(fmt.Sprintf("\nWarning: Could not fetch seeker account to calculate suggestion: %v", err)))
-	} else {
-		protocolConfig, err := client.FetchProtocolConfig()
-		if err != nil {
-			fmt.Println(warningStyle.Render(fmt.Sprintf("\nWarning: Could not fetch protocol config to calculate suggestion: %v", err)))
-		} else {
-			if protocolConfig.BaseRatePerMb > 0 && seekerAccount.EscrowBalance > 0 {
-				// Use 90% of balance for calculation to leave a buffer for fees and rate fluctuations.
-				affordableBalance := (seekerAccount.EscrowBalance * 9) / 10
-				// The contract adds a 10% buffer, so we account for that in our suggestion.
-				// rate_per_mb * 1.1
-				effectiveRate := (protocolConfig.BaseRatePerMb * 11) / 10
-				if effectiveRate > 0 {
-					suggestedMb = affordableBalance / effectiveRate
-				}
-			}
-		}
+	} else if affordableMb, err := pricing.AffordableMb(protocolConfig, warden, seekerAccount.EscrowBalance); err == nil && affordableMb > 0 {
+		suggestedMb = affordableMb
 	}
 	// --- End Smart Suggestion Logic ---
 
@@ -537,6 +575,17 @@ func handleStartConnection(signer solana.PrivateKey) {
 		return
 	}
 
+	if warden != nil && protocolConfig != nil {
+		if quote, err := pricing.QuoteConnection(protocolConfig, warden, estimatedMb); err == nil {
+			printQuote(quote)
+			orchestrator := &daemon.Orchestrator{Client: client, Profile: profileName}
+			if err := orchestrator.Allow(quote.EscrowRequired); err != nil {
+				fmt.Println(warningStyle.Render(fmt.Sprintf("\n❌ Connection refused: %v", err)))
+				return
+			}
+		}
+	}
+
 	fmt.Println(promptStyle.Render(fmt.Sprintf("\nStarting connection with Warden %s for %d MB...", wardenPubkeyStr, estimatedMb)))
 	sig, err := client.StartConnection(wardenPubkey, estimatedMb)
 	if err != nil {
@@ -703,51 +752,100 @@ func handleRegistration(signer solana.PrivateKey) {
 	stakeTokenStr := ""
 	tokenPrompt := &survey.Select{
 		Message: "Choose your stake token:",
-		Options: []string{"SOL", "USDC"},
+		Options: []string{"SOL", "USDC", "USDT"},
 	}
 	survey.AskOne(tokenPrompt, &stakeTokenStr, survey.WithValidator(survey.Required))
-	var stakeToken arkham_protocol.StakeToken
-	switch stakeTokenStr {
-	case "SOL":
-		stakeToken = arkham_protocol.StakeToken_Sol
-	case "USDC":
-		stakeToken = arkham_protocol.StakeToken_Usdc
-	default:
+	stakeToken, err := arkham_protocol.ParseStakeToken(stakeTokenStr)
+	if err != nil {
 		fmt.Println(warningStyle.Render("Invalid token selected."))
 		return
 	}
+	client, err := arkham_protocol.NewClient(GetRpcEndpoint(), signer)
+	if err != nil {
+		fmt.Println(warningStyle.Render(fmt.Sprintf("Failed to create Solana client: %v", err)))
+		return
+	}
+	decimals, err := client.StakeTokenDecimals(stakeToken)
+	if err != nil {
+		fmt.Println(warningStyle.Render(fmt.Sprintf("Cannot stake %s: %v", stakeTokenStr, err)))
+		return
+	}
 	stakeAmountStr := ""
 	amountPrompt := &survey.Input{
 		Message: fmt.Sprintf("Enter amount of %s to stake:", stakeTokenStr),
 	}
 	survey.AskOne(amountPrompt, &stakeAmountStr, survey.WithValidator(survey.Required))
-	stakeAmountFloat, err := strconv.ParseFloat(stakeAmountStr, 64)
-	if err != nil {
+	stakeAmount, err := arkham_protocol.ParseTokenAmount(stakeAmountStr, decimals)
+	if err != nil || stakeAmount == 0 {
 		fmt.Println(warningStyle.Render("Invalid amount entered."))
 		return
 	}
-	var amountLamports uint64
-	if stakeToken == arkham_protocol.StakeToken_Sol {
-		amountLamports = uint64(stakeAmountFloat * float64(solana.LAMPORTS_PER_SOL))
-	} else {
-		amountLamports = uint64(stakeAmountFloat * 1_000_000)
+
+	// --- Pre-flight ---
+	preflight, err := client.PreflightWardenStake(context.Background(), stakeToken, stakeAmount)
+	if err != nil {
+		fmt.Println(warningStyle.Render(fmt.Sprintf("\n❌ Could not check your %s balance: %v", stakeTokenStr, err)))
+		return
 	}
-	client, err := arkham_protocol.NewClient(GetRpcEndpoint(), signer)
+	if !preflight.AccountExists {
+		createAccount := false
+		survey.AskOne(&survey.Confirm{
+			Message: fmt.Sprintf("You have no %s token account (%s). Create it now?", stakeTokenStr, preflight.Account),
+			Default: true,
+		}, &createAccount)
+		if !createAccount {
+			return
+		}
+		sig, err := client.CreateStakeTokenAccount(stakeToken)
+		if err != nil {
+			fmt.Println(warningStyle.Render(fmt.Sprintf("\n❌ Failed to create token account: %v", err)))
+			return
+		}
+		fmt.Printf("   Token account created: %s\n", sig.String())
+		preflight.AccountExists = true
+	}
+
+	fmt.Println(infoStyle.Render(fmt.Sprintf("\n   Balance:     %s %s", arkham_protocol.FormatTokenAmount(preflight.Balance, decimals), stakeTokenStr)))
+	fmt.Println(infoStyle.Render(fmt.Sprintf("   Stake:       %s %s", arkham_protocol.FormatTokenAmount(stakeAmount, decimals), stakeTokenStr)))
+	fmt.Println(infoStyle.Render(fmt.Sprintf("   Stake value: $%s", arkham_protocol.FormatTokenAmount(preflight.StakeValueUsd, arkham_protocol.OraclePriceDecimals))))
+	if preflight.TierErr == nil {
+		fmt.Println(infoStyle.Render(fmt.Sprintf("   Tier:        %s", preflight.Tier)))
+	}
+	if err := preflight.Check(); err != nil {
+		fmt.Println(warningStyle.Render(fmt.Sprintf("\n❌ %v", err)))
+		return
+	}
+	loc, err := discoverLocation(client)
 	if err != nil {
-		fmt.Println(warningStyle.Render(fmt.Sprintf("Failed to create Solana client: %v", err)))
+		fmt.Println(warningStyle.Render(fmt.Sprintf("\n❌ Could not determine your location: %v", err)))
 		return
 	}
-	peerID := "12D3KooWPlaceholderPeerID" + signer.PublicKey().String()[:10]
-	regionCode := uint8(0)
-	ipHash := sha256.Sum256([]byte("127.0.0.1"))
-	fmt.Println(promptStyle.Render(fmt.Sprintf("\nRegistering as Warden with %f %s...", stakeAmountFloat, stakeTokenStr)))
+	fmt.Println(infoStyle.Render(fmt.Sprintf("\n   Public IP:   %s", loc.IP)))
+	fmt.Println(infoStyle.Render(fmt.Sprintf("   Region:      %s (code %d)", loc.Region(), loc.RegionCode)))
+	if protocolConfig, err := client.FetchProtocolConfig(); err == nil {
+		fmt.Println(infoStyle.Render(fmt.Sprintf("   Geo premium: %.2f%%", float64(pricing.GeoPremiumBps(protocolConfig, loc.RegionCode))/100)))
+	}
+	fmt.Println(infoStyle.Render(fmt.Sprintf("   IP hash:     %x", loc.IPHash)))
+	proceed := false
+	survey.AskOne(&survey.Confirm{Message: "Register with this stake and location?", Default: true}, &proceed)
+	if !proceed {
+		return
+	}
+	// --- End Pre-flight ---
+
+	peerID, err := daemon.PeerID()
+	if err != nil {
+		fmt.Println(warningStyle.Render(fmt.Sprintf("\n❌ Failed to load node identity: %v", err)))
+		return
+	}
+	fmt.Println(promptStyle.Render(fmt.Sprintf("\nRegistering as Warden with %s %s...", arkham_protocol.FormatTokenAmount(stakeAmount, decimals), stakeTokenStr)))
 	fmt.Println(promptStyle.Render("Please wait..."))
 	sig, err := client.InitializeWarden(
 		stakeToken,
-		amountLamports,
-		peerID,
-		regionCode,
-		ipHash,
+		stakeAmount,
+		peerID.String(),
+		loc.RegionCode,
+		loc.IPHash,
 	)
 	if err != nil {
 		fmt.Println(warningStyle.Render(fmt.Sprintf("\n❌ Registration failed: %v", err)))
@@ -778,6 +876,13 @@ func openURL(url string) {
 	}
 }
 
+// printWarnings shows the accounts a partially failed fetch had to skip.
+func printWarnings(warnings []arkham_protocol.Warning) {
+	for _, w := range warnings {
+		fmt.Println(warningStyle.Render(fmt.Sprintf("⚠️  Skipped %s: %s: %s", w.Account, w.Message, w.Error)))
+	}
+}
+
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
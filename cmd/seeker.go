@@ -0,0 +1,340 @@
+package cmd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"arkham-cli/daemon"
+	"arkham-cli/node"
+	"arkham-cli/pricing"
+	"arkham-cli/proxy"
+	"arkham-cli/selection"
+	arkham_protocol "arkham-cli/solana"
+	"arkham-cli/storage"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	seekerProfile       string
+	seekerAuto          bool
+	seekerWarden        string
+	seekerRegion        string
+	seekerMaxPrice      uint64
+	seekerMinReputation float64
+	seekerMb            uint64
+	seekerProbeTimeout  time.Duration
+	seekerProxyListen   string
+)
+
+var seekerCmd = &cobra.Command{
+	Use:   "seeker",
+	Short: "Seeker commands.",
+}
+
+var seekerConnectCmd = &cobra.Command{
+	Use:   "connect",
+	Short: "Open a paid session with a warden, or pick the best one with --auto.",
+	Long: `Opens a paid session with a warden and routes local SOCKS5 and HTTP CONNECT traffic
+from --listen through it.
+
+The session tops up the escrow if it does not cover --mb, starts the on-chain connection,
+and then serves the proxy. It runs until Ctrl+C or until the MB paid for are used; the
+warden then submits a bandwidth proof for the traffic and the connection is ended, so the
+rest of the escrow is released. Connections left open by a session that did not exit
+cleanly are ended the next time a session starts or the daemon runs.
+
+With --auto, every registered warden that passes --region, --max-price and --min-reputation
+is pinged over libp2p and ranked by price, reputation, uptime, latency and load (see the
+selection package for the scoring function). The best warden is tried first; if the session
+cannot be negotiated the next candidate is used.`,
+	RunE: runSeekerConnect,
+}
+
+var seekerProxyCmd = &cobra.Command{
+	Use:   "proxy",
+	Short: "Route local SOCKS5 and HTTP CONNECT traffic through a warden without WireGuard.",
+	Long: `Listens on --listen for SOCKS5 and HTTP CONNECT clients and carries every flow as a
+libp2p stream to the warden on ` + node.ProtocolProxy + `. The warden dials the destination,
+subject to its exit policy. No root privileges are needed.
+
+The session is paid for and settled as with "seeker connect --warden".`,
+	RunE: runSeekerProxy,
+}
+
+func init() {
+	seekerConnectCmd.Flags().StringVar(&seekerProfile, "profile", "seeker", "wallet profile to pay from")
+	seekerConnectCmd.Flags().BoolVar(&seekerAuto, "auto", false, "select the warden automatically")
+	seekerConnectCmd.Flags().StringVar(&seekerWarden, "warden", "", "warden public key (without --auto)")
+	seekerConnectCmd.Flags().StringVar(&seekerRegion, "region", "", "only consider wardens in this region (us, eu, asia, latam, africa or a region code)")
+	seekerConnectCmd.Flags().Uint64Var(&seekerMaxPrice, "max-price", 0, "maximum rate in lamports per MB")
+	seekerConnectCmd.Flags().Float64Var(&seekerMinReputation, "min-reputation", 0, "minimum reputation (0-5)")
+	seekerConnectCmd.Flags().Uint64Var(&seekerMb, "mb", 0, "estimated MB for the connection (default: as much as the escrow covers)")
+	seekerConnectCmd.Flags().DurationVar(&seekerProbeTimeout, "probe-timeout", 15*time.Second, "how long to spend measuring warden latency")
+	seekerConnectCmd.Flags().StringVar(&seekerProxyListen, "listen", "127.0.0.1:1080", "local address for SOCKS5 and HTTP CONNECT clients")
+
+	seekerProxyCmd.Flags().StringVar(&seekerProfile, "profile", "seeker", "wallet profile to pay from")
+	seekerProxyCmd.Flags().StringVar(&seekerWarden, "warden", "", "warden public key to tunnel through")
+	seekerProxyCmd.Flags().Uint64Var(&seekerMb, "mb", 0, "estimated MB for the connection (default: as much as the escrow covers)")
+	seekerProxyCmd.Flags().DurationVar(&seekerProbeTimeout, "probe-timeout", 15*time.Second, "how long to wait for the warden")
+	seekerProxyCmd.Flags().StringVar(&seekerProxyListen, "listen", "127.0.0.1:1080", "local address for SOCKS5 and HTTP CONNECT clients")
+	seekerProxyCmd.MarkFlagRequired("warden")
+
+	seekerCmd.AddCommand(seekerConnectCmd)
+	seekerCmd.AddCommand(seekerProxyCmd)
+	rootCmd.AddCommand(seekerCmd)
+}
+
+func runSeekerConnect(cmd *cobra.Command, args []string) error {
+	if !seekerAuto && seekerWarden == "" {
+		return fmt.Errorf("either --warden or --auto is required")
+	}
+
+	db, err := storage.NewWalletStorage()
+	if err != nil {
+		return fmt.Errorf("failed to open wallet storage: %w", err)
+	}
+	signer, err := db.GetWallet(seekerProfile)
+	if err != nil {
+		return fmt.Errorf("failed to load profile '%s': %w", seekerProfile, err)
+	}
+	client, err := arkham_protocol.NewClient(GetRpcEndpoint(), signer)
+	if err != nil {
+		return fmt.Errorf("failed to create Solana client: %w", err)
+	}
+	protocolConfig, err := client.FetchProtocolConfig()
+	if err != nil {
+		return err
+	}
+	orchestrator := &daemon.Orchestrator{Client: client, Profile: seekerProfile}
+
+	// Listen before paying, so a busy port does not cost a connection.
+	l, err := net.Listen("tcp", seekerProxyListen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", seekerProxyListen, err)
+	}
+	defer l.Close()
+	serveErr := make(chan error, 1)
+
+	p2pNode, err := newEphemeralNode(client)
+	if err != nil {
+		return err
+	}
+	p2pNode.SeekerKey = ed25519.PrivateKey(signer)
+	if err := p2pNode.Start(); err != nil {
+		return fmt.Errorf("failed to start P2P node: %w", err)
+	}
+	defer p2pNode.Stop()
+
+	if !seekerAuto {
+		wardenAuthority, err := solana.PublicKeyFromBase58(seekerWarden)
+		if err != nil {
+			return fmt.Errorf("invalid warden public key: %w", err)
+		}
+		warden, err := client.FetchWardenByAuthority(wardenAuthority)
+		if err != nil {
+			return err
+		}
+		if err := negotiateSession(p2pNode, &selection.Candidate{Warden: warden}); err != nil {
+			return err
+		}
+		session, err := openProxySession(p2pNode, orchestrator, protocolConfig, warden, l, serveErr)
+		if err != nil {
+			return err
+		}
+		return runProxySession(session, serveErr)
+	}
+
+	criteria := selection.Criteria{
+		MaxRatePerMb:  seekerMaxPrice,
+		MinReputation: seekerMinReputation,
+	}
+	if seekerRegion != "" {
+		region, err := selection.ParseRegion(seekerRegion)
+		if err != nil {
+			return err
+		}
+		criteria.Region = &region
+	}
+
+	wardens, warnings, err := client.FetchAllWardens()
+	if err != nil {
+		return err
+	}
+	printWarnings(warnings)
+
+	// Rank once without latency to know which wardens are worth pinging.
+	eligible := selection.Rank(protocolConfig, wardens, criteria, nil)
+	if len(eligible) == 0 {
+		return fmt.Errorf("no warden matches the selection criteria")
+	}
+
+	fmt.Println(promptStyle.Render(fmt.Sprintf("Measuring latency to %d wardens...", len(eligible))))
+	probeWardens(p2pNode, eligible)
+
+	candidates := selection.Rank(protocolConfig, wardens, criteria, daemon.WardenQuality(p2pNode))
+
+	fmt.Println(titleStyle.Render("\n🔎 Warden ranking"))
+	for i, c := range candidates {
+		if i == 5 {
+			fmt.Printf("   ... and %d more\n", len(candidates)-i)
+			break
+		}
+		fmt.Printf("   %d. %s\n      %s\n", i+1, c.Warden.Authority, c.Explain())
+	}
+
+	var session *daemon.PaidSession
+	chosen, err := selection.Connect(candidates,
+		func(c *selection.Candidate) error {
+			fmt.Println(promptStyle.Render(fmt.Sprintf("\nTrying warden %s...", c.Warden.Authority)))
+			if err := negotiateSession(p2pNode, c); err != nil {
+				return err
+			}
+			session, err = openProxySession(p2pNode, orchestrator, protocolConfig, c.Warden, l, serveErr)
+			return err
+		},
+		func(c *selection.Candidate, err error) {
+			fmt.Println(warningStyle.Render(fmt.Sprintf("   Skipping %s: %v", c.Warden.Authority, err)))
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(infoStyle.Render(fmt.Sprintf("\nSelected %s because it had the best %s", chosen.Warden.Authority, chosen.Explain())))
+	return runProxySession(session, serveErr)
+}
+
+// probeWardens pings the wardens' peers concurrently until seekerProbeTimeout expires.
+func probeWardens(p2pNode *node.P2PNode, candidates []*selection.Candidate) {
+	ctx, cancel := context.WithTimeout(context.Background(), seekerProbeTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, c := range candidates {
+		id, err := peer.Decode(c.Warden.PeerId)
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p2pNode.ProbeLatency(ctx, id)
+		}()
+	}
+	wg.Wait()
+}
+
+// negotiateSession makes sure the warden is reachable over libp2p and that its peer controls
+// the Warden account before paying for a session.
+func negotiateSession(p2pNode *node.P2PNode, c *selection.Candidate) error {
+	id, err := peer.Decode(c.Warden.PeerId)
+	if err != nil {
+		return fmt.Errorf("warden has an invalid peer ID: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), seekerProbeTimeout)
+	defer cancel()
+	if _, err := p2pNode.ProbeLatency(ctx, id); err != nil {
+		return fmt.Errorf("warden is unreachable: %w", err)
+	}
+	if err := p2pNode.VerifyAuthority(ctx, id, c.Warden.Authority); err != nil {
+		return fmt.Errorf("warden failed identity verification: %w", err)
+	}
+	return nil
+}
+
+// proxyTransport carries a paid session's traffic as proxy streams to a single warden.
+type proxyTransport struct {
+	node   *node.P2PNode
+	warden peer.ID
+	server *proxy.Server
+}
+
+func (t *proxyTransport) BytesTransferred() uint64 {
+	return t.server.BytesTransferred()
+}
+
+func (t *proxyTransport) SendProof(ctx context.Context, hop int, proof node.BandwidthProof) error {
+	return t.node.SendProxyProof(ctx, t.warden, proof)
+}
+
+func (t *proxyTransport) Close() error {
+	return t.server.Close()
+}
+
+// openProxySession pays for a session with the warden and serves the local proxy on l
+// through it.
+func openProxySession(p2pNode *node.P2PNode, orchestrator *daemon.Orchestrator, protocolConfig *arkham_protocol.ProtocolConfig, warden *arkham_protocol.Warden, l net.Listener, serveErr chan<- error) (*daemon.PaidSession, error) {
+	wardenPeer, err := peer.Decode(warden.PeerId)
+	if err != nil {
+		return nil, fmt.Errorf("warden has an invalid peer ID: %w", err)
+	}
+	if seekerMb > 0 {
+		quote, err := pricing.QuoteConnection(protocolConfig, warden, seekerMb)
+		if err != nil {
+			return nil, err
+		}
+		printQuote(quote)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), seekerProbeTimeout)
+	defer cancel()
+	return orchestrator.Open(ctx, protocolConfig, []*arkham_protocol.Warden{warden}, seekerMb, func(ctx context.Context) (daemon.Transport, error) {
+		server := &proxy.Server{
+			Dial: func(ctx context.Context, addr string) (net.Conn, error) {
+				return p2pNode.DialProxy(ctx, wardenPeer, addr)
+			},
+		}
+		go func() { serveErr <- server.Serve(l) }()
+		return &proxyTransport{node: p2pNode, warden: wardenPeer, server: server}, nil
+	})
+}
+
+// runProxySession waits for Ctrl+C, the proxy to fail or the session to use the MB paid
+// for, and then settles the session: the warden submits the final proof before the
+// connection is ended.
+func runProxySession(session *daemon.PaidSession, serveErr <-chan error) error {
+	fmt.Println(titleStyle.Render("\n🧦 Proxy running"))
+	fmt.Printf("   SOCKS5:       socks5://%s\n", seekerProxyListen)
+	fmt.Printf("   HTTP CONNECT: http://%s\n", seekerProxyListen)
+	fmt.Printf("   Warden:       %s\n", session.Wardens[0].Authority)
+	fmt.Printf("   Paid for:     %d MB\n", session.Mb[0])
+	fmt.Println(promptStyle.Render("Press Ctrl+C to stop and settle."))
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	var err error
+	select {
+	case err = <-serveErr:
+	case <-session.Exhausted():
+		fmt.Println(warningStyle.Render("\nThe session used the MB paid for."))
+	case <-stop:
+	}
+
+	fmt.Println(promptStyle.Render("\nSettling the session..."))
+	transferred := session.Transport.BytesTransferred()
+	settlements := session.Close(context.Background())
+	fmt.Printf("   Transferred %d bytes\n", transferred)
+	for _, s := range settlements {
+		if s.Error != "" {
+			fmt.Println(warningStyle.Render(fmt.Sprintf("   %s: %d MB, %s", s.Warden, s.Mb, s.Error)))
+			continue
+		}
+		fmt.Println(infoStyle.Render(fmt.Sprintf("   %s: %d MB settled, connection ended", s.Warden, s.Mb)))
+	}
+	return err
+}
+
+func runSeekerProxy(cmd *cobra.Command, args []string) error {
+	seekerAuto = false
+	return runSeekerConnect(cmd, args)
+}
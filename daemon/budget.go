@@ -0,0 +1,188 @@
+package daemon
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"arkham-cli/budget"
+	ap "arkham-cli/solana"
+	"arkham-cli/storage"
+)
+
+// BudgetsDir is the directory in the config directory that holds the seekers' budgets.
+const BudgetsDir = "budgets"
+
+// budgetInterval is how often the daemon tops up escrows that fell below their floor.
+const budgetInterval = time.Minute
+
+// BudgetStatus is a profile's budget policy, its standing this month, and the balances
+// the policy acts on.
+type BudgetStatus struct {
+	Policy budget.Policy `json:"policy"`
+	Usage  budget.Usage  `json:"usage"`
+	Escrow uint64        `json:"escrow"`
+	Wallet uint64        `json:"wallet"`
+}
+
+func (o *Orchestrator) budgets() string {
+	if o.Budgets != "" {
+		return o.Budgets
+	}
+	return filepath.Join(storage.ConfigDir(), BudgetsDir)
+}
+
+// usage counts the month's spending of a seeker, starting a new month if one began. The
+// escrow its open Connections still hold is only looked up when the budget has a cap.
+func (o *Orchestrator) usage(b *budget.Budget, seeker *ap.Seeker) (budget.Usage, error) {
+	if b.Roll(time.Now(), seeker.TotalSpent) {
+		if err := b.Save(o.budgets(), o.Profile); err != nil {
+			return budget.Usage{}, err
+		}
+	}
+	var committed uint64
+	if b.MonthlyCap > 0 {
+		connections, warnings, err := o.Client.FetchMyConnections("seeker")
+		if err != nil {
+			return budget.Usage{}, err
+		}
+		logWarnings(o.log(), warnings)
+		for _, c := range connections {
+			committed += c.Account.AmountEscrowed - min(c.Account.AmountPaid, c.Account.AmountEscrowed)
+		}
+	}
+	return b.Usage(seeker.TotalSpent, committed), nil
+}
+
+// Budget returns the profile's budget status.
+func (o *Orchestrator) Budget() (*BudgetStatus, error) {
+	b, err := budget.Load(o.budgets(), o.Profile)
+	if err != nil {
+		return nil, err
+	}
+	seeker, err := o.Client.FetchSeekerAccount()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch seeker account: %w", err)
+	}
+	usage, err := o.usage(b, seeker)
+	if err != nil {
+		return nil, err
+	}
+	wallet, err := o.Client.GetBalance(o.Client.Signer.PublicKey())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch wallet balance: %w", err)
+	}
+	return &BudgetStatus{Policy: b.Policy, Usage: usage, Escrow: seeker.EscrowBalance, Wallet: wallet}, nil
+}
+
+// SetBudget replaces the profile's budget policy. The month's spending carries over.
+func (o *Orchestrator) SetBudget(p budget.Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	b, err := budget.Load(o.budgets(), o.Profile)
+	if err != nil {
+		return err
+	}
+	b.Policy = p
+	return b.Save(o.budgets(), o.Profile)
+}
+
+// Allow checks that a connection projected to cost cost lamports fits in the profile's
+// monthly budget. It is for connections started outside Open, which checks on its own.
+func (o *Orchestrator) Allow(cost uint64) error {
+	b, err := budget.Load(o.budgets(), o.Profile)
+	if err != nil || b.MonthlyCap == 0 {
+		return err
+	}
+	seeker, err := o.Client.FetchSeekerAccount()
+	if err != nil {
+		return fmt.Errorf("failed to fetch seeker account: %w", err)
+	}
+	usage, err := o.usage(b, seeker)
+	if err != nil {
+		return err
+	}
+	return b.Allow(usage, cost)
+}
+
+// TopUp deposits the budget's top-up when the escrow is below its floor, and returns the
+// amount deposited. The floor and top-ups apply to the public escrow.
+func (o *Orchestrator) TopUp() (uint64, error) {
+	b, err := budget.Load(o.budgets(), o.Profile)
+	if err != nil || b.EscrowFloor == 0 {
+		return 0, err
+	}
+	seeker, err := o.Client.FetchSeekerAccount()
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch seeker account: %w", err)
+	}
+	if seeker.EscrowBalance >= b.EscrowFloor {
+		return 0, nil
+	}
+	// A top-up is spending set aside, so it also has to fit in the month.
+	usage, err := o.usage(b, seeker)
+	if err != nil {
+		return 0, err
+	}
+	wallet, err := o.Client.GetBalance(o.Client.Signer.PublicKey())
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch wallet balance: %w", err)
+	}
+	amount, err := b.Deposit(seeker.EscrowBalance, wallet, 0)
+	if err != nil || amount == 0 {
+		return 0, err
+	}
+	if usage.Remaining != nil {
+		amount = min(amount, *usage.Remaining)
+		if amount == 0 {
+			return 0, budget.ErrOverBudget
+		}
+	}
+	if _, err := o.Client.DepositEscrow(amount, false); err != nil {
+		return 0, fmt.Errorf("failed to deposit %d lamports of escrow: %w", amount, err)
+	}
+	return amount, nil
+}
+
+// applyBudgets tops up the escrow of every profile whose budget has a floor, every
+// budgetInterval until the daemon closes.
+func (d *Daemon) applyBudgets() {
+	ticker := time.NewTicker(budgetInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		profiles, err := d.Wallets.GetAllWalletNames()
+		if err != nil {
+			d.log.Warn("failed to list profiles for escrow top-ups", "err", err)
+			continue
+		}
+		for _, profile := range profiles {
+			o, err := d.Orchestrator(profile)
+			if err != nil {
+				continue
+			}
+			amount, err := o.TopUp()
+			if err != nil {
+				d.log.Warn("escrow top-up refused", "profile", profile, "err", err)
+				continue
+			}
+			if amount > 0 {
+				d.log.Info("topped up escrow", "profile", profile, "lamports", amount)
+			}
+		}
+	}
+}
+
+// Orchestrator returns the session orchestrator of a profile.
+func (d *Daemon) Orchestrator(profile string) (*Orchestrator, error) {
+	client, err := d.ClientForProfile(profile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownProfile, profile)
+	}
+	return &Orchestrator{Client: client, Profile: profile, Logger: d.log}, nil
+}
@@ -0,0 +1,304 @@
+package daemon
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"time"
+
+	"arkham-cli/events"
+	"arkham-cli/node"
+	"arkham-cli/pricing"
+	"arkham-cli/selection"
+	ap "arkham-cli/solana"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	circuitBuildTimeout = 60 * time.Second
+	wardenVerifyTimeout = 10 * time.Second
+	proofAckTimeout     = 60 * time.Second
+	bytesPerMb          = 1024 * 1024
+)
+
+var (
+	ErrNodeNotRunning   = errors.New("P2P node is not running")
+	ErrSessionActive    = errors.New("a circuit is already active; disconnect first")
+	ErrNoSession        = errors.New("no active circuit")
+	ErrUnknownProfile   = errors.New("profile not found")
+	ErrNotEnoughWardens = errors.New("not enough available wardens")
+	ErrTooManyHops      = fmt.Errorf("a circuit has at most %d hops", MaxHops)
+)
+
+// MaxHops is the longest circuit Connect builds. Every hop adds a layer, a round trip and
+// an on-chain Connection to pay for.
+const MaxHops = 5
+
+// CircuitSession is a seeker circuit built by Connect. Every hop has its own on-chain
+// Connection, so every warden on the path is paid for the traffic it relayed.
+type CircuitSession struct {
+	Profile string
+	Circuit *node.Circuit
+	Wardens []*ap.Warden
+	Started time.Time
+
+	paid *PaidSession
+}
+
+// ConnectRequest asks the daemon to build a circuit.
+type ConnectRequest struct {
+	Profile string `json:"profile"`
+	Hops    int    `json:"hops"`
+	// Mb is the estimated MB per hop. Zero splits the escrow balance evenly across hops.
+	Mb uint64 `json:"mb"`
+}
+
+// ConnectResult describes the circuit Connect built.
+type ConnectResult struct {
+	Path    []string `json:"path"`
+	Wardens []string `json:"wardens"`
+}
+
+// HopSettlement is the outcome of settling one hop on disconnect.
+type HopSettlement struct {
+	Warden string `json:"warden"`
+	Mb     uint64 `json:"mb"`
+	Error  string `json:"error,omitempty"`
+}
+
+// SessionInfo summarises the daemon's seeker circuit for clients.
+type SessionInfo struct {
+	Profile string    `json:"profile"`
+	Path    []string  `json:"path"`
+	Wardens []string  `json:"wardens"`
+	Bytes   uint64    `json:"bytes"`
+	Started time.Time `json:"started"`
+}
+
+// verifyWarden checks that the warden's peer controls its on-chain authority before the
+// seeker pays it, and that the warden has room for another seeker. Wardens that do not
+// serve ProtocolInfo are assumed to have room.
+func (d *Daemon) verifyWarden(id peer.ID, warden *ap.Warden) error {
+	ctx, cancel := context.WithTimeout(d.ctx, wardenVerifyTimeout)
+	defer cancel()
+	if err := d.Node.VerifyAuthority(ctx, id, warden.Authority); err != nil {
+		return err
+	}
+	if caps, err := d.Node.Capabilities(ctx, id); err == nil && caps.AtCapacity() {
+		return fmt.Errorf("warden is serving its maximum of %d sessions", caps.MaxSessions)
+	}
+	return nil
+}
+
+// Connect ranks the registered wardens and picks the best req.Hops of them whose peers
+// prove they control the Warden account. It then funds the escrow, opens one on-chain
+// Connection per hop and builds the circuit through them. The circuit is disconnected by
+// itself once it has used the MB paid for.
+func (d *Daemon) Connect(req ConnectRequest) (*ConnectResult, error) {
+	if req.Profile == "" {
+		req.Profile = "seeker"
+	}
+	if req.Hops <= 0 {
+		req.Hops = 1
+	}
+	if req.Hops > MaxHops {
+		return nil, ErrTooManyHops
+	}
+
+	host := d.Node.GetHost()
+	if host == nil {
+		return nil, ErrNodeNotRunning
+	}
+
+	d.sessionMu.Lock()
+	defer d.sessionMu.Unlock()
+	if d.session != nil {
+		return nil, ErrSessionActive
+	}
+
+	client, err := d.ClientForProfile(req.Profile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownProfile, req.Profile)
+	}
+	protocolConfig, err := client.FetchProtocolConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch protocol config: %w", err)
+	}
+	wardens, warnings, err := client.FetchAllWardens()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch wardens: %w", err)
+	}
+	logWarnings(d.log, warnings)
+
+	candidates := selection.Rank(protocolConfig, wardens, selection.Criteria{}, WardenQuality(d.Node))
+
+	var path []peer.ID
+	var pathWardens []*ap.Warden
+	seen := map[peer.ID]bool{host.ID(): true}
+	for _, c := range candidates {
+		id, err := peer.Decode(c.Warden.PeerId)
+		if err != nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		if err := d.verifyWarden(id, c.Warden); err != nil {
+			d.log.Warn("skipping warden", "warden", c.Warden.Authority, "peer", id, "err", err)
+			continue
+		}
+		path = append(path, id)
+		pathWardens = append(pathWardens, c.Warden)
+		if len(path) == req.Hops {
+			break
+		}
+	}
+	if len(path) < req.Hops {
+		return nil, fmt.Errorf("%w for %d hops", ErrNotEnoughWardens, req.Hops)
+	}
+
+	ctx, cancel := context.WithTimeout(d.ctx, circuitBuildTimeout)
+	defer cancel()
+	orchestrator := &Orchestrator{Client: client, Profile: req.Profile, Logger: d.log}
+	var circuit *node.Circuit
+	paid, err := orchestrator.Open(ctx, protocolConfig, pathWardens, req.Mb, func(ctx context.Context) (Transport, error) {
+		var err error
+		if circuit, err = d.Node.BuildCircuit(ctx, path, ed25519.PrivateKey(client.Signer)); err != nil {
+			return nil, fmt.Errorf("failed to build circuit: %w", err)
+		}
+		return circuit, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	session := &CircuitSession{
+		Profile: req.Profile,
+		Circuit: circuit,
+		Wardens: pathWardens,
+		Started: paid.Started,
+		paid:    paid,
+	}
+	d.session = session
+	go d.watchSession(session)
+	d.Events.Publish(events.TypeSession, node.SessionEvent{
+		Role:  node.RoleSeeker,
+		Kind:  node.KindCircuit,
+		Peer:  path[len(path)-1].String(),
+		State: node.SessionStart,
+	})
+
+	result := &ConnectResult{}
+	for i, id := range path {
+		result.Path = append(result.Path, id.String())
+		result.Wardens = append(result.Wardens, pathWardens[i].Authority.String())
+	}
+	return result, nil
+}
+
+// Disconnect has every hop submit a bandwidth proof for the traffic of the active circuit,
+// closes it and ends the on-chain connections.
+func (d *Daemon) Disconnect() ([]HopSettlement, error) {
+	d.sessionMu.Lock()
+	session := d.session
+	d.session = nil
+	d.sessionMu.Unlock()
+	if session == nil {
+		return nil, ErrNoSession
+	}
+	return d.settle(session), nil
+}
+
+// settle closes a session that has been taken out of d.session.
+func (d *Daemon) settle(session *CircuitSession) []HopSettlement {
+	transferred := session.Circuit.BytesTransferred()
+	settlements := session.paid.Close(d.ctx)
+	d.Events.Publish(events.TypeSession, node.SessionEvent{
+		Role:  node.RoleSeeker,
+		Kind:  node.KindCircuit,
+		Peer:  session.Wardens[len(session.Wardens)-1].PeerId,
+		State: node.SessionStop,
+		Bytes: transferred,
+	})
+	return settlements
+}
+
+// watchSession settles the session once it has used the MB paid for or its circuit
+// collapses, unless it was disconnected first.
+func (d *Daemon) watchSession(session *CircuitSession) {
+	select {
+	case <-session.paid.Exhausted():
+		d.log.Info("circuit used the MB paid for; disconnecting")
+	case <-session.Circuit.Done():
+		d.log.Warn("circuit closed; settling its connections")
+	case <-d.ctx.Done():
+		return
+	}
+	d.sessionMu.Lock()
+	if d.session != session {
+		d.sessionMu.Unlock()
+		return
+	}
+	d.session = nil
+	d.sessionMu.Unlock()
+	d.settle(session)
+}
+
+// Sessions returns the daemon's active seeker circuit, if any.
+func (d *Daemon) Sessions() []SessionInfo {
+	d.sessionMu.Lock()
+	defer d.sessionMu.Unlock()
+	sessions := []SessionInfo{}
+	if d.session == nil {
+		return sessions
+	}
+	info := SessionInfo{
+		Profile: d.session.Profile,
+		Bytes:   d.session.Circuit.BytesTransferred(),
+		Started: d.session.Started,
+	}
+	for _, warden := range d.session.Wardens {
+		info.Path = append(info.Path, warden.PeerId)
+		info.Wardens = append(info.Wardens, warden.Authority.String())
+	}
+	return append(sessions, info)
+}
+
+// shareMb sizes a hop's connection so that all hops together cost at most funds lamports.
+func shareMb(protocolConfig *ap.ProtocolConfig, warden *ap.Warden, funds uint64, hops int) (uint64, error) {
+	mb, err := pricing.AffordableMb(protocolConfig, warden, funds/uint64(hops))
+	if err != nil {
+		return 0, err
+	}
+	if mb == 0 {
+		return 0, fmt.Errorf("escrow balance does not cover a single MB per hop")
+	}
+	return mb, nil
+}
+
+// recoverConnections ends the Connections that every profile left open when a session
+// exited without settling, so their escrow is released.
+func (d *Daemon) recoverConnections() {
+	profiles, err := d.Wallets.GetAllWalletNames()
+	if err != nil {
+		d.log.Warn("failed to list profiles for connection recovery", "err", err)
+		return
+	}
+	for _, profile := range profiles {
+		if d.ctx.Err() != nil {
+			return
+		}
+		orchestrator, err := d.Orchestrator(profile)
+		if err != nil {
+			continue
+		}
+		ended, err := orchestrator.Recover()
+		if err != nil {
+			d.log.Warn("failed to recover orphaned connections", "profile", profile, "err", err)
+			continue
+		}
+		if len(ended) > 0 {
+			d.log.Info("recovered orphaned connections", "profile", profile, "count", len(ended))
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+
+	"arkham-cli/node"
+)
+
+// Client talks to a running daemon over its control socket.
+type Client struct {
+	rpc *rpc.Client
+}
+
+// Dial connects to the daemon listening on the unix socket at path.
+func Dial(path string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("daemon is not running (no socket at %s): %w", path, err)
+	}
+	return &Client{rpc: jsonrpc.NewClient(conn)}, nil
+}
+
+// Close closes the connection to the daemon.
+func (c *Client) Close() error {
+	return c.rpc.Close()
+}
+
+func (c *Client) call(method string, args, reply any) error {
+	return c.rpc.Call(ServiceName+"."+method, args, reply)
+}
+
+// Status returns the node status.
+func (c *Client) Status() (node.NodeStatus, error) {
+	var status node.NodeStatus
+	err := c.call("Status", Empty{}, &status)
+	return status, err
+}
+
+// StartNode starts the daemon's P2P node.
+func (c *Client) StartNode() (node.NodeStatus, error) {
+	var status node.NodeStatus
+	err := c.call("StartNode", Empty{}, &status)
+	return status, err
+}
+
+// StopNode stops the daemon's P2P node.
+func (c *Client) StopNode() (node.NodeStatus, error) {
+	var status node.NodeStatus
+	err := c.call("StopNode", Empty{}, &status)
+	return status, err
+}
+
+// Peers lists the peers the daemon knows.
+func (c *Client) Peers() ([]node.PeerInfo, error) {
+	var peers []node.PeerInfo
+	err := c.call("Peers", Empty{}, &peers)
+	return peers, err
+}
+
+// Sessions lists the daemon's seeker circuits and served sessions.
+func (c *Client) Sessions() (SessionsReply, error) {
+	var reply SessionsReply
+	err := c.call("Sessions", Empty{}, &reply)
+	return reply, err
+}
+
+// Connect asks the daemon to build a seeker circuit.
+func (c *Client) Connect(req ConnectRequest) (ConnectResult, error) {
+	var result ConnectResult
+	err := c.call("Connect", req, &result)
+	return result, err
+}
+
+// Disconnect asks the daemon to settle and tear down its seeker circuit.
+func (c *Client) Disconnect() ([]HopSettlement, error) {
+	var settlements []HopSettlement
+	err := c.call("Disconnect", Empty{}, &settlements)
+	return settlements, err
+}
@@ -0,0 +1,466 @@
+// Package daemon owns the long-running parts of an Arkham node: the P2P node, seeker
+// circuit sessions, bandwidth proof submission and the on-chain account watchers.
+// `arkham-cli daemon` serves it on a local control socket, and the GUI embeds it.
+package daemon
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"arkham-cli/events"
+	"arkham-cli/journal"
+	"arkham-cli/metrics"
+	"arkham-cli/node"
+	"arkham-cli/policy"
+	"arkham-cli/selection"
+	ap "arkham-cli/solana"
+	"arkham-cli/storage"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Config holds the settings a daemon is created with.
+type Config struct {
+	RpcEndpoint string
+	WsEndpoint  string
+	// ExitPolicyPath is the exit policy file enforced when serving as a warden. Empty
+	// means no policy.
+	ExitPolicyPath string
+	// WardenProfile is the wallet profile that submits proofs for relayed traffic and that
+	// the node attests to over the identity handshake.
+	WardenProfile string
+	// ReputationProfile is the wallet profile that reports registered wardens' link quality
+	// on chain every hour. It must be the protocol's reputation updater. Empty disables
+	// reporting.
+	ReputationProfile string
+	// MetricsListen is the address to serve Prometheus metrics on. Empty disables them.
+	MetricsListen string
+	// Node is the node's networking config. When nil it is read from NodeConfigFile.
+	Node *node.Config
+	// Logger receives the daemon's diagnostics and is handed to the node, the exit policy
+	// and the Solana clients. When nil, slog.Default is used.
+	Logger *slog.Logger
+}
+
+// Files the daemon keeps in the config directory.
+const (
+	// IdentityFile holds the node's libp2p key, which fixes its peer ID.
+	IdentityFile = "node.key"
+	// NodeConfigFile holds the node's networking config.
+	NodeConfigFile = "node.json"
+	// AddrBookFile holds the last known addresses of registered wardens.
+	AddrBookFile = "peers.json"
+)
+
+const (
+	watcherRetryDelay        = 30 * time.Second
+	exitPolicyReloadInterval = 5 * time.Second
+)
+
+// Daemon is a running Arkham node and the state that goes with it.
+type Daemon struct {
+	Node     *node.P2PNode
+	Wallets  *storage.WalletStorage
+	ReadOnly *ap.Client
+	// Events carries node, session, transaction and chain events for live clients.
+	Events *events.Bus
+
+	cfg    Config
+	log    *slog.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	clientsMu sync.Mutex
+	clients   map[string]*ap.Client
+
+	sessionMu sync.Mutex
+	session   *CircuitSession
+
+	// journal records the warden's served sessions and the receipts it submits. It is
+	// nil if it could not be opened.
+	journal *journal.Journal
+
+	listenerMu sync.Mutex
+	listener   net.Listener
+}
+
+// New creates a daemon and starts its account watchers. The P2P node is created but not
+// started; call StartNode.
+func New(cfg Config) (*Daemon, error) {
+	if cfg.WardenProfile == "" {
+		cfg.WardenProfile = "warden"
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	if cfg.MetricsListen != "" {
+		ap.RPCTransport = metrics.RPCTransport(nil)
+	}
+	wallets, err := storage.NewWalletStorage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open wallet storage: %w", err)
+	}
+	readOnly, err := ap.NewReadOnlyClient(cfg.RpcEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create solana client: %w", err)
+	}
+	readOnly.Logger = cfg.Logger.With("component", "solana")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Daemon{
+		Node:     node.NewP2PNode(),
+		Wallets:  wallets,
+		ReadOnly: readOnly,
+		Events:   events.NewBus(events.DefaultBacklog),
+		cfg:      cfg,
+		log:      cfg.Logger,
+		ctx:      ctx,
+		cancel:   cancel,
+		clients:  make(map[string]*ap.Client),
+	}
+	identity, err := LoadIdentity()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	d.Node.Identity = identity
+	if signer, err := wallets.GetWallet(cfg.WardenProfile); err == nil {
+		d.Node.SetAuthorityKey(ed25519.PrivateKey(signer))
+		// Only a warden serves as an exit. One created later becomes an exit when the
+		// daemon restarts.
+		d.Node.Relay.Authorize = d.authorizeSeeker
+	}
+	nodeCfg := cfg.Node
+	if nodeCfg == nil {
+		loaded, err := LoadNodeConfig()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		nodeCfg = &loaded
+	}
+	if err := d.Node.SetConfig(*nodeCfg); err != nil {
+		cancel()
+		return nil, fmt.Errorf("invalid node config: %w", err)
+	}
+	d.Node.ChainPeers = WardenPeers(readOnly, d.log)
+	d.Node.AddrBook = filepath.Join(storage.ConfigDir(), AddrBookFile)
+	d.Node.Advertise = d.advertise
+	d.Node.Relay.OnProof = d.submitRelayedProof
+	d.Node.Events = d.Events
+	d.Node.Logger = cfg.Logger.With("component", "node")
+
+	if cfg.ExitPolicyPath != "" {
+		exitPolicy, err := policy.LoadEngine(cfg.ExitPolicyPath)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		exitPolicy.Logger = cfg.Logger.With("component", "policy")
+		go exitPolicy.Watch(ctx, exitPolicyReloadInterval)
+		d.Node.Relay.Policy = exitPolicy
+		d.Node.Relay.SeekerTier = d.seekerTier
+		d.log.Info("enforcing exit policy", "path", cfg.ExitPolicyPath)
+	}
+
+	protocolConfigPDA, _, err := readOnly.GetProtocolConfigPDA()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to derive protocol config PDA: %w", err)
+	}
+	d.journal, err = journal.Open(filepath.Join(storage.ConfigDir(), SessionsDir, cfg.WardenProfile+".warden.journal"))
+	if err != nil {
+		d.log.Warn("warden journal is unavailable; receipts will not survive a restart", "err", err)
+	}
+	pending := d.replayJournal()
+
+	go d.watchAccounts(readOnly, protocolConfigPDA)
+	if len(pending) > 0 {
+		go d.resubmitReceipts(pending)
+	}
+	go d.publishSessionProgress()
+	go d.watchEgress()
+	go d.recoverConnections()
+	go d.applyBudgets()
+	if cfg.ReputationProfile != "" {
+		go d.reportReputation()
+	}
+	if cfg.MetricsListen != "" {
+		go d.serveMetrics(cfg.MetricsListen)
+	}
+
+	return d, nil
+}
+
+// Context is cancelled when the daemon closes.
+func (d *Daemon) Context() context.Context {
+	return d.ctx
+}
+
+// Close tears down the active circuit session, stops the node and the account watchers.
+func (d *Daemon) Close() error {
+	if _, err := d.Disconnect(); err != nil && err != ErrNoSession {
+		d.log.Error("failed to tear down circuit on shutdown", "err", err)
+	}
+	d.cancel()
+	d.listenerMu.Lock()
+	if d.listener != nil {
+		d.listener.Close()
+	}
+	d.listenerMu.Unlock()
+	err := d.Node.Stop()
+	if d.journal != nil {
+		d.journal.Close()
+	}
+	return err
+}
+
+// LoadIdentity reads the node's libp2p key from the config directory, creating it on first
+// use. Registration publishes the peer ID it fixes.
+func LoadIdentity() (crypto.PrivKey, error) {
+	return node.LoadIdentity(filepath.Join(storage.ConfigDir(), IdentityFile))
+}
+
+// PeerID returns the node's persistent peer ID, the one wardens register on chain.
+func PeerID() (peer.ID, error) {
+	identity, err := LoadIdentity()
+	if err != nil {
+		return "", err
+	}
+	return peer.IDFromPrivateKey(identity)
+}
+
+// LoadNodeConfig reads the node config saved in the config directory.
+func LoadNodeConfig() (node.Config, error) {
+	return node.LoadConfig(filepath.Join(storage.ConfigDir(), NodeConfigFile))
+}
+
+// SetNodeConfig validates and saves the node's networking config. It applies the next time
+// the node starts.
+func (d *Daemon) SetNodeConfig(cfg node.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if err := node.SaveConfig(filepath.Join(storage.ConfigDir(), NodeConfigFile), cfg); err != nil {
+		return err
+	}
+	return d.Node.SetConfig(cfg)
+}
+
+// StartNode starts the P2P node if it is not running.
+func (d *Daemon) StartNode() (node.NodeStatus, error) {
+	if err := d.Node.Start(); err != nil {
+		return node.NodeStatus{}, fmt.Errorf("failed to start P2P node: %w", err)
+	}
+	return d.Node.Status(), nil
+}
+
+// StopNode stops the P2P node if it is running.
+func (d *Daemon) StopNode() (node.NodeStatus, error) {
+	if err := d.Node.Stop(); err != nil {
+		return node.NodeStatus{}, fmt.Errorf("failed to stop P2P node: %w", err)
+	}
+	return d.Node.Status(), nil
+}
+
+// ClientForProfile returns the long-lived client for a wallet profile, creating it and
+// starting its account watcher on first use.
+func (d *Daemon) ClientForProfile(profileName string) (*ap.Client, error) {
+	d.clientsMu.Lock()
+	defer d.clientsMu.Unlock()
+
+	if client, ok := d.clients[profileName]; ok {
+		return client, nil
+	}
+
+	signer, err := d.Wallets.GetWallet(profileName)
+	if err != nil {
+		return nil, err
+	}
+	client, err := ap.NewClient(d.cfg.RpcEndpoint, signer)
+	if err != nil {
+		return nil, err
+	}
+	client.Logger = d.log.With("component", "solana", "profile", profileName)
+	client.OnTransaction = func(sig solana.Signature) {
+		go d.trackTransaction(profileName, client, sig)
+	}
+	d.clients[profileName] = client
+	if profileName == d.cfg.WardenProfile {
+		// The warden may have been created after the daemon started.
+		d.Node.SetAuthorityKey(ed25519.PrivateKey(signer))
+	}
+
+	wardenPDA, _, err := client.GetWardenPDA()
+	if err != nil {
+		return nil, err
+	}
+	seekerPDA, _, err := ap.GetSeekerPDA(signer.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	go d.watchAccounts(client, wardenPDA, seekerPDA)
+	go d.watchTransactions(profileName, client)
+
+	return client, nil
+}
+
+// WardenPeers returns a node.P2PNode.ChainPeers source listing the peer IDs the wardens
+// registered, skipping any that do not decode.
+func WardenPeers(client *ap.Client, logger *slog.Logger) func(context.Context) ([]peer.ID, error) {
+	return func(ctx context.Context) ([]peer.ID, error) {
+		wardens, warnings, err := client.FetchAllWardens()
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch wardens: %w", err)
+		}
+		logWarnings(logger, warnings)
+		ids := make([]peer.ID, 0, len(wardens))
+		for _, w := range wardens {
+			if id, err := peer.Decode(w.PeerId); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		return ids, nil
+	}
+}
+
+// WardenQuality returns a selection.QualityFunc reading the link quality the node measured
+// to wardens' peers.
+func WardenQuality(n *node.P2PNode) selection.QualityFunc {
+	return func(peerID string) (selection.Quality, bool) {
+		id, err := peer.Decode(peerID)
+		if err != nil {
+			return selection.Quality{}, false
+		}
+		q, ok := n.PeerQuality(id)
+		if !ok || !q.Answered() {
+			return selection.Quality{}, false
+		}
+		return selection.Quality{RTT: q.RTT, Jitter: q.Jitter, Loss: q.Loss}, true
+	}
+}
+
+// logWarnings logs the accounts a partially failed fetch had to skip.
+func logWarnings(logger *slog.Logger, warnings []ap.Warning) {
+	for _, w := range warnings {
+		logger.Warn(w.Message, "account", w.Account, "err", w.Error)
+	}
+}
+
+// watchAccounts keeps the shared account cache fresh from websocket notifications,
+// reconnecting after failures until the daemon closes.
+func (d *Daemon) watchAccounts(client *ap.Client, keys ...solana.PublicKey) {
+	for {
+		err := client.WatchAccounts(d.ctx, d.cfg.WsEndpoint, keys...)
+		if d.ctx.Err() != nil {
+			return
+		}
+		d.log.Warn("account watcher stopped", "retryIn", watcherRetryDelay, "err", err)
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-time.After(watcherRetryDelay):
+		}
+	}
+}
+
+// submitRelayedProof submits a proof a seeker sent through a circuit or proxy, as the local
+// warden.
+func (d *Daemon) submitRelayedProof(seeker peer.ID, proof node.BandwidthProof) error {
+	client, err := d.ClientForProfile(d.cfg.WardenProfile)
+	if err != nil {
+		metrics.Proofs.WithLabelValues(metrics.ProofFailed).Inc()
+		return fmt.Errorf("no warden profile on this node")
+	}
+	if err := d.checkReceipt(client, proof); err != nil {
+		metrics.Proofs.WithLabelValues(metrics.ProofRejected).Inc()
+		d.log.Warn("dropping relayed bandwidth proof", "seeker", seeker, "err", err)
+		return err
+	}
+	// The receipt is journaled before it is submitted, so a restart can still claim it.
+	receipt := &journal.Receipt{
+		Seeker:    solana.PublicKeyFromBytes(proof.Seeker[:]).String(),
+		Warden:    client.Signer.PublicKey().String(),
+		Mb:        proof.MbConsumed,
+		Timestamp: proof.Timestamp,
+		Signature: proof.Signature[:],
+	}
+	if err := d.appendJournal(journal.Record{Kind: journal.KindReceipt, Peer: seeker.String(), Receipt: receipt}); err != nil {
+		metrics.Proofs.WithLabelValues(metrics.ProofFailed).Inc()
+		return err
+	}
+	sig, err := client.SubmitBandwidthProof(
+		proof.MbConsumed,
+		solana.PublicKeyFromBytes(proof.Seeker[:]),
+		solana.SignatureFromBytes(proof.Signature[:]),
+		proof.Timestamp,
+	)
+	if err != nil {
+		metrics.Proofs.WithLabelValues(metrics.ProofFailed).Inc()
+		d.log.Error("failed to submit relayed bandwidth proof", "seeker", seeker, "err", err)
+		return err
+	}
+	metrics.Proofs.WithLabelValues(metrics.ProofSubmitted).Inc()
+	d.appendJournal(journal.Record{Kind: journal.KindSubmitted, Receipt: receipt, Transaction: sig.String()})
+	return nil
+}
+
+// ErrInvalidReceipt drops a bandwidth proof that the seeker it names did not sign.
+var ErrInvalidReceipt = errors.New("bandwidth proof is not signed by the seeker's wallet")
+
+// checkReceipt accepts a relayed proof only for a seeker with a Connection to this warden,
+// and only when the seeker's wallet signed it for that Connection.
+func (d *Daemon) checkReceipt(client *ap.Client, proof node.BandwidthProof) error {
+	seeker := solana.PublicKeyFromBytes(proof.Seeker[:])
+	connection, err := client.FetchConnection(seeker, client.Signer.PublicKey())
+	if err != nil {
+		return fmt.Errorf("failed to look up the seeker's connection: %w", err)
+	}
+	if connection == nil {
+		return ErrNoConnection
+	}
+	if !ap.VerifyBandwidthProofSignature(seeker, client.Signer.PublicKey(), proof.MbConsumed, proof.Timestamp, solana.SignatureFromBytes(proof.Signature[:])) {
+		return ErrInvalidReceipt
+	}
+	return nil
+}
+
+// ErrNoConnection refuses exit traffic to a seeker without an active Connection with the
+// warden.
+var ErrNoConnection = errors.New("seeker has no active connection with this warden")
+
+// authorizeSeeker admits a seeker to the warden's exit while its wallet holds a Connection
+// with the warden that still has escrow to pay for traffic.
+func (d *Daemon) authorizeSeeker(seeker peer.ID, authority [32]byte) error {
+	client, err := d.ClientForProfile(d.cfg.WardenProfile)
+	if err != nil {
+		return fmt.Errorf("no warden profile on this node")
+	}
+	connection, err := client.FetchConnection(solana.PublicKeyFromBytes(authority[:]), client.Signer.PublicKey())
+	if err != nil {
+		d.log.Warn("failed to look up seeker connection", "seeker", seeker, "err", err)
+		return fmt.Errorf("failed to look up the seeker's connection")
+	}
+	if connection == nil || connection.AmountPaid >= connection.AmountEscrowed {
+		return ErrNoConnection
+	}
+	return nil
+}
+
+// seekerTier maps a seeker's on-chain premium status to its exit policy tier.
+func (d *Daemon) seekerTier(authority [32]byte) string {
+	seeker, err := d.ReadOnly.FetchSeekerByAuthority(solana.PublicKeyFromBytes(authority[:]))
+	if err != nil || seeker.PremiumExpiresAt == nil || *seeker.PremiumExpiresAt < time.Now().Unix() {
+		return policy.TierStandard
+	}
+	return policy.TierPremium
+}
@@ -0,0 +1,87 @@
+package daemon
+
+import (
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"arkham-cli/internal/solanatest"
+	"arkham-cli/journal"
+	"arkham-cli/node"
+	ap "arkham-cli/solana"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestSubmitRelayedProofDropsInvalidReceipts(t *testing.T) {
+	chain := solanatest.NewServer(t)
+	warden := solana.NewWallet().PrivateKey
+	seeker := chain.Client(solana.NewWallet().PrivateKey)
+	stranger := chain.Client(solana.NewWallet().PrivateKey)
+
+	seekerPDA, _, _ := ap.GetSeekerPDA(seeker.Signer.PublicKey())
+	wardenPDA, _, _ := ap.GetWardenPDAForAuthority(warden.PublicKey())
+	connectionPDA, _, _ := ap.GetConnectionPDA(seekerPDA, wardenPDA)
+	chain.SetProgramAccount(connectionPDA, ap.Account_Connection, ap.Connection{
+		Seeker:         seekerPDA,
+		Warden:         wardenPDA,
+		AmountEscrowed: 1000,
+	})
+
+	j, err := journal.Open(filepath.Join(t.TempDir(), "journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { j.Close() })
+	d := &Daemon{
+		cfg:     Config{WardenProfile: "warden"},
+		log:     slog.Default(),
+		clients: map[string]*ap.Client{"warden": chain.Client(warden)},
+		journal: j,
+	}
+
+	now := time.Now().Unix()
+	proof := func(signer *ap.Client, seeker solana.PublicKey, signedMb, mb uint64, wardenKey solana.PublicKey) node.BandwidthProof {
+		t.Helper()
+		sig, err := signer.GenerateBandwidthProofSignature(wardenKey, signedMb, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return node.BandwidthProof{MbConsumed: mb, Timestamp: now, Seeker: seeker, Signature: sig}
+	}
+	self := seeker.Signer.PublicKey()
+	otherWarden := solana.NewWallet().PublicKey()
+
+	for _, tt := range []struct {
+		name  string
+		proof node.BandwidthProof
+		err   error
+	}{
+		{"signed by another wallet", proof(stranger, self, 5, 5, warden.PublicKey()), ErrInvalidReceipt},
+		{"tampered MB", proof(seeker, self, 5, 50, warden.PublicKey()), ErrInvalidReceipt},
+		{"signed for another warden", proof(seeker, self, 5, 5, otherWarden), ErrInvalidReceipt},
+		{"no connection", proof(stranger, stranger.Signer.PublicKey(), 5, 5, warden.PublicKey()), ErrNoConnection},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := d.submitRelayedProof(peer.ID("seeker"), tt.proof); err != tt.err {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+		})
+	}
+	if n := len(chain.Transactions()); n != 0 {
+		t.Fatalf("submitted %d invalid receipts", n)
+	}
+	if pending := j.Pending(); len(pending) != 0 {
+		t.Fatalf("journaled invalid receipts %+v", pending)
+	}
+
+	if err := d.submitRelayedProof(peer.ID("seeker"), proof(seeker, self, 5, 5, warden.PublicKey())); err != nil {
+		t.Fatal(err)
+	}
+	instructions := chain.ProgramInstructions()
+	if len(instructions) != 1 || !instructions[0].Is(ap.Instruction_SubmitBandwidthProof) {
+		t.Fatalf("sent %+v, want one bandwidth proof", instructions)
+	}
+}
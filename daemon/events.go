@@ -0,0 +1,147 @@
+package daemon
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"arkham-cli/events"
+	"arkham-cli/journal"
+	"arkham-cli/node"
+	ap "arkham-cli/solana"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+const (
+	sessionProgressInterval = 2 * time.Second
+	confirmationTimeout     = 90 * time.Second
+	chainEventTimeout       = 30 * time.Second
+)
+
+// Transaction statuses.
+const (
+	TxSent      = "sent"
+	TxConfirmed = "confirmed"
+	TxFailed    = "failed"
+)
+
+// TransactionEvent reports the progress of a transaction a profile sent.
+type TransactionEvent struct {
+	Signature string `json:"signature"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ChainEvent carries the events decoded from a confirmed transaction that mentions a
+// profile's wallet.
+type ChainEvent struct {
+	Signature string            `json:"signature"`
+	Events    *ap.HistoryResult `json:"events"`
+}
+
+// publishSessionProgress reports the byte counters of active sessions every
+// sessionProgressInterval, for the sessions whose counters moved.
+func (d *Daemon) publishSessionProgress() {
+	ticker := time.NewTicker(sessionProgressInterval)
+	defer ticker.Stop()
+
+	last := make(map[string]uint64)
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current := make(map[string]uint64)
+		for _, s := range d.Node.ServedSessions() {
+			key := s.Kind + "/" + s.Peer
+			current[key] = s.Bytes
+			if _, ok := last[key]; !ok {
+				d.appendJournal(journal.Record{Kind: journal.KindOpen, Session: key, Peer: s.Peer})
+			}
+			if last[key] != s.Bytes {
+				d.appendJournal(journal.Record{Kind: journal.KindBytes, Session: key, Bytes: s.Bytes})
+				d.Events.Publish(events.TypeSession, node.SessionEvent{
+					Role:  node.RoleWarden,
+					Kind:  s.Kind,
+					Peer:  s.Peer,
+					State: node.SessionProgress,
+					Bytes: s.Bytes,
+				})
+			}
+		}
+		for _, s := range d.Sessions() {
+			exit := s.Path[len(s.Path)-1]
+			key := node.RoleSeeker + "/" + exit
+			current[key] = s.Bytes
+			if last[key] != s.Bytes {
+				d.Events.Publish(events.TypeSession, node.SessionEvent{
+					Role:  node.RoleSeeker,
+					Kind:  "circuit",
+					Peer:  exit,
+					State: node.SessionProgress,
+					Bytes: s.Bytes,
+				})
+			}
+		}
+		for key := range last {
+			if _, ok := current[key]; !ok && !strings.HasPrefix(key, node.RoleSeeker+"/") {
+				d.appendJournal(journal.Record{Kind: journal.KindClose, Session: key})
+			}
+		}
+		last = current
+	}
+}
+
+// trackTransaction reports a sent transaction and then whether it was confirmed.
+func (d *Daemon) trackTransaction(profile string, client *ap.Client, sig solana.Signature) {
+	d.Events.PublishProfile(profile, events.TypeTransaction, TransactionEvent{Signature: sig.String(), Status: TxSent})
+
+	ctx, cancel := context.WithTimeout(d.ctx, confirmationTimeout)
+	defer cancel()
+	event := TransactionEvent{Signature: sig.String(), Status: TxConfirmed}
+	if err := client.AwaitConfirmation(ctx, sig); err != nil {
+		if d.ctx.Err() != nil {
+			return
+		}
+		event.Status = TxFailed
+		event.Error = err.Error()
+	}
+	d.Events.PublishProfile(profile, events.TypeTransaction, event)
+}
+
+// watchTransactions decodes the confirmed transactions that mention a profile's wallet and
+// publishes their events, reconnecting after failures until the daemon closes.
+func (d *Daemon) watchTransactions(profile string, client *ap.Client) {
+	self := client.Signer.PublicKey()
+	for {
+		err := client.WatchTransactions(d.ctx, d.cfg.WsEndpoint, self, func(sig solana.Signature) {
+			go d.publishChainEvents(profile, client, sig)
+		})
+		if d.ctx.Err() != nil {
+			return
+		}
+		d.log.Warn("transaction watcher stopped", "profile", profile, "retryIn", watcherRetryDelay, "err", err)
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-time.After(watcherRetryDelay):
+		}
+	}
+}
+
+func (d *Daemon) publishChainEvents(profile string, client *ap.Client, sig solana.Signature) {
+	ctx, cancel := context.WithTimeout(d.ctx, chainEventTimeout)
+	defer cancel()
+	decoded, err := client.TransactionEvents(ctx, sig, client.Signer.PublicKey())
+	if err != nil {
+		d.log.Warn("failed to decode transaction", "signature", sig, "err", err)
+		return
+	}
+	if len(decoded.SolHistory)+len(decoded.ArkhamHistory)+len(decoded.ConnectionHistory)+len(decoded.ThroughputHistory) == 0 {
+		return
+	}
+	d.Events.PublishProfile(profile, events.TypeChain, ChainEvent{Signature: sig.String(), Events: decoded})
+}
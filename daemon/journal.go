@@ -0,0 +1,84 @@
+package daemon
+
+import (
+	"arkham-cli/journal"
+	"arkham-cli/metrics"
+	ap "arkham-cli/solana"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// appendJournal writes a record to the warden journal, if there is one.
+func (d *Daemon) appendJournal(r journal.Record) error {
+	if d.journal == nil {
+		return nil
+	}
+	if err := d.journal.Append(r); err != nil {
+		d.log.Error("failed to write warden journal", "kind", r.Kind, "err", err)
+		return err
+	}
+	return nil
+}
+
+// replayJournal closes the served sessions a previous run left in the warden journal and
+// returns the receipts it did not get on chain.
+func (d *Daemon) replayJournal() []journal.Pending {
+	if d.journal == nil {
+		return nil
+	}
+	for _, s := range d.journal.Sessions() {
+		d.log.Info("served session was interrupted by a restart", "session", s.ID, "bytes", s.Bytes, "opened", s.Opened)
+		d.appendJournal(journal.Record{Kind: journal.KindClose, Session: s.ID})
+	}
+	return d.journal.Pending()
+}
+
+// resubmitReceipts reconciles receipts from before a restart against their Connection's
+// proofs, and submits those that are missing while the Connection is still open.
+func (d *Daemon) resubmitReceipts(pending []journal.Pending) {
+	client, err := d.ClientForProfile(d.cfg.WardenProfile)
+	if err != nil {
+		d.log.Warn("cannot resubmit journaled receipts without the warden profile", "profile", d.cfg.WardenProfile, "receipts", len(pending))
+		return
+	}
+	for _, p := range pending {
+		if d.ctx.Err() != nil {
+			return
+		}
+		if err := d.resubmitReceipt(client, p); err != nil {
+			d.log.Warn("failed to resubmit journaled receipt; it is retried on the next start", "seeker", p.Seeker, "mb", p.Mb, "err", err)
+		}
+	}
+}
+
+func (d *Daemon) resubmitReceipt(client *ap.Client, p journal.Pending) error {
+	receipt := p.Receipt
+	if receipt.Warden != client.Signer.PublicKey().String() {
+		d.log.Warn("journaled receipt belongs to another warden", "warden", receipt.Warden)
+		return d.appendJournal(journal.Record{Kind: journal.KindAbandoned, Receipt: &receipt})
+	}
+	seeker, err := solana.PublicKeyFromBase58(receipt.Seeker)
+	if err != nil {
+		return d.appendJournal(journal.Record{Kind: journal.KindAbandoned, Receipt: &receipt})
+	}
+	connection, err := client.FetchConnection(seeker, client.Signer.PublicKey())
+	if err != nil {
+		return err
+	}
+	if connection == nil {
+		d.log.Warn("connection ended before a journaled receipt was submitted", "seeker", seeker, "mb", receipt.Mb)
+		return d.appendJournal(journal.Record{Kind: journal.KindAbandoned, Receipt: &receipt})
+	}
+	if hasProof(connection, receipt.Signature) {
+		return d.appendJournal(journal.Record{Kind: journal.KindSubmitted, Receipt: &receipt})
+	}
+
+	sig, err := client.SubmitBandwidthProof(receipt.Mb, seeker, solana.SignatureFromBytes(receipt.Signature), receipt.Timestamp)
+	if err != nil {
+		metrics.Proofs.WithLabelValues(metrics.ProofFailed).Inc()
+		return err
+	}
+	metrics.Proofs.WithLabelValues(metrics.ProofSubmitted).Inc()
+	d.log.Info("resubmitted journaled receipt", "seeker", seeker, "mb", receipt.Mb, "signature", sig)
+	return d.appendJournal(journal.Record{Kind: journal.KindSubmitted, Receipt: &receipt, Transaction: sig.String()})
+}
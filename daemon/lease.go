@@ -0,0 +1,94 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// leaseTimeout is how long a session lease stays live without a heartbeat. Connections
+// named by an expired lease are orphans: the process that opened them is gone.
+const leaseTimeout = 3 * time.Minute
+
+// sessionLease records which wardens a running seeker session holds Connections with, so
+// that recovery in another process leaves them alone.
+type sessionLease struct {
+	Wardens   []solana.PublicKey `json:"wardens"`
+	Heartbeat time.Time          `json:"heartbeat"`
+}
+
+func leasePath(dir, profile string) string {
+	return filepath.Join(dir, profile+".json")
+}
+
+// live reports whether the lease was refreshed recently enough to belong to a running
+// session.
+func (l *sessionLease) live(now time.Time) bool {
+	return l != nil && now.Sub(l.Heartbeat) < leaseTimeout
+}
+
+func (l *sessionLease) holds(warden solana.PublicKey) bool {
+	for _, w := range l.Wardens {
+		if w == warden {
+			return true
+		}
+	}
+	return false
+}
+
+// loadLease reads a profile's lease. A missing file is no lease.
+func loadLease(dir, profile string) (*sessionLease, error) {
+	data, err := os.ReadFile(leasePath(dir, profile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session lease: %w", err)
+	}
+	var l sessionLease
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("failed to parse session lease: %w", err)
+	}
+	return &l, nil
+}
+
+// save writes the lease to a temporary file and renames it into place, so recovery never
+// reads a partial lease.
+func (l *sessionLease) save(dir, profile string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to save session lease: %w", err)
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".lease-*")
+	if err != nil {
+		return fmt.Errorf("failed to save session lease: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save session lease: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save session lease: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), leasePath(dir, profile)); err != nil {
+		return fmt.Errorf("failed to save session lease: %w", err)
+	}
+	return nil
+}
+
+func removeLease(dir, profile string) error {
+	err := os.Remove(leasePath(dir, profile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"time"
+
+	"arkham-cli/geo"
+	"arkham-cli/node"
+	"arkham-cli/pricing"
+	"arkham-cli/selection"
+)
+
+const egressCheckInterval = 10 * time.Minute
+
+var ErrPublicIPUnknown = errors.New("public IP unknown: start the node and wait for peers to observe it, or set publicIp in the node config")
+
+// Location resolves the region code and IP hash a warden registers from the node's egress IP.
+func (d *Daemon) Location() (geo.Location, error) {
+	ip, ok := d.Node.PublicIP()
+	if !ok {
+		return geo.Location{}, ErrPublicIPUnknown
+	}
+	return geo.Locate(ip)
+}
+
+// watchEgress warns when the node's egress IP no longer matches the IP hash the warden
+// registered, once per new IP.
+func (d *Daemon) watchEgress() {
+	ticker := time.NewTicker(egressCheckInterval)
+	defer ticker.Stop()
+
+	var warned netip.Addr
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		loc, err := d.Location()
+		if err != nil {
+			continue
+		}
+		signer, err := d.Wallets.GetWallet(d.cfg.WardenProfile)
+		if err != nil {
+			continue
+		}
+		warden, err := d.ReadOnly.FetchWardenByAuthority(signer.PublicKey())
+		if err != nil {
+			continue
+		}
+		if warden.IpHash == loc.IPHash {
+			warned = netip.Addr{}
+			continue
+		}
+		if loc.IP == warned {
+			continue
+		}
+		warned = loc.IP
+		d.log.Warn("egress IP does not match the registered IP hash; seekers may see a different location than advertised",
+			"ip", loc.IP, "region", loc.Region(), "registeredRegion", selection.RegionName(warden.RegionCode))
+	}
+}
+
+// advertise adds the warden's region and effective price to the node's capability
+// document. A registered warden advertises its on-chain region; otherwise the region comes
+// from the egress IP.
+func (d *Daemon) advertise(ctx context.Context, c *node.Capabilities) {
+	if loc, err := d.Location(); err == nil {
+		c.Region = loc.Region()
+	}
+	signer, err := d.Wallets.GetWallet(d.cfg.WardenProfile)
+	if err != nil {
+		return
+	}
+	warden, err := d.ReadOnly.FetchWardenByAuthority(signer.PublicKey())
+	if err != nil {
+		return
+	}
+	c.Region = selection.RegionName(warden.RegionCode)
+	protocolConfig, err := d.ReadOnly.FetchProtocolConfig()
+	if err != nil {
+		return
+	}
+	if rate, err := pricing.RatePerMb(protocolConfig, warden); err == nil {
+		c.RatePerMb = rate
+	}
+}
@@ -0,0 +1,78 @@
+package daemon
+
+import (
+	"time"
+
+	"arkham-cli/metrics"
+	"arkham-cli/node"
+	ap "arkham-cli/solana"
+)
+
+// accountMetricsInterval is how often the on-chain account gauges are refreshed.
+const accountMetricsInterval = time.Minute
+
+// serveMetrics registers the daemon's state with the metrics gauges and serves them on
+// addr until the daemon closes.
+func (d *Daemon) serveMetrics(addr string) {
+	metrics.PeersConnected.Set(func() []metrics.Sample {
+		var samples []metrics.Sample
+		for source, count := range d.Node.PeersBySource() {
+			samples = append(samples, metrics.Sample{Labels: []string{source}, Value: float64(count)})
+		}
+		return samples
+	})
+	metrics.SessionsActive.Set(func() []metrics.Sample {
+		counts := map[[2]string]int{}
+		for _, s := range d.Node.ServedSessions() {
+			counts[[2]string{node.RoleWarden, s.Kind}]++
+		}
+		counts[[2]string{node.RoleSeeker, "circuit"}] += len(d.Sessions())
+		var samples []metrics.Sample
+		for labels, count := range counts {
+			samples = append(samples, metrics.Sample{Labels: labels[:], Value: float64(count)})
+		}
+		return samples
+	})
+
+	go d.refreshAccountMetrics()
+	if err := metrics.Serve(d.ctx, addr, d.log); err != nil {
+		d.log.Error("metrics server stopped", "err", err)
+	}
+}
+
+// refreshAccountMetrics updates the on-chain gauges of every profile the daemon has a client
+// for, starting with the warden profile.
+func (d *Daemon) refreshAccountMetrics() {
+	d.ClientForProfile(d.cfg.WardenProfile)
+
+	ticker := time.NewTicker(accountMetricsInterval)
+	defer ticker.Stop()
+	for {
+		d.clientsMu.Lock()
+		clients := make(map[string]*ap.Client, len(d.clients))
+		for name, client := range d.clients {
+			clients[name] = client
+		}
+		d.clientsMu.Unlock()
+
+		for name, client := range clients {
+			if registered, err := client.IsWardenRegistered(); err == nil && registered {
+				if warden, err := client.FetchWardenAccount(); err == nil {
+					metrics.WardenPendingClaims.WithLabelValues(name).Set(float64(warden.PendingClaims))
+					metrics.WardenReputation.WithLabelValues(name).Set(float64(warden.ReputationScore))
+				}
+			}
+			if registered, err := client.IsSeekerRegistered(); err == nil && registered {
+				if seeker, err := client.FetchSeekerAccount(); err == nil {
+					metrics.SeekerEscrowBalance.WithLabelValues(name).Set(float64(seeker.EscrowBalance))
+				}
+			}
+		}
+
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,505 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"arkham-cli/budget"
+	"arkham-cli/journal"
+	"arkham-cli/metrics"
+	"arkham-cli/node"
+	"arkham-cli/pricing"
+	ap "arkham-cli/solana"
+	"arkham-cli/storage"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// SessionsDir is the directory in the config directory that holds session leases.
+const SessionsDir = "sessions"
+
+const (
+	// meterInterval is how often a paid session's traffic is journaled and checked
+	// against what was paid for, and its lease refreshed.
+	meterInterval = 5 * time.Second
+	// receiptGrace is how long recovery leaves a connection open for its warden to submit
+	// a receipt the seeker signed, before ending it anyway.
+	receiptGrace = 10 * time.Minute
+)
+
+var ErrSessionElsewhere = errors.New("profile has an active session in another process")
+
+// Transport is the P2P side of a paid session: a circuit, or a proxy tunnel to one warden.
+// Hop i of the transport is the session's i-th warden.
+type Transport interface {
+	BytesTransferred() uint64
+	// SendProof delivers a bandwidth proof to a hop and returns once the warden has
+	// submitted it.
+	SendProof(ctx context.Context, hop int, proof node.BandwidthProof) error
+	Close() error
+}
+
+// Orchestrator runs the on-chain side of a seeker's sessions. Open funds the escrow and
+// starts a Connection with every warden before the P2P session is negotiated; Close has
+// each warden submit its final proof before the Connection is ended, so escrow is never
+// left locked.
+type Orchestrator struct {
+	Client  *ap.Client
+	Profile string
+	// Leases is the directory holding session leases and journals. Empty uses SessionsDir
+	// in the config directory.
+	Leases string
+	// Budgets is the directory holding budgets. Empty uses BudgetsDir in the config
+	// directory.
+	Budgets string
+	// Logger receives the orchestrator's diagnostics. When nil, slog.Default is used.
+	Logger *slog.Logger
+}
+
+func (o *Orchestrator) log() *slog.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return slog.Default()
+}
+
+func (o *Orchestrator) leases() string {
+	if o.Leases != "" {
+		return o.Leases
+	}
+	return filepath.Join(storage.ConfigDir(), SessionsDir)
+}
+
+// journalPath is the profile's seeker journal.
+func (o *Orchestrator) journalPath() string {
+	return filepath.Join(o.leases(), o.Profile+".journal")
+}
+
+// PaidSession is a P2P session with one on-chain Connection per warden.
+type PaidSession struct {
+	Wardens []*ap.Warden
+	// Mb is the MB each warden's Connection was opened for.
+	Mb        []uint64
+	Transport Transport
+	Started   time.Time
+
+	o         *Orchestrator
+	id        string
+	journal   *journal.Journal
+	exhausted chan struct{}
+	stop      chan struct{}
+	metered   sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// Open ends any orphaned Connections of the profile, checks that a Connection of mb MB
+// with every warden fits in the profile's budget, makes sure the escrow covers them,
+// starts them, and calls negotiate to set up the P2P session. Zero mb splits the escrow
+// balance, or what the budget leaves if that is less, evenly across the wardens. If any
+// step fails, the Connections already started are ended again.
+func (o *Orchestrator) Open(ctx context.Context, protocolConfig *ap.ProtocolConfig, wardens []*ap.Warden, mb uint64, negotiate func(ctx context.Context) (Transport, error)) (*PaidSession, error) {
+	if lease, err := loadLease(o.leases(), o.Profile); err == nil && lease.live(time.Now()) {
+		return nil, fmt.Errorf("%w: '%s'", ErrSessionElsewhere, o.Profile)
+	}
+	if _, err := o.Recover(); err != nil {
+		return nil, fmt.Errorf("failed to recover orphaned connections: %w", err)
+	}
+
+	b, err := budget.Load(o.budgets(), o.Profile)
+	if err != nil {
+		return nil, err
+	}
+	seeker, err := o.Client.FetchSeekerAccount()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch seeker account: %w", err)
+	}
+	usage, err := o.usage(b, seeker)
+	if err != nil {
+		return nil, err
+	}
+
+	// Zero mb spends what the escrow holds, within what the budget leaves.
+	funds := seeker.EscrowBalance
+	if usage.Remaining != nil {
+		funds = min(funds, *usage.Remaining)
+	}
+	mbs := make([]uint64, len(wardens))
+	var required uint64
+	for i, warden := range wardens {
+		mbs[i] = mb
+		if mb == 0 {
+			if mbs[i], err = shareMb(protocolConfig, warden, funds, len(wardens)); err != nil {
+				return nil, err
+			}
+		}
+		quote, err := pricing.QuoteConnection(protocolConfig, warden, mbs[i])
+		if err != nil {
+			return nil, err
+		}
+		required += quote.EscrowRequired
+	}
+	if err := b.Allow(usage, required); err != nil {
+		return nil, err
+	}
+	if err := o.ensureEscrow(b, seeker, required); err != nil {
+		return nil, err
+	}
+
+	lease := &sessionLease{Heartbeat: time.Now()}
+	for _, warden := range wardens {
+		lease.Wardens = append(lease.Wardens, warden.Authority)
+	}
+	if err := lease.save(o.leases(), o.Profile); err != nil {
+		return nil, err
+	}
+	j, err := journal.Open(o.journalPath())
+	if err != nil {
+		removeLease(o.leases(), o.Profile)
+		return nil, err
+	}
+	id := newSessionID()
+	open := journal.Record{Kind: journal.KindOpen, Session: id, Seeker: o.Client.Signer.PublicKey().String(), Mb: mbs}
+	for _, warden := range wardens {
+		open.Wardens = append(open.Wardens, warden.Authority.String())
+	}
+	if err := j.Append(open); err != nil {
+		j.Close()
+		removeLease(o.leases(), o.Profile)
+		return nil, err
+	}
+	var started []*ap.Warden
+	abort := func() {
+		o.endConnections(started)
+		j.Append(journal.Record{Kind: journal.KindClose, Session: id})
+		j.Close()
+		removeLease(o.leases(), o.Profile)
+	}
+	for i, warden := range wardens {
+		if _, err := o.Client.StartConnection(warden.Authority, mbs[i]); err != nil {
+			abort()
+			return nil, fmt.Errorf("failed to start connection with warden %s: %w", warden.Authority, err)
+		}
+		started = append(started, warden)
+	}
+
+	transport, err := negotiate(ctx)
+	if err != nil {
+		abort()
+		return nil, err
+	}
+
+	s := &PaidSession{
+		Wardens:   wardens,
+		Mb:        mbs,
+		Transport: transport,
+		Started:   time.Now(),
+		o:         o,
+		id:        id,
+		journal:   j,
+		exhausted: make(chan struct{}),
+		stop:      make(chan struct{}),
+	}
+	s.metered.Add(1)
+	go s.meter(lease)
+	return s, nil
+}
+
+// ensureEscrow deposits what the escrow lacks for the Connections about to be started,
+// topping it up to the budget's floor on the way.
+func (o *Orchestrator) ensureEscrow(b *budget.Budget, seeker *ap.Seeker, required uint64) error {
+	wallet, err := o.Client.GetBalance(o.Client.Signer.PublicKey())
+	if err != nil {
+		return fmt.Errorf("failed to fetch wallet balance: %w", err)
+	}
+	amount, err := b.Deposit(seeker.EscrowBalance, wallet, required)
+	if err != nil || amount == 0 {
+		return err
+	}
+	o.log().Info("depositing escrow for the session", "lamports", amount)
+	// Sessions are paid from the public escrow, so that is where the deposit goes.
+	if _, err := o.Client.DepositEscrow(amount, false); err != nil {
+		return fmt.Errorf("failed to deposit %d lamports of escrow: %w", amount, err)
+	}
+	return nil
+}
+
+// meter refreshes the session's lease and closes exhausted once the traffic reaches the
+// MB paid for, until the session closes.
+func (s *PaidSession) meter(lease *sessionLease) {
+	defer s.metered.Done()
+	ticker := time.NewTicker(meterInterval)
+	defer ticker.Stop()
+	paid := s.Mb[0]
+	for _, mb := range s.Mb[1:] {
+		paid = min(paid, mb)
+	}
+	var journaled uint64
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		lease.Heartbeat = time.Now()
+		if err := lease.save(s.o.leases(), s.o.Profile); err != nil {
+			s.o.log().Warn("failed to refresh session lease", "err", err)
+		}
+		transferred := s.Transport.BytesTransferred()
+		if transferred != journaled {
+			if err := s.journal.Append(journal.Record{Kind: journal.KindBytes, Session: s.id, Bytes: transferred}); err != nil {
+				s.o.log().Warn("failed to journal session traffic", "err", err)
+			}
+			journaled = transferred
+		}
+		select {
+		case <-s.exhausted:
+		default:
+			if transferred >= paid*bytesPerMb {
+				s.o.log().Info("session used the MB paid for", "mb", paid)
+				close(s.exhausted)
+			}
+		}
+	}
+}
+
+// Exhausted is closed once the session's traffic reaches the MB paid for. Traffic beyond
+// it is not covered by the escrow, so the session should be closed.
+func (s *PaidSession) Exhausted() <-chan struct{} {
+	return s.exhausted
+}
+
+// Close sends every warden a bandwidth proof for the session's traffic and waits for it to
+// be submitted, closes the transport, and ends the Connections. It returns one settlement
+// per warden and is only effective once.
+func (s *PaidSession) Close(ctx context.Context) []HopSettlement {
+	var settlements []HopSettlement
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		s.metered.Wait()
+
+		// Every hop relayed the same payload, so every hop gets a proof for the same MB,
+		// up to what its Connection was opened for.
+		transferred := s.Transport.BytesTransferred()
+		s.journal.Append(journal.Record{Kind: journal.KindBytes, Session: s.id, Bytes: transferred})
+		mb := (transferred + bytesPerMb - 1) / bytesPerMb
+		settlements = make([]HopSettlement, len(s.Wardens))
+		for i, warden := range s.Wardens {
+			hopMb := min(mb, s.Mb[i])
+			settlements[i] = HopSettlement{Warden: warden.Authority.String(), Mb: hopMb}
+			if hopMb == 0 {
+				continue
+			}
+			if err := s.sendProof(ctx, i, warden, hopMb); err != nil {
+				s.o.log().Error("warden did not submit the final proof", "warden", warden.Authority, "err", err)
+				settlements[i].Error = err.Error()
+			}
+		}
+
+		s.Transport.Close()
+		ended := true
+		for i, err := range s.o.endConnections(s.Wardens) {
+			if err != nil {
+				ended = false
+				if settlements[i].Error == "" {
+					settlements[i].Error = err.Error()
+				}
+			}
+		}
+		// A connection that could not be ended is left in the journal for recovery.
+		if ended {
+			s.journal.Append(journal.Record{Kind: journal.KindClose, Session: s.id})
+		}
+		s.journal.Close()
+		if err := removeLease(s.o.leases(), s.o.Profile); err != nil {
+			s.o.log().Warn("failed to remove session lease", "err", err)
+		}
+	})
+	return settlements
+}
+
+// sendProof signs a bandwidth proof for one hop and waits for the warden to submit it.
+func (s *PaidSession) sendProof(ctx context.Context, hop int, warden *ap.Warden, mb uint64) error {
+	timestamp := time.Now().Unix()
+	sig, err := s.o.Client.GenerateBandwidthProofSignature(warden.Authority, mb, timestamp)
+	if err != nil {
+		return err
+	}
+	metrics.Proofs.WithLabelValues(metrics.ProofSigned).Inc()
+	proof := node.BandwidthProof{
+		MbConsumed: mb,
+		Timestamp:  timestamp,
+		Seeker:     s.o.Client.Signer.PublicKey(),
+		Signature:  sig,
+	}
+	// The receipt is journaled before it leaves, so recovery knows the warden may still
+	// submit it.
+	receipt := &journal.Receipt{
+		Seeker:    s.o.Client.Signer.PublicKey().String(),
+		Warden:    warden.Authority.String(),
+		Mb:        mb,
+		Timestamp: timestamp,
+		Signature: sig[:],
+	}
+	if err := s.journal.Append(journal.Record{Kind: journal.KindReceipt, Session: s.id, Receipt: receipt}); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, proofAckTimeout)
+	defer cancel()
+	if err := s.Transport.SendProof(ctx, hop, proof); err != nil {
+		return err
+	}
+	return s.journal.Append(journal.Record{Kind: journal.KindSubmitted, Session: s.id, Receipt: receipt})
+}
+
+// endConnections ends the Connection with each warden, returning one error per warden.
+func (o *Orchestrator) endConnections(wardens []*ap.Warden) []error {
+	errs := make([]error, len(wardens))
+	for i, warden := range wardens {
+		if _, err := o.Client.EndConnection(warden.Authority); err != nil {
+			o.log().Error("failed to end connection", "warden", warden.Authority, "err", err)
+			errs[i] = err
+		}
+	}
+	return errs
+}
+
+// Recover ends the profile's Connections that no live session holds: those left behind
+// by a process that exited without closing its session. It returns the wardens whose
+// Connections were ended.
+//
+// Without a live session, Recover also replays the profile's journal. Receipts found in a
+// Connection's BandwidthProofs are marked submitted. A Connection with a receipt that is
+// not on chain yet is left open for receiptGrace, so its warden can still be paid for the
+// traffic it served, and receipts whose Connection has ended are abandoned.
+func (o *Orchestrator) Recover() ([]solana.PublicKey, error) {
+	lease, err := loadLease(o.leases(), o.Profile)
+	if err != nil {
+		return nil, err
+	}
+	if !lease.live(time.Now()) {
+		lease = nil
+	}
+	connections, warnings, err := o.Client.FetchMyConnections("seeker")
+	if err != nil {
+		return nil, err
+	}
+	logWarnings(o.log(), warnings)
+
+	// The journal belongs to the live session, if there is one.
+	var j *journal.Journal
+	if lease == nil {
+		if j, err = journal.Open(o.journalPath()); err != nil {
+			return nil, err
+		}
+		defer j.Close()
+	}
+
+	authorities := make(map[solana.PublicKey]solana.PublicKey)
+	if len(connections) > 0 {
+		wardens, warnings, err := o.Client.FetchAllWardens()
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch wardens: %w", err)
+		}
+		logWarnings(o.log(), warnings)
+		for _, w := range wardens {
+			if pda, _, err := ap.GetWardenPDAForAuthority(w.Authority); err == nil {
+				authorities[pda] = w.Authority
+			}
+		}
+	}
+
+	var ended []solana.PublicKey
+	open := make(map[string]bool)
+	for _, c := range connections {
+		authority, ok := authorities[c.Account.Warden]
+		if !ok {
+			o.log().Warn("orphaned connection with an unknown warden", "connection", c.PublicKey, "warden", c.Account.Warden)
+			continue
+		}
+		if lease != nil && lease.holds(authority) {
+			continue
+		}
+		if j != nil && o.awaitingWarden(j, authority, &c.Account) {
+			open[authority.String()] = true
+			continue
+		}
+		if _, err := o.Client.EndConnection(authority); err != nil {
+			o.log().Error("failed to end orphaned connection", "warden", authority, "err", err)
+			open[authority.String()] = true
+			continue
+		}
+		o.log().Info("ended orphaned connection", "warden", authority, "escrowed", c.Account.AmountEscrowed)
+		ended = append(ended, authority)
+	}
+	if lease == nil {
+		removeLease(o.leases(), o.Profile)
+	}
+	if j == nil {
+		return ended, nil
+	}
+
+	for _, p := range j.Pending() {
+		if open[p.Warden] {
+			continue
+		}
+		o.log().Warn("abandoning receipt whose connection has ended", "warden", p.Warden, "mb", p.Mb)
+		receipt := p.Receipt
+		j.Append(journal.Record{Kind: journal.KindAbandoned, Session: p.Session, Receipt: &receipt})
+	}
+	for _, session := range j.Sessions() {
+		settled := true
+		for _, w := range session.Wardens {
+			settled = settled && !open[w]
+		}
+		if settled {
+			o.log().Info("closed interrupted session", "session", session.ID, "bytes", session.Bytes, "opened", session.Opened)
+			j.Append(journal.Record{Kind: journal.KindClose, Session: session.ID})
+		}
+	}
+	return ended, nil
+}
+
+// awaitingWarden reconciles the journal's pending receipts for a warden against its
+// Connection's proofs, and reports whether one of them may still be submitted.
+func (o *Orchestrator) awaitingWarden(j *journal.Journal, warden solana.PublicKey, connection *ap.Connection) bool {
+	waiting := false
+	for _, p := range j.Pending() {
+		if p.Warden != warden.String() {
+			continue
+		}
+		receipt := p.Receipt
+		if hasProof(connection, receipt.Signature) {
+			j.Append(journal.Record{Kind: journal.KindSubmitted, Session: p.Session, Receipt: &receipt})
+			continue
+		}
+		if time.Since(p.Signed) < receiptGrace {
+			o.log().Info("leaving connection open for the warden to submit a receipt", "warden", warden, "mb", p.Mb)
+			waiting = true
+		}
+	}
+	return waiting
+}
+
+// hasProof reports whether a Connection holds the proof with the given seeker signature.
+func hasProof(connection *ap.Connection, signature []byte) bool {
+	for _, proof := range connection.BandwidthProofs {
+		if bytes.Equal(proof.SeekerSignature[:], signature) {
+			return true
+		}
+	}
+	return false
+}
+
+func newSessionID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,430 @@
+package daemon
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"arkham-cli/internal/solanatest"
+	"arkham-cli/journal"
+	"arkham-cli/node"
+	ap "arkham-cli/solana"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// fakeChain is a solanatest server that applies escrow deposits and starts and ends
+// Connections the way the program does.
+type fakeChain struct {
+	*solanatest.Server
+	seeker solana.PrivateKey
+
+	mu     sync.Mutex
+	escrow uint64
+	// refuseStart and refuseEnd make the program reject StartConnection and
+	// EndConnection with a warden PDA.
+	refuseStart map[solana.PublicKey]bool
+	refuseEnd   map[solana.PublicKey]bool
+}
+
+func newFakeChain(t *testing.T, escrow uint64) *fakeChain {
+	t.Helper()
+	c := &fakeChain{
+		Server:      solanatest.NewServer(t),
+		seeker:      solana.NewWallet().PrivateKey,
+		refuseStart: make(map[solana.PublicKey]bool),
+		refuseEnd:   make(map[solana.PublicKey]bool),
+	}
+	c.OnTransaction = c.apply
+	c.SetBalance(c.seeker.PublicKey(), solana.LAMPORTS_PER_SOL)
+	c.setEscrow(escrow)
+	return c
+}
+
+func (c *fakeChain) setEscrow(escrow uint64) {
+	c.escrow = escrow
+	pda, _, _ := ap.GetSeekerPDA(c.seeker.PublicKey())
+	c.SetProgramAccount(pda, ap.Account_Seeker, ap.Seeker{Authority: c.seeker.PublicKey(), EscrowBalance: escrow})
+}
+
+func (c *fakeChain) apply(tx *solana.Transaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, ix := range solanatest.ProgramInstructions(tx) {
+		switch {
+		case ix.Is(ap.Instruction_DepositEscrow):
+			c.setEscrow(c.escrow + binary.LittleEndian.Uint64(ix.Data[8:16]))
+		case ix.Is(ap.Instruction_StartConnection):
+			connection, seeker, warden := ix.Accounts[0], ix.Accounts[1], ix.Accounts[2]
+			if c.refuseStart[warden] {
+				return errors.New("warden refused the connection")
+			}
+			c.SetProgramAccount(connection, ap.Account_Connection, ap.Connection{
+				Seeker:         seeker,
+				Warden:         warden,
+				AmountEscrowed: binary.LittleEndian.Uint64(ix.Data[8:16]),
+			})
+		case ix.Is(ap.Instruction_EndConnection):
+			if c.refuseEnd[ix.Accounts[2]] {
+				return errors.New("connection cannot be ended")
+			}
+			c.DeleteAccount(ix.Accounts[0])
+		}
+	}
+	return nil
+}
+
+// addWarden registers a warden on chain.
+func (c *fakeChain) addWarden() *ap.Warden {
+	w := &ap.Warden{Authority: solana.NewWallet().PublicKey(), PeerId: "peer"}
+	pda, _, _ := ap.GetWardenPDAForAuthority(w.Authority)
+	c.SetProgramAccount(pda, ap.Account_Warden, *w)
+	return w
+}
+
+// connect puts a Connection between the seeker and a warden on chain.
+func (c *fakeChain) connect(w *ap.Warden, proofs ...ap.BandwidthProof) {
+	seeker, _, _ := ap.GetSeekerPDA(c.seeker.PublicKey())
+	warden, _, _ := ap.GetWardenPDAForAuthority(w.Authority)
+	connection, _, _ := ap.GetConnectionPDA(seeker, warden)
+	c.SetProgramAccount(connection, ap.Account_Connection, ap.Connection{
+		Seeker:          seeker,
+		Warden:          warden,
+		AmountEscrowed:  1000,
+		BandwidthProofs: proofs,
+	})
+}
+
+// connected returns the authorities of the wardens the seeker has a Connection with.
+func (c *fakeChain) connected(t *testing.T, wardens ...*ap.Warden) []solana.PublicKey {
+	t.Helper()
+	connections, _, err := c.Client(c.seeker).FetchMyConnections("seeker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var authorities []solana.PublicKey
+	for _, w := range wardens {
+		pda, _, _ := ap.GetWardenPDAForAuthority(w.Authority)
+		for _, connection := range connections {
+			if connection.Account.Warden == pda {
+				authorities = append(authorities, w.Authority)
+			}
+		}
+	}
+	return authorities
+}
+
+// orchestrator returns an orchestrator for the seeker keeping its files in dir.
+func (c *fakeChain) orchestrator(dir string) *Orchestrator {
+	return &Orchestrator{
+		Client:  c.Client(c.seeker),
+		Profile: "seeker",
+		Leases:  filepath.Join(dir, "sessions"),
+		Budgets: filepath.Join(dir, "budgets"),
+		Logger:  slog.New(slog.DiscardHandler),
+	}
+}
+
+// fakeTransport stands in for the P2P session.
+type fakeTransport struct {
+	mu     sync.Mutex
+	bytes  uint64
+	proofs map[int]node.BandwidthProof
+	fail   map[int]error
+	closed bool
+}
+
+func newFakeTransport(bytes uint64) *fakeTransport {
+	return &fakeTransport{bytes: bytes, proofs: make(map[int]node.BandwidthProof), fail: make(map[int]error)}
+}
+
+func (f *fakeTransport) BytesTransferred() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.bytes
+}
+
+func (f *fakeTransport) SendProof(ctx context.Context, hop int, proof node.BandwidthProof) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fail[hop]; err != nil {
+		return err
+	}
+	f.proofs[hop] = proof
+	return nil
+}
+
+func (f *fakeTransport) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+func negotiated(transport Transport) func(context.Context) (Transport, error) {
+	return func(context.Context) (Transport, error) { return transport, nil }
+}
+
+func testProtocolConfig() *ap.ProtocolConfig {
+	return &ap.ProtocolConfig{BaseRatePerMb: 1000, TierMultipliers: [3]uint16{10_000, 10_000, 10_000}}
+}
+
+// readJournal replays the seeker's journal and closes it again at once, so the
+// orchestrator can keep using it.
+func readJournal(t *testing.T, o *Orchestrator) *journal.Journal {
+	t.Helper()
+	j, err := journal.Open(o.journalPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+	return j
+}
+
+func TestOrchestratorOpenAndClose(t *testing.T) {
+	chain := newFakeChain(t, 5_000)
+	a, b := chain.addWarden(), chain.addWarden()
+	o := chain.orchestrator(t.TempDir())
+	transport := newFakeTransport(3*bytesPerMb + 1)
+
+	s, err := o.Open(context.Background(), testProtocolConfig(), []*ap.Warden{a, b}, 10, negotiated(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 10 MB at 1000 lamports plus the 10% buffer is 11000 per warden; the escrow lacked 17000.
+	instructions := chain.ProgramInstructions()
+	if len(instructions) != 3 || !instructions[0].Is(ap.Instruction_DepositEscrow) ||
+		!instructions[1].Is(ap.Instruction_StartConnection) || !instructions[2].Is(ap.Instruction_StartConnection) {
+		t.Fatalf("sent %d instructions, want a deposit and two connections", len(instructions))
+	}
+	if deposit := binary.LittleEndian.Uint64(instructions[0].Data[8:16]); deposit != 17_000 {
+		t.Fatalf("deposited %d lamports, want 17000", deposit)
+	}
+	if got := chain.connected(t, a, b); len(got) != 2 {
+		t.Fatalf("connected to %v, want both wardens", got)
+	}
+	lease, err := loadLease(o.Leases, o.Profile)
+	if err != nil || !lease.live(time.Now()) || !lease.holds(a.Authority) || !lease.holds(b.Authority) {
+		t.Fatalf("lease = %+v, %v", lease, err)
+	}
+
+	// Another process finds the lease and leaves the session alone.
+	other := chain.orchestrator(filepath.Dir(o.Leases))
+	if _, err := other.Open(context.Background(), testProtocolConfig(), []*ap.Warden{a}, 10, negotiated(newFakeTransport(0))); !errors.Is(err, ErrSessionElsewhere) {
+		t.Fatalf("second Open = %v, want %v", err, ErrSessionElsewhere)
+	}
+	if ended, err := other.Recover(); err != nil || len(ended) != 0 {
+		t.Fatalf("recovery ended %v (%v) from a live session", ended, err)
+	}
+
+	settlements := s.Close(context.Background())
+	if len(settlements) != 2 {
+		t.Fatalf("settlements = %+v", settlements)
+	}
+	for i, w := range []*ap.Warden{a, b} {
+		if settlements[i].Mb != 4 || settlements[i].Error != "" {
+			t.Fatalf("settlement %d = %+v, want 4 MB", i, settlements[i])
+		}
+		proof := transport.proofs[i]
+		if proof.MbConsumed != 4 || proof.Seeker != chain.seeker.PublicKey() ||
+			!ap.VerifyBandwidthProofSignature(chain.seeker.PublicKey(), w.Authority, 4, proof.Timestamp, proof.Signature) {
+			t.Fatalf("hop %d got proof %+v", i, proof)
+		}
+	}
+	if !transport.closed {
+		t.Fatal("the transport was left open")
+	}
+	if got := chain.connected(t, a, b); len(got) != 0 {
+		t.Fatalf("connections with %v were left open", got)
+	}
+	if lease, _ := loadLease(o.Leases, o.Profile); lease != nil {
+		t.Fatalf("lease %+v was left behind", lease)
+	}
+	j := readJournal(t, o)
+	if len(j.Sessions()) != 0 || len(j.Pending()) != 0 {
+		t.Fatalf("journal holds %+v and %+v", j.Sessions(), j.Pending())
+	}
+	if again := s.Close(context.Background()); again != nil {
+		t.Fatalf("second Close = %+v", again)
+	}
+}
+
+func TestOrchestratorOpenEndsStartedConnectionsOnFailure(t *testing.T) {
+	chain := newFakeChain(t, 1_000_000)
+	a, b, c := chain.addWarden(), chain.addWarden(), chain.addWarden()
+	bPDA, _, _ := ap.GetWardenPDAForAuthority(b.Authority)
+	o := chain.orchestrator(t.TempDir())
+
+	t.Run("warden refuses the connection", func(t *testing.T) {
+		chain.refuseStart[bPDA] = true
+		defer delete(chain.refuseStart, bPDA)
+		negotiatedCalled := false
+		_, err := o.Open(context.Background(), testProtocolConfig(), []*ap.Warden{a, b}, 10, func(context.Context) (Transport, error) {
+			negotiatedCalled = true
+			return newFakeTransport(0), nil
+		})
+		if err == nil || !strings.Contains(err.Error(), b.Authority.String()) {
+			t.Fatalf("Open = %v, want the refusing warden named", err)
+		}
+		if negotiatedCalled {
+			t.Fatal("the P2P session was negotiated without every connection")
+		}
+		if got := chain.connected(t, a, b); len(got) != 0 {
+			t.Fatalf("connections with %v were left open", got)
+		}
+	})
+
+	t.Run("negotiation fails", func(t *testing.T) {
+		_, err := o.Open(context.Background(), testProtocolConfig(), []*ap.Warden{a, b}, 10, func(context.Context) (Transport, error) {
+			return nil, errors.New("warden unreachable")
+		})
+		if err == nil || err.Error() != "warden unreachable" {
+			t.Fatalf("Open = %v", err)
+		}
+		if got := chain.connected(t, a, b); len(got) != 0 {
+			t.Fatalf("connections with %v were left open", got)
+		}
+	})
+
+	if lease, _ := loadLease(o.Leases, o.Profile); lease != nil {
+		t.Fatalf("a failed Open left lease %+v", lease)
+	}
+	if sessions := readJournal(t, o).Sessions(); len(sessions) != 0 {
+		t.Fatalf("failed Opens left sessions %+v", sessions)
+	}
+
+	// The seeker falls back to another warden.
+	chain.refuseStart[bPDA] = true
+	s, err := o.Open(context.Background(), testProtocolConfig(), []*ap.Warden{a, c}, 10, negotiated(newFakeTransport(0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chain.connected(t, a, b, c); len(got) != 2 || got[0] != a.Authority || got[1] != c.Authority {
+		t.Fatalf("connected to %v, want the fallback path", got)
+	}
+	s.Close(context.Background())
+}
+
+func TestOrchestratorCloseLeavesUnsettledWardensToRecovery(t *testing.T) {
+	chain := newFakeChain(t, 1_000_000)
+	a, b := chain.addWarden(), chain.addWarden()
+	aPDA, _, _ := ap.GetWardenPDAForAuthority(a.Authority)
+	o := chain.orchestrator(t.TempDir())
+	transport := newFakeTransport(bytesPerMb)
+	transport.fail[1] = errors.New("warden did not acknowledge")
+
+	s, err := o.Open(context.Background(), testProtocolConfig(), []*ap.Warden{a, b}, 10, negotiated(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.refuseEnd[aPDA] = true
+	settlements := s.Close(context.Background())
+	if !strings.Contains(settlements[0].Error, "connection cannot be ended") {
+		t.Fatalf("settlement for the warden whose connection stayed open = %+v", settlements[0])
+	}
+	if !strings.Contains(settlements[1].Error, "warden did not acknowledge") {
+		t.Fatalf("settlement for the warden without a proof = %+v", settlements[1])
+	}
+	if got := chain.connected(t, a, b); len(got) != 1 || got[0] != a.Authority {
+		t.Fatalf("connected to %v, want only the warden that could not be ended", got)
+	}
+
+	// The unsubmitted receipt and the open session wait for recovery.
+	j := readJournal(t, o)
+	if pending := j.Pending(); len(pending) != 1 || pending[0].Warden != b.Authority.String() {
+		t.Fatalf("pending receipts = %+v", pending)
+	}
+	if len(j.Sessions()) != 1 {
+		t.Fatalf("sessions = %+v, want the unsettled one", j.Sessions())
+	}
+
+	delete(chain.refuseEnd, aPDA)
+	o.Client.Cache.Clear()
+	ended, err := o.Recover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a's receipt was submitted, so its connection is ended; b's connection has ended,
+	// so its receipt is abandoned.
+	if len(ended) != 1 || ended[0] != a.Authority {
+		t.Fatalf("recovery ended %v, want %s", ended, a.Authority)
+	}
+	j = readJournal(t, o)
+	if len(j.Pending()) != 0 || len(j.Sessions()) != 0 {
+		t.Fatalf("recovery left %+v and %+v", j.Pending(), j.Sessions())
+	}
+}
+
+func TestOrchestratorRecover(t *testing.T) {
+	chain := newFakeChain(t, 0)
+	orphan, waiting, settled, held := chain.addWarden(), chain.addWarden(), chain.addWarden(), chain.addWarden()
+	settledSig := [64]byte{1}
+	chain.connect(orphan)
+	chain.connect(waiting)
+	chain.connect(settled, ap.BandwidthProof{MbConsumed: 2, SeekerSignature: settledSig})
+	chain.connect(held)
+	o := chain.orchestrator(t.TempDir())
+
+	// A previous process journaled a receipt for waiting that is not on chain, and one for
+	// settled that is.
+	j, err := journal.Open(o.journalPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeker := chain.seeker.PublicKey().String()
+	j.Append(journal.Record{Kind: journal.KindOpen, Session: "s1", Seeker: seeker, Wardens: []string{waiting.Authority.String(), settled.Authority.String()}})
+	j.Append(journal.Record{Kind: journal.KindReceipt, Session: "s1", Receipt: &journal.Receipt{Seeker: seeker, Warden: waiting.Authority.String(), Mb: 1, Signature: []byte{2}}})
+	j.Append(journal.Record{Kind: journal.KindReceipt, Session: "s1", Receipt: &journal.Receipt{Seeker: seeker, Warden: settled.Authority.String(), Mb: 2, Signature: settledSig[:]}})
+	j.Close()
+
+	// Its lease expired, so none of its wardens are held.
+	lease := &sessionLease{Wardens: []solana.PublicKey{orphan.Authority}, Heartbeat: time.Now().Add(-leaseTimeout - time.Minute)}
+	if err := lease.save(o.Leases, o.Profile); err != nil {
+		t.Fatal(err)
+	}
+	ended, err := o.Recover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ended) != 3 {
+		t.Fatalf("recovery ended %v, want the orphan, the settled and the held warden", ended)
+	}
+	for _, w := range ended {
+		if w == waiting.Authority {
+			t.Fatal("recovery ended a connection whose warden can still submit a receipt")
+		}
+	}
+	if got := chain.connected(t, orphan, waiting, settled, held); len(got) != 1 || got[0] != waiting.Authority {
+		t.Fatalf("connected to %v, want only the warden with a pending receipt", got)
+	}
+	if lease, _ := loadLease(o.Leases, o.Profile); lease != nil {
+		t.Fatalf("recovery kept the expired lease %+v", lease)
+	}
+	j = readJournal(t, o)
+	if pending := j.Pending(); len(pending) != 1 || pending[0].Warden != waiting.Authority.String() {
+		t.Fatalf("pending receipts = %+v, want only the waiting warden's", pending)
+	}
+	if len(j.Sessions()) != 1 {
+		t.Fatalf("sessions = %+v, want the one still waiting", j.Sessions())
+	}
+
+	// A live lease keeps its wardens' connections.
+	chain.connect(held)
+	lease = &sessionLease{Wardens: []solana.PublicKey{held.Authority, waiting.Authority}, Heartbeat: time.Now()}
+	if err := lease.save(o.Leases, o.Profile); err != nil {
+		t.Fatal(err)
+	}
+	if ended, err := o.Recover(); err != nil || len(ended) != 0 {
+		t.Fatalf("recovery ended %v (%v) under a live lease", ended, err)
+	}
+	if got := chain.connected(t, held, waiting); len(got) != 2 {
+		t.Fatalf("connected to %v, want the live session's wardens", got)
+	}
+}
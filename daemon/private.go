@@ -0,0 +1,55 @@
+package daemon
+
+import (
+	"fmt"
+
+	ap "arkham-cli/solana"
+)
+
+// PrivateActivity is what the chain records of a profile's private escrow and private
+// earnings: the seeker's private escrow account, and the totals of the escrow deposits and
+// earnings claims made with use_private.
+type PrivateActivity struct {
+	// Escrow is the seeker's private escrow account, once the program has assigned one.
+	Escrow    *string `json:"escrow,omitempty"`
+	Deposited uint64  `json:"deposited"`
+	Claimed   uint64  `json:"claimed"`
+}
+
+// NewPrivateActivity reads the private escrow of a seeker account and sums the private
+// deposits and claims in its authority's history. Either may be nil.
+func NewPrivateActivity(seeker *ap.Seeker, history *ap.HistoryResult) *PrivateActivity {
+	activity := &PrivateActivity{}
+	if seeker != nil && seeker.PrivateEscrow != nil {
+		escrow := seeker.PrivateEscrow.String()
+		activity.Escrow = &escrow
+	}
+	if history == nil {
+		return activity
+	}
+	for _, e := range history.ArkhamHistory {
+		if !e.Private {
+			continue
+		}
+		switch e.Type {
+		case "EscrowDeposited":
+			activity.Deposited += e.Amount
+		case "EarningsClaimed":
+			activity.Claimed += e.Amount
+		}
+	}
+	return activity
+}
+
+// FetchPrivateActivity reads a profile's private activity from the chain.
+func FetchPrivateActivity(client *ap.Client) (*PrivateActivity, error) {
+	seeker, err := client.FetchSeekerAccount()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch seeker account: %w", err)
+	}
+	history, err := client.GetHistory(client.Signer.PublicKey())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch history: %w", err)
+	}
+	return NewPrivateActivity(seeker, history), nil
+}
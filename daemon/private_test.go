@@ -0,0 +1,63 @@
+package daemon
+
+import (
+	"testing"
+
+	"arkham-cli/internal/solanatest"
+	ap "arkham-cli/solana"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+func TestNewPrivateActivitySumsPrivateEvents(t *testing.T) {
+	escrow := solana.NewWallet().PublicKey()
+	history := &ap.HistoryResult{ArkhamHistory: []ap.GenericEvent{
+		{Type: "EscrowDeposited", Amount: 300, Private: true},
+		{Type: "EscrowDeposited", Amount: 5000},
+		{Type: "EscrowDeposited", Amount: 200, Private: true},
+		{Type: "EarningsClaimed", Amount: 70, Private: true},
+		{Type: "EarningsClaimed", Amount: 900},
+		{Type: "BandwidthProofSubmitted", Amount: 1, Private: true},
+	}}
+
+	a := NewPrivateActivity(&ap.Seeker{PrivateEscrow: &escrow}, history)
+	if a.Escrow == nil || *a.Escrow != escrow.String() {
+		t.Fatalf("escrow = %v, want %s", a.Escrow, escrow)
+	}
+	if a.Deposited != 500 || a.Claimed != 70 {
+		t.Fatalf("activity = %+v, want 500 deposited and 70 claimed", a)
+	}
+
+	if a := NewPrivateActivity(&ap.Seeker{}, nil); a.Escrow != nil || a.Deposited != 0 || a.Claimed != 0 {
+		t.Fatalf("activity without a private escrow or history = %+v", a)
+	}
+}
+
+func TestFetchPrivateActivityReadsTheSeeker(t *testing.T) {
+	chain := solanatest.NewServer(t)
+	signer := solana.NewWallet().PrivateKey
+	client := chain.Client(signer)
+
+	a, err := FetchPrivateActivity(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Escrow != nil {
+		t.Fatalf("unregistered seeker has private escrow %s", *a.Escrow)
+	}
+
+	escrow := solana.NewWallet().PublicKey()
+	seekerPDA, _, _ := ap.GetSeekerPDA(signer.PublicKey())
+	chain.SetProgramAccount(seekerPDA, ap.Account_Seeker, ap.Seeker{
+		Authority:     signer.PublicKey(),
+		EscrowBalance: 1000,
+		PrivateEscrow: &escrow,
+	})
+	a, err = FetchPrivateActivity(chain.Client(signer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Escrow == nil || *a.Escrow != escrow.String() {
+		t.Fatalf("escrow = %v, want %s", a.Escrow, escrow)
+	}
+}
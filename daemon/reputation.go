@@ -0,0 +1,82 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	reputationReportInterval = time.Hour
+	reputationProbeTimeout   = 15 * time.Second
+)
+
+// reportReputation reports every registered warden's link quality on chain each
+// reputationReportInterval until the daemon closes.
+func (d *Daemon) reportReputation() {
+	ticker := time.NewTicker(reputationReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := d.reportReputationRound(); err != nil {
+			d.log.Warn("reputation report failed", "err", err)
+		}
+	}
+}
+
+// reportReputationRound probes each registered warden and submits its quality: whether it
+// answered, and its ping success rate as the uptime in basis points. Probed wardens stay
+// connected, so the node's prober keeps measuring them until the next round.
+func (d *Daemon) reportReputationRound() error {
+	if !d.Node.Status().IsRunning {
+		return fmt.Errorf("node is not running")
+	}
+	client, err := d.ClientForProfile(d.cfg.ReputationProfile)
+	if err != nil {
+		return fmt.Errorf("%w: '%s'", ErrUnknownProfile, d.cfg.ReputationProfile)
+	}
+	protocolConfig, err := client.FetchProtocolConfig()
+	if err != nil {
+		return fmt.Errorf("failed to fetch protocol config: %w", err)
+	}
+	if protocolConfig.ReputationUpdater != client.Signer.PublicKey() {
+		return fmt.Errorf("profile '%s' is not the protocol's reputation updater %s", d.cfg.ReputationProfile, protocolConfig.ReputationUpdater)
+	}
+	wardens, warnings, err := client.FetchAllWardens()
+	if err != nil {
+		return fmt.Errorf("failed to fetch wardens: %w", err)
+	}
+	logWarnings(d.log, warnings)
+
+	self := d.Node.GetHost()
+	for _, warden := range wardens {
+		if d.ctx.Err() != nil {
+			return nil
+		}
+		id, err := peer.Decode(warden.PeerId)
+		if err != nil || (self != nil && id == self.ID()) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(d.ctx, reputationProbeTimeout)
+		_, probeErr := d.Node.ProbeLatency(ctx, id)
+		cancel()
+
+		var uptime uint16
+		if q, ok := d.Node.PeerQuality(id); ok {
+			uptime = uint16(math.Round((1 - q.Loss) * 10000))
+		}
+		if _, err := client.UpdateReputation(warden.Authority, probeErr == nil, uptime); err != nil {
+			d.log.Error("failed to report warden reputation", "warden", warden.Authority, "err", err)
+			continue
+		}
+		d.log.Debug("reported warden reputation", "warden", warden.Authority, "reachable", probeErr == nil, "uptime", uptime)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"path/filepath"
+	"time"
+
+	"arkham-cli/node"
+	"arkham-cli/storage"
+)
+
+// ServiceName is the versioned name of the control API. Methods are called as
+// "ArkhamV1.<Method>" with JSON-RPC 1.0 framing over the control socket.
+const ServiceName = "ArkhamV1"
+
+// SocketFile is the control socket's file name inside the config directory.
+const SocketFile = "arkhamd.sock"
+
+// DefaultSocketPath returns where the daemon listens unless told otherwise.
+func DefaultSocketPath() string {
+	return filepath.Join(storage.ConfigDir(), SocketFile)
+}
+
+// Empty is the argument of methods that take none.
+type Empty struct{}
+
+// SessionsReply lists the circuits the daemon built as a seeker and the traffic it relays
+// as a warden.
+type SessionsReply struct {
+	Circuits []SessionInfo        `json:"circuits"`
+	Served   []node.ServedSession `json:"served"`
+}
+
+// API is the control service exposed on the socket. Its exported methods follow net/rpc
+// conventions.
+type API struct {
+	d *Daemon
+}
+
+// Status reports whether the node is running, its peer ID and its addresses.
+func (a *API) Status(_ Empty, reply *node.NodeStatus) error {
+	*reply = a.d.Node.Status()
+	return nil
+}
+
+// StartNode starts the P2P node.
+func (a *API) StartNode(_ Empty, reply *node.NodeStatus) error {
+	status, err := a.d.StartNode()
+	*reply = status
+	return err
+}
+
+// StopNode stops the P2P node.
+func (a *API) StopNode(_ Empty, reply *node.NodeStatus) error {
+	status, err := a.d.StopNode()
+	*reply = status
+	return err
+}
+
+// Peers lists the known peers.
+func (a *API) Peers(_ Empty, reply *[]node.PeerInfo) error {
+	*reply = a.d.Node.Peers()
+	return nil
+}
+
+// Sessions lists seeker circuits and served sessions.
+func (a *API) Sessions(_ Empty, reply *SessionsReply) error {
+	*reply = SessionsReply{
+		Circuits: a.d.Sessions(),
+		Served:   a.d.Node.ServedSessions(),
+	}
+	return nil
+}
+
+// Connect builds a seeker circuit.
+func (a *API) Connect(req ConnectRequest, reply *ConnectResult) error {
+	result, err := a.d.Connect(req)
+	if err != nil {
+		return err
+	}
+	*reply = *result
+	return nil
+}
+
+// Disconnect settles and tears down the seeker circuit.
+func (a *API) Disconnect(_ Empty, reply *[]HopSettlement) error {
+	settlements, err := a.d.Disconnect()
+	*reply = settlements
+	return err
+}
+
+// Serve listens on the unix socket at path and answers control requests until the daemon
+// closes. The socket is only accessible to the user running the daemon.
+func (d *Daemon) Serve(path string) error {
+	if err := removeStaleSocket(path); err != nil {
+		return err
+	}
+	l, err := listenPrivate(path)
+	if err != nil {
+		return err
+	}
+	d.listenerMu.Lock()
+	if d.ctx.Err() != nil {
+		d.listenerMu.Unlock()
+		l.Close()
+		return nil
+	}
+	d.listener = l
+	d.listenerMu.Unlock()
+
+	server := rpc.NewServer()
+	if err := server.RegisterName(ServiceName, &API{d: d}); err != nil {
+		l.Close()
+		return err
+	}
+
+	d.log.Info("control socket listening", "path", path)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if d.ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
+
+// listenPrivate creates the socket inside a new directory only the current user can enter,
+// restricts it to 0600 and only then moves it to path. Listening on path directly would
+// leave the socket open to everyone between Listen and Chmod.
+func listenPrivate(path string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".arkhamd-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a private directory for %s: %w", path, err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, SocketFile)
+	l, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0600); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to restrict %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	return &socketListener{Listener: l, path: path}, nil
+}
+
+// socketListener removes its socket file when it closes.
+type socketListener struct {
+	net.Listener
+	path string
+}
+
+func (l *socketListener) Close() error {
+	err := l.Listener.Close()
+	os.Remove(l.path)
+	return err
+}
+
+// removeStaleSocket deletes a socket file left behind by a daemon that is no longer
+// running, and refuses to start if one still answers.
+func removeStaleSocket(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("a daemon is already listening on %s", path)
+	}
+	return os.Remove(path)
+}
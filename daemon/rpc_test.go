@@ -0,0 +1,119 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"arkham-cli/node"
+)
+
+// serveTestDaemon serves the control socket of a daemon whose node is not running.
+func serveTestDaemon(t *testing.T, path string) (*Daemon, chan error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Daemon{Node: node.NewP2PNode(), log: slog.New(slog.DiscardHandler), ctx: ctx, cancel: cancel}
+	served := make(chan error, 1)
+	go func() { served <- d.Serve(path) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			break
+		}
+		select {
+		case err := <-served:
+			t.Fatalf("Serve returned early: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the control socket never appeared")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d, served
+}
+
+func TestControlSocketRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, SocketFile)
+	d, served := serveTestDaemon(t, path)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0600 {
+		t.Fatalf("socket mode = %s, want a 0600 socket", info.Mode())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("the private directory was left behind: %v", entries)
+	}
+
+	client, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if status, err := client.Status(); err != nil || status.IsRunning {
+		t.Fatalf("status = %+v, %v, want a stopped node", status, err)
+	}
+	if peers, err := client.Peers(); err != nil || len(peers) != 0 {
+		t.Fatalf("peers = %v, %v", peers, err)
+	}
+	if sessions, err := client.Sessions(); err != nil || len(sessions.Circuits) != 0 || len(sessions.Served) != 0 {
+		t.Fatalf("sessions = %+v, %v", sessions, err)
+	}
+	// Daemon errors come back as the RPC error text.
+	if _, err := client.Connect(ConnectRequest{Hops: MaxHops + 1}); err == nil || err.Error() != ErrTooManyHops.Error() {
+		t.Fatalf("connect = %v, want %v", err, ErrTooManyHops)
+	}
+	if _, err := client.Connect(ConnectRequest{}); err == nil || err.Error() != ErrNodeNotRunning.Error() {
+		t.Fatalf("connect = %v, want %v", err, ErrNodeNotRunning)
+	}
+	if _, err := client.Disconnect(); err == nil || err.Error() != ErrNoSession.Error() {
+		t.Fatalf("disconnect = %v, want %v", err, ErrNoSession)
+	}
+
+	// A second daemon refuses a socket that still answers.
+	other := &Daemon{Node: node.NewP2PNode(), log: slog.New(slog.DiscardHandler), ctx: context.Background()}
+	if err := other.Serve(path); err == nil || !strings.Contains(err.Error(), "already listening") {
+		t.Fatalf("second Serve = %v", err)
+	}
+
+	d.Close()
+	if err := <-served; err != nil {
+		t.Fatalf("Serve = %v after Close", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("socket still exists after Close: %v", err)
+	}
+	if _, err := Dial(path); err == nil {
+		t.Fatal("dialled a closed daemon")
+	}
+}
+
+func TestControlSocketReplacesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SocketFile)
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	serveTestDaemon(t, path)
+
+	client, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Status(); err != nil {
+		t.Fatal(err)
+	}
+}
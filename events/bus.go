@@ -0,0 +1,143 @@
+// Package events fans out node, session and chain activity to live subscribers such as the
+// GUI's event stream. Recent events are kept so a reconnecting subscriber can resume from
+// the last ID it saw.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	TypeNode        = "node"
+	TypePeer        = "peer"
+	TypeSession     = "session"
+	TypeTransaction = "transaction"
+	TypeChain       = "chain"
+)
+
+const (
+	// DefaultBacklog is how many events a bus keeps for resuming subscribers.
+	DefaultBacklog = 1024
+	// subscriberBuffer is how far a subscriber may fall behind before it is dropped.
+	subscriberBuffer = 256
+)
+
+// Event is one published event.
+type Event struct {
+	ID   uint64 `json:"id"`
+	Type string `json:"type"`
+	// Profile is the wallet profile the event belongs to, for transaction and chain events.
+	Profile string    `json:"profile,omitempty"`
+	Time    time.Time `json:"time"`
+	Data    any       `json:"data"`
+}
+
+// Bus publishes events to subscribers. A nil *Bus discards everything published to it.
+type Bus struct {
+	mu      sync.Mutex
+	nextID  uint64
+	backlog []Event
+	size    int
+	subs    map[chan Event]struct{}
+}
+
+// NewBus creates a bus that keeps the last backlog events. IDs start at the creation time
+// in microseconds, so IDs from an earlier process are older than anything this bus holds
+// and a subscriber resuming with one is told it missed events.
+func NewBus(backlog int) *Bus {
+	if backlog <= 0 {
+		backlog = DefaultBacklog
+	}
+	return &Bus{
+		nextID: uint64(time.Now().UnixMicro()),
+		size:   backlog,
+		subs:   make(map[chan Event]struct{}),
+	}
+}
+
+// Publish sends an event to every subscriber.
+func (b *Bus) Publish(typ string, data any) {
+	b.PublishProfile("", typ, data)
+}
+
+// PublishProfile sends an event that belongs to a wallet profile.
+func (b *Bus) PublishProfile(profile, typ string, data any) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	e := Event{ID: b.nextID, Type: typ, Profile: profile, Time: time.Now(), Data: data}
+	if len(b.backlog) == b.size {
+		copy(b.backlog, b.backlog[1:])
+		b.backlog = b.backlog[:len(b.backlog)-1]
+	}
+	b.backlog = append(b.backlog, e)
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			// The subscriber fell behind. Drop it; it can reconnect and resume from
+			// the backlog.
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscription is a live feed of events.
+type Subscription struct {
+	// Backlog holds the events published after the ID the subscriber resumed from.
+	Backlog []Event
+	// Missed is set when the resume ID is older than the backlog, so events were lost and
+	// the subscriber should refresh its state.
+	Missed bool
+	// C delivers new events. It is closed when the subscriber falls too far behind or
+	// unsubscribes.
+	C <-chan Event
+
+	bus *Bus
+	ch  chan Event
+}
+
+// Subscribe starts a feed. lastID is the last event the subscriber saw, or zero for a new
+// subscriber, which gets no backlog.
+func (b *Bus) Subscribe(lastID uint64) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	b.subs[ch] = struct{}{}
+	sub := &Subscription{C: ch, bus: b, ch: ch}
+	if lastID == 0 || lastID >= b.nextID {
+		sub.Missed = lastID > b.nextID
+		return sub
+	}
+
+	oldest := b.nextID + 1
+	if len(b.backlog) > 0 {
+		oldest = b.backlog[0].ID
+	}
+	sub.Missed = lastID+1 < oldest
+	for _, e := range b.backlog {
+		if e.ID > lastID {
+			sub.Backlog = append(sub.Backlog, e)
+		}
+	}
+	return sub
+}
+
+// Close unsubscribes.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	if _, ok := s.bus.subs[s.ch]; ok {
+		delete(s.bus.subs, s.ch)
+		close(s.ch)
+	}
+}
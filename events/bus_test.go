@@ -0,0 +1,70 @@
+package events
+
+import "testing"
+
+func TestSubscribeResumesFromBacklog(t *testing.T) {
+	bus := NewBus(4)
+	bus.Publish(TypeNode, 1)
+	first := bus.Subscribe(0)
+	defer first.Close()
+	if len(first.Backlog) != 0 || first.Missed {
+		t.Fatalf("a new subscriber should start empty, got %d events (missed=%v)", len(first.Backlog), first.Missed)
+	}
+
+	bus.Publish(TypePeer, 2)
+	bus.Publish(TypePeer, 3)
+	seen := <-first.C
+	if seen.Type != TypePeer || seen.Data != 2 {
+		t.Fatalf("unexpected live event %+v", seen)
+	}
+
+	resumed := bus.Subscribe(seen.ID)
+	defer resumed.Close()
+	if resumed.Missed || len(resumed.Backlog) != 1 || resumed.Backlog[0].Data != 3 {
+		t.Fatalf("expected to resume with the one later event, got %+v (missed=%v)", resumed.Backlog, resumed.Missed)
+	}
+}
+
+func TestSubscribeReportsMissedEvents(t *testing.T) {
+	bus := NewBus(2)
+	bus.Publish(TypeNode, 1)
+	sub := bus.Subscribe(0)
+	sub.Close()
+	first := bus.backlog[0].ID
+	for i := 2; i <= 5; i++ {
+		bus.Publish(TypeNode, i)
+	}
+
+	resumed := bus.Subscribe(first)
+	defer resumed.Close()
+	if !resumed.Missed || len(resumed.Backlog) != 2 {
+		t.Fatalf("expected a gap with the 2 retained events, got %d (missed=%v)", len(resumed.Backlog), resumed.Missed)
+	}
+
+	stale := bus.Subscribe(1)
+	defer stale.Close()
+	if !stale.Missed {
+		t.Fatal("an ID from an earlier process should be reported as missed")
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	bus := NewBus(0)
+	sub := bus.Subscribe(0)
+	for i := 0; i <= subscriberBuffer; i++ {
+		bus.Publish(TypeSession, i)
+	}
+	n := 0
+	for range sub.C {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Fatalf("expected %d buffered events before the feed closed, got %d", subscriberBuffer, n)
+	}
+	sub.Close()
+}
+
+func TestNilBusDiscards(t *testing.T) {
+	var bus *Bus
+	bus.Publish(TypeNode, nil)
+}
@@ -0,0 +1,138 @@
+// Package geo maps a warden's public IP to the region code it registers on chain and
+// computes the IP hash registered with it. Regions come from an offline table shipped with
+// the binary, so registration does not depend on a GeoIP service.
+package geo
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Region codes, as used on chain by Warden.RegionCode and ProtocolConfig.GeoPremiums.
+const (
+	RegionUS     uint8 = 0
+	RegionEU     uint8 = 1
+	RegionAsia   uint8 = 2
+	RegionLatAm  uint8 = 3
+	RegionAfrica uint8 = 4
+)
+
+// Regions maps the region codes to their names.
+var Regions = map[uint8]string{
+	RegionUS:     "us",
+	RegionEU:     "eu",
+	RegionAsia:   "asia",
+	RegionLatAm:  "latam",
+	RegionAfrica: "africa",
+}
+
+// IPHashSalt is prefixed to the IP before hashing, so the registered hash cannot be matched
+// against hashes of the same IP made for other purposes. IPHash documents the encoding.
+const IPHashSalt = "arkham-warden-ip/v1:"
+
+// IPHash returns the hash a warden registers for its egress IP: SHA-256 over IPHashSalt
+// followed by the IP in its canonical text form, with IPv4-mapped IPv6 addresses unmapped.
+func IPHash(ip netip.Addr) [32]byte {
+	return sha256.Sum256([]byte(IPHashSalt + ip.Unmap().String()))
+}
+
+//go:embed regions.txt
+var regionsTable []byte
+
+type entry struct {
+	prefix netip.Prefix
+	region uint8
+}
+
+// table returns the parsed region table, longest prefixes first.
+var table = sync.OnceValue(func() []entry {
+	entries, err := parseTable(regionsTable)
+	if err != nil {
+		panic(err)
+	}
+	return entries
+})
+
+func parseTable(data []byte) ([]entry, error) {
+	codes := make(map[string]uint8, len(Regions))
+	for code, name := range Regions {
+		codes[name] = code
+	}
+
+	var entries []entry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("regions.txt:%d: expected a prefix and a region", line)
+		}
+		prefix, err := netip.ParsePrefix(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("regions.txt:%d: %w", line, err)
+		}
+		code, ok := codes[fields[1]]
+		if !ok {
+			return nil, fmt.Errorf("regions.txt:%d: unknown region %q", line, fields[1])
+		}
+		entries = append(entries, entry{prefix.Masked(), code})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].prefix.Bits() > entries[j].prefix.Bits()
+	})
+	return entries, nil
+}
+
+// Lookup returns the region of a public IP, or false when the table does not cover it.
+func Lookup(ip netip.Addr) (uint8, bool) {
+	ip = ip.Unmap()
+	for _, e := range table() {
+		if e.prefix.Contains(ip) {
+			return e.region, true
+		}
+	}
+	return 0, false
+}
+
+// IsPublic reports whether an IP can identify a warden's egress.
+func IsPublic(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
+
+// Location is what a warden registers about its egress IP.
+type Location struct {
+	IP         netip.Addr
+	RegionCode uint8
+	IPHash     [32]byte
+}
+
+// Locate resolves the region and IP hash of a public egress IP.
+func Locate(ip netip.Addr) (Location, error) {
+	if !IsPublic(ip) {
+		return Location{}, fmt.Errorf("%s is not a public IP", ip)
+	}
+	region, ok := Lookup(ip)
+	if !ok {
+		return Location{}, fmt.Errorf("no region is known for %s", ip)
+	}
+	return Location{IP: ip.Unmap(), RegionCode: region, IPHash: IPHash(ip)}, nil
+}
+
+// Region returns the name of the location's region.
+func (l Location) Region() string {
+	return Regions[l.RegionCode]
+}
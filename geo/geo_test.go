@@ -0,0 +1,60 @@
+package geo
+
+import (
+	"crypto/sha256"
+	"net/netip"
+	"testing"
+)
+
+func TestTableParses(t *testing.T) {
+	entries, err := parseTable(regionsTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) == 0 {
+		t.Fatal("region table is empty")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want uint8
+	}{
+		{"8.8.8.8", RegionUS},
+		{"81.2.69.142", RegionEU},
+		{"1.1.1.1", RegionAsia},
+		{"200.160.2.3", RegionLatAm},
+		{"41.0.0.1", RegionAfrica},
+		{"::ffff:8.8.8.8", RegionUS},
+		{"2a00:1450::1", RegionEU},
+		// A longer prefix wins over the /12 or /16 around it.
+		{"2001:1200::1", RegionLatAm},
+	}
+	for _, tt := range tests {
+		got, ok := Lookup(netip.MustParseAddr(tt.ip))
+		if !ok || got != tt.want {
+			t.Errorf("Lookup(%s) = %d, %v; want %d", tt.ip, got, ok, tt.want)
+		}
+	}
+}
+
+func TestLocate(t *testing.T) {
+	for _, ip := range []string{"10.0.0.1", "192.168.1.1", "127.0.0.1", "fd00::1"} {
+		if _, err := Locate(netip.MustParseAddr(ip)); err == nil {
+			t.Errorf("expected %s to be rejected", ip)
+		}
+	}
+
+	loc, err := Locate(netip.MustParseAddr("::ffff:81.2.69.142"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Region() != "eu" {
+		t.Fatalf("region = %s, want eu", loc.Region())
+	}
+	// The hash is over the salted canonical IPv4 form, whichever way the IP was written.
+	if loc.IPHash != sha256.Sum256([]byte("arkham-warden-ip/v1:81.2.69.142")) {
+		t.Fatal("unexpected IP hash")
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"arkham-cli/apiv1"
+	"arkham-cli/cmd"
+)
+
+const (
+	sessionCookie = "arkham_session"
+	tokenHeader   = "X-Arkham-Token"
+	tokenParam    = "token"
+	// loginFailureDelay slows down password guessing.
+	loginFailureDelay = time.Second
+)
+
+// guiSecurity guards the GUI server. Every launch gets a random session token; the browser
+// receives it through the URL the CLI opens and keeps it in a SameSite=Strict cookie, and
+// API requests must present it. Host and Origin headers are checked against the names the
+// server is reachable under, which stops DNS rebinding and cross-site requests.
+type guiSecurity struct {
+	token        string
+	passwordHash [32]byte
+	hasPassword  bool
+	tls          bool
+	allowedHosts map[string]bool
+	// extraHosts is set when hosts besides the loopback names were configured.
+	extraHosts bool
+}
+
+func newGuiSecurity(cfg cmd.GuiConfig, tls bool) (*guiSecurity, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate session token: %w", err)
+	}
+	g := &guiSecurity{
+		token: hex.EncodeToString(buf),
+		tls:   tls,
+		allowedHosts: map[string]bool{
+			"localhost": true,
+			"127.0.0.1": true,
+			"::1":       true,
+		},
+	}
+	if cfg.Password != "" {
+		g.passwordHash = sha256.Sum256([]byte(cfg.Password))
+		g.hasPassword = true
+	}
+	for _, host := range cfg.AllowedHosts {
+		g.allowedHosts[strings.ToLower(host)] = true
+		g.extraHosts = true
+	}
+	return g, nil
+}
+
+// isLoopback reports whether a listen address only accepts local connections.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// checkHost accepts loopback names and configured hosts. Over TLS any host is accepted
+// unless hosts were configured, because a rebinding attacker cannot present our
+// certificate.
+func (g *guiSecurity) checkHost(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	if g.allowedHosts[host] {
+		return true
+	}
+	return g.tls && !g.extraHosts
+}
+
+// checkOrigin requires a browser Origin, when there is one, to be this server.
+func (g *guiSecurity) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	scheme := "http"
+	if g.tls {
+		scheme = "https"
+	}
+	return u.Scheme == scheme && strings.EqualFold(u.Host, r.Host)
+}
+
+func (g *guiSecurity) validToken(candidate string) bool {
+	return candidate != "" && subtle.ConstantTimeCompare([]byte(candidate), []byte(g.token)) == 1
+}
+
+// authenticated reports whether the request carries the session token.
+func (g *guiSecurity) authenticated(r *http.Request) bool {
+	if g.validToken(r.Header.Get(tokenHeader)) {
+		return true
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil && g.validToken(c.Value) {
+		return true
+	}
+	return false
+}
+
+func (g *guiSecurity) setSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    g.token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   g.tls,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// wrap applies the host, origin and session checks in front of next.
+func (g *guiSecurity) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !g.checkHost(r.Host) {
+			http.Error(w, "Unrecognised Host header", http.StatusMisdirectedRequest)
+			return
+		}
+		if !g.checkOrigin(r) {
+			http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+			return
+		}
+
+		// The launch URL carries the token once; swap it for a cookie and drop it from the
+		// address bar.
+		if token := r.URL.Query().Get(tokenParam); token != "" {
+			if !g.validToken(token) {
+				http.Error(w, "Invalid session token", http.StatusUnauthorized)
+				return
+			}
+			g.setSessionCookie(w)
+			clean := *r.URL
+			query := clean.Query()
+			query.Del(tokenParam)
+			clean.RawQuery = query.Encode()
+			http.Redirect(w, r, clean.RequestURI(), http.StatusSeeOther)
+			return
+		}
+
+		if r.URL.Path == "/login" && g.hasPassword {
+			g.handleLogin(w, r)
+			return
+		}
+
+		// Static assets carry nothing secret; everything else needs the session.
+		if strings.HasPrefix(r.URL.Path, "/_app/") || r.URL.Path == "/favicon.png" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !g.authenticated(r) {
+			g.deny(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (g *guiSecurity) deny(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, apiv1.Prefix+"/") {
+		writeAPIError(w, apiv1.NewError(http.StatusUnauthorized, apiv1.CodeUnauthorized, "Missing or invalid session token"))
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		http.Error(w, "Missing or invalid session token", http.StatusUnauthorized)
+		return
+	}
+	if g.hasPassword {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	http.Error(w, "Open the GUI with the link printed by `arkham-cli gui`.", http.StatusUnauthorized)
+}
+
+const loginPage = `<!doctype html>
+<html><head><meta charset="utf-8"><title>Arkham GUI</title></head>
+<body style="font-family:sans-serif;max-width:20em;margin:4em auto">
+<h2>Arkham GUI</h2>%s
+<form method="POST" action="/login">
+<input type="password" name="password" placeholder="Password" autofocus style="width:100%%">
+<button type="submit" style="margin-top:1em">Sign in</button>
+</form></body></html>`
+
+// handleLogin exchanges the GUI password for the session cookie.
+func (g *guiSecurity) handleLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method != http.MethodPost {
+		fmt.Fprintf(w, loginPage, "")
+		return
+	}
+	hash := sha256.Sum256([]byte(r.PostFormValue("password")))
+	if subtle.ConstantTimeCompare(hash[:], g.passwordHash[:]) != 1 {
+		time.Sleep(loginFailureDelay)
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, loginPage, "<p>Wrong password.</p>")
+		return
+	}
+	g.setSessionCookie(w)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// injectToken adds the session token to index.html and makes the UI's same-origin API
+// calls send it as a header, for browsers that withhold the cookie.
+func (g *guiSecurity) injectToken(index []byte) []byte {
+	snippet := fmt.Sprintf(`<meta name="arkham-token" content="%[1]s">
+<script>(function(){var t=%[1]q,f=window.fetch;window.fetch=function(i,o){var u=typeof i==="string"?i:i.url;if(u.startsWith("/api/")){o=o||{};o.headers=new Headers(o.headers||{});o.headers.set(%[2]q,t)}return f.call(this,i,o)}})();</script>
+</head>`, g.token, tokenHeader)
+	return bytes.Replace(index, []byte("</head>"), []byte(snippet), 1)
+}
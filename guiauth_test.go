@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"arkham-cli/cmd"
+)
+
+func newTestGuiSecurity(t *testing.T, cfg cmd.GuiConfig, tls bool) (*guiSecurity, http.Handler) {
+	t.Helper()
+	g, err := newGuiSecurity(cfg, tls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := g.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	return g, handler
+}
+
+func serve(handler http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestGuiRequiresSessionToken(t *testing.T) {
+	g, handler := newTestGuiSecurity(t, cmd.GuiConfig{}, false)
+
+	r := httptest.NewRequest(http.MethodPost, "http://127.0.0.1:8088/api/node/start", nil)
+	if w := serve(handler, r); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "http://127.0.0.1:8088/api/node/start", nil)
+	r.Header.Set(tokenHeader, g.token)
+	if w := serve(handler, r); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 with the token header, got %d", w.Code)
+	}
+
+	// The launch URL swaps the token for a cookie.
+	r = httptest.NewRequest(http.MethodGet, "http://127.0.0.1:8088/?token="+g.token, nil)
+	w := serve(handler, r)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/" {
+		t.Fatalf("expected a redirect to /, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != g.token || cookies[0].SameSite != http.SameSiteStrictMode {
+		t.Fatalf("expected a SameSite=Strict session cookie, got %v", cookies)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "http://localhost:8088/api/node/status", nil)
+	r.AddCookie(cookies[0])
+	if w := serve(handler, r); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 with the session cookie, got %d", w.Code)
+	}
+}
+
+func TestGuiRejectsForeignHostAndOrigin(t *testing.T) {
+	g, handler := newTestGuiSecurity(t, cmd.GuiConfig{}, false)
+
+	// DNS rebinding: an attacker's name resolving to 127.0.0.1.
+	r := httptest.NewRequest(http.MethodPost, "http://evil.example:8088/api/create-profile", nil)
+	r.Header.Set(tokenHeader, g.token)
+	if w := serve(handler, r); w.Code != http.StatusMisdirectedRequest {
+		t.Fatalf("expected 421 for a foreign Host, got %d", w.Code)
+	}
+
+	// CSRF: a page on another origin posting to the GUI with the victim's cookie.
+	r = httptest.NewRequest(http.MethodPost, "http://127.0.0.1:8088/api/create-profile", nil)
+	r.Header.Set("Origin", "https://evil.example")
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: g.token})
+	if w := serve(handler, r); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a foreign Origin, got %d", w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "http://127.0.0.1:8088/api/create-profile", nil)
+	r.Header.Set("Origin", "http://127.0.0.1:8088")
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: g.token})
+	if w := serve(handler, r); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a same-origin request, got %d", w.Code)
+	}
+}
+
+func TestGuiPasswordLogin(t *testing.T) {
+	g, handler := newTestGuiSecurity(t, cmd.GuiConfig{Password: "hunter2", AllowedHosts: []string{"vpn.example"}}, true)
+
+	r := httptest.NewRequest(http.MethodGet, "https://vpn.example/", nil)
+	if w := serve(handler, r); w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login" {
+		t.Fatalf("expected a redirect to /login, got %d", w.Code)
+	}
+
+	form := url.Values{"password": {"hunter2"}}
+	r = httptest.NewRequest(http.MethodPost, "https://vpn.example/login", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Origin", "https://vpn.example")
+	w := serve(handler, r)
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusSeeOther || len(cookies) != 1 || cookies[0].Value != g.token || !cookies[0].Secure {
+		t.Fatalf("expected a secure session cookie after login, got %d %v", w.Code, cookies)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "https://other.example/", nil)
+	if w := serve(handler, r); w.Code != http.StatusMisdirectedRequest {
+		t.Fatalf("expected hosts outside ARKHAM_GUI_ALLOWED_HOSTS to be refused, got %d", w.Code)
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1:8088": true,
+		"[::1]:8088":     true,
+		"localhost:8088": true,
+		"0.0.0.0:8088":   false,
+		":8088":          false,
+		"10.0.0.5:8088":  false,
+	} {
+		if got := isLoopback(addr); got != want {
+			t.Errorf("isLoopback(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package solanatest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"arkham-cli/internal/solanatest"
+	ap "arkham-cli/solana"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+func TestAccountCacheExpiresEntries(t *testing.T) {
+	cache := ap.NewAccountCache()
+	key := solana.NewWallet().PublicKey()
+
+	if _, ok := cache.Get(key); ok {
+		t.Fatal("empty cache returned an entry")
+	}
+	cache.PutWithTTL(key, []byte{1, 2, 3}, 50*time.Millisecond)
+	if data, ok := cache.Get(key); !ok || len(data) != 3 {
+		t.Fatalf("live entry = %v, %v", data, ok)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := cache.Get(key); ok {
+		t.Fatal("cache returned an expired entry")
+	}
+
+	// A missing account is cached as a live entry with nil data.
+	cache.Put(key, nil)
+	if data, ok := cache.Get(key); !ok || data != nil {
+		t.Fatalf("missing account = %v, %v", data, ok)
+	}
+	cache.Invalidate(key)
+	if _, ok := cache.Get(key); ok {
+		t.Fatal("invalidated entry is still cached")
+	}
+}
+
+func TestGetMultipleAccountsBatchesAndCaches(t *testing.T) {
+	chain := solanatest.NewServer(t)
+	client := chain.Client(solana.NewWallet().PrivateKey)
+
+	keys := make([]solana.PublicKey, 250)
+	for i := range keys {
+		keys[i] = solana.NewWallet().PublicKey()
+		if i%2 == 0 {
+			chain.SetAccount(keys[i], solanatest.Account{Lamports: 1, Data: []byte{byte(i)}})
+		}
+	}
+	// Duplicates are loaded once.
+	request := append(keys, keys[0], keys[1])
+
+	accounts, err := client.GetMultipleAccounts(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := chain.Requests("getMultipleAccounts"); n != 3 {
+		t.Fatalf("loaded 250 accounts in %d requests, want 3", n)
+	}
+	if len(accounts) != len(keys) {
+		t.Fatalf("got %d accounts, want %d", len(accounts), len(keys))
+	}
+	for i, key := range keys {
+		data := accounts[key]
+		if i%2 == 0 && (len(data) != 1 || data[0] != byte(i)) {
+			t.Fatalf("account %d = %v", i, data)
+		}
+		if i%2 == 1 && data != nil {
+			t.Fatalf("missing account %d = %v", i, data)
+		}
+	}
+
+	// Existing and missing accounts are both served from the cache.
+	if _, err := client.GetMultipleAccounts(context.Background(), keys); err != nil {
+		t.Fatal(err)
+	}
+	if n := chain.Requests("getMultipleAccounts"); n != 3 {
+		t.Fatalf("cached accounts were loaded again: %d requests", n)
+	}
+
+	client.Cache.Invalidate(keys[0], keys[1])
+	if _, err := client.GetMultipleAccounts(context.Background(), keys); err != nil {
+		t.Fatal(err)
+	}
+	if n := chain.Requests("getMultipleAccounts"); n != 4 {
+		t.Fatalf("invalidated accounts took %d requests, want 4", n-3)
+	}
+}
+
+func TestTransactionsInvalidateOnceConfirmed(t *testing.T) {
+	chain := solanatest.NewServer(t)
+	signer := solana.NewWallet().PrivateKey
+	client := chain.Client(signer)
+	seekerPDA, _, _ := ap.GetSeekerPDA(signer.PublicKey())
+	setEscrow := func(balance uint64) {
+		chain.SetProgramAccount(seekerPDA, ap.Account_Seeker, ap.Seeker{
+			Authority:     signer.PublicKey(),
+			EscrowBalance: balance,
+		})
+	}
+	escrow := func() uint64 {
+		t.Helper()
+		seeker, err := client.FetchSeekerAccount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return seeker.EscrowBalance
+	}
+
+	setEscrow(1000)
+	if got := escrow(); got != 1000 {
+		t.Fatalf("escrow = %d, want 1000", got)
+	}
+
+	// While the deposit is unconfirmed the node still serves the old state, so reading it
+	// must not refresh the cache with that state.
+	chain.HoldConfirmations(true)
+	if _, err := client.DepositEscrow(700, false); err != nil {
+		t.Fatal(err)
+	}
+	loads := chain.Requests("getMultipleAccounts")
+	if got := escrow(); got != 1000 {
+		t.Fatalf("escrow before confirmation = %d, want 1000", got)
+	}
+	if n := chain.Requests("getMultipleAccounts"); n != loads {
+		t.Fatal("the seeker was reloaded before the deposit was confirmed")
+	}
+
+	setEscrow(1700)
+	chain.HoldConfirmations(false)
+	deadline := time.Now().Add(10 * time.Second)
+	for escrow() != 1700 {
+		if time.Now().After(deadline) {
+			t.Fatal("the seeker was not reloaded after the deposit was confirmed")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestFetchAllWardensScansOnceAndDecodesAccounts(t *testing.T) {
+	chain := solanatest.NewServer(t)
+	client := chain.Client(solana.NewWallet().PrivateKey)
+	authorities := map[solana.PublicKey]bool{}
+	for range 3 {
+		authority := solana.NewWallet().PublicKey()
+		pda, _, _ := ap.GetWardenPDAForAuthority(authority)
+		chain.SetProgramAccount(pda, ap.Account_Warden, ap.Warden{Authority: authority, PeerId: "peer"})
+		authorities[authority] = true
+	}
+
+	for i := range 2 {
+		wardens, warnings, err := client.FetchAllWardens()
+		if err != nil || len(warnings) != 0 {
+			t.Fatalf("fetch %d: %v, %v", i, err, warnings)
+		}
+		if len(wardens) != len(authorities) {
+			t.Fatalf("fetch %d returned %d wardens, want %d", i, len(wardens), len(authorities))
+		}
+		for _, w := range wardens {
+			if !authorities[w.Authority] || w.PeerId != "peer" {
+				t.Fatalf("fetch %d decoded %+v", i, w)
+			}
+		}
+	}
+	if n := chain.Requests("getProgramAccounts"); n != 1 {
+		t.Fatalf("scanned the program accounts %d times, want once", n)
+	}
+}
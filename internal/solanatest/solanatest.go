@@ -0,0 +1,334 @@
+// Package solanatest provides an in-memory Solana JSON-RPC server for tests. It serves the
+// RPC methods the Arkham client uses from a map of accounts, and records the transactions
+// sent to it; tests apply a transaction's effects with OnTransaction.
+package solanatest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	ap "arkham-cli/solana"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/mr-tron/base58"
+)
+
+// Account is an account held by the server.
+type Account struct {
+	Lamports uint64
+	Owner    solana.PublicKey
+	Data     []byte
+}
+
+// Server is a fake Solana RPC node.
+type Server struct {
+	URL string
+
+	// OnTransaction is called with every transaction sent, before it is recorded. An
+	// error rejects the transaction.
+	OnTransaction func(tx *solana.Transaction) error
+
+	mu           sync.Mutex
+	accounts     map[solana.PublicKey]Account
+	transactions []*solana.Transaction
+	requests     map[string]int
+	pending      bool
+}
+
+// NewServer starts a server that is closed with the test.
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		accounts: make(map[solana.PublicKey]Account),
+		requests: make(map[string]int),
+	}
+	server := httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(server.Close)
+	s.URL = server.URL
+	return s
+}
+
+// Client returns a client for the server signing with signer. It has its own account
+// cache, so tests do not share cached state.
+func (s *Server) Client(signer solana.PrivateKey) *ap.Client {
+	client, _ := ap.NewClient(s.URL, signer)
+	client.Cache = ap.NewAccountCache()
+	return client
+}
+
+// SetAccount stores an account.
+func (s *Server) SetAccount(key solana.PublicKey, account Account) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounts[key] = account
+}
+
+// SetProgramAccount stores an Arkham program account, encoded with its discriminator.
+func (s *Server) SetProgramAccount(key solana.PublicKey, discriminator [8]byte, value bin.BinaryMarshaler) {
+	buf := new(bytes.Buffer)
+	buf.Write(discriminator[:])
+	if err := value.MarshalWithEncoder(bin.NewBorshEncoder(buf)); err != nil {
+		panic(fmt.Sprintf("solanatest: failed to encode account %s: %v", key, err))
+	}
+	s.SetAccount(key, Account{Lamports: 1_000_000, Owner: ap.ProgramID, Data: buf.Bytes()})
+}
+
+// SetBalance sets the lamports of an account, creating it as a system account if needed.
+func (s *Server) SetBalance(key solana.PublicKey, lamports uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account, ok := s.accounts[key]
+	if !ok {
+		account.Owner = solana.SystemProgramID
+	}
+	account.Lamports = lamports
+	s.accounts[key] = account
+}
+
+// DeleteAccount removes an account.
+func (s *Server) DeleteAccount(key solana.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.accounts, key)
+}
+
+// HoldConfirmations makes the server report transactions as processed but not yet confirmed
+// while hold is true.
+func (s *Server) HoldConfirmations(hold bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = hold
+}
+
+// Transactions returns the transactions sent so far.
+func (s *Server) Transactions() []*solana.Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*solana.Transaction(nil), s.transactions...)
+}
+
+// Requests returns how many times an RPC method was called.
+func (s *Server) Requests(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[method]
+}
+
+// ProgramInstructions returns the Arkham instructions of the transactions sent so far,
+// with their data and account keys.
+func (s *Server) ProgramInstructions() []Instruction {
+	var instructions []Instruction
+	for _, tx := range s.Transactions() {
+		instructions = append(instructions, ProgramInstructions(tx)...)
+	}
+	return instructions
+}
+
+// ProgramInstructions returns the Arkham instructions of one transaction, for use in
+// OnTransaction.
+func ProgramInstructions(tx *solana.Transaction) []Instruction {
+	var instructions []Instruction
+	for _, ix := range tx.Message.Instructions {
+		program, err := tx.Message.Program(ix.ProgramIDIndex)
+		if err != nil || !program.Equals(ap.ProgramID) {
+			continue
+		}
+		accounts, _ := ix.ResolveInstructionAccounts(&tx.Message)
+		keys := make([]solana.PublicKey, len(accounts))
+		for i, a := range accounts {
+			keys[i] = a.PublicKey
+		}
+		instructions = append(instructions, Instruction{Data: ix.Data, Accounts: keys})
+	}
+	return instructions
+}
+
+// Instruction is an Arkham instruction sent to the server.
+type Instruction struct {
+	Data     []byte
+	Accounts []solana.PublicKey
+}
+
+// Is reports whether the instruction has the given discriminator.
+func (ix Instruction) Is(discriminator [8]byte) bool {
+	return len(ix.Data) >= 8 && bytes.Equal(ix.Data[:8], discriminator[:])
+}
+
+type request struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.requests[req.Method]++
+	s.mu.Unlock()
+
+	result, err := s.handle(req)
+	resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+	if err != nil {
+		resp["error"] = rpcError{Code: -32000, Message: err.Error()}
+	} else {
+		resp["result"] = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) handle(req request) (any, error) {
+	context := map[string]any{"slot": 1}
+	switch req.Method {
+	case "getLatestBlockhash":
+		return map[string]any{
+			"context": context,
+			"value":   map[string]any{"blockhash": solana.Hash{1}.String(), "lastValidBlockHeight": 1000},
+		}, nil
+	case "getBalance":
+		var key solana.PublicKey
+		if err := param(req, 0, &key); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return map[string]any{"context": context, "value": s.accounts[key].Lamports}, nil
+	case "getMultipleAccounts":
+		var keys []solana.PublicKey
+		if err := param(req, 0, &keys); err != nil {
+			return nil, err
+		}
+		if len(keys) > 100 {
+			return nil, fmt.Errorf("Too many inputs provided; max 100")
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		value := make([]*rpc.Account, len(keys))
+		for i, key := range keys {
+			if account, ok := s.accounts[key]; ok {
+				value[i] = rpcAccount(account)
+			}
+		}
+		return map[string]any{"context": context, "value": value}, nil
+	case "getProgramAccounts":
+		var program solana.PublicKey
+		var opts struct {
+			Filters []struct {
+				DataSize uint64 `json:"dataSize"`
+				Memcmp   *struct {
+					Offset uint64 `json:"offset"`
+					Bytes  string `json:"bytes"`
+				} `json:"memcmp"`
+			} `json:"filters"`
+		}
+		if err := param(req, 0, &program); err != nil {
+			return nil, err
+		}
+		if len(req.Params) > 1 {
+			if err := param(req, 1, &opts); err != nil {
+				return nil, err
+			}
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		result := rpc.GetProgramAccountsResult{}
+	accounts:
+		for key, account := range s.accounts {
+			if !account.Owner.Equals(program) {
+				continue
+			}
+			for _, f := range opts.Filters {
+				if f.DataSize != 0 && uint64(len(account.Data)) != f.DataSize {
+					continue accounts
+				}
+				if f.Memcmp != nil {
+					want, err := base58.Decode(f.Memcmp.Bytes)
+					if err != nil {
+						return nil, err
+					}
+					end := f.Memcmp.Offset + uint64(len(want))
+					if end > uint64(len(account.Data)) || !bytes.Equal(account.Data[f.Memcmp.Offset:end], want) {
+						continue accounts
+					}
+				}
+			}
+			result = append(result, &rpc.KeyedAccount{Pubkey: key, Account: rpcAccount(account)})
+		}
+		return result, nil
+	case "sendTransaction":
+		var encoded string
+		if err := param(req, 0, &encoded); err != nil {
+			return nil, err
+		}
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, err
+		}
+		tx, err := solana.TransactionFromDecoder(bin.NewBinDecoder(data))
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.VerifySignatures(); err != nil {
+			return nil, err
+		}
+		if s.OnTransaction != nil {
+			if err := s.OnTransaction(tx); err != nil {
+				return nil, err
+			}
+		}
+		s.mu.Lock()
+		s.transactions = append(s.transactions, tx)
+		s.mu.Unlock()
+		return tx.Signatures[0].String(), nil
+	case "getSignatureStatuses":
+		var sigs []solana.Signature
+		if err := param(req, 0, &sigs); err != nil {
+			return nil, err
+		}
+		status := "confirmed"
+		s.mu.Lock()
+		if s.pending {
+			status = "processed"
+		}
+		s.mu.Unlock()
+		value := make([]map[string]any, len(sigs))
+		for i := range sigs {
+			value[i] = map[string]any{"slot": 1, "confirmations": nil, "err": nil, "confirmationStatus": status}
+		}
+		return map[string]any{"context": context, "value": value}, nil
+	case "getSignaturesForAddress":
+		return []any{}, nil
+	}
+	return nil, fmt.Errorf("solanatest: method %s is not supported", req.Method)
+}
+
+func param(req request, i int, v any) error {
+	if i >= len(req.Params) {
+		return fmt.Errorf("%s: missing parameter %d", req.Method, i)
+	}
+	return json.Unmarshal(req.Params[i], v)
+}
+
+func rpcAccount(account Account) *rpc.Account {
+	return &rpc.Account{
+		Lamports: account.Lamports,
+		Owner:    account.Owner,
+		Data:     rpc.DataBytesOrJSONFromBytes(account.Data),
+	}
+}
@@ -0,0 +1,329 @@
+// Package journal is a crash-safe log of paid sessions and the bandwidth receipts that
+// settle them. Every record is appended and fsynced before the step it describes is
+// taken, so a process restarting after a crash knows which sessions it had open, how many
+// bytes they moved, and which signed receipts have not reached the chain yet.
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kinds of record.
+const (
+	// KindOpen starts a session.
+	KindOpen = "open"
+	// KindBytes sets the bytes a session has moved so far.
+	KindBytes = "bytes"
+	// KindReceipt records a signed receipt before it is sent or submitted.
+	KindReceipt = "receipt"
+	// KindSubmitted records that a receipt reached the chain.
+	KindSubmitted = "submitted"
+	// KindAbandoned records that a receipt can no longer be submitted, because its
+	// connection has ended.
+	KindAbandoned = "abandoned"
+	// KindClose ends a session.
+	KindClose = "close"
+)
+
+// compactEvery is how many appends the journal takes before it is rewritten with only
+// the open sessions and pending receipts.
+const compactEvery = 4096
+
+// Record is one journal entry. Which fields are set depends on Kind.
+type Record struct {
+	Kind    string    `json:"kind"`
+	Session string    `json:"session,omitempty"`
+	Time    time.Time `json:"time"`
+	// Peer, Seeker, Wardens and Mb describe the session in KindOpen records: the remote
+	// peer, the paying seeker's authority, and the wardens and MB its connections were
+	// opened with.
+	Peer    string   `json:"peer,omitempty"`
+	Seeker  string   `json:"seeker,omitempty"`
+	Wardens []string `json:"wardens,omitempty"`
+	Mb      []uint64 `json:"mb,omitempty"`
+	Bytes   uint64   `json:"bytes,omitempty"`
+	Receipt *Receipt `json:"receipt,omitempty"`
+	// Transaction is the signature of the transaction that submitted the receipt. It is
+	// empty when the submission was only acknowledged by the warden or found on chain.
+	Transaction string `json:"transaction,omitempty"`
+}
+
+// Receipt is a bandwidth proof signed by a seeker, as the program verifies it.
+type Receipt struct {
+	Seeker    string `json:"seeker"`
+	Warden    string `json:"warden"`
+	Mb        uint64 `json:"mb"`
+	Timestamp int64  `json:"timestamp"`
+	Signature []byte `json:"signature"`
+}
+
+func (r *Receipt) key() string {
+	return hex.EncodeToString(r.Signature)
+}
+
+// Session is a session the journal holds open.
+type Session struct {
+	ID      string    `json:"id"`
+	Peer    string    `json:"peer,omitempty"`
+	Seeker  string    `json:"seeker,omitempty"`
+	Wardens []string  `json:"wardens,omitempty"`
+	Mb      []uint64  `json:"mb,omitempty"`
+	Opened  time.Time `json:"opened"`
+	Bytes   uint64    `json:"bytes"`
+	Updated time.Time `json:"updated"`
+}
+
+// Pending is a receipt that has not been submitted or abandoned.
+type Pending struct {
+	Receipt
+	Session string    `json:"session,omitempty"`
+	Signed  time.Time `json:"signed"`
+}
+
+// Journal is an open journal file. It is safe for concurrent use within one process; only
+// one process may have a journal open at a time.
+type Journal struct {
+	mu       sync.Mutex
+	path     string
+	f        *os.File
+	sessions map[string]*Session
+	pending  map[string]*Pending
+	appended int
+}
+
+// Open replays the journal at path, creating it if it does not exist, and compacts it.
+// A torn record at the end, from a crash in the middle of an append, is dropped.
+func Open(path string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+	j := &Journal{
+		path:     path,
+		sessions: make(map[string]*Session),
+		pending:  make(map[string]*Pending),
+	}
+	if err := j.replay(); err != nil {
+		return nil, err
+	}
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *Journal) replay() error {
+	f, err := os.Open(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// A record without its newline was never completely written.
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read journal: %w", err)
+		}
+		var rec Record
+		if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+			// Records after a corrupt one cannot be trusted to follow it.
+			return nil
+		}
+		j.apply(rec)
+	}
+}
+
+func (j *Journal) apply(r Record) {
+	switch r.Kind {
+	case KindOpen:
+		j.sessions[r.Session] = &Session{
+			ID:      r.Session,
+			Peer:    r.Peer,
+			Seeker:  r.Seeker,
+			Wardens: r.Wardens,
+			Mb:      r.Mb,
+			Opened:  r.Time,
+			Updated: r.Time,
+		}
+	case KindBytes:
+		if s, ok := j.sessions[r.Session]; ok {
+			s.Bytes = r.Bytes
+			s.Updated = r.Time
+		}
+	case KindReceipt:
+		if r.Receipt != nil {
+			j.pending[r.Receipt.key()] = &Pending{Receipt: *r.Receipt, Session: r.Session, Signed: r.Time}
+		}
+	case KindSubmitted, KindAbandoned:
+		if r.Receipt != nil {
+			delete(j.pending, r.Receipt.key())
+		}
+	case KindClose:
+		delete(j.sessions, r.Session)
+	}
+}
+
+// live returns the records that recreate the journal's state, oldest first.
+func (j *Journal) live() []Record {
+	var records []Record
+	for _, s := range j.sessions {
+		records = append(records, Record{
+			Kind:    KindOpen,
+			Session: s.ID,
+			Time:    s.Opened,
+			Peer:    s.Peer,
+			Seeker:  s.Seeker,
+			Wardens: s.Wardens,
+			Mb:      s.Mb,
+		})
+		if s.Bytes > 0 {
+			records = append(records, Record{Kind: KindBytes, Session: s.ID, Time: s.Updated, Bytes: s.Bytes})
+		}
+	}
+	for _, p := range j.pending {
+		receipt := p.Receipt
+		records = append(records, Record{Kind: KindReceipt, Session: p.Session, Time: p.Signed, Receipt: &receipt})
+	}
+	sort.SliceStable(records, func(a, b int) bool { return records[a].Time.Before(records[b].Time) })
+	return records
+}
+
+// compact rewrites the journal with only its live records and reopens it for appending.
+// The new file is synced before it replaces the old one, so a crash leaves either.
+func (j *Journal) compact() error {
+	if j.f != nil {
+		j.f.Close()
+		j.f = nil
+	}
+	dir := filepath.Dir(j.path)
+	tmp, err := os.CreateTemp(dir, ".journal-*")
+	if err != nil {
+		return fmt.Errorf("failed to compact journal: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	for _, r := range j.live() {
+		line, err := json.Marshal(r)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compact journal: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compact journal: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to compact journal: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		return fmt.Errorf("failed to compact journal: %w", err)
+	}
+	syncDir(dir)
+
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	j.f = f
+	j.appended = 0
+	return nil
+}
+
+// syncDir makes a rename in dir durable. Not every platform can sync a directory, so
+// failures are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// Append writes a record and syncs it to disk before returning. A zero Time is set to now.
+func (j *Journal) Append(r Record) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return fmt.Errorf("journal is closed")
+	}
+	if _, err := j.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to append to journal: %w", err)
+	}
+	if err := j.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+	j.apply(r)
+	j.appended++
+	if j.appended >= compactEvery {
+		return j.compact()
+	}
+	return nil
+}
+
+// Sessions returns the open sessions, oldest first.
+func (j *Journal) Sessions() []Session {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	sessions := make([]Session, 0, len(j.sessions))
+	for _, s := range j.sessions {
+		sessions = append(sessions, *s)
+	}
+	sort.Slice(sessions, func(a, b int) bool { return sessions[a].Opened.Before(sessions[b].Opened) })
+	return sessions
+}
+
+// Pending returns the receipts that have been neither submitted nor abandoned, oldest
+// first.
+func (j *Journal) Pending() []Pending {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	pending := make([]Pending, 0, len(j.pending))
+	for _, p := range j.pending {
+		pending = append(pending, *p)
+	}
+	sort.Slice(pending, func(a, b int) bool { return pending[a].Signed.Before(pending[b].Signed) })
+	return pending
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return nil
+	}
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
@@ -0,0 +1,87 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalReplaysAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seeker.journal")
+	j, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	submitted := &Receipt{Seeker: "s", Warden: "a", Mb: 1, Timestamp: 1, Signature: []byte{1}}
+	pending := &Receipt{Seeker: "s", Warden: "b", Mb: 2, Timestamp: 2, Signature: []byte{2}}
+	for _, r := range []Record{
+		{Kind: KindOpen, Session: "live", Wardens: []string{"a", "b"}, Mb: []uint64{5, 5}},
+		{Kind: KindOpen, Session: "done"},
+		{Kind: KindBytes, Session: "live", Bytes: 100},
+		{Kind: KindBytes, Session: "live", Bytes: 300},
+		{Kind: KindReceipt, Session: "live", Receipt: submitted},
+		{Kind: KindReceipt, Session: "live", Receipt: pending},
+		{Kind: KindSubmitted, Receipt: submitted, Transaction: "tx"},
+		{Kind: KindClose, Session: "done"},
+	} {
+		if err := j.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j.Close()
+
+	// A crash in the middle of an append leaves a torn last record.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"kind":"close","session":"li`)
+	f.Close()
+
+	j, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	sessions := j.Sessions()
+	if len(sessions) != 1 || sessions[0].ID != "live" || sessions[0].Bytes != 300 || len(sessions[0].Mb) != 2 {
+		t.Fatalf("sessions = %+v", sessions)
+	}
+	receipts := j.Pending()
+	if len(receipts) != 1 || receipts[0].Warden != "b" || receipts[0].Session != "live" {
+		t.Fatalf("pending = %+v", receipts)
+	}
+
+	// The reopened journal keeps appending after the compacted state.
+	if err := j.Append(Record{Kind: KindAbandoned, Receipt: pending}); err != nil {
+		t.Fatal(err)
+	}
+	if len(j.Pending()) != 0 {
+		t.Fatal("abandoned receipt is still pending")
+	}
+}
+
+func TestJournalCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "warden.journal")
+	j, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	j.Append(Record{Kind: KindOpen, Session: "s"})
+	for i := 0; i < compactEvery; i++ {
+		if err := j.Append(Record{Kind: KindBytes, Session: "s", Bytes: uint64(i + 1)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 1024 {
+		t.Fatalf("journal is %d bytes after compaction", info.Size())
+	}
+	if s := j.Sessions(); len(s) != 1 || s[0].Bytes != compactEvery {
+		t.Fatalf("sessions after compaction = %+v", s)
+	}
+}
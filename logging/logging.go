@@ -0,0 +1,90 @@
+// Package logging builds the structured loggers handed to the library packages. Every
+// logger it creates redacts key material, whatever attribute it is logged under.
+package logging
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/libp2p/go-libp2p/core/crypto"
+)
+
+// Output formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Redacted replaces the value of sensitive attributes.
+const Redacted = "[REDACTED]"
+
+// Options selects a logger's level, format and destination.
+type Options struct {
+	// Level is the minimum level logged. The zero value is slog.LevelInfo.
+	Level slog.Level
+	// Format is FormatText (the default) or FormatJSON.
+	Format string
+	// Output defaults to os.Stderr so logs never mix with command output on stdout.
+	Output io.Writer
+}
+
+// New creates a logger from opts.
+func New(opts Options) (*slog.Logger, error) {
+	out := opts.Output
+	if out == nil {
+		out = os.Stderr
+	}
+	handlerOpts := &slog.HandlerOptions{Level: opts.Level, ReplaceAttr: Redact}
+	switch strings.ToLower(opts.Format) {
+	case "", FormatText:
+		return slog.New(slog.NewTextHandler(out, handlerOpts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(out, handlerOpts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q (want %s or %s)", opts.Format, FormatText, FormatJSON)
+	}
+}
+
+// ParseLevel parses debug, info, warn or error. An empty string is info.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return level, nil
+	}
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return level, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", s)
+	}
+	return level, nil
+}
+
+// Discard returns a logger that drops everything.
+func Discard() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// sensitiveKeys are attribute names, lower-cased, whose values are never logged.
+var sensitiveKeys = map[string]bool{
+	"privatekey": true, "private_key": true, "secret": true, "seed": true, "mnemonic": true,
+	"keypair": true, "password": true, "token": true, "authorization": true,
+}
+
+// Redact is a slog ReplaceAttr function that hides private keys and the values of
+// attributes named like secrets.
+func Redact(groups []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, Redacted)
+	}
+	if a.Value.Kind() != slog.KindAny {
+		return a
+	}
+	switch a.Value.Any().(type) {
+	case solana.PrivateKey, *solana.PrivateKey, ed25519.PrivateKey, crypto.PrivKey:
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+func TestRedactsKeyMaterial(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(Options{Format: FormatJSON, Output: &buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet := solana.NewWallet().PrivateKey
+	_, edKey, _ := ed25519.GenerateKey(nil)
+	logger.Info("keys", "wallet", wallet, "node", edKey, "password", "hunter2", "peer", "12D3Koo")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("output is not JSON: %v: %s", err, buf.String())
+	}
+	for _, key := range []string{"wallet", "node", "password"} {
+		if line[key] != Redacted {
+			t.Errorf("%s = %v, want %s", key, line[key], Redacted)
+		}
+	}
+	if line["peer"] != "12D3Koo" {
+		t.Errorf("peer = %v, want it untouched", line["peer"])
+	}
+	if strings.Contains(buf.String(), wallet.String()) {
+		t.Error("wallet key leaked into the log")
+	}
+}
+
+func TestLevelsAndFormats(t *testing.T) {
+	level, err := ParseLevel("warn")
+	if err != nil || level != slog.LevelWarn {
+		t.Fatalf("ParseLevel(warn) = %v, %v", level, err)
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("ParseLevel accepted an unknown level")
+	}
+	if _, err := New(Options{Format: "xml"}); err == nil {
+		t.Error("New accepted an unknown format")
+	}
+
+	var buf bytes.Buffer
+	logger, _ := New(Options{Level: level, Output: &buf})
+	logger.Info("hidden")
+	logger.Warn("shown", "n", 1)
+	if got := buf.String(); strings.Contains(got, "hidden") || !strings.Contains(got, "level=WARN msg=shown n=1") {
+		t.Errorf("unexpected text output: %q", got)
+	}
+}
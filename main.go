@@ -1,26 +1,37 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"runtime"
 	"strconv"
 	"strings"
-	"crypto/sha256"
+	"sync"
+	"syscall"
+	"time"
 
+	"arkham-cli/apiv1"
 	"arkham-cli/cmd"
+	"arkham-cli/daemon"
+	"arkham-cli/geo"
 	"arkham-cli/node"
+	"arkham-cli/pricing"
 	ap "arkham-cli/solana"
+	"arkham-cli/selection"
 	"arkham-cli/storage"
 	"github.com/gagliardetto/solana-go"
+	"github.com/libp2p/go-libp2p/core/peer"
 )
 
 //go:embed all:gui-assets
@@ -28,7 +39,18 @@ var embeddedUI embed.FS
 
 var p2pNode *node.P2PNode
 
+// serverCtx scopes background work started by the GUI server, such as account watchers.
+// startGuiServer cancels it on SIGINT or SIGTERM.
+var serverCtx = context.Background()
+
+// guiShutdownTimeout bounds how long in-flight GUI requests get to finish on shutdown.
+const guiShutdownTimeout = 10 * time.Second
+
 func main() {
+	if err := cmd.InitLogging(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	// Special handling for the 'gui' command before Cobra takes over.
 	if len(os.Args) > 1 && os.Args[1] == "gui" {
 		startGuiServer()
@@ -37,6 +59,23 @@ func main() {
 	}
 }
 
+// --- Shared Clients ---
+
+// arkhamd is the daemon embedded in the GUI process. It owns the node, the seeker circuit,
+// proof submission and the account watchers.
+var arkhamd *daemon.Daemon
+
+var (
+	walletStore    *storage.WalletStorage
+	readOnlyClient *ap.Client
+)
+
+// clientForProfile returns the long-lived client for a wallet profile, creating it and
+// starting its account watcher on first use. Tests replace it.
+var clientForProfile = func(profileName string) (*ap.Client, error) {
+	return arkhamd.ClientForProfile(profileName)
+}
+
 // --- API Handlers ---
 
 func handleNodeStart(w http.ResponseWriter, r *http.Request) {
@@ -71,43 +110,8 @@ func handleNodeStatus(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleP2PGraph(w http.ResponseWriter, r *http.Request) {
-	host := p2pNode.GetHost()
-	if host == nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode([]node.PeerInfo{})
-		return
-	}
-
-	peers := host.Peerstore().Peers()
-	var peerInfos []node.PeerInfo
-
-	for _, p := range peers {
-		if p == host.ID() {
-			continue
-		}
-
-		addrs := host.Peerstore().Addrs(p)
-		addrStrings := make([]string, len(addrs))
-		for i, addr := range addrs {
-			addrStrings[i] = addr.String()
-		}
-
-		var latency int64
-		if lat, err := host.Peerstore().Get(p, "latency"); err == nil {
-			if l, ok := lat.(int64); ok {
-				latency = l
-			}
-		}
-
-		peerInfos = append(peerInfos, node.PeerInfo{
-			ID:      p.String(),
-			Addrs:   addrStrings,
-			Latency: latency,
-		})
-	}
-
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(peerInfos)
+	json.NewEncoder(w).Encode(p2pNode.Peers())
 }
 
 func handleGetHistory(w http.ResponseWriter, r *http.Request) {
@@ -117,24 +121,13 @@ func handleGetHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, err := storage.NewWalletStorage()
-	if err != nil {
-		http.Error(w, "Failed to open wallet storage", http.StatusInternalServerError)
-		return
-	}
-	signer, err := db.GetWallet(profileName)
+	client, err := clientForProfile(profileName)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Profile '%s' not found", profileName), http.StatusBadRequest)
 		return
 	}
 
-	client, err := ap.NewClient(cmd.GetRpcEndpoint(), signer)
-	if err != nil {
-		http.Error(w, "Failed to create solana client", http.StatusInternalServerError)
-		return
-	}
-
-	history, err := client.GetHistory(signer.PublicKey())
+	history, err := client.GetHistory(client.Signer.PublicKey())
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get transaction history: %v", err), http.StatusInternalServerError)
 		return
@@ -145,12 +138,7 @@ func handleGetHistory(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleGetProfiles(w http.ResponseWriter, r *http.Request) {
-	db, err := storage.NewWalletStorage()
-	if err != nil {
-		http.Error(w, "failed to connect to wallet storage", http.StatusInternalServerError)
-		return
-	}
-	profiles, err := db.GetAllWalletNames()
+	profiles, err := walletStore.GetAllWalletNames()
 	if err != nil {
 		http.Error(w, "failed to get wallet profiles", http.StatusInternalServerError)
 		return
@@ -164,12 +152,7 @@ func handleGetProfiles(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleGetAddresses(w http.ResponseWriter, r *http.Request) {
-	db, err := storage.NewWalletStorage()
-	if err != nil {
-		http.Error(w, "failed to connect to wallet storage", http.StatusInternalServerError)
-		return
-	}
-	wallets, err := db.GetAllWallets()
+	wallets, err := walletStore.GetAllWallets()
 	if err != nil {
 		http.Error(w, "failed to get wallets", http.StatusInternalServerError)
 		return
@@ -200,26 +183,49 @@ func handleCreateProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, err := storage.NewWalletStorage()
-	if err != nil {
-		http.Error(w, "Failed to open wallet storage", http.StatusInternalServerError)
-		return
-	}
-
-	newWallet := solana.NewWallet()
-	err = db.SaveWallet(req.Profile, newWallet.PrivateKey)
+	publicKey, err := createProfile(req.Profile)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to save new %s wallet: %v", req.Profile, err), http.StatusInternalServerError)
+		httpError(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"profile": req.Profile,
-		"publicKey": newWallet.PublicKey().String(),
+		"publicKey": publicKey.String(),
 	})
 }
 
+// createProfile generates a wallet and stores it under a new profile name. Existing
+// profiles are never overwritten.
+func createProfile(name string) (solana.PublicKey, error) {
+	if err := apiv1.Validate(apiv1.CreateProfileRequest{Profile: name}); err != nil {
+		return solana.PublicKey{}, err
+	}
+	if _, err := walletStore.GetWallet(name); err == nil {
+		return solana.PublicKey{}, apiv1.Errorf(http.StatusConflict, apiv1.CodeConflict, "Profile '%s' already exists", name)
+	}
+
+	newWallet := solana.NewWallet()
+	if err := walletStore.SaveWallet(name, newWallet.PrivateKey); err != nil {
+		return solana.PublicKey{}, fmt.Errorf("failed to save new %s wallet: %w", name, err)
+	}
+	return newWallet.PublicKey(), nil
+}
+
+// httpError writes err as plain text for the legacy /api routes, with the status of its
+// v1 envelope.
+func httpError(w http.ResponseWriter, err error) {
+	apiErr := apiv1.AsError(err)
+	message := apiErr.Message
+	if fields, ok := apiErr.Details.([]apiv1.FieldError); ok {
+		for _, field := range fields {
+			message += fmt.Sprintf("; %s %s", field.Field, field.Message)
+		}
+	}
+	http.Error(w, message, apiErr.Status)
+}
+
 func handleGetBalance(w http.ResponseWriter, r *http.Request) {
 	profileName := r.URL.Query().Get("profile")
 	if profileName == "" {
@@ -227,24 +233,13 @@ func handleGetBalance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, err := storage.NewWalletStorage()
-	if err != nil {
-		http.Error(w, "Failed to open wallet storage", http.StatusInternalServerError)
-		return
-	}
-	signer, err := db.GetWallet(profileName)
+	client, err := clientForProfile(profileName)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Profile '%s' not found", profileName), http.StatusBadRequest)
 		return
 	}
 
-	client, err := ap.NewClient(cmd.GetRpcEndpoint(), signer)
-	if err != nil {
-		http.Error(w, "Failed to create solana client", http.StatusInternalServerError)
-		return
-	}
-
-	balance, err := client.GetBalance(signer.PublicKey())
+	balance, err := client.GetBalance(client.Signer.PublicKey())
 	if err != nil {
 		http.Error(w, "Failed to get balance", http.StatusInternalServerError)
 		return
@@ -273,24 +268,13 @@ func handleGetTokenBalance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, err := storage.NewWalletStorage()
-	if err != nil {
-		http.Error(w, "Failed to open wallet storage", http.StatusInternalServerError)
-		return
-	}
-	signer, err := db.GetWallet(profileName)
+	client, err := clientForProfile(profileName)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Profile '%s' not found", profileName), http.StatusBadRequest)
 		return
 	}
 
-	client, err := ap.NewClient(cmd.GetRpcEndpoint(), signer)
-	if err != nil {
-		http.Error(w, "Failed to create solana client", http.StatusInternalServerError)
-		return
-	}
-
-	balance, err := client.GetTokenBalance(signer.PublicKey(), mint)
+	balance, err := client.GetTokenBalance(client.Signer.PublicKey(), mint)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get token balance: %v", err), http.StatusInternalServerError)
 		return
@@ -346,38 +330,20 @@ func handleWardenStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, err := storage.NewWalletStorage()
-	if err != nil {
-		http.Error(w, "Failed to open wallet storage", http.StatusInternalServerError)
-		return
-	}
-	signer, err := db.GetWallet(profileName)
+	client, err := clientForProfile(profileName)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{"is_registered": false, "warden": nil})
 		return
 	}
 
-	client, err := ap.NewClient(cmd.GetRpcEndpoint(), signer)
-	if err != nil {
-		http.Error(w, "Failed to create solana client", http.StatusInternalServerError)
-		return
-	}
-
 	type WardenStatusResponse struct {
 		IsRegistered bool        `json:"is_registered"`
 		Warden       *WardenView `json:"warden"`
 	}
 
-	isRegistered, err := client.IsWardenRegistered()
-	if err != nil || !isRegistered {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(WardenStatusResponse{IsRegistered: false, Warden: nil})
-		return
-	}
-
-	wardenAccount, err := client.FetchWardenAccount()
-	if err != nil {
+	wardenAccount, err := lookupWarden(client)
+	if err != nil || wardenAccount == nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(WardenStatusResponse{IsRegistered: false, Warden: nil})
 		return
@@ -419,38 +385,21 @@ func handleSeekerStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, err := storage.NewWalletStorage()
-	if err != nil {
-		http.Error(w, "Failed to open wallet storage", http.StatusInternalServerError)
-		return
-	}
-	signer, err := db.GetWallet(profileName)
+	client, err := clientForProfile(profileName)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{"is_registered": false, "seeker": nil})
 		return
 	}
 
-	client, err := ap.NewClient(cmd.GetRpcEndpoint(), signer)
-	if err != nil {
-		http.Error(w, "Failed to create solana client", http.StatusInternalServerError)
-		return
-	}
-
 	type SeekerStatusResponse struct {
-		IsRegistered bool        `json:"is_registered"`
-		Seeker       *SeekerView `json:"seeker"`
-	}
-
-	isRegistered, err := client.IsSeekerRegistered()
-	if err != nil || !isRegistered {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(SeekerStatusResponse{IsRegistered: false, Seeker: nil})
-		return
+		IsRegistered bool                 `json:"is_registered"`
+		Seeker       *SeekerView          `json:"seeker"`
+		Budget       *daemon.BudgetStatus `json:"budget,omitempty"`
 	}
 
-	seekerAccount, err := client.FetchSeekerAccount()
-	if err != nil {
+	seekerAccount, err := lookupSeeker(client)
+	if err != nil || seekerAccount == nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(SeekerStatusResponse{IsRegistered: false, Seeker: nil})
 		return
@@ -466,13 +415,66 @@ func handleSeekerStatus(w http.ResponseWriter, r *http.Request) {
 		PremiumExpiresAt:       seekerAccount.PremiumExpiresAt,
 	}
 
+	response := SeekerStatusResponse{IsRegistered: true, Seeker: seekerView}
+	if o, err := arkhamd.Orchestrator(profileName); err == nil {
+		response.Budget, _ = o.Budget()
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(SeekerStatusResponse{IsRegistered: true, Seeker: seekerView})
+	json.NewEncoder(w).Encode(response)
+}
+
+// lookupWarden returns the profile's warden account, or nil if it is not registered.
+func lookupWarden(client *ap.Client) (*ap.Warden, error) {
+	isRegistered, err := client.IsWardenRegistered()
+	if err != nil || !isRegistered {
+		return nil, err
+	}
+	return client.FetchWardenAccount()
+}
+
+// lookupSeeker returns the profile's seeker account, or nil if it is not registered.
+func lookupSeeker(client *ap.Client) (*ap.Seeker, error) {
+	isRegistered, err := client.IsSeekerRegistered()
+	if err != nil || !isRegistered {
+		return nil, err
+	}
+	return client.FetchSeekerAccount()
+}
+
+const solPriceTTL = time.Minute
+
+var (
+	solPriceMu      sync.Mutex
+	solPriceValue   float64
+	solPriceFetched time.Time
+)
+
+// cachedSolPrice returns the SOL price in USD, asking the configured price source at most once
+// per solPriceTTL. CoinGecko is used when the price source is unavailable.
+func cachedSolPrice() (float64, error) {
+	solPriceMu.Lock()
+	defer solPriceMu.Unlock()
+
+	if solPriceValue != 0 && time.Since(solPriceFetched) < solPriceTTL {
+		return solPriceValue, nil
+	}
+	price, err := readOnlyClient.GetUSDPrice(serverCtx, ap.StakeToken_Sol)
+	if err != nil {
+		log.Printf("Price source unavailable, falling back to CoinGecko: %v", err)
+		price, err = getSolPrice()
+		if err != nil {
+			return 0, err
+		}
+	}
+	solPriceValue = price
+	solPriceFetched = time.Now()
+	return price, nil
 }
 
 // A helper function to fetch the current SOL price from CoinGecko.
 func getSolPrice() (float64, error) {
-	resp, err := http.Get("https://api.coingecko.com/api/v3/simple/price?ids=solana&vs_currencies=usd")
+	resp, err := http.Get(cmd.GetCoinGeckoURL() + "/simple/price?ids=solana&vs_currencies=usd")
 	if err != nil {
 		return 0, fmt.Errorf("failed to call coingecko: %w", err)
 	}
@@ -507,18 +509,44 @@ type WardenApiView struct {
 	Location   string  `json:"location"`
 	Reputation float64 `json:"reputation"`
 	PricePerGb float64 `json:"price"` // Price in USD per GB
+	// Status flags wardens that are offline or at capacity; see apiv1.WardenStatusOf.
+	Status       string             `json:"status"`
+	Capabilities *node.Capabilities `json:"capabilities,omitempty"`
 }
 
 func handleGetWardens(w http.ResponseWriter, r *http.Request) {
-	client, err := ap.NewReadOnlyClient(cmd.GetRpcEndpoint())
+	listings, err := listWardens()
 	if err != nil {
-		http.Error(w, "Failed to create solana client", http.StatusInternalServerError)
+		httpError(w, err)
 		return
 	}
 
+	response := make([]*WardenApiView, 0, len(listings))
+	for _, listing := range listings {
+		response = append(response, &WardenApiView{
+			ID:           listing.PeerId,
+			Authority:    listing.Authority,
+			Nickname:     listing.Nickname,
+			Location:     listing.Location,
+			Reputation:   listing.Reputation,
+			PricePerGb:   listing.PricePerGbUsd,
+			Status:       listing.Status,
+			Capabilities: listing.Capabilities,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// listWardens prices every registered warden for display.
+func listWardens() ([]apiv1.WardenListing, error) {
+	client := readOnlyClient
+
 	// Fetch all required data concurrently
 	var protocolConfig *ap.ProtocolConfig
 	var wardens []*ap.Warden
+	var warnings []ap.Warning
 	var solPrice float64
 	var configErr, wardensErr, priceErr error
 
@@ -529,11 +557,11 @@ func handleGetWardens(w http.ResponseWriter, r *http.Request) {
 		ch <- func() {}
 	}()
 	go func() {
-		wardens, wardensErr = client.FetchAllWardens()
+		wardens, warnings, wardensErr = client.FetchAllWardens()
 		ch <- func() {}
 	}()
 	go func() {
-		solPrice, priceErr = getSolPrice()
+		solPrice, priceErr = cachedSolPrice()
 		ch <- func() {}
 	}()
 
@@ -542,12 +570,13 @@ func handleGetWardens(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if configErr != nil {
-		http.Error(w, fmt.Sprintf("Failed to fetch protocol config: %v", configErr), http.StatusInternalServerError)
-		return
+		return nil, apiv1.Errorf(http.StatusBadGateway, apiv1.CodeUpstream, "Failed to fetch protocol config: %v", configErr)
 	}
 	if wardensErr != nil {
-		http.Error(w, fmt.Sprintf("Failed to fetch wardens: %v", wardensErr), http.StatusInternalServerError)
-		return
+		return nil, apiv1.Errorf(http.StatusBadGateway, apiv1.CodeUpstream, "Failed to fetch wardens: %v", wardensErr)
+	}
+	for _, w := range warnings {
+		slog.Warn(w.Message, "account", w.Account, "err", w.Error)
 	}
 	if priceErr != nil {
 		// Don't fail the whole request if price is unavailable, just default to 0
@@ -555,113 +584,235 @@ func handleGetWardens(w http.ResponseWriter, r *http.Request) {
 		solPrice = 0
 	}
 
-	// Create lookup maps for easier access
-	geoPremiumMap := make(map[uint8]uint16)
-	for _, p := range protocolConfig.GeoPremiums {
-		geoPremiumMap[p.RegionCode] = p.PremiumBps
-	}
-	tierMultiplierMap := map[ap.Tier]uint16{
-		ap.Tier_Bronze: protocolConfig.TierMultipliers[0],
-		ap.Tier_Silver: protocolConfig.TierMultipliers[1],
-		ap.Tier_Gold:   protocolConfig.TierMultipliers[2],
-	}
 	regionMap := map[uint8]string{
-		0: "🇺🇸 USA",
-		1: "🇪🇺 Europe",
-		2: "🇯🇵 Asia",
+		geo.RegionUS:     "🇺🇸 USA",
+		geo.RegionEU:     "🇪🇺 Europe",
+		geo.RegionAsia:   "🇯🇵 Asia",
+		geo.RegionLatAm:  "🌎 Latin America",
+		geo.RegionAfrica: "🌍 Africa",
 	}
 
-	// Process wardens into the API view
-	response := make([]*WardenApiView, 0)
+	listings := make([]apiv1.WardenListing, 0, len(wardens))
 	for _, warden := range wardens {
-		geoPremiumBps := float64(geoPremiumMap[warden.RegionCode])
-		tierMultiplierBps := float64(tierMultiplierMap[warden.Tier])
-
-		// Calculate effective rate per MB in lamports
-		effectiveRatePerMb := float64(protocolConfig.BaseRatePerMb) *
-			(1 + geoPremiumBps/10000.0) *
-			(tierMultiplierBps / 10000.0)
-
-		// Convert to price per GB in USD
-		pricePerGbLamports := effectiveRatePerMb * 1024
-		pricePerGbSol := pricePerGbLamports / float64(solana.LAMPORTS_PER_SOL)
-		pricePerGbUsd := pricePerGbSol * solPrice
-
-		apiView := &WardenApiView{
-			ID:         warden.PeerId,
-			Authority:  warden.Authority.String(),
-			Nickname:   warden.Authority.String()[:6] + "..." + warden.Authority.String()[len(warden.Authority.String())-4:],
-			Location:   regionMap[warden.RegionCode],
-			Reputation: float64(warden.ReputationScore) / 2000.0, // 0-10000 to 0-5
-			PricePerGb: pricePerGbUsd,
+		ratePerMb, err := pricing.RatePerMb(protocolConfig, warden)
+		if err != nil {
+			log.Printf("Warning: could not price warden %s: %v", warden.Authority, err)
+			continue
 		}
-		response = append(response, apiView)
+		authority := warden.Authority.String()
+		location, ok := regionMap[warden.RegionCode]
+		if !ok {
+			location = selection.RegionName(warden.RegionCode)
+		}
+		listings = append(listings, apiv1.WardenListing{
+			PeerId:        warden.PeerId,
+			Authority:     authority,
+			Nickname:      authority[:6] + "..." + authority[len(authority)-4:],
+			Location:      location,
+			Reputation:    float64(warden.ReputationScore) / 2000.0, // 0-10000 to 0-5
+			PricePerGbUsd: pricing.PricePerGbUSD(ratePerMb, solPrice),
+		})
+	}
+	checkWardens(listings)
+	return listings, nil
+}
+
+const (
+	// wardenInfoTimeout bounds how long the warden list waits for wardens to describe
+	// themselves.
+	wardenInfoTimeout = 5 * time.Second
+	wardenInfoWorkers = 16
+)
+
+// checkWardens asks each listed warden's node for its capability document and sets the
+// listing's status from the answer.
+func checkWardens(listings []apiv1.WardenListing) {
+	if !p2pNode.Status().IsRunning {
+		for i := range listings {
+			listings[i].Status = apiv1.WardenUnknown
+		}
+		return
+	}
+	ctx, cancel := context.WithTimeout(serverCtx, wardenInfoTimeout)
+	defer cancel()
+
+	sem := make(chan struct{}, wardenInfoWorkers)
+	var wg sync.WaitGroup
+	for i := range listings {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			id, err := peer.Decode(listings[i].PeerId)
+			if err != nil {
+				listings[i].Status = apiv1.WardenOffline
+				return
+			}
+			caps, err := p2pNode.Capabilities(ctx, id)
+			listings[i].Status = apiv1.WardenStatusOf(caps, err)
+			listings[i].Capabilities = caps
+		}()
+	}
+	wg.Wait()
+}
+
+func handleQuote(w http.ResponseWriter, r *http.Request) {
+	wardenParam := r.URL.Query().Get("warden")
+	if wardenParam == "" {
+		http.Error(w, "Missing 'warden' query parameter", http.StatusBadRequest)
+		return
+	}
+	wardenAuthority, err := solana.PublicKeyFromBase58(wardenParam)
+	if err != nil {
+		http.Error(w, "Invalid 'warden' query parameter", http.StatusBadRequest)
+		return
+	}
+	mb, err := strconv.ParseUint(r.URL.Query().Get("mb"), 10, 64)
+	if err != nil || mb == 0 {
+		http.Error(w, "Invalid 'mb' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	quote, err := quoteConnection(wardenAuthority, mb)
+	if err != nil {
+		httpError(w, err)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(quote)
 }
 
+// quoteConnection quotes mb MB through a warden, with the USD cost when the SOL price is
+// known.
+func quoteConnection(wardenAuthority solana.PublicKey, mb uint64) (*apiv1.Quote, error) {
+	protocolConfig, err := readOnlyClient.FetchProtocolConfig()
+	if err != nil {
+		return nil, apiv1.Errorf(http.StatusBadGateway, apiv1.CodeUpstream, "Failed to fetch protocol config: %v", err)
+	}
+	warden, err := readOnlyClient.FetchWardenByAuthority(wardenAuthority)
+	if err != nil {
+		return nil, apiv1.Errorf(http.StatusNotFound, apiv1.CodeNotFound, "Failed to fetch warden: %v", err)
+	}
+
+	quote, err := pricing.QuoteConnection(protocolConfig, warden, mb)
+	if err != nil {
+		return nil, apiv1.Errorf(http.StatusBadRequest, apiv1.CodeInvalidRequest, "Failed to quote connection: %v", err)
+	}
+
+	view := &apiv1.Quote{Quote: quote}
+	if solPrice, err := cachedSolPrice(); err == nil {
+		view.CostUsd = float64(quote.Cost) / float64(solana.LAMPORTS_PER_SOL) * solPrice
+	}
+	return view, nil
+}
 
 type RegisterWardenRequest struct {
 	Profile     string  `json:"profile"`
 	StakeToken  string  `json:"stakeToken"`
 	StakeAmount float64 `json:"stakeAmount"`
+	// CreateTokenAccount creates a missing stake token account before registering.
+	CreateTokenAccount bool `json:"createTokenAccount"`
 }
 
-func handleRegisterWarden(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
-		return
+// previewWardenStake resolves the stake token and amount of a registration request and
+// runs the balance pre-flight for it.
+func previewWardenStake(client *ap.Client, stakeToken string, stakeAmount float64) (*ap.StakePreflight, error) {
+	token, err := ap.ParseStakeToken(stakeToken)
+	if err != nil {
+		return nil, err
+	}
+	decimals, err := client.StakeTokenDecimals(token)
+	if err != nil {
+		return nil, err
 	}
+	amount, err := ap.ParseTokenAmount(strconv.FormatFloat(stakeAmount, 'f', -1, 64), decimals)
+	if err != nil {
+		return nil, err
+	}
+	if amount == 0 {
+		return nil, fmt.Errorf("stake amount must be greater than zero")
+	}
+	return client.PreflightWardenStake(serverCtx, token, amount)
+}
 
-	var req RegisterWardenRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
+func newStakePreviewView(preflight *ap.StakePreflight) apiv1.StakePreview {
+	view := apiv1.StakePreview{
+		StakeToken:    preflight.StakeToken.String(),
+		Account:       preflight.Account.String(),
+		AccountExists: preflight.AccountExists,
+		Decimals:      preflight.Decimals,
+		Balance:       ap.FormatTokenAmount(preflight.Balance, preflight.Decimals),
+		Amount:        ap.FormatTokenAmount(preflight.Amount, preflight.Decimals),
+		Sufficient:    preflight.Sufficient(),
+		StakeValueUsd: preflight.StakeValueUsd,
+	}
+	if !preflight.Mint.IsZero() {
+		view.Mint = preflight.Mint.String()
 	}
+	if preflight.TierErr == nil {
+		view.Tier = preflight.Tier.String()
+	}
+	if err := preflight.Check(); err != nil {
+		view.Error = err.Error()
+	}
+	return view
+}
 
-	db, err := storage.NewWalletStorage()
+func handleStakePreview(w http.ResponseWriter, r *http.Request) {
+	profileName := r.URL.Query().Get("profile")
+	if profileName == "" {
+		http.Error(w, "Missing 'profile' query parameter", http.StatusBadRequest)
+		return
+	}
+	stakeAmount, err := strconv.ParseFloat(r.URL.Query().Get("amount"), 64)
 	if err != nil {
-		http.Error(w, "Failed to open wallet storage", http.StatusInternalServerError)
+		http.Error(w, "Invalid 'amount' query parameter", http.StatusBadRequest)
 		return
 	}
-	signer, err := db.GetWallet(req.Profile)
+
+	client, err := clientForProfile(profileName)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Profile '%s' not found", req.Profile), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Profile '%s' not found", profileName), http.StatusBadRequest)
 		return
 	}
 
-	client, err := ap.NewClient(cmd.GetRpcEndpoint(), signer)
+	preflight, err := previewWardenStake(client, r.URL.Query().Get("stakeToken"), stakeAmount)
 	if err != nil {
-		http.Error(w, "Failed to create solana client", http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to preview stake: %v", err), http.StatusBadRequest)
 		return
 	}
 
-	var stakeTokenEnum ap.StakeToken
-	if req.StakeToken == "SOL" {
-		stakeTokenEnum = ap.StakeToken_Sol
-	} else if req.StakeToken == "USDC" {
-		stakeTokenEnum = ap.StakeToken_Usdc
-	} else {
-		http.Error(w, "Invalid stake token specified", http.StatusBadRequest)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newStakePreviewView(preflight))
+}
+
+func handleRegisterWarden(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var amountLamports uint64
-	if stakeTokenEnum == ap.StakeToken_Sol {
-		amountLamports = uint64(req.StakeAmount * float64(solana.LAMPORTS_PER_SOL))
-	} else {
-		amountLamports = uint64(req.StakeAmount * 1_000_000)
+	var req RegisterWardenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
 	}
-	
-	peerID := "12D3KooWPlaceholderPeerID" + signer.PublicKey().String()[:10]
-	regionCode := uint8(0)
-	ipHash := sha256.Sum256([]byte("127.0.0.1"))
 
-	sig, err := client.InitializeWarden(stakeTokenEnum, amountLamports, peerID, regionCode, ipHash)
+	client, err := clientForProfile(req.Profile)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to send registration transaction: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Profile '%s' not found", req.Profile), http.StatusBadRequest)
+		return
+	}
+
+	sig, err := registerWarden(client, apiv1.RegisterWardenRequest{
+		StakeToken:         req.StakeToken,
+		StakeAmount:        req.StakeAmount,
+		CreateTokenAccount: req.CreateTokenAccount,
+	})
+	if err != nil {
+		httpError(w, err)
 		return
 	}
 
@@ -672,12 +823,57 @@ func handleRegisterWarden(w http.ResponseWriter, r *http.Request) {
 }
 
 
+// wardenLocation resolves the region and IP hash registration publishes from the node's
+// egress IP.
+func wardenLocation() (geo.Location, error) {
+	loc, err := arkhamd.Location()
+	if err != nil {
+		return geo.Location{}, apiv1.NewError(http.StatusConflict, apiv1.CodeConflict, err.Error())
+	}
+	return loc, nil
+}
+
+// registerWarden checks the stake, creates the stake token account when asked to and sends
+// the registration transaction.
+func registerWarden(client *ap.Client, req apiv1.RegisterWardenRequest) (*solana.Signature, error) {
+	preflight, err := previewWardenStake(client, req.StakeToken, req.StakeAmount)
+	if err != nil {
+		return nil, apiv1.Errorf(http.StatusBadRequest, apiv1.CodeInvalidRequest, "Invalid stake: %v", err)
+	}
+
+	if !preflight.AccountExists && req.CreateTokenAccount {
+		if _, err := client.CreateStakeTokenAccount(preflight.StakeToken); err != nil {
+			return nil, apiv1.Errorf(http.StatusBadGateway, apiv1.CodeUpstream, "Failed to create token account: %v", err)
+		}
+		// A freshly created account is empty, so the balance check below still applies.
+		preflight.AccountExists = true
+	}
+	if err := preflight.Check(); err != nil {
+		return nil, apiv1.NewError(http.StatusBadRequest, apiv1.CodeInvalidRequest, err.Error())
+	}
+
+	peerID, err := daemon.PeerID()
+	if err != nil {
+		return nil, apiv1.Errorf(http.StatusInternalServerError, apiv1.CodeInternal, "Failed to load node identity: %v", err)
+	}
+	loc, err := wardenLocation()
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := client.InitializeWarden(preflight.StakeToken, preflight.Amount, peerID.String(), loc.RegionCode, loc.IPHash)
+	if err != nil {
+		return nil, apiv1.Errorf(http.StatusBadGateway, apiv1.CodeUpstream, "Failed to send registration transaction: %v", err)
+	}
+	return sig, nil
+}
+
 // --- GUI Server ---
 
-func findNextAvailablePort(startPort int) (string, error) {
+func findNextAvailablePort(host string, startPort int) (string, error) {
 	// Try up to 100 ports starting from startPort
 	for port := startPort; port < startPort+100; port++ {
-		addr := fmt.Sprintf(":%d", port)
+		addr := net.JoinHostPort(host, strconv.Itoa(port))
 		listener, err := net.Listen("tcp", addr)
 		if err == nil {
 			// Port is available, close the listener and return the port
@@ -692,7 +888,42 @@ func findNextAvailablePort(startPort int) (string, error) {
 func startGuiServer() {
 	cmd.GetRpcEndpoint()
 
-	p2pNode = node.NewP2PNode()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serverCtx = ctx
+
+	var err error
+	arkhamd, err = daemon.New(daemon.Config{
+		RpcEndpoint:       cmd.GetRpcEndpoint(),
+		WsEndpoint:        cmd.GetWsEndpoint(),
+		ExitPolicyPath:    cmd.GetExitPolicyPath(),
+		MetricsListen:     cmd.GetMetricsListen(),
+		ReputationProfile: cmd.GetReputationProfile(),
+	})
+	if err != nil {
+		log.Fatalf("Failed to start daemon: %v", err)
+	}
+	p2pNode = arkhamd.Node
+	walletStore = arkhamd.Wallets
+	readOnlyClient = arkhamd.ReadOnly
+
+	guiCfg := cmd.GetGuiConfig()
+	useTLS := guiCfg.TLSCert != "" && guiCfg.TLSKey != ""
+	listenAddr := guiCfg.Listen
+	if listenAddr == "" {
+		port, err := findNextAvailablePort("127.0.0.1", 8088)
+		if err != nil {
+			log.Fatalf("Failed to start GUI server: %v", err)
+		}
+		listenAddr = net.JoinHostPort("127.0.0.1", port)
+	}
+	if !isLoopback(listenAddr) && (!useTLS || guiCfg.Password == "") {
+		log.Fatalf("Refusing to expose the GUI on %s without TLS and a password; set ARKHAM_GUI_TLS_CERT, ARKHAM_GUI_TLS_KEY and ARKHAM_GUI_PASSWORD", listenAddr)
+	}
+	security, err := newGuiSecurity(guiCfg, useTLS)
+	if err != nil {
+		log.Fatalf("Failed to start GUI server: %v", err)
+	}
 
 	content, err := fs.Sub(embeddedUI, "gui-assets")
 	if err != nil {
@@ -714,6 +945,12 @@ func startGuiServer() {
 	http.HandleFunc("/api/seeker-status", handleSeekerStatus)
 	http.HandleFunc("/api/wardens", handleGetWardens)
 	http.HandleFunc("/api/history", handleGetHistory)
+	http.HandleFunc("/api/quote", handleQuote)
+	http.HandleFunc("/api/stake-preview", handleStakePreview)
+	http.HandleFunc("/api/connect", handleConnect)
+	http.HandleFunc("/api/disconnect", handleDisconnect)
+	http.HandleFunc("/api/events", handleEvents)
+	newAPIv1Router(http.DefaultServeMux)
 
 	// Frontend File Server
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -725,15 +962,15 @@ func startGuiServer() {
 		}
 
 		file, err := content.Open(path)
-		if err != nil {
-			index, err := content.Open("index.html")
+		if err != nil || path == "index.html" {
+			index, err := fs.ReadFile(content, "index.html")
 			if err != nil {
 				http.Error(w, "index.html not found", http.StatusInternalServerError)
 				return
 			}
 			w.Header().Set("Content-Type", "text/html; charset=utf-8")
-			stat, _ := index.Stat()
-			http.ServeContent(w, r, "index.html", stat.ModTime(), index.(io.ReadSeeker))
+			w.Header().Set("Cache-Control", "no-store")
+			w.Write(security.injectToken(index))
 			return
 		}
 		defer file.Close()
@@ -742,12 +979,15 @@ func startGuiServer() {
 		http.ServeContent(w, r, r.URL.Path, stat.ModTime(), file.(io.ReadSeeker))
 	})
 
-	port, err := findNextAvailablePort(8088)
-	if err != nil {
-		log.Fatalf("Failed to start GUI server: %v", err)
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
 	}
-
-	url := fmt.Sprintf("http://localhost:%s", port)
+	browserHost, port, _ := net.SplitHostPort(listenAddr)
+	if ip := net.ParseIP(browserHost); browserHost == "" || (ip != nil && ip.IsUnspecified()) {
+		browserHost = "localhost"
+	}
+	url := fmt.Sprintf("%s://%s/?token=%s", scheme, net.JoinHostPort(browserHost, port), security.token)
 	fmt.Printf("🚀 Launching Arkham GUI at %s\n", url)
 
 	go func() {
@@ -767,5 +1007,34 @@ func startGuiServer() {
 		}
 	}()
 
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	server := &http.Server{
+		Addr:    listenAddr,
+		Handler: security.wrap(http.DefaultServeMux),
+		// Requests derive from serverCtx, so event streams end when shutdown begins.
+		BaseContext: func(net.Listener) context.Context { return serverCtx },
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		if useTLS {
+			serveErr <- server.ListenAndServeTLS(guiCfg.TLSCert, guiCfg.TLSKey)
+		} else {
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		arkhamd.Close()
+		log.Fatal(err)
+	case <-serverCtx.Done():
+	}
+	fmt.Println("\nShutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), guiShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("GUI server shutdown: %v", err)
+	}
+	if err := arkhamd.Close(); err != nil {
+		log.Printf("Daemon shutdown: %v", err)
+	}
 }
@@ -0,0 +1,201 @@
+// Package metrics exposes node and warden metrics in the Prometheus format. Counters and
+// histograms are updated where the work happens; gauges that describe current state are
+// read from their owners at scrape time.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every Arkham metric plus the Go runtime and process collectors.
+var Registry = prometheus.NewRegistry()
+
+// Session roles and byte directions. "in" is traffic received from the seeker's side of a
+// session, "out" is traffic sent towards it.
+const (
+	RoleWarden = "warden"
+	RoleSeeker = "seeker"
+)
+
+// Proof results.
+const (
+	ProofSigned    = "signed"
+	ProofSubmitted = "submitted"
+	ProofFailed    = "failed"
+	ProofRejected  = "rejected"
+)
+
+var (
+	// PeersConnected is the number of connected libp2p peers by how they were discovered.
+	PeersConnected = NewGaugeFunc("arkham_peers_connected",
+		"Connected libp2p peers by discovery source.", "source")
+
+	// PeerLatency is the ping round trip measured to peers.
+	PeerLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "arkham_peer_latency_seconds",
+		Help:    "Ping round trip to peers.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	})
+
+	// SessionsActive is the number of active sessions by role and kind (proxy or circuit).
+	SessionsActive = NewGaugeFunc("arkham_sessions_active",
+		"Active sessions by role and kind.", "role", "kind")
+
+	// SessionBytes counts session payload by role and direction.
+	SessionBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "arkham_session_bytes_total",
+		Help: "Session bytes by role and direction.",
+	}, []string{"role", "direction"})
+
+	WardenBytesIn  = SessionBytes.WithLabelValues(RoleWarden, "in")
+	WardenBytesOut = SessionBytes.WithLabelValues(RoleWarden, "out")
+	SeekerBytesIn  = SessionBytes.WithLabelValues(RoleSeeker, "in")
+	SeekerBytesOut = SessionBytes.WithLabelValues(RoleSeeker, "out")
+
+	// Proofs counts bandwidth proofs signed as a seeker, and submitted, failed or rejected as
+	// a warden.
+	Proofs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "arkham_proofs_total",
+		Help: "Bandwidth proofs by result.",
+	}, []string{"result"})
+
+	// RPCDuration is the latency of Solana JSON-RPC calls by method.
+	RPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "arkham_rpc_request_duration_seconds",
+		Help:    "Solana RPC call latency by method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+
+	// RPCErrors counts failed Solana JSON-RPC calls by method.
+	RPCErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "arkham_rpc_errors_total",
+		Help: "Failed Solana RPC calls by method.",
+	}, []string{"method"})
+
+	// On-chain account gauges by wallet profile, refreshed periodically.
+	WardenPendingClaims = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "arkham_warden_pending_claims_lamports",
+		Help: "Warden earnings waiting to be claimed.",
+	}, []string{"profile"})
+	WardenReputation = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "arkham_warden_reputation_score",
+		Help: "Warden reputation score (0-10000).",
+	}, []string{"profile"})
+	SeekerEscrowBalance = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "arkham_seeker_escrow_balance_lamports",
+		Help: "Seeker escrow balance.",
+	}, []string{"profile"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		PeersConnected, PeerLatency, SessionsActive, SessionBytes, Proofs,
+		RPCDuration, RPCErrors,
+		WardenPendingClaims, WardenReputation, SeekerEscrowBalance,
+	)
+}
+
+// Sample is one labelled value of a GaugeFunc.
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// GaugeFunc is a labelled gauge whose values are read from a function at scrape time. It
+// reports nothing until Set is called.
+type GaugeFunc struct {
+	desc *prometheus.Desc
+	mu   sync.Mutex
+	fn   func() []Sample
+}
+
+// NewGaugeFunc creates a GaugeFunc with the given label names.
+func NewGaugeFunc(name, help string, labels ...string) *GaugeFunc {
+	return &GaugeFunc{desc: prometheus.NewDesc(name, help, labels, nil)}
+}
+
+// Set installs the function that reads the gauge's values.
+func (g *GaugeFunc) Set(fn func() []Sample) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.fn = fn
+}
+
+// Describe implements prometheus.Collector.
+func (g *GaugeFunc) Describe(ch chan<- *prometheus.Desc) {
+	ch <- g.desc
+}
+
+// Collect implements prometheus.Collector.
+func (g *GaugeFunc) Collect(ch chan<- prometheus.Metric) {
+	g.mu.Lock()
+	fn := g.fn
+	g.mu.Unlock()
+	if fn == nil {
+		return
+	}
+	for _, s := range fn() {
+		m, err := prometheus.NewConstMetric(g.desc, prometheus.GaugeValue, s.Value, s.Labels...)
+		if err != nil {
+			continue
+		}
+		ch <- m
+	}
+}
+
+// CountReader adds every byte read from r to c.
+func CountReader(r io.Reader, c prometheus.Counter) io.Reader {
+	return &countingReader{r: r, c: c}
+}
+
+type countingReader struct {
+	r io.Reader
+	c prometheus.Counter
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.c.Add(float64(n))
+	}
+	return n, err
+}
+
+// Handler serves the registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Serve serves /metrics on addr until ctx is cancelled.
+func Serve(ctx context.Context, addr string, logger *slog.Logger) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for metrics on %s: %w", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	logger.Info("serving metrics", "url", fmt.Sprintf("http://%s/metrics", listener.Addr()))
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
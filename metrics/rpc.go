@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+)
+
+// RPCTransport wraps an HTTP transport carrying Solana JSON-RPC requests and records the
+// latency and errors of each call by method. Batched requests are recorded as "batch".
+func RPCTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &rpcTransport{next: next}
+}
+
+type rpcTransport struct {
+	next http.RoundTripper
+}
+
+func (t *rpcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	method := "unknown"
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		method = rpcMethod(body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	RPCDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		RPCErrors.WithLabelValues(method).Inc()
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		RPCErrors.WithLabelValues(method).Inc()
+		return resp, nil
+	}
+
+	// JSON-RPC reports failures in a 200 response, so look for an error member.
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		RPCErrors.WithLabelValues(method).Inc()
+		return resp, nil
+	}
+	var reply struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &reply) == nil && len(reply.Error) > 0 && string(reply.Error) != "null" {
+		RPCErrors.WithLabelValues(method).Inc()
+	}
+	return resp, nil
+}
+
+// rpcMethod extracts the method of a JSON-RPC request body.
+func rpcMethod(body []byte) string {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		return "batch"
+	}
+	var req struct {
+		Method string `json:"method"`
+	}
+	if json.Unmarshal(body, &req) != nil || req.Method == "" {
+		return "unknown"
+	}
+	return req.Method
+}
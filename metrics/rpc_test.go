@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRPCMethod(t *testing.T) {
+	cases := map[string]string{
+		`{"jsonrpc":"2.0","id":1,"method":"getBalance","params":[]}`: "getBalance",
+		` [{"method":"getBalance"},{"method":"getSlot"}]`:            "batch",
+		`{"id":1}`: "unknown",
+		`not json`: "unknown",
+	}
+	for body, want := range cases {
+		if got := rpcMethod([]byte(body)); got != want {
+			t.Errorf("rpcMethod(%q) = %q, want %q", body, got, want)
+		}
+	}
+}
+
+func TestRPCTransportCountsErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "sendTransaction") {
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32002,"message":"failed"}}`))
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":5,"error":null}`))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: RPCTransport(nil)}
+	post := func(method string) string {
+		resp, err := client.Post(server.URL, "application/json",
+			strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"`+method+`"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if got := post("getSlot"); !strings.Contains(got, `"result":5`) {
+		t.Fatalf("response body not passed through: %s", got)
+	}
+	post("sendTransaction")
+
+	if got := testutil.ToFloat64(RPCErrors.WithLabelValues("getSlot")); got != 0 {
+		t.Errorf("getSlot errors = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(RPCErrors.WithLabelValues("sendTransaction")); got != 1 {
+		t.Errorf("sendTransaction errors = %v, want 1", got)
+	}
+	if got := testutil.CollectAndCount(RPCDuration); got != 2 {
+		t.Errorf("RPCDuration series = %d, want 2", got)
+	}
+}
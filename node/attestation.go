@@ -0,0 +1,257 @@
+package node
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ProtocolIdentity exchanges attestations binding each side's peer ID to the Solana wallet
+// behind its on-chain account. The dialler sends its attestation as a proxy-style message
+// and the listener answers with a status byte and its own. An empty attestation means the
+// side attests no wallet.
+const ProtocolIdentity = "/arkham/identity/1.0.0"
+
+const identityTimeout = 10 * time.Second
+
+// Attestation binds a peer ID to a Solana authority: the libp2p key signs the authority
+// and the authority signs the peer ID, so the binding needs both keys.
+type Attestation struct {
+	Peer               peer.ID
+	Authority          solana.PublicKey
+	PeerSignature      []byte
+	AuthoritySignature solana.Signature
+}
+
+// attestedAuthority is the message the libp2p key signs.
+func attestedAuthority(authority solana.PublicKey) []byte {
+	return append([]byte("arkham-identity-authority:"), authority[:]...)
+}
+
+// attestedPeer is the message the Solana authority signs.
+func attestedPeer(p peer.ID) []byte {
+	return append([]byte("arkham-identity-peer:"), []byte(p)...)
+}
+
+// NewAttestation signs the binding between the libp2p identity and the wallet.
+func NewAttestation(identity crypto.PrivKey, wallet ed25519.PrivateKey) (*Attestation, error) {
+	id, err := peer.IDFromPrivateKey(identity)
+	if err != nil {
+		return nil, err
+	}
+	authority := solana.PublicKeyFromBytes(wallet.Public().(ed25519.PublicKey))
+	peerSig, err := identity.Sign(attestedAuthority(authority))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign attestation: %w", err)
+	}
+	return &Attestation{
+		Peer:               id,
+		Authority:          authority,
+		PeerSignature:      peerSig,
+		AuthoritySignature: solana.SignatureFromBytes(ed25519.Sign(wallet, attestedPeer(id))),
+	}, nil
+}
+
+// Verify checks both signatures. The peer ID must embed its public key, as Ed25519 IDs do.
+func (a *Attestation) Verify() error {
+	pub, err := a.Peer.ExtractPublicKey()
+	if err != nil {
+		return fmt.Errorf("cannot verify attestation of %s: %w", a.Peer, err)
+	}
+	if ok, err := pub.Verify(attestedAuthority(a.Authority), a.PeerSignature); err != nil || !ok {
+		return fmt.Errorf("invalid peer signature in attestation of %s", a.Peer)
+	}
+	if !ed25519.Verify(a.Authority[:], attestedPeer(a.Peer), a.AuthoritySignature[:]) {
+		return fmt.Errorf("invalid authority signature in attestation of %s", a.Peer)
+	}
+	return nil
+}
+
+// marshal encodes the authority, its signature and the peer signature. The peer ID is not
+// sent: it is the authenticated remote peer of the stream.
+func (a *Attestation) marshal() []byte {
+	buf := make([]byte, 0, attestationLen+len(a.PeerSignature))
+	buf = append(buf, a.Authority[:]...)
+	buf = append(buf, a.AuthoritySignature[:]...)
+	return append(buf, a.PeerSignature...)
+}
+
+// unmarshalAttestation decodes and verifies an attestation sent by p. It returns nil for an
+// empty body.
+func unmarshalAttestation(p peer.ID, body []byte) (*Attestation, error) {
+	if len(body) == 0 {
+		return nil, nil
+	}
+	if len(body) <= attestationLen {
+		return nil, fmt.Errorf("malformed attestation")
+	}
+	a := &Attestation{
+		Peer:               p,
+		Authority:          solana.PublicKeyFromBytes(body[:ed25519.PublicKeySize]),
+		AuthoritySignature: solana.SignatureFromBytes(body[ed25519.PublicKeySize:attestationLen]),
+		PeerSignature:      body[attestationLen:],
+	}
+	if err := a.Verify(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// attestations remembers the authorities peers proved over ProtocolIdentity.
+type attestations struct {
+	mu    sync.Mutex
+	peers map[peer.ID]solana.PublicKey
+}
+
+func (a *attestations) set(p peer.ID, authority solana.PublicKey) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.peers == nil {
+		a.peers = make(map[peer.ID]solana.PublicKey)
+	}
+	a.peers[p] = authority
+}
+
+func (a *attestations) get(p peer.ID) (solana.PublicKey, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	authority, ok := a.peers[p]
+	return authority, ok
+}
+
+// SetAuthorityKey sets the wallet this node attests to over ProtocolIdentity, normally the
+// warden's authority. Without one the node attests SeekerKey, if set.
+func (n *P2PNode) SetAuthorityKey(key ed25519.PrivateKey) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.authorityKey = key
+}
+
+// PeerAuthority returns the wallet a peer has proved it controls, if any.
+func (n *P2PNode) PeerAuthority(p peer.ID) (solana.PublicKey, bool) {
+	return n.attested.get(p)
+}
+
+// localAttestation returns this node's attestation, or nil when it attests no wallet.
+func (n *P2PNode) localAttestation() (*Attestation, error) {
+	n.mu.Lock()
+	h, wallet := n.host, n.authorityKey
+	n.mu.Unlock()
+	if wallet == nil {
+		wallet = n.SeekerKey
+	}
+	if h == nil || wallet == nil {
+		return nil, nil
+	}
+	return NewAttestation(h.Peerstore().PrivKey(h.ID()), wallet)
+}
+
+// identityHandler answers ProtocolIdentity handshakes.
+func (n *P2PNode) identityHandler(s network.Stream) {
+	defer s.Close()
+	remote := s.Conn().RemotePeer()
+
+	s.SetDeadline(time.Now().Add(identityTimeout))
+	_, body, err := readProxyMessage(bufio.NewReader(s))
+	if err != nil {
+		return
+	}
+	theirs, err := unmarshalAttestation(remote, body)
+	if err != nil {
+		writeProxyMessage(s, proxyStatusFailed, []byte(err.Error()))
+		return
+	}
+	if theirs != nil {
+		n.attested.set(remote, theirs.Authority)
+	}
+	ours, err := n.localAttestation()
+	if err != nil {
+		writeProxyMessage(s, proxyStatusFailed, []byte(err.Error()))
+		return
+	}
+	var reply []byte
+	if ours != nil {
+		reply = ours.marshal()
+	}
+	writeProxyMessage(s, proxyStatusOK, reply)
+}
+
+// Attest runs the identity handshake with a peer, sending this node's attestation and
+// returning the peer's, or nil if the peer attests no wallet.
+func (n *P2PNode) Attest(ctx context.Context, p peer.ID) (*Attestation, error) {
+	ours, err := n.localAttestation()
+	if err != nil {
+		return nil, err
+	}
+	var body []byte
+	if ours != nil {
+		body = ours.marshal()
+	}
+
+	if err := n.connectPeer(ctx, p); err != nil {
+		return nil, err
+	}
+	h := n.GetHost()
+	if h == nil {
+		return nil, fmt.Errorf("node is not running")
+	}
+	s, err := h.NewStream(ctx, p, ProtocolIdentity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open identity stream to %s: %w", p, err)
+	}
+	defer s.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(identityTimeout)
+	}
+	s.SetDeadline(deadline)
+
+	if err := writeProxyMessage(s, 0, body); err != nil {
+		s.Reset()
+		return nil, err
+	}
+	status, reply, err := readProxyMessage(s)
+	if err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("peer %s did not answer identity handshake: %w", p, err)
+	}
+	if status != proxyStatusOK {
+		return nil, fmt.Errorf("peer %s refused identity handshake: %s", p, reply)
+	}
+	theirs, err := unmarshalAttestation(p, reply)
+	if err != nil {
+		return nil, err
+	}
+	if theirs != nil {
+		n.attested.set(p, theirs.Authority)
+	}
+	return theirs, nil
+}
+
+// VerifyAuthority checks that a peer controls the given wallet, so a seeker knows the peer
+// it dialled is the warden it is paying. It runs the identity handshake unless the peer has
+// already attested that wallet.
+func (n *P2PNode) VerifyAuthority(ctx context.Context, p peer.ID, authority solana.PublicKey) error {
+	if attested, ok := n.PeerAuthority(p); ok && attested.Equals(authority) {
+		return nil
+	}
+	a, err := n.Attest(ctx, p)
+	if err != nil {
+		return err
+	}
+	if a == nil {
+		return fmt.Errorf("peer %s does not attest a wallet", p)
+	}
+	if !a.Authority.Equals(authority) {
+		return fmt.Errorf("peer %s attests wallet %s, not %s", p, a.Authority, authority)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package node
+
+import (
+	"context"
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/libp2p/go-libp2p/core/crypto"
+)
+
+func TestAttestationVerify(t *testing.T) {
+	identity, _, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	a, err := NewAttestation(identity, wallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := unmarshalAttestation(a.Peer, a.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Authority.Equals(a.Authority) {
+		t.Fatalf("decoded authority %s, want %s", decoded.Authority, a.Authority)
+	}
+
+	// Claiming the attestation for another wallet or another peer must fail.
+	forged := *a
+	forged.Authority = solana.NewWallet().PublicKey()
+	if forged.Verify() == nil {
+		t.Fatal("expected an attestation for another wallet to fail")
+	}
+	other, _, _ := crypto.GenerateEd25519Key(nil)
+	otherAttestation, err := NewAttestation(other, wallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged = *a
+	forged.Peer = otherAttestation.Peer
+	if forged.Verify() == nil {
+		t.Fatal("expected an attestation replayed by another peer to fail")
+	}
+}
+
+func TestIdentityHandshake(t *testing.T) {
+	seeker, warden := newTestNode(t), newTestNode(t)
+	warden.GetHost().SetStreamHandler(ProtocolIdentity, warden.identityHandler)
+	wardenHost := warden.GetHost()
+	seeker.GetHost().Peerstore().AddAddrs(wardenHost.ID(), wardenHost.Addrs(), time.Hour)
+
+	wardenKey := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	wardenAuthority := solana.PublicKeyFromBytes(wardenKey.Public().(ed25519.PublicKey))
+	seekerKey := ed25519.NewKeyFromSeed(append(make([]byte, ed25519.SeedSize-1), 1))
+	seeker.SeekerKey = seekerKey
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := seeker.VerifyAuthority(ctx, wardenHost.ID(), wardenAuthority); err == nil {
+		t.Fatal("expected a warden without a wallet to fail verification")
+	}
+
+	warden.SetAuthorityKey(wardenKey)
+	if err := seeker.VerifyAuthority(ctx, wardenHost.ID(), solana.NewWallet().PublicKey()); err == nil {
+		t.Fatal("expected verification against another wallet to fail")
+	}
+	if err := seeker.VerifyAuthority(ctx, wardenHost.ID(), wardenAuthority); err != nil {
+		t.Fatal(err)
+	}
+
+	// The warden learned the seeker's wallet in the same handshake.
+	attested, ok := warden.PeerAuthority(seeker.GetHost().ID())
+	if !ok || !attested.Equals(solana.PublicKeyFromBytes(seekerKey.Public().(ed25519.PublicKey))) {
+		t.Fatalf("warden recorded seeker authority %s, %v", attested, ok)
+	}
+}
@@ -0,0 +1,223 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const (
+	chainBootstrapInterval = 10 * time.Minute
+	// chainBootstrapPeers is how many registered wardens the node stays connected to.
+	chainBootstrapPeers = 8
+	chainDialTimeout    = 15 * time.Second
+)
+
+// chainPeers holds the peer IDs of the registered wardens from the last bootstrap round.
+// It has its own lock because the DHT reads it from its goroutines, which Stop joins while
+// holding the node's.
+type chainPeers struct {
+	mu  sync.Mutex
+	ids []peer.ID
+}
+
+func (c *chainPeers) set(ids []peer.ID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ids = ids
+}
+
+func (c *chainPeers) get() []peer.ID {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ids
+}
+
+// chainBootstrapEnabled reports whether the node seeds the DHT from the registered wardens.
+func (n *P2PNode) chainBootstrapEnabled() bool {
+	return n.ChainPeers != nil && !n.cfg.DisableChainBootstrap
+}
+
+// dhtModeLocked returns the configured DHT mode, or the one the node's role implies.
+func (n *P2PNode) dhtModeLocked() string {
+	switch {
+	case n.cfg.DHTMode != "":
+		return n.cfg.DHTMode
+	case n.authorityKey != nil:
+		return DHTModeServer
+	case n.SeekerKey != nil:
+		return DHTModeClient
+	}
+	return DHTModeAuto
+}
+
+// knownChainPeers returns the registered wardens whose addresses the peerstore knows,
+// for the DHT to bootstrap from.
+func (n *P2PNode) knownChainPeers(h host.Host) []peer.AddrInfo {
+	var infos []peer.AddrInfo
+	for _, id := range n.chain.get() {
+		if id == h.ID() {
+			continue
+		}
+		if addrs := h.Peerstore().Addrs(id); len(addrs) > 0 {
+			infos = append(infos, peer.AddrInfo{ID: id, Addrs: addrs})
+		}
+	}
+	return infos
+}
+
+// bootstrapFromChain keeps the node connected to a few registered wardens every
+// chainBootstrapInterval until ctx is cancelled, so the DHT never depends on fixed
+// bootstrap peers.
+func (n *P2PNode) bootstrapFromChain(ctx context.Context, h host.Host) {
+	for {
+		if err := n.connectChainPeers(ctx, h); err != nil && ctx.Err() == nil {
+			n.log().Warn("bootstrapping from registered wardens failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(chainBootstrapInterval):
+		}
+	}
+}
+
+// connectChainPeers runs one round: it refreshes the registered wardens, connects to
+// random ones until chainBootstrapPeers are connected, and saves their addresses.
+func (n *P2PNode) connectChainPeers(ctx context.Context, h host.Host) error {
+	ids, err := n.ChainPeers(ctx)
+	if err != nil {
+		return err
+	}
+	n.chain.set(ids)
+
+	connected := 0
+	for _, i := range rand.Perm(len(ids)) {
+		id := ids[i]
+		if id == h.ID() {
+			continue
+		}
+		if h.Network().Connectedness(id) == network.Connected {
+			connected++
+			continue
+		}
+		if connected >= chainBootstrapPeers {
+			continue
+		}
+		dialCtx, cancel := context.WithTimeout(ctx, chainDialTimeout)
+		err := n.connectPeer(dialCtx, id)
+		cancel()
+		if err != nil {
+			n.log().Debug("failed to connect to registered warden", "peer", id, "err", err)
+			continue
+		}
+		h.Peerstore().Put(id, discoverySourceKey, SourceChain)
+		connected++
+		n.spawn(func(ctx context.Context) { n.measurePeer(ctx, id) })
+	}
+
+	if n.AddrBook == "" {
+		return nil
+	}
+	book := make(addrBook)
+	for _, id := range ids {
+		if addrs := h.Peerstore().Addrs(id); len(addrs) > 0 && id != h.ID() {
+			book[id] = addrs
+		}
+	}
+	return book.save(n.AddrBook)
+}
+
+// addrBook remembers the addresses of registered wardens across restarts, so a node can
+// dial them before the DHT is able to find them.
+type addrBook map[peer.ID][]ma.Multiaddr
+
+// loadAddrBook reads an address book. A missing file is an empty book.
+func loadAddrBook(path string) (addrBook, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return addrBook{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read peer address book: %w", err)
+	}
+	var raw map[string][]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse peer address book %s: %w", path, err)
+	}
+	book := make(addrBook, len(raw))
+	for s, addrs := range raw {
+		id, err := peer.Decode(s)
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if addr, err := ma.NewMultiaddr(a); err == nil {
+				book[id] = append(book[id], addr)
+			}
+		}
+	}
+	return book, nil
+}
+
+// save writes the book to a temporary file and renames it into place, so concurrent
+// readers never see a partial book.
+func (b addrBook) save(path string) error {
+	raw := make(map[string][]string, len(b))
+	for id, addrs := range b {
+		for _, a := range addrs {
+			raw[id.String()] = append(raw[id.String()], a.String())
+		}
+	}
+	data, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".peers-*")
+	if err != nil {
+		return fmt.Errorf("failed to save peer address book: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save peer address book: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save peer address book: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save peer address book: %w", err)
+	}
+	return nil
+}
+
+// loadAddrBookInto adds the saved addresses to the peerstore and remembers their peers as
+// registered wardens until the first bootstrap round refreshes the list.
+func (n *P2PNode) loadAddrBookInto(h host.Host) {
+	if n.AddrBook == "" {
+		return
+	}
+	book, err := loadAddrBook(n.AddrBook)
+	if err != nil {
+		n.log().Warn("ignoring peer address book", "err", err)
+		return
+	}
+	ids := make([]peer.ID, 0, len(book))
+	for id, addrs := range book {
+		h.Peerstore().AddAddrs(id, addrs, peerstore.AddressTTL)
+		ids = append(ids, id)
+	}
+	n.chain.set(ids)
+}
@@ -0,0 +1,96 @@
+package node
+
+import (
+	"context"
+	"crypto/ed25519"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+func TestDHTModeFollowsRole(t *testing.T) {
+	n := NewP2PNode()
+	if mode := n.dhtModeLocked(); mode != DHTModeAuto {
+		t.Errorf("plain node mode = %s", mode)
+	}
+	n.SeekerKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	if mode := n.dhtModeLocked(); mode != DHTModeClient {
+		t.Errorf("seeker mode = %s", mode)
+	}
+	n.SetAuthorityKey(n.SeekerKey)
+	if mode := n.dhtModeLocked(); mode != DHTModeServer {
+		t.Errorf("warden mode = %s", mode)
+	}
+	n.cfg.DHTMode = DHTModeClient
+	if mode := n.dhtModeLocked(); mode != DHTModeClient {
+		t.Errorf("configured mode = %s", mode)
+	}
+}
+
+func TestBootstrapFromChain(t *testing.T) {
+	loopback := Config{ListenAddrs: []string{"/ip4/127.0.0.1/tcp/0"}, DHTMode: DHTModeServer}
+
+	warden := NewP2PNode()
+	if err := warden.SetConfig(loopback); err != nil {
+		t.Fatal(err)
+	}
+	if err := warden.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer warden.Stop()
+	wardenHost := warden.GetHost()
+	for _, p := range wardenHost.Mux().Protocols() {
+		if p == protocol.ID("/ipfs/kad/1.0.0") {
+			t.Fatal("node speaks the public IPFS DHT protocol")
+		}
+	}
+	if !hasProtocol(wardenHost.Mux().Protocols(), "/arkham/kad/1.0.0") {
+		t.Fatalf("warden does not serve the Arkham DHT: %v", wardenHost.Mux().Protocols())
+	}
+
+	// A previous run saved the warden's addresses; the chain lists it as registered.
+	book := filepath.Join(t.TempDir(), "peers.json")
+	if err := (addrBook{wardenHost.ID(): wardenHost.Addrs()}).save(book); err != nil {
+		t.Fatal(err)
+	}
+	seeker := NewP2PNode()
+	if err := seeker.SetConfig(loopback); err != nil {
+		t.Fatal(err)
+	}
+	seeker.AddrBook = book
+	seeker.ChainPeers = func(ctx context.Context) ([]peer.ID, error) {
+		return []peer.ID{wardenHost.ID()}, nil
+	}
+	if err := seeker.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer seeker.Stop()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for seeker.GetHost().Network().Connectedness(wardenHost.ID()) != network.Connected {
+		if time.Now().After(deadline) {
+			t.Fatal("seeker did not connect to the registered warden")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	saved, err := loadAddrBook(book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved[wardenHost.ID()]) == 0 {
+		t.Fatal("warden addresses were not kept in the address book")
+	}
+}
+
+func hasProtocol(protocols []protocol.ID, want protocol.ID) bool {
+	for _, p := range protocols {
+		if p == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,265 @@
+package node
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ProtocolCircuit carries multi-hop circuits between a seeker and a chain of wardens.
+//
+// A circuit is built one hop at a time. The seeker performs an X25519 handshake with each
+// hop, sending it through the hops already in the circuit, so every hop only ever talks to
+// its predecessor and successor. Relay cells are wrapped in one AES-CTR layer per hop; each
+// hop removes its layer on the way out and adds it on the way back, and only the hop a cell
+// is addressed to can recognise it. Only the exit hop ever sees the destination address.
+//
+// A BEGIN cell is laid out like a ProtocolProxy connect request: an attestation length
+// byte, the attestation and the destination. The attestation is the seeker's wallet
+// authority followed by its signature over circuitAttestation, and the exit only opens
+// streams for a wallet it authorizes. Only wardens and exits serve the protocol.
+const ProtocolCircuit = "/arkham/circuit/1.0.0"
+
+const circuitHandshakeContext = "arkham-circuit-v1"
+
+// Frame types exchanged between adjacent hops.
+const (
+	frameCreate  byte = 1
+	frameCreated byte = 2
+	frameRelay   byte = 3
+	frameDestroy byte = 4
+)
+
+// Relay commands, carried inside the encrypted relay cell.
+const (
+	relayExtend    byte = 1
+	relayExtended  byte = 2
+	relayBegin     byte = 3
+	relayConnected byte = 4
+	relayData      byte = 5
+	relayEnd       byte = 6
+	relayProof     byte = 7
+	relayProofAck  byte = 8
+	relaySendme    byte = 9
+)
+
+const (
+	maxFramePayload = 65535
+	relayHeaderLen  = 4 + 1 + 2 // digest, command, stream ID
+	// maxRelayData keeps data cells well under the frame limit.
+	maxRelayData = 16 * 1024
+	// streamWindow is how much data the exit may send on a stream before the seeker has
+	// read it. The seeker returns credit in SENDME cells once sendmeIncrement was read.
+	streamWindow    = 32 * maxRelayData
+	sendmeIncrement = 8 * maxRelayData
+)
+
+func writeFrame(w io.Writer, typ byte, payload []byte) error {
+	if len(payload) > maxFramePayload {
+		return fmt.Errorf("frame payload too large: %d bytes", len(payload))
+	}
+	buf := make([]byte, 3+len(payload))
+	buf[0] = typ
+	binary.BigEndian.PutUint16(buf[1:3], uint16(len(payload)))
+	copy(buf[3:], payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readFrame(r *bufio.Reader) (byte, []byte, error) {
+	var header [3]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[1:3]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+// circuitLayer is the symmetric state one hop shares with the seeker.
+type circuitLayer struct {
+	fwd       cipher.Stream
+	bwd       cipher.Stream
+	fwdDigest []byte
+	bwdDigest []byte
+	// handshake is the seeker's and the hop's ephemeral keys, which a seeker's wallet signs
+	// to have the hop serve as its exit.
+	handshake []byte
+}
+
+func newCircuitLayer(priv *ecdh.PrivateKey, peerPub, seekerEph, hopEph []byte) (*circuitLayer, error) {
+	pub, err := ecdh.X25519().NewPublicKey(peerPub)
+	if err != nil {
+		return nil, fmt.Errorf("invalid handshake key: %w", err)
+	}
+	shared, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, fmt.Errorf("handshake failed: %w", err)
+	}
+
+	salt := make([]byte, 0, len(seekerEph)+len(hopEph))
+	salt = append(salt, seekerEph...)
+	salt = append(salt, hopEph...)
+	keys, err := hkdf.Key(sha256.New, shared, salt, circuitHandshakeContext, 128)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive circuit keys: %w", err)
+	}
+
+	fwd, err := newCTR(keys[0:32])
+	if err != nil {
+		return nil, err
+	}
+	bwd, err := newCTR(keys[32:64])
+	if err != nil {
+		return nil, err
+	}
+	return &circuitLayer{
+		fwd:       fwd,
+		bwd:       bwd,
+		fwdDigest: keys[64:96],
+		bwdDigest: keys[96:128],
+		handshake: salt,
+	}, nil
+}
+
+func newCTR(key []byte) (cipher.Stream, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	// Every key is used for exactly one stream, so a zero IV is safe.
+	return cipher.NewCTR(block, make([]byte, aes.BlockSize)), nil
+}
+
+// handshakeTranscript is what a hop signs with its libp2p identity key to prove that the
+// handshake reply comes from it and not from an earlier hop in the circuit.
+func handshakeTranscript(seekerEph, hopEph []byte) []byte {
+	msg := make([]byte, 0, len(circuitHandshakeContext)+len(seekerEph)+len(hopEph))
+	msg = append(msg, circuitHandshakeContext...)
+	msg = append(msg, seekerEph...)
+	msg = append(msg, hopEph...)
+	return msg
+}
+
+// circuitAttestation is the message a seeker signs with its wallet to have the exit open
+// streams for it. It covers the exit's handshake, so it is good for one circuit only and
+// cannot be replayed by another hop.
+func circuitAttestation(handshake []byte) []byte {
+	return append([]byte("arkham-circuit-seeker:"), handshake...)
+}
+
+func relayDigest(key []byte, body []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return mac.Sum(nil)[:4]
+}
+
+// sealRelay builds a plaintext relay cell that the hop owning digestKey will recognise.
+func sealRelay(digestKey []byte, cmd byte, streamID uint16, data []byte) []byte {
+	cell := make([]byte, relayHeaderLen+len(data))
+	cell[4] = cmd
+	binary.BigEndian.PutUint16(cell[5:7], streamID)
+	copy(cell[relayHeaderLen:], data)
+	copy(cell[0:4], relayDigest(digestKey, cell[4:]))
+	return cell
+}
+
+// openRelay checks whether a decrypted relay cell is addressed to the owner of digestKey.
+func openRelay(digestKey []byte, cell []byte) (cmd byte, streamID uint16, data []byte, ok bool) {
+	if len(cell) < relayHeaderLen {
+		return 0, 0, nil, false
+	}
+	if !hmac.Equal(cell[0:4], relayDigest(digestKey, cell[4:])) {
+		return 0, 0, nil, false
+	}
+	return cell[4], binary.BigEndian.Uint16(cell[5:7]), cell[relayHeaderLen:], true
+}
+
+// flowWindow is the credit the exit has left to send on one stream. A slow reader stops
+// the exit reading from the destination instead of growing the seeker's buffer.
+type flowWindow struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	credit int
+	closed bool
+}
+
+func newFlowWindow() *flowWindow {
+	w := &flowWindow{credit: streamWindow}
+	w.cond = sync.NewCond(&w.mu)
+	return w
+}
+
+// take waits until n bytes of credit are available and uses them. It returns false once
+// the window is closed.
+func (w *flowWindow) take(n int) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.credit < n && !w.closed {
+		w.cond.Wait()
+	}
+	if w.closed {
+		return false
+	}
+	w.credit -= n
+	return true
+}
+
+// add returns credit from a SENDME. It fails if the seeker returns more than it was sent.
+func (w *flowWindow) add(n int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if n <= 0 || w.credit+n > streamWindow {
+		return fmt.Errorf("SENDME of %d bytes exceeds the stream window", n)
+	}
+	w.credit += n
+	w.cond.Broadcast()
+	return nil
+}
+
+func (w *flowWindow) close() {
+	w.mu.Lock()
+	w.closed = true
+	w.cond.Broadcast()
+	w.mu.Unlock()
+}
+
+// BandwidthProof is a seeker-signed statement of the MB a warden relayed, in the format
+// SubmitBandwidthProof expects.
+type BandwidthProof struct {
+	MbConsumed uint64
+	Timestamp  int64
+	Seeker     [32]byte
+	Signature  [64]byte
+}
+
+func (p BandwidthProof) marshal() []byte {
+	buf := make([]byte, 16+32+64)
+	binary.LittleEndian.PutUint64(buf[0:8], p.MbConsumed)
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(p.Timestamp))
+	copy(buf[16:48], p.Seeker[:])
+	copy(buf[48:112], p.Signature[:])
+	return buf
+}
+
+func unmarshalBandwidthProof(data []byte) (BandwidthProof, error) {
+	var p BandwidthProof
+	if len(data) != 16+32+64 {
+		return p, fmt.Errorf("malformed bandwidth proof")
+	}
+	p.MbConsumed = binary.LittleEndian.Uint64(data[0:8])
+	p.Timestamp = int64(binary.LittleEndian.Uint64(data[8:16]))
+	copy(p.Seeker[:], data[16:48])
+	copy(p.Signature[:], data[48:112])
+	return p, nil
+}
@@ -0,0 +1,523 @@
+package node
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"arkham-cli/metrics"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ErrCircuitClosed is returned by operations on a torn-down circuit.
+var ErrCircuitClosed = errors.New("circuit closed")
+
+// Circuit is a seeker's path through one or more wardens. The last hop is the exit.
+type Circuit struct {
+	Path []peer.ID
+
+	stream network.Stream
+	reader *bufio.Reader
+	layers []*circuitLayer
+	// attestation opens every BEGIN cell: the seeker wallet's attestation for the exit.
+	attestation []byte
+
+	// fwdMu serialises the forward ciphers and writes to the first hop.
+	fwdMu sync.Mutex
+
+	mu      sync.Mutex
+	streams map[uint16]*circuitConn
+	nextID  uint16
+	acks    map[int]chan string
+
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	bytesSent     atomic.Uint64
+	bytesReceived atomic.Uint64
+}
+
+// BuildCircuit builds a circuit through path, extending it one hop at a time. wallet is the
+// seeker's wallet key, which attests the circuit's streams to the exit; exits open no
+// streams for a circuit built without one.
+func (n *P2PNode) BuildCircuit(ctx context.Context, path []peer.ID, wallet ed25519.PrivateKey) (*Circuit, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("a circuit needs at least one hop")
+	}
+	h := n.GetHost()
+	if h == nil {
+		return nil, fmt.Errorf("node is not running")
+	}
+	if err := n.connectPeer(ctx, path[0]); err != nil {
+		return nil, err
+	}
+	s, err := h.NewStream(ctx, path[0], ProtocolCircuit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open circuit to %s: %w", path[0], err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetDeadline(deadline)
+	}
+
+	c := &Circuit{
+		Path:    path,
+		stream:  s,
+		reader:  bufio.NewReader(s),
+		streams: make(map[uint16]*circuitConn),
+		acks:    make(map[int]chan string),
+		closed:  make(chan struct{}),
+	}
+
+	// First hop: the handshake goes directly over the stream.
+	priv, seekerEph, err := newHandshakeKey()
+	if err != nil {
+		s.Reset()
+		return nil, err
+	}
+	if err := writeFrame(s, frameCreate, seekerEph); err != nil {
+		s.Reset()
+		return nil, err
+	}
+	typ, created, err := readFrame(c.reader)
+	if err != nil || typ != frameCreated {
+		s.Reset()
+		return nil, fmt.Errorf("hop %s did not complete the handshake", path[0])
+	}
+	if err := c.addLayer(path[0], priv, seekerEph, created); err != nil {
+		s.Reset()
+		return nil, err
+	}
+
+	// Further hops: ask the current last hop to extend the circuit.
+	for _, hop := range path[1:] {
+		priv, seekerEph, err := newHandshakeKey()
+		if err != nil {
+			s.Reset()
+			return nil, err
+		}
+		hopBytes := []byte(hop)
+		extend := append([]byte{byte(len(hopBytes))}, hopBytes...)
+		extend = append(extend, seekerEph...)
+		if err := c.send(len(c.layers)-1, relayExtend, 0, extend); err != nil {
+			s.Reset()
+			return nil, err
+		}
+
+		_, cmd, _, data, err := c.receive()
+		if err != nil {
+			s.Reset()
+			return nil, err
+		}
+		if cmd != relayExtended {
+			s.Reset()
+			return nil, fmt.Errorf("failed to extend circuit to %s: %s", hop, data)
+		}
+		if err := c.addLayer(hop, priv, seekerEph, data); err != nil {
+			s.Reset()
+			return nil, err
+		}
+	}
+
+	c.attestation = attestationBody(wallet, circuitAttestation(c.layers[len(c.layers)-1].handshake))
+	s.SetDeadline(time.Time{})
+	go c.readLoop()
+	return c, nil
+}
+
+func newHandshakeKey() (*ecdh.PrivateKey, []byte, error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv, priv.PublicKey().Bytes(), nil
+}
+
+// addLayer checks the hop's signed handshake reply and derives its layer keys.
+func (c *Circuit) addLayer(hop peer.ID, priv *ecdh.PrivateKey, seekerEph, created []byte) error {
+	if len(created) < 32 {
+		return fmt.Errorf("malformed handshake reply from %s", hop)
+	}
+	hopEph, sig := created[:32], created[32:]
+
+	pub, err := hop.ExtractPublicKey()
+	if err != nil {
+		return fmt.Errorf("cannot verify hop %s: %w", hop, err)
+	}
+	ok, err := pub.Verify(handshakeTranscript(seekerEph, hopEph), sig)
+	if err != nil || !ok {
+		return fmt.Errorf("hop %s sent an invalid handshake signature", hop)
+	}
+
+	layer, err := newCircuitLayer(priv, hopEph, seekerEph, hopEph)
+	if err != nil {
+		return err
+	}
+	c.layers = append(c.layers, layer)
+	return nil
+}
+
+// send wraps a relay cell for hop in every layer up to and including it.
+func (c *Circuit) send(hop int, cmd byte, streamID uint16, data []byte) error {
+	cell := sealRelay(c.layers[hop].fwdDigest, cmd, streamID, data)
+	c.fwdMu.Lock()
+	defer c.fwdMu.Unlock()
+	for i := hop; i >= 0; i-- {
+		c.layers[i].fwd.XORKeyStream(cell, cell)
+	}
+	return writeFrame(c.stream, frameRelay, cell)
+}
+
+// receive reads the next relay cell and peels layers until one hop recognises it.
+func (c *Circuit) receive() (hop int, cmd byte, streamID uint16, data []byte, err error) {
+	for {
+		typ, payload, err := readFrame(c.reader)
+		if err != nil {
+			return 0, 0, 0, nil, err
+		}
+		switch typ {
+		case frameRelay:
+		case frameDestroy:
+			return 0, 0, 0, nil, ErrCircuitClosed
+		default:
+			continue
+		}
+		for i, layer := range c.layers {
+			layer.bwd.XORKeyStream(payload, payload)
+			if cmd, streamID, data, ok := openRelay(layer.bwdDigest, payload); ok {
+				return i, cmd, streamID, data, nil
+			}
+		}
+		return 0, 0, 0, nil, fmt.Errorf("received a relay cell no hop claims")
+	}
+}
+
+func (c *Circuit) readLoop() {
+	defer c.Close()
+	for {
+		hop, cmd, streamID, data, err := c.receive()
+		if err != nil {
+			return
+		}
+		switch cmd {
+		case relayConnected, relayData, relayEnd:
+			if hop != len(c.layers)-1 {
+				continue
+			}
+			c.mu.Lock()
+			conn := c.streams[streamID]
+			c.mu.Unlock()
+			if conn != nil {
+				conn.deliver(cmd, data)
+			}
+		case relayProofAck:
+			c.mu.Lock()
+			ack := c.acks[hop]
+			c.mu.Unlock()
+			if ack != nil {
+				select {
+				case ack <- string(data):
+				default:
+				}
+			}
+		}
+	}
+}
+
+// Dial opens a TCP stream to addr from the exit hop.
+func (c *Circuit) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	conn := &circuitConn{
+		circuit:   c,
+		addr:      addr,
+		connected: make(chan error, 1),
+	}
+	conn.cond = sync.NewCond(&conn.mu)
+
+	c.mu.Lock()
+	select {
+	case <-c.closed:
+		c.mu.Unlock()
+		return nil, ErrCircuitClosed
+	default:
+	}
+	for {
+		c.nextID++
+		if c.nextID != 0 && c.streams[c.nextID] == nil {
+			break
+		}
+	}
+	conn.id = c.nextID
+	c.streams[conn.id] = conn
+	c.mu.Unlock()
+
+	if err := c.send(len(c.layers)-1, relayBegin, conn.id, slices.Concat(c.attestation, []byte(addr))); err != nil {
+		c.removeStream(conn.id)
+		return nil, err
+	}
+
+	select {
+	case err := <-conn.connected:
+		if err != nil {
+			c.removeStream(conn.id)
+			return nil, err
+		}
+		return conn, nil
+	case <-ctx.Done():
+		conn.Close()
+		return nil, ctx.Err()
+	case <-c.closed:
+		return nil, ErrCircuitClosed
+	}
+}
+
+func (c *Circuit) removeStream(id uint16) {
+	c.mu.Lock()
+	delete(c.streams, id)
+	c.mu.Unlock()
+}
+
+// SendProof delivers a bandwidth proof to one hop and waits for it to be accepted.
+func (c *Circuit) SendProof(ctx context.Context, hop int, proof BandwidthProof) error {
+	if hop < 0 || hop >= len(c.layers) {
+		return fmt.Errorf("circuit has no hop %d", hop)
+	}
+	ack := make(chan string, 1)
+	c.mu.Lock()
+	c.acks[hop] = ack
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.acks, hop)
+		c.mu.Unlock()
+	}()
+
+	if err := c.send(hop, relayProof, 0, proof.marshal()); err != nil {
+		return err
+	}
+	select {
+	case msg := <-ack:
+		if msg != "" {
+			return fmt.Errorf("hop %s rejected the proof: %s", c.Path[hop], msg)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.closed:
+		return ErrCircuitClosed
+	}
+}
+
+// BytesTransferred returns the payload bytes carried by the circuit in both directions.
+func (c *Circuit) BytesTransferred() uint64 {
+	return c.bytesSent.Load() + c.bytesReceived.Load()
+}
+
+// Done is closed when the circuit is torn down.
+func (c *Circuit) Done() <-chan struct{} {
+	return c.closed
+}
+
+// Close tears the circuit down at every hop.
+func (c *Circuit) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.fwdMu.Lock()
+		writeFrame(c.stream, frameDestroy, nil)
+		c.fwdMu.Unlock()
+		c.stream.Close()
+
+		c.mu.Lock()
+		streams := c.streams
+		c.streams = make(map[uint16]*circuitConn)
+		c.mu.Unlock()
+		for _, conn := range streams {
+			conn.deliver(relayEnd, []byte(ErrCircuitClosed.Error()))
+		}
+	})
+	return nil
+}
+
+// circuitConn is one TCP stream carried by a circuit.
+type circuitConn struct {
+	circuit   *Circuit
+	id        uint16
+	addr      string
+	connected chan error
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// buf holds data the exit sent that was not read yet. The exit stays within
+	// streamWindow of it, and read counts what to return in the next SENDME.
+	buf  []byte
+	read int
+	eof  bool
+	// readDeadline and writeDeadline are zero when unset. readTimer wakes a blocked Read
+	// when the read deadline passes.
+	readDeadline  time.Time
+	writeDeadline time.Time
+	readTimer     *time.Timer
+	closeOnce     sync.Once
+}
+
+func (s *circuitConn) deliver(cmd byte, data []byte) {
+	switch cmd {
+	case relayConnected:
+		select {
+		case s.connected <- nil:
+		default:
+		}
+	case relayData:
+		s.circuit.bytesReceived.Add(uint64(len(data)))
+		metrics.SeekerBytesIn.Add(float64(len(data)))
+		s.mu.Lock()
+		overrun := len(s.buf)+len(data) > streamWindow
+		if !overrun {
+			s.buf = append(s.buf, data...)
+			s.cond.Broadcast()
+		}
+		s.mu.Unlock()
+		if overrun {
+			// The exit ignored the window; drop the stream rather than buffer without limit.
+			s.Close()
+		}
+	case relayEnd:
+		select {
+		case s.connected <- fmt.Errorf("exit refused %s: %s", s.addr, data):
+		default:
+		}
+		s.mu.Lock()
+		s.eof = true
+		s.cond.Broadcast()
+		s.mu.Unlock()
+		s.circuit.removeStream(s.id)
+	}
+}
+
+func (s *circuitConn) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	for len(s.buf) == 0 && !s.eof {
+		if !s.readDeadline.IsZero() && !time.Now().Before(s.readDeadline) {
+			s.mu.Unlock()
+			return 0, os.ErrDeadlineExceeded
+		}
+		s.cond.Wait()
+	}
+	if len(s.buf) == 0 {
+		s.mu.Unlock()
+		return 0, io.EOF
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	s.read += n
+	var sendme int
+	if s.read >= sendmeIncrement && !s.eof {
+		sendme, s.read = s.read, 0
+	}
+	s.mu.Unlock()
+
+	if sendme > 0 {
+		credit := binary.BigEndian.AppendUint32(nil, uint32(sendme))
+		s.circuit.send(len(s.circuit.layers)-1, relaySendme, s.id, credit)
+	}
+	return n, nil
+}
+
+// Write sends p in data cells. The write deadline is checked before each cell; a cell
+// already handed to the circuit is not interrupted.
+func (s *circuitConn) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		s.mu.Lock()
+		eof, deadline := s.eof, s.writeDeadline
+		s.mu.Unlock()
+		if eof {
+			return written, io.ErrClosedPipe
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return written, os.ErrDeadlineExceeded
+		}
+
+		chunk := p[written:]
+		if len(chunk) > maxRelayData {
+			chunk = chunk[:maxRelayData]
+		}
+		if err := s.circuit.send(len(s.circuit.layers)-1, relayData, s.id, chunk); err != nil {
+			return written, err
+		}
+		s.circuit.bytesSent.Add(uint64(len(chunk)))
+		metrics.SeekerBytesOut.Add(float64(len(chunk)))
+		written += len(chunk)
+	}
+	return written, nil
+}
+
+func (s *circuitConn) Close() error {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		wasOpen := !s.eof
+		s.eof = true
+		if s.readTimer != nil {
+			s.readTimer.Stop()
+		}
+		s.cond.Broadcast()
+		s.mu.Unlock()
+		s.circuit.removeStream(s.id)
+		if wasOpen {
+			s.circuit.send(len(s.circuit.layers)-1, relayEnd, s.id, nil)
+		}
+	})
+	return nil
+}
+
+func (s *circuitConn) LocalAddr() net.Addr  { return circuitAddr("circuit") }
+func (s *circuitConn) RemoteAddr() net.Addr { return circuitAddr(s.addr) }
+
+func (s *circuitConn) SetDeadline(t time.Time) error {
+	s.SetReadDeadline(t)
+	return s.SetWriteDeadline(t)
+}
+
+func (s *circuitConn) SetReadDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readDeadline = t
+	if s.readTimer != nil {
+		s.readTimer.Stop()
+		s.readTimer = nil
+	}
+	if d := time.Until(t); !t.IsZero() && d > 0 {
+		s.readTimer = time.AfterFunc(d, func() {
+			s.mu.Lock()
+			s.cond.Broadcast()
+			s.mu.Unlock()
+		})
+	}
+	// Wake a blocked Read so it sees a deadline that already passed.
+	s.cond.Broadcast()
+	return nil
+}
+
+func (s *circuitConn) SetWriteDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writeDeadline = t
+	return nil
+}
+
+type circuitAddr string
+
+func (a circuitAddr) Network() string { return "arkham-circuit" }
+func (a circuitAddr) String() string  { return string(a) }
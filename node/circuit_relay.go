@@ -0,0 +1,527 @@
+package node
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"arkham-cli/metrics"
+	"arkham-cli/policy"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// CircuitRelay configures how this node serves as a hop in other peers' circuits.
+type CircuitRelay struct {
+	// Dial opens exit connections. It defaults to a plain net.Dialer.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+	// OnProof is called with the bandwidth proofs a seeker sends this hop. Returning nil
+	// acknowledges the proof to the seeker. Without it proofs are rejected.
+	OnProof func(seeker peer.ID, proof BandwidthProof) error
+	// Policy is the exit policy applied to proxied flows and circuit exits. Without it every
+	// destination outside the networks a policy refuses by default is allowed, and seekers
+	// are not limited.
+	Policy *policy.Engine
+	// SeekerTier returns the tier of a seeker that proved its wallet authority. Without it
+	// every seeker is served as policy.TierStandard.
+	SeekerTier func(authority [32]byte) string
+	// Authorize admits a seeker that proved its wallet authority to this node's exit,
+	// normally by checking that the wallet holds an active Connection with this warden.
+	// Without it the node is not an exit: it does not serve ProtocolProxy and refuses to
+	// open streams at the end of a circuit, though it still relays circuits.
+	Authorize func(seeker peer.ID, authority [32]byte) error
+}
+
+// exit reports whether the node serves exit traffic.
+func (r *CircuitRelay) exit() bool {
+	return r != nil && r.Authorize != nil
+}
+
+// authorize checks that a seeker may use the exit before anything is dialled for it.
+func (r *CircuitRelay) authorize(seeker peer.ID, s policy.Seeker) error {
+	if !r.exit() {
+		return fmt.Errorf("this node is not an exit")
+	}
+	if s.Authority == "" {
+		return fmt.Errorf("the exit only serves seekers that prove their wallet")
+	}
+	authority, err := solana.PublicKeyFromBase58(s.Authority)
+	if err != nil {
+		return err
+	}
+	return r.Authorize(seeker, authority)
+}
+
+// attestedSeeker is the policy identity of a seeker that proved its wallet authority.
+func (r *CircuitRelay) attestedSeeker(seeker peer.ID, authority solana.PublicKey) policy.Seeker {
+	identity := policy.Seeker{PeerID: seeker.String(), Authority: authority.String()}
+	if r != nil && r.SeekerTier != nil {
+		identity.Tier = r.SeekerTier(authority)
+	}
+	return identity
+}
+
+// openSession joins the exit policy session of a seeker. It returns a nil session when no
+// policy is configured.
+func (r *CircuitRelay) openSession(s policy.Seeker) (*policy.Session, error) {
+	if r == nil || r.Policy == nil {
+		return nil, nil
+	}
+	return r.Policy.Open(s)
+}
+
+// defaultExitPolicy checks the destinations of a relay without an exit policy. The empty
+// policy refuses only internal networks.
+var defaultExitPolicy = policy.NewEngine(&policy.Policy{})
+
+// dialExit opens an exit connection to addr, subject to the exit policy. Traffic on the
+// returned connection counts against session, which may be nil.
+func (r *CircuitRelay) dialExit(ctx context.Context, session *policy.Session, addr string) (net.Conn, error) {
+	dial := (&net.Dialer{}).DialContext
+	if r != nil && r.Dial != nil {
+		dial = r.Dial
+	}
+	exitPolicy := defaultExitPolicy
+	if r != nil && r.Policy != nil {
+		exitPolicy = r.Policy
+	}
+	resolved, err := exitPolicy.ResolveDestination(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dial(ctx, "tcp", resolved)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return conn, nil
+	}
+	return session.Conn(conn), nil
+}
+
+const (
+	circuitExtendTimeout = 30 * time.Second
+	circuitDialTimeout   = 15 * time.Second
+)
+
+// hopCircuit is the state of one circuit passing through this node.
+type hopCircuit struct {
+	node   *P2PNode
+	relay  *CircuitRelay
+	prev   network.Stream
+	layer  *circuitLayer
+	seeker peer.ID
+
+	// bwdMu serialises the backward cipher and writes to prev, so cells are encrypted in
+	// the order they are sent.
+	bwdMu sync.Mutex
+	next  network.Stream
+
+	mu      sync.Mutex
+	streams map[uint16]*exitStream
+	closed  bool
+	// authority is the wallet the exit streams are attested to and session its exit
+	// policy session, both set by the first exit stream.
+	authority string
+	session   *policy.Session
+
+	// relayed counts the cell bytes forwarded in both directions.
+	relayed atomic.Uint64
+}
+
+// exitStream is a stream's connection to its destination and the window of data it may
+// still send towards the seeker.
+type exitStream struct {
+	net.Conn
+	window *flowWindow
+}
+
+func (s *exitStream) Close() error {
+	s.window.close()
+	return s.Conn.Close()
+}
+
+// relaysCircuits reports whether the node serves as a hop in other peers' circuits. Only
+// a warden, which attests the wallet it is paid to, or an exit does.
+func (n *P2PNode) relaysCircuits() bool {
+	n.mu.Lock()
+	wallet := n.authorityKey
+	n.mu.Unlock()
+	return wallet != nil || n.Relay.exit()
+}
+
+func (n *P2PNode) circuitHandler(s network.Stream) {
+	if !n.relaysCircuits() {
+		s.Reset()
+		return
+	}
+	c := &hopCircuit{
+		node:    n,
+		relay:   n.Relay,
+		prev:    s,
+		seeker:  s.Conn().RemotePeer(),
+		streams: make(map[uint16]*exitStream),
+	}
+	n.addCircuit(c)
+	defer n.removeCircuit(c)
+	defer c.close()
+
+	reader := bufio.NewReader(s)
+	if err := c.handshake(reader); err != nil {
+		n.log().Warn("circuit handshake failed", "seeker", c.seeker, "err", err)
+		return
+	}
+
+	for {
+		typ, payload, err := readFrame(reader)
+		if err != nil {
+			return
+		}
+		switch typ {
+		case frameRelay:
+			c.relayed.Add(uint64(len(payload)))
+			metrics.WardenBytesIn.Add(float64(len(payload)))
+			if err := c.handleForward(payload); err != nil {
+				n.log().Info("closing circuit", "seeker", c.seeker, "err", err)
+				return
+			}
+		case frameDestroy:
+			return
+		default:
+			n.log().Warn("unexpected circuit frame from predecessor", "seeker", c.seeker, "type", typ)
+			return
+		}
+	}
+}
+
+// handshake answers the CREATE frame that opens every circuit hop.
+func (c *hopCircuit) handshake(reader *bufio.Reader) error {
+	typ, seekerEph, err := readFrame(reader)
+	if err != nil {
+		return err
+	}
+	if typ != frameCreate {
+		return fmt.Errorf("expected CREATE, got frame type %d", typ)
+	}
+
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	hopEph := priv.PublicKey().Bytes()
+	c.layer, err = newCircuitLayer(priv, seekerEph, seekerEph, hopEph)
+	if err != nil {
+		return err
+	}
+
+	h := c.node.GetHost()
+	if h == nil {
+		return fmt.Errorf("node is not running")
+	}
+	identity := h.Peerstore().PrivKey(h.ID())
+	if identity == nil {
+		return fmt.Errorf("node has no identity key")
+	}
+	sig, err := identity.Sign(handshakeTranscript(seekerEph, hopEph))
+	if err != nil {
+		return err
+	}
+	return writeFrame(c.prev, frameCreated, append(hopEph, sig...))
+}
+
+// handleForward peels this hop's layer from a relay cell and either handles it or passes it on.
+func (c *hopCircuit) handleForward(payload []byte) error {
+	c.layer.fwd.XORKeyStream(payload, payload)
+
+	cmd, streamID, data, ok := openRelay(c.layer.fwdDigest, payload)
+	if !ok {
+		c.mu.Lock()
+		next := c.next
+		c.mu.Unlock()
+		if next == nil {
+			return fmt.Errorf("unrecognised relay cell at the end of the circuit")
+		}
+		return writeFrame(next, frameRelay, payload)
+	}
+
+	switch cmd {
+	case relayExtend:
+		return c.extend(data)
+	case relayBegin:
+		go c.begin(streamID, data)
+	case relayData:
+		c.mu.Lock()
+		conn := c.streams[streamID]
+		c.mu.Unlock()
+		if conn != nil {
+			if _, err := conn.Write(data); err != nil {
+				c.endStream(streamID, true)
+			}
+		}
+	case relayEnd:
+		c.endStream(streamID, false)
+	case relaySendme:
+		c.mu.Lock()
+		stream := c.streams[streamID]
+		c.mu.Unlock()
+		if stream == nil {
+			return nil
+		}
+		if len(data) != 4 {
+			return fmt.Errorf("malformed SENDME cell")
+		}
+		return stream.window.add(int(binary.BigEndian.Uint32(data)))
+	case relayProof:
+		ack := ""
+		proof, err := unmarshalBandwidthProof(data)
+		if err == nil {
+			if c.relay == nil || c.relay.OnProof == nil {
+				err = fmt.Errorf("this warden does not accept bandwidth proofs")
+			} else {
+				err = c.relay.OnProof(c.seeker, proof)
+			}
+		}
+		if err != nil {
+			ack = err.Error()
+		}
+		return c.sendBackward(relayProofAck, streamID, []byte(ack))
+	default:
+		return fmt.Errorf("unknown relay command %d", cmd)
+	}
+	return nil
+}
+
+// extend opens the next hop and hands the seeker's CREATE to it.
+func (c *hopCircuit) extend(data []byte) error {
+	c.mu.Lock()
+	extended := c.next != nil
+	c.mu.Unlock()
+	if extended {
+		return fmt.Errorf("circuit is already extended")
+	}
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return fmt.Errorf("malformed EXTEND cell")
+	}
+	nextID, err := peer.IDFromBytes(data[1 : 1+data[0]])
+	if err != nil {
+		return fmt.Errorf("malformed EXTEND peer ID: %w", err)
+	}
+	create := data[1+data[0]:]
+
+	fail := func(err error) error {
+		// Tell the seeker why; the circuit itself stays usable up to this hop.
+		return c.sendBackward(relayEnd, 0, []byte(err.Error()))
+	}
+
+	ctx, cancel := context.WithTimeout(c.node.context(), circuitExtendTimeout)
+	defer cancel()
+	if err := c.node.connectPeer(ctx, nextID); err != nil {
+		return fail(err)
+	}
+	h := c.node.GetHost()
+	if h == nil {
+		return fmt.Errorf("node is not running")
+	}
+	next, err := h.NewStream(ctx, nextID, ProtocolCircuit)
+	if err != nil {
+		return fail(fmt.Errorf("failed to open circuit to %s: %w", nextID, err))
+	}
+	if err := writeFrame(next, frameCreate, create); err != nil {
+		next.Reset()
+		return fail(err)
+	}
+	nextReader := bufio.NewReader(next)
+	typ, created, err := readFrame(nextReader)
+	if err != nil || typ != frameCreated {
+		next.Reset()
+		return fail(fmt.Errorf("next hop %s did not complete the handshake", nextID))
+	}
+
+	c.mu.Lock()
+	c.next = next
+	c.mu.Unlock()
+	go c.pumpBackward(nextReader)
+
+	return c.sendBackward(relayExtended, 0, created)
+}
+
+// pumpBackward adds this hop's layer to cells coming back from the successor.
+func (c *hopCircuit) pumpBackward(reader *bufio.Reader) {
+	defer c.close()
+	for {
+		typ, payload, err := readFrame(reader)
+		if err != nil || typ != frameRelay {
+			return
+		}
+		c.relayed.Add(uint64(len(payload)))
+		metrics.WardenBytesOut.Add(float64(len(payload)))
+		c.bwdMu.Lock()
+		c.layer.bwd.XORKeyStream(payload, payload)
+		err = writeFrame(c.prev, frameRelay, payload)
+		c.bwdMu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// sendBackward originates a relay cell from this hop towards the seeker.
+func (c *hopCircuit) sendBackward(cmd byte, streamID uint16, data []byte) error {
+	cell := sealRelay(c.layer.bwdDigest, cmd, streamID, data)
+	c.relayed.Add(uint64(len(cell)))
+	metrics.WardenBytesOut.Add(float64(len(cell)))
+	c.bwdMu.Lock()
+	defer c.bwdMu.Unlock()
+	c.layer.bwd.XORKeyStream(cell, cell)
+	return writeFrame(c.prev, frameRelay, cell)
+}
+
+// begin opens an exit connection for a stream and relays its data back to the seeker, as
+// fast as the seeker reads it. Nothing is dialled unless the seeker's wallet attested the
+// stream and the relay authorizes it.
+func (c *hopCircuit) begin(streamID uint16, data []byte) {
+	if !c.relay.exit() {
+		c.sendBackward(relayEnd, streamID, []byte("this node is not an exit"))
+		return
+	}
+	seeker, addr, err := c.exitSeeker(data)
+	if err == nil {
+		err = c.relay.authorize(c.seeker, seeker)
+	}
+	if err != nil {
+		c.sendBackward(relayEnd, streamID, []byte(err.Error()))
+		return
+	}
+	session, err := c.exitSession(seeker)
+	if err != nil {
+		c.sendBackward(relayEnd, streamID, []byte(err.Error()))
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.node.context(), circuitDialTimeout)
+	conn, err := c.relay.dialExit(ctx, session, addr)
+	cancel()
+	if err != nil {
+		c.sendBackward(relayEnd, streamID, []byte(err.Error()))
+		return
+	}
+
+	stream := &exitStream{Conn: conn, window: newFlowWindow()}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		stream.Close()
+		return
+	}
+	c.streams[streamID] = stream
+	c.mu.Unlock()
+
+	if err := c.sendBackward(relayConnected, streamID, nil); err != nil {
+		c.endStream(streamID, false)
+		return
+	}
+
+	buf := make([]byte, maxRelayData)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			if !stream.window.take(n) || c.sendBackward(relayData, streamID, buf[:n]) != nil {
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	c.endStream(streamID, true)
+}
+
+// exitSeeker splits a BEGIN cell into the seeker's policy identity and the destination.
+// The predecessor is only the peer the circuit arrives from, so the seeker is identified
+// by the wallet that signed this circuit's handshake; without a signature it has none.
+func (c *hopCircuit) exitSeeker(data []byte) (policy.Seeker, string, error) {
+	identity := policy.Seeker{PeerID: c.seeker.String()}
+	attestation, addr, ok := splitAttestation(data)
+	if !ok {
+		return identity, "", fmt.Errorf("malformed BEGIN cell")
+	}
+	if len(attestation) == 0 {
+		return identity, addr, nil
+	}
+	authority, err := verifyAttestation(attestation, circuitAttestation(c.layer.handshake))
+	if err != nil {
+		return identity, "", err
+	}
+	return c.relay.attestedSeeker(c.seeker, authority), addr, nil
+}
+
+// exitSession returns the circuit's exit policy session, opening it for seeker on first
+// use. Every stream of a circuit must be attested to the same wallet.
+func (c *hopCircuit) exitSession(seeker policy.Seeker) (*policy.Session, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrCircuitClosed
+	}
+	if c.authority != "" {
+		if seeker.Authority != c.authority {
+			return nil, fmt.Errorf("the circuit's streams are attested to another wallet")
+		}
+		return c.session, nil
+	}
+	session, err := c.relay.openSession(seeker)
+	if err != nil {
+		return nil, err
+	}
+	c.authority, c.session = seeker.Authority, session
+	return session, nil
+}
+
+// endStream closes an exit connection, telling the seeker if notify is set.
+func (c *hopCircuit) endStream(streamID uint16, notify bool) {
+	c.mu.Lock()
+	conn := c.streams[streamID]
+	delete(c.streams, streamID)
+	c.mu.Unlock()
+	if conn == nil {
+		return
+	}
+	conn.Close()
+	if notify {
+		c.sendBackward(relayEnd, streamID, nil)
+	}
+}
+
+func (c *hopCircuit) close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	streams := c.streams
+	c.streams = make(map[uint16]*exitStream)
+	next := c.next
+	session := c.session
+	c.mu.Unlock()
+
+	if session != nil {
+		session.Close()
+	}
+	for _, conn := range streams {
+		conn.Close()
+	}
+	if next != nil {
+		writeFrame(next, frameDestroy, nil)
+		next.Close()
+	}
+	c.prev.Close()
+}
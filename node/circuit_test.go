@@ -0,0 +1,416 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"arkham-cli/policy"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// newTestExit creates a test node that serves as an exit to every seeker, allowing
+// loopback destinations so tests can reach their local servers.
+func newTestExit(t *testing.T) *P2PNode {
+	t.Helper()
+	n := newTestNode(t)
+	n.Relay.Policy = loopbackPolicy(t)
+	n.Relay.Authorize = func(peer.ID, [32]byte) error { return nil }
+	return n
+}
+
+// newTestRelay creates a test node that relays circuits as a warden but is not an exit.
+func newTestRelay(t *testing.T) *P2PNode {
+	t.Helper()
+	n := newTestNode(t)
+	_, wallet, _ := ed25519.GenerateKey(nil)
+	n.SetAuthorityKey(wallet)
+	return n
+}
+
+// buildTestCircuit lets every node reach the others and builds a circuit from seeker
+// through hops, attested with the seeker's wallet.
+func buildTestCircuit(t *testing.T, seeker *P2PNode, hops ...*P2PNode) *Circuit {
+	t.Helper()
+	if seeker.SeekerKey == nil {
+		_, seeker.SeekerKey, _ = ed25519.GenerateKey(nil)
+	}
+	c, err := tryTestCircuit(seeker, seeker.SeekerKey, hops...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func tryTestCircuit(seeker *P2PNode, wallet ed25519.PrivateKey, hops ...*P2PNode) (*Circuit, error) {
+	nodes := append([]*P2PNode{seeker}, hops...)
+	for _, a := range nodes {
+		for _, b := range nodes {
+			if a != b {
+				a.GetHost().Peerstore().AddAddrs(b.GetHost().ID(), b.GetHost().Addrs(), time.Hour)
+			}
+		}
+	}
+	path := make([]peer.ID, len(hops))
+	for i, hop := range hops {
+		path[i] = hop.GetHost().ID()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return seeker.BuildCircuit(ctx, path, wallet)
+}
+
+// listen starts a TCP server on loopback that hands each connection to serve.
+func listen(t *testing.T, serve func(net.Conn)) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func echo(conn net.Conn) {
+	defer conn.Close()
+	io.Copy(conn, conn)
+}
+
+func dialCircuit(t *testing.T, c *Circuit, addr string) net.Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := c.Dial(ctx, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// testLayers performs the handshake of n hops in memory and returns the seeker's and the
+// hops' sides of each layer.
+func testLayers(t *testing.T, n int) (seeker, hops []*circuitLayer) {
+	t.Helper()
+	for range n {
+		seekerKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+		hopKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+		seekerEph, hopEph := seekerKey.PublicKey().Bytes(), hopKey.PublicKey().Bytes()
+		s, err := newCircuitLayer(seekerKey, hopEph, seekerEph, hopEph)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := newCircuitLayer(hopKey, seekerEph, seekerEph, hopEph)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seeker, hops = append(seeker, s), append(hops, h)
+	}
+	return seeker, hops
+}
+
+func TestCircuitLayersOnlyLetTheAddressedHopRecognise(t *testing.T) {
+	seeker, hops := testLayers(t, 3)
+
+	// Forward: a cell for the exit is wrapped in every layer and only the exit claims it.
+	cell := sealRelay(seeker[2].fwdDigest, relayBegin, 7, []byte("example.com:443"))
+	for i := 2; i >= 0; i-- {
+		seeker[i].fwd.XORKeyStream(cell, cell)
+	}
+	for i, hop := range hops {
+		hop.fwd.XORKeyStream(cell, cell)
+		cmd, streamID, data, ok := openRelay(hop.fwdDigest, cell)
+		if i < 2 {
+			if ok {
+				t.Fatalf("hop %d recognised a cell addressed to the exit", i)
+			}
+			continue
+		}
+		if !ok || cmd != relayBegin || streamID != 7 || string(data) != "example.com:443" {
+			t.Fatalf("exit read %d/%d/%q, recognised %v", cmd, streamID, data, ok)
+		}
+	}
+
+	// Backward: a cell from the middle hop picks up the first hop's layer on the way, and
+	// the seeker attributes it to the middle hop.
+	cell = sealRelay(hops[1].bwdDigest, relayProofAck, 0, nil)
+	hops[1].bwd.XORKeyStream(cell, cell)
+	hops[0].bwd.XORKeyStream(cell, cell)
+	seeker[0].bwd.XORKeyStream(cell, cell)
+	if _, _, _, ok := openRelay(seeker[0].bwdDigest, cell); ok {
+		t.Fatal("seeker attributed the middle hop's cell to the first hop")
+	}
+	seeker[1].bwd.XORKeyStream(cell, cell)
+	if cmd, _, _, ok := openRelay(seeker[1].bwdDigest, cell); !ok || cmd != relayProofAck {
+		t.Fatalf("seeker did not recognise the middle hop's cell: %d %v", cmd, ok)
+	}
+
+	// A cell altered in transit fails its recognition digest.
+	cell = sealRelay(seeker[0].fwdDigest, relayData, 1, []byte("payload"))
+	seeker[0].fwd.XORKeyStream(cell, cell)
+	cell[len(cell)-1] ^= 1
+	hops[0].fwd.XORKeyStream(cell, cell)
+	if _, _, _, ok := openRelay(hops[0].fwdDigest, cell); ok {
+		t.Fatal("hop recognised a tampered cell")
+	}
+}
+
+func TestCircuitMultiHop(t *testing.T) {
+	addr := listen(t, echo)
+	seeker, entry, middle, exit := newTestNode(t), newTestRelay(t), newTestRelay(t), newTestExit(t)
+	c := buildTestCircuit(t, seeker, entry, middle, exit)
+	if len(c.layers) != 3 {
+		t.Fatalf("circuit has %d layers, want 3", len(c.layers))
+	}
+
+	conn := dialCircuit(t, c, addr)
+	msg := bytes.Repeat([]byte("arkham "), 10_000)
+	go conn.Write(msg)
+	got := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Fatal("echo through the circuit came back altered")
+	}
+	if c.BytesTransferred() != uint64(2*len(msg)) {
+		t.Fatalf("circuit counted %d bytes, want %d", c.BytesTransferred(), 2*len(msg))
+	}
+	for i, hop := range []*P2PNode{entry, middle, exit} {
+		if sessions := hop.ServedSessions(); len(sessions) != 1 || sessions[0].Kind != KindCircuit {
+			t.Fatalf("hop %d serves %+v, want one circuit", i, sessions)
+		}
+	}
+}
+
+func TestCircuitExitRefusal(t *testing.T) {
+	addr := listen(t, echo)
+	seeker, entry, relay := newTestNode(t), newTestRelay(t), newTestRelay(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// A node that is not an exit relays the circuit but opens no streams.
+	c := buildTestCircuit(t, seeker, entry, relay)
+	if _, err := c.Dial(ctx, addr); err == nil || !strings.Contains(err.Error(), "not an exit") {
+		t.Fatalf("expected a relay-only hop to refuse the stream, got %v", err)
+	}
+
+	// An exit without a policy still refuses the internal networks.
+	exit := newTestNode(t)
+	exit.Relay.Authorize = func(peer.ID, [32]byte) error { return nil }
+	dialled := false
+	exit.Relay.Dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialled = true
+		return nil, errors.New("unexpected dial")
+	}
+	c = buildTestCircuit(t, seeker, entry, exit)
+	for _, target := range []string{addr, "[::1]:80", "169.254.169.254:80", "10.0.0.1:22"} {
+		if _, err := c.Dial(ctx, target); err == nil || !strings.Contains(err.Error(), "exit policy") {
+			t.Fatalf("expected the exit to refuse %s, got %v", target, err)
+		}
+	}
+	if dialled {
+		t.Fatal("the exit dialled a refused destination")
+	}
+	select {
+	case <-c.Done():
+		t.Fatal("a refused stream tore down the circuit")
+	default:
+	}
+}
+
+func TestCircuitExitAuthorizesSeeker(t *testing.T) {
+	addr := listen(t, echo)
+	seeker, entry, exit := newTestNode(t), newTestRelay(t), newTestExit(t)
+	_, paying, _ := ed25519.GenerateKey(nil)
+	_, stranger, _ := ed25519.GenerateKey(nil)
+	payingKey := paying.Public().(ed25519.PublicKey)
+
+	var authorized []peer.ID
+	exit.Relay.Authorize = func(p peer.ID, authority [32]byte) error {
+		authorized = append(authorized, p)
+		if !bytes.Equal(authority[:], payingKey) {
+			return errors.New("no active connection")
+		}
+		return nil
+	}
+	exit.Relay.SeekerTier = func(authority [32]byte) string { return policy.TierPremium }
+	dials := 0
+	exit.Relay.Dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials++
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// A wallet without a connection, or no wallet at all, gets END and nothing is dialled.
+	seeker.SeekerKey = stranger
+	c := buildTestCircuit(t, seeker, entry, exit)
+	if _, err := c.Dial(ctx, addr); err == nil || !strings.Contains(err.Error(), "no active connection") {
+		t.Fatalf("dial for an unauthorized wallet = %v", err)
+	}
+	unattested, err := tryTestCircuit(seeker, nil, entry, exit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unattested.Close()
+	if _, err := unattested.Dial(ctx, addr); err == nil || !strings.Contains(err.Error(), "prove their wallet") {
+		t.Fatalf("dial without a wallet = %v", err)
+	}
+
+	// An attestation is bound to the circuit it was signed for.
+	seeker.SeekerKey = paying
+	c = buildTestCircuit(t, seeker, entry, exit)
+	replayed := buildTestCircuit(t, seeker, entry, exit)
+	replayed.attestation = c.attestation
+	if _, err := replayed.Dial(ctx, addr); err == nil || !strings.Contains(err.Error(), "invalid seeker attestation") {
+		t.Fatalf("dial with another circuit's attestation = %v", err)
+	}
+	if dials != 0 {
+		t.Fatalf("the exit dialled %d times for refused seekers", dials)
+	}
+	if len(authorized) != 1 || authorized[0] != entry.GetHost().ID() {
+		t.Fatalf("authorized %v, want only the stranger's stream from the entry", authorized)
+	}
+
+	// The paying wallet is served, under its own exit policy session.
+	dialCircuit(t, c, addr)
+	if dials != 1 {
+		t.Fatalf("the exit dialled %d times, want once", dials)
+	}
+	var sessions []policy.Seeker
+	exit.served.mu.Lock()
+	for hop := range exit.served.circuits {
+		hop.mu.Lock()
+		if hop.session != nil {
+			sessions = append(sessions, hop.session.Seeker())
+		}
+		hop.mu.Unlock()
+	}
+	exit.served.mu.Unlock()
+	want := policy.Seeker{PeerID: entry.GetHost().ID().String(), Authority: solana.PublicKeyFromBytes(payingKey).String(), Tier: policy.TierPremium}
+	if len(sessions) != 1 || sessions[0] != want {
+		t.Fatalf("exit sessions = %+v, want %+v", sessions, want)
+	}
+}
+
+func TestOnlyWardensAndExitsRelayCircuits(t *testing.T) {
+	seeker, plain := newTestNode(t), newTestNode(t)
+	if _, err := tryTestCircuit(seeker, nil, plain); err == nil {
+		t.Fatal("a node without a warden wallet relayed a circuit")
+	}
+}
+
+func TestCircuitTeardown(t *testing.T) {
+	closed := make(chan struct{})
+	addr := listen(t, func(conn net.Conn) {
+		io.Copy(io.Discard, conn)
+		conn.Close()
+		close(closed)
+	})
+	seeker, entry, exit := newTestNode(t), newTestRelay(t), newTestExit(t)
+	c := buildTestCircuit(t, seeker, entry, exit)
+	conn := dialCircuit(t, c, addr)
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Close()
+	select {
+	case <-closed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the exit kept the destination connection open after teardown")
+	}
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read on a torn-down circuit = %v, want EOF", err)
+	}
+	if _, err := c.Dial(context.Background(), addr); !errors.Is(err, ErrCircuitClosed) {
+		t.Fatalf("dial on a torn-down circuit = %v", err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for len(entry.ServedSessions())+len(exit.ServedSessions()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("hops still serve %+v and %+v", entry.ServedSessions(), exit.ServedSessions())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestCircuitFlowControl(t *testing.T) {
+	const total = 4 * streamWindow
+	addr := listen(t, func(conn net.Conn) {
+		defer conn.Close()
+		conn.Write(make([]byte, total))
+	})
+	seeker, exit := newTestNode(t), newTestExit(t)
+	c := buildTestCircuit(t, seeker, exit)
+	conn := dialCircuit(t, c, addr)
+
+	// Without reads the exit stops at the window.
+	time.Sleep(300 * time.Millisecond)
+	stream := conn.(*circuitConn)
+	stream.mu.Lock()
+	buffered := len(stream.buf)
+	stream.mu.Unlock()
+	if buffered == 0 || buffered > streamWindow {
+		t.Fatalf("seeker buffered %d bytes, want at most the %d byte window", buffered, streamWindow)
+	}
+
+	n, err := io.Copy(io.Discard, conn)
+	if err != nil || n != total {
+		t.Fatalf("read %d bytes (%v), want %d", n, err, total)
+	}
+}
+
+func TestCircuitConnDeadlines(t *testing.T) {
+	addr := listen(t, echo)
+	seeker, exit := newTestNode(t), newTestExit(t)
+	c := buildTestCircuit(t, seeker, exit)
+	conn := dialCircuit(t, c, addr)
+
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	start := time.Now()
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("read past the deadline = %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("read did not return at its deadline")
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(-time.Second))
+	if _, err := conn.Write([]byte("late")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("write past the deadline = %v", err)
+	}
+
+	// Clearing the deadlines makes the stream usable again.
+	conn.SetDeadline(time.Time{})
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 4)
+	if _, err := io.ReadFull(conn, got); err != nil || string(got) != "ping" {
+		t.Fatalf("echo = %q, %v", got, err)
+	}
+}
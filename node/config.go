@@ -0,0 +1,286 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"time"
+
+	"arkham-cli/geo"
+
+	"github.com/libp2p/go-libp2p"
+	kaddht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// connGracePeriod protects new connections from the connection manager for a while.
+const connGracePeriod = time.Minute
+
+// ProtocolDHTPrefix keeps the Arkham DHT apart from the public IPFS DHT. Its protocol is
+// /arkham/kad/1.0.0.
+const ProtocolDHTPrefix = "/arkham"
+
+// DHT modes. A server answers DHT queries for other peers; a client only asks.
+const (
+	DHTModeAuto   = "auto"
+	DHTModeServer = "server"
+	DHTModeClient = "client"
+)
+
+// Config controls the node's libp2p networking. The zero value listens on libp2p's default
+// addresses, announces what it listens on, bootstraps the DHT from the registered wardens,
+// picks the DHT mode from the node's role and keeps relay and hole punching on.
+type Config struct {
+	// ListenAddrs are the multiaddrs to listen on, e.g. /ip4/0.0.0.0/tcp/4001.
+	ListenAddrs []string `json:"listenAddrs,omitempty"`
+	// AnnounceAddrs, when set, replace the listen addresses advertised to peers, e.g. a
+	// public address behind port forwarding.
+	AnnounceAddrs []string `json:"announceAddrs,omitempty"`
+	// NoAnnounceAddrs are multiaddrs or CIDR ranges never advertised to peers.
+	NoAnnounceAddrs []string `json:"noAnnounceAddrs,omitempty"`
+	// BootstrapPeers are /p2p multiaddrs that seed the DHT.
+	BootstrapPeers []string `json:"bootstrapPeers,omitempty"`
+	// DisableChainBootstrap stops the node from also seeding the DHT from the peer IDs of
+	// the wardens registered on chain.
+	DisableChainBootstrap bool `json:"disableChainBootstrap,omitempty"`
+	// DHTMode is DHTModeAuto, DHTModeServer or DHTModeClient. Empty picks server for
+	// wardens, client for seekers and auto otherwise.
+	DHTMode string `json:"dhtMode,omitempty"`
+
+	DisableRelay        bool `json:"disableRelay,omitempty"`
+	DisableHolePunching bool `json:"disableHolePunching,omitempty"`
+
+	// ConnLowWater and ConnHighWater bound the number of connections: above the high
+	// watermark the connection manager trims down to the low one. Zero keeps libp2p's
+	// defaults.
+	ConnLowWater  int `json:"connLowWater,omitempty"`
+	ConnHighWater int `json:"connHighWater,omitempty"`
+
+	// PublicIP overrides the egress IP the node observes through its peers. Wardens
+	// register its region and hash.
+	PublicIP string `json:"publicIp,omitempty"`
+}
+
+// ConfigError reports an invalid Config field, named as in its JSON form.
+type ConfigError struct {
+	Field string
+	Err   error
+}
+
+func (e *ConfigError) Error() string { return e.Field + ": " + e.Err.Error() }
+func (e *ConfigError) Unwrap() error { return e.Err }
+
+// Validate checks every address and the watermarks, returning a *ConfigError.
+func (c Config) Validate() error {
+	for _, s := range c.ListenAddrs {
+		if _, err := ma.NewMultiaddr(s); err != nil {
+			return &ConfigError{"listenAddrs", fmt.Errorf("invalid address %q: %w", s, err)}
+		}
+	}
+	for _, s := range c.AnnounceAddrs {
+		if _, err := ma.NewMultiaddr(s); err != nil {
+			return &ConfigError{"announceAddrs", fmt.Errorf("invalid address %q: %w", s, err)}
+		}
+	}
+	if _, _, err := parseNoAnnounce(c.NoAnnounceAddrs); err != nil {
+		return &ConfigError{"noAnnounceAddrs", err}
+	}
+	if _, err := parseBootstrapPeers(c.BootstrapPeers); err != nil {
+		return &ConfigError{"bootstrapPeers", err}
+	}
+	switch c.DHTMode {
+	case "", DHTModeAuto, DHTModeServer, DHTModeClient:
+	default:
+		return &ConfigError{"dhtMode", fmt.Errorf("must be %s, %s or %s", DHTModeAuto, DHTModeServer, DHTModeClient)}
+	}
+	if c.PublicIP != "" {
+		ip, err := netip.ParseAddr(c.PublicIP)
+		if err != nil {
+			return &ConfigError{"publicIp", fmt.Errorf("invalid IP %q", c.PublicIP)}
+		}
+		if !geo.IsPublic(ip) {
+			return &ConfigError{"publicIp", fmt.Errorf("%s is not a public IP", ip)}
+		}
+	}
+	switch {
+	case c.ConnLowWater < 0:
+		return &ConfigError{"connLowWater", errors.New("must not be negative")}
+	case c.ConnHighWater < 0:
+		return &ConfigError{"connHighWater", errors.New("must not be negative")}
+	case (c.ConnLowWater == 0) != (c.ConnHighWater == 0):
+		return &ConfigError{"connHighWater", errors.New("set both connection watermarks or neither")}
+	case c.ConnLowWater > c.ConnHighWater:
+		return &ConfigError{"connLowWater", fmt.Errorf("%d is above the high watermark %d", c.ConnLowWater, c.ConnHighWater)}
+	}
+	return nil
+}
+
+// libp2pOptions translates the config into host options. It must be valid.
+func (c Config) libp2pOptions() ([]libp2p.Option, error) {
+	var opts []libp2p.Option
+	if len(c.ListenAddrs) > 0 {
+		opts = append(opts, libp2p.ListenAddrStrings(c.ListenAddrs...))
+	}
+	if c.DisableRelay {
+		opts = append(opts, libp2p.DisableRelay())
+	} else {
+		opts = append(opts, libp2p.EnableRelay())
+	}
+	if !c.DisableHolePunching {
+		opts = append(opts, libp2p.EnableHolePunching())
+	}
+	if c.ConnHighWater > 0 {
+		cm, err := connmgr.NewConnManager(c.ConnLowWater, c.ConnHighWater, connmgr.WithGracePeriod(connGracePeriod))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create connection manager: %w", err)
+		}
+		opts = append(opts, libp2p.ConnectionManager(cm))
+	}
+	if len(c.AnnounceAddrs) > 0 || len(c.NoAnnounceAddrs) > 0 {
+		factory, err := c.addrsFactory()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, libp2p.AddrsFactory(factory))
+	}
+	return opts, nil
+}
+
+// dhtOptions returns the options of the Arkham DHT in the given mode. Its bootstrap peers
+// are the configured ones plus whatever extra returns.
+func (c Config) dhtOptions(mode string, extra func() []peer.AddrInfo) ([]kaddht.Option, error) {
+	peers, err := parseBootstrapPeers(c.BootstrapPeers)
+	if err != nil {
+		return nil, err
+	}
+	dhtMode := kaddht.ModeAuto
+	switch mode {
+	case DHTModeServer:
+		dhtMode = kaddht.ModeServer
+	case DHTModeClient:
+		dhtMode = kaddht.ModeClient
+	}
+	return []kaddht.Option{
+		kaddht.ProtocolPrefix(ProtocolDHTPrefix),
+		kaddht.Mode(dhtMode),
+		kaddht.BootstrapPeersFunc(func() []peer.AddrInfo {
+			if extra == nil {
+				return peers
+			}
+			return append(append([]peer.AddrInfo(nil), peers...), extra()...)
+		}),
+	}, nil
+}
+
+// addrsFactory advertises AnnounceAddrs in place of the listen addresses, minus anything
+// matching NoAnnounceAddrs.
+func (c Config) addrsFactory() (func([]ma.Multiaddr) []ma.Multiaddr, error) {
+	var announce []ma.Multiaddr
+	for _, s := range c.AnnounceAddrs {
+		a, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid announce address %q: %w", s, err)
+		}
+		announce = append(announce, a)
+	}
+	exact, nets, err := parseNoAnnounce(c.NoAnnounceAddrs)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(addrs []ma.Multiaddr) []ma.Multiaddr {
+		if len(announce) > 0 {
+			addrs = announce
+		}
+		out := make([]ma.Multiaddr, 0, len(addrs))
+	next:
+		for _, a := range addrs {
+			for _, e := range exact {
+				if a.Equal(e) {
+					continue next
+				}
+			}
+			if ip, err := manet.ToIP(a); err == nil {
+				for _, n := range nets {
+					if n.Contains(ip) {
+						continue next
+					}
+				}
+			}
+			out = append(out, a)
+		}
+		return out
+	}, nil
+}
+
+// parseNoAnnounce splits no-announce entries into exact multiaddrs and CIDR ranges.
+func parseNoAnnounce(entries []string) ([]ma.Multiaddr, []*net.IPNet, error) {
+	var exact []ma.Multiaddr
+	var nets []*net.IPNet
+	for _, s := range entries {
+		if _, n, err := net.ParseCIDR(s); err == nil {
+			nets = append(nets, n)
+			continue
+		}
+		a, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid no-announce entry %q: want a multiaddr or CIDR range", s)
+		}
+		exact = append(exact, a)
+	}
+	return exact, nets, nil
+}
+
+// parseBootstrapPeers parses /p2p multiaddrs, merging addresses of the same peer.
+func parseBootstrapPeers(addrs []string) ([]peer.AddrInfo, error) {
+	var maddrs []ma.Multiaddr
+	for _, s := range addrs {
+		a, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bootstrap peer %q: %w", s, err)
+		}
+		maddrs = append(maddrs, a)
+	}
+	infos, err := peer.AddrInfosFromP2pAddrs(maddrs...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bootstrap peers: %w", err)
+	}
+	return infos, nil
+}
+
+// LoadConfig reads a node config file. A missing file is the zero config.
+func LoadConfig(path string) (Config, error) {
+	var c Config
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("failed to read node config: %w", err)
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("failed to parse node config %s: %w", path, err)
+	}
+	if err := c.Validate(); err != nil {
+		return c, fmt.Errorf("invalid node config %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// SaveConfig writes a node config file.
+func SaveConfig(path string, c Config) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write node config: %w", err)
+	}
+	return nil
+}
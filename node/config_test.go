@@ -0,0 +1,176 @@
+package node
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const testBootstrapPeer = "/ip4/127.0.0.1/tcp/4001/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN"
+
+func TestConfigValidate(t *testing.T) {
+	valid := Config{
+		ListenAddrs:     []string{"/ip4/0.0.0.0/tcp/4001"},
+		AnnounceAddrs:   []string{"/ip4/203.0.113.7/tcp/4001"},
+		NoAnnounceAddrs: []string{"10.0.0.0/8", "/ip4/127.0.0.1/tcp/4001"},
+		BootstrapPeers:  []string{testBootstrapPeer},
+		ConnLowWater:    50,
+		ConnHighWater:   100,
+		PublicIP:        "203.0.113.7",
+		DHTMode:         DHTModeServer,
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+
+	cases := map[string]Config{
+		"listenAddrs":     {ListenAddrs: []string{"tcp/4001"}},
+		"announceAddrs":   {AnnounceAddrs: []string{"not-an-addr"}},
+		"noAnnounceAddrs": {NoAnnounceAddrs: []string{"10.0.0.0/33"}},
+		"bootstrapPeers":  {BootstrapPeers: []string{"/ip4/127.0.0.1/tcp/4001"}},
+		"connLowWater":    {ConnLowWater: 200, ConnHighWater: 100},
+		"connHighWater":   {ConnLowWater: 10},
+		"publicIp":        {PublicIP: "192.168.1.5"},
+		"dhtMode":         {DHTMode: "full"},
+	}
+	for field, cfg := range cases {
+		var cfgErr *ConfigError
+		if err := cfg.Validate(); !errors.As(err, &cfgErr) || cfgErr.Field != field {
+			t.Errorf("%s: got %v", field, err)
+		}
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	ip, ok := mostCommonPublicIP([]ma.Multiaddr{
+		ma.StringCast("/ip4/127.0.0.1/tcp/4001"),
+		ma.StringCast("/ip4/192.168.1.5/tcp/4001"),
+		ma.StringCast("/ip4/198.51.100.1/tcp/4001"),
+		ma.StringCast("/ip4/203.0.113.7/tcp/4001"),
+		ma.StringCast("/ip4/203.0.113.7/udp/4001/quic-v1"),
+	})
+	if !ok || ip.String() != "203.0.113.7" {
+		t.Errorf("most common public IP = %s, %v", ip, ok)
+	}
+	if _, ok := mostCommonPublicIP([]ma.Multiaddr{ma.StringCast("/ip4/10.0.0.1/tcp/4001")}); ok {
+		t.Error("expected no public IP among private addresses")
+	}
+
+	n := NewP2PNode()
+	if _, ok := n.PublicIP(); ok {
+		t.Error("a stopped node without an override should not know its public IP")
+	}
+	if err := n.SetConfig(Config{PublicIP: "198.51.100.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if ip, ok := n.PublicIP(); !ok || ip.String() != "198.51.100.1" {
+		t.Errorf("override gave %s, %v", ip, ok)
+	}
+}
+
+func TestAddrsFactory(t *testing.T) {
+	listen := []ma.Multiaddr{
+		ma.StringCast("/ip4/127.0.0.1/tcp/4001"),
+		ma.StringCast("/ip4/10.1.2.3/tcp/4001"),
+		ma.StringCast("/ip4/192.168.1.5/udp/4001/quic-v1"),
+	}
+
+	factory, err := Config{NoAnnounceAddrs: []string{"10.0.0.0/8", "/ip4/127.0.0.1/tcp/4001"}}.addrsFactory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := factory(listen); len(got) != 1 || !got[0].Equal(listen[2]) {
+		t.Errorf("no-announce filter kept %v", got)
+	}
+
+	factory, err = Config{AnnounceAddrs: []string{"/ip4/203.0.113.7/tcp/4001"}}.addrsFactory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := factory(listen); len(got) != 1 || got[0].String() != "/ip4/203.0.113.7/tcp/4001" {
+		t.Errorf("announce addresses = %v", got)
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.json")
+	cfg, err := LoadConfig(path)
+	if err != nil || !reflect.DeepEqual(cfg, Config{}) {
+		t.Fatalf("missing file: %+v, %v", cfg, err)
+	}
+
+	want := Config{ListenAddrs: []string{"/ip4/0.0.0.0/tcp/4001"}, DisableRelay: true, ConnLowWater: 1, ConnHighWater: 2}
+	if err := SaveConfig(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadConfig(path)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("round trip: %+v, %v", got, err)
+	}
+}
+
+func TestIdentityPersistsPeerID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.key")
+	first, err := LoadIdentity(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := LoadIdentity(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.Equals(second) {
+		t.Fatal("identity changed between loads")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("identity file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	n := NewP2PNode()
+	n.Identity = first
+	if err := n.SetConfig(Config{
+		ListenAddrs:    []string{"/ip4/127.0.0.1/tcp/0"},
+		BootstrapPeers: []string{testBootstrapPeer},
+		DisableRelay:   true,
+		ConnLowWater:   10,
+		ConnHighWater:  20,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for i := 0; i < 2; i++ {
+		if err := n.Start(); err != nil {
+			t.Fatal(err)
+		}
+		status := n.Status()
+		ids = append(ids, status.PeerID)
+		for _, addr := range status.Addresses {
+			if !isLoopbackTCP(ma.StringCast(addr)) {
+				t.Errorf("listening on %s, want only loopback TCP", addr)
+			}
+		}
+		if err := n.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ids[0] != ids[1] {
+		t.Errorf("peer ID changed across restarts: %s then %s", ids[0], ids[1])
+	}
+}
+
+func isLoopbackTCP(a ma.Multiaddr) bool {
+	ip, err := a.ValueForProtocol(ma.P_IP4)
+	if err != nil || ip != "127.0.0.1" {
+		return false
+	}
+	_, err = a.ValueForProtocol(ma.P_TCP)
+	return err == nil
+}
@@ -0,0 +1,80 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"arkham-cli/geo"
+
+	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+const publicIPPollInterval = time.Second
+
+// PublicIP returns the node's public egress IP: Config.PublicIP when set, otherwise the
+// public IP most of the node's addresses carry, counting the addresses peers observed over
+// identify and those AutoNAT confirmed.
+func (n *P2PNode) PublicIP() (netip.Addr, bool) {
+	n.mu.Lock()
+	h, override := n.host, n.cfg.PublicIP
+	n.mu.Unlock()
+	if override != "" {
+		ip, err := netip.ParseAddr(override)
+		return ip.Unmap(), err == nil
+	}
+	if h == nil {
+		return netip.Addr{}, false
+	}
+
+	addrs := h.Addrs()
+	if ids, ok := h.(interface{ IDService() identify.IDService }); ok {
+		addrs = append(addrs, ids.IDService().OwnObservedAddrs()...)
+	}
+	return mostCommonPublicIP(addrs)
+}
+
+// WaitPublicIP polls PublicIP until the node knows its egress IP or ctx is done.
+func (n *P2PNode) WaitPublicIP(ctx context.Context) (netip.Addr, error) {
+	ticker := time.NewTicker(publicIPPollInterval)
+	defer ticker.Stop()
+	for {
+		if ip, ok := n.PublicIP(); ok {
+			return ip, nil
+		}
+		select {
+		case <-ctx.Done():
+			return netip.Addr{}, fmt.Errorf("no peer has observed the node's public IP yet: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// mostCommonPublicIP returns the public IP found in the most addresses, preferring the
+// first seen on a tie.
+func mostCommonPublicIP(addrs []ma.Multiaddr) (netip.Addr, bool) {
+	counts := make(map[netip.Addr]int)
+	var best netip.Addr
+	for _, a := range addrs {
+		raw, err := manet.ToIP(a)
+		if err != nil {
+			continue
+		}
+		ip, ok := netip.AddrFromSlice(raw)
+		if !ok {
+			continue
+		}
+		ip = ip.Unmap()
+		if !geo.IsPublic(ip) {
+			continue
+		}
+		counts[ip]++
+		if !best.IsValid() || counts[ip] > counts[best] {
+			best = ip
+		}
+	}
+	return best, best.IsValid()
+}
@@ -0,0 +1,67 @@
+package node
+
+import (
+	"arkham-cli/events"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// Peer event states.
+const (
+	PeerConnected    = "connected"
+	PeerDisconnected = "disconnected"
+	PeerLatency      = "latency"
+)
+
+// PeerEvent reports a peer connecting, disconnecting or answering a ping. Latency events
+// carry the peer's link quality after the ping.
+type PeerEvent struct {
+	ID      string   `json:"id"`
+	State   string   `json:"state"`
+	Addrs   []string `json:"addrs,omitempty"`
+	Latency int64    `json:"latency,omitempty"` // Average round trip in milliseconds
+	Jitter  int64    `json:"jitter,omitempty"`  // Average round trip variation in milliseconds
+	Loss    float64  `json:"loss,omitempty"`    // Share of unanswered pings, from 0 to 1
+}
+
+// Session roles and states.
+const (
+	RoleWarden = "warden"
+	RoleSeeker = "seeker"
+
+	SessionStart    = "start"
+	SessionStop     = "stop"
+	SessionProgress = "progress"
+)
+
+// SessionEvent reports a session starting, stopping or moving bytes. Wardens report the
+// proxy flows and circuits they serve; seekers report their own circuit.
+type SessionEvent struct {
+	Role  string `json:"role"`
+	Kind  string `json:"kind"`
+	Peer  string `json:"peer"`
+	State string `json:"state"`
+	Bytes uint64 `json:"bytes"`
+}
+
+// peerConnected reports a peer's first connection.
+func (n *P2PNode) peerConnected(net network.Network, c network.Conn) {
+	p := c.RemotePeer()
+	if len(net.ConnsToPeer(p)) != 1 {
+		return
+	}
+	n.Events.Publish(events.TypePeer, PeerEvent{
+		ID:    p.String(),
+		State: PeerConnected,
+		Addrs: []string{c.RemoteMultiaddr().String()},
+	})
+}
+
+// peerDisconnected reports a peer's last connection closing.
+func (n *P2PNode) peerDisconnected(net network.Network, c network.Conn) {
+	p := c.RemotePeer()
+	if net.Connectedness(p) == network.Connected {
+		return
+	}
+	n.Events.Publish(events.TypePeer, PeerEvent{ID: p.String(), State: PeerDisconnected})
+}
@@ -0,0 +1,281 @@
+package node
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"arkham-cli/policy"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ProtocolInfo answers a request for the node's capability document. The dialler sends a
+// proxy-style message whose head is the highest document version it understands; the
+// listener answers with a status byte and the signed document.
+const ProtocolInfo = "/arkham/info/1.0.0"
+
+// InfoVersion is the version of the capability document this node issues. Later versions
+// only add fields, so readers accept any version from 1.
+const InfoVersion = 1
+
+const (
+	infoTimeout = 10 * time.Second
+	// infoCacheTTL is how long a fetched document is reused before asking the peer again.
+	infoCacheTTL = time.Minute
+)
+
+// Kinds of session a node serves.
+const (
+	KindProxy   = "proxy"
+	KindCircuit = "circuit"
+)
+
+// Capabilities is the document a node advertises over ProtocolInfo, signed by its libp2p
+// key.
+type Capabilities struct {
+	Version int    `json:"version"`
+	Peer    string `json:"peer"`
+	// Authority is the wallet the node attests to, if any.
+	Authority string `json:"authority,omitempty"`
+	Software  string `json:"software"`
+	// Sessions lists the kinds of session the node serves.
+	Sessions []string `json:"sessions"`
+	// ActiveSessions counts the seekers being served. MaxSessions is the exit policy's cap
+	// and FreeSessions what is left of it; both are zero without a cap.
+	ActiveSessions int `json:"activeSessions"`
+	MaxSessions    int `json:"maxSessions,omitempty"`
+	FreeSessions   int `json:"freeSessions,omitempty"`
+	// ExitPolicy summarises the node's exit policy. Nil means every destination is allowed.
+	ExitPolicy *policy.Summary `json:"exitPolicy,omitempty"`
+	// Region and RatePerMb, the effective price in lamports per MB, are set by a warden
+	// node's Advertise hook.
+	Region    string    `json:"region,omitempty"`
+	RatePerMb uint64    `json:"ratePerMb,omitempty"`
+	IssuedAt  time.Time `json:"issuedAt"`
+}
+
+// AtCapacity reports whether the node serves no more seekers.
+func (c *Capabilities) AtCapacity() bool {
+	return c.MaxSessions > 0 && c.ActiveSessions >= c.MaxSessions
+}
+
+// signedCapabilities is a capability document as it travels: the exact JSON that was
+// signed, and the signature.
+type signedCapabilities struct {
+	Document  json.RawMessage `json:"document"`
+	Signature []byte          `json:"signature"`
+}
+
+// signedInfo is what the libp2p key signs, so the signature cannot be replayed as any
+// other Arkham message.
+func signedInfo(document []byte) []byte {
+	return append([]byte("arkham-info:"), document...)
+}
+
+// SoftwareVersion identifies the running build, from the module version and VCS revision
+// Go stamps into it.
+func SoftwareVersion() string {
+	version := "arkham-cli (devel)"
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return version
+	}
+	if info.Main.Version != "" {
+		version = "arkham-cli " + info.Main.Version
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+			version += " " + s.Value[:12]
+		}
+	}
+	return version
+}
+
+// localCapabilities describes this node as it is now.
+func (n *P2PNode) localCapabilities(ctx context.Context) (*Capabilities, error) {
+	n.mu.Lock()
+	h, wallet := n.host, n.authorityKey
+	n.mu.Unlock()
+	if h == nil {
+		return nil, fmt.Errorf("node is not running")
+	}
+
+	c := &Capabilities{
+		Version:  InfoVersion,
+		Peer:     h.ID().String(),
+		Software: SoftwareVersion(),
+		Sessions: []string{},
+		IssuedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	if n.Relay.exit() {
+		c.Sessions = append(c.Sessions, KindProxy)
+	}
+	if n.relaysCircuits() {
+		c.Sessions = append(c.Sessions, KindCircuit)
+	}
+	if wallet != nil {
+		c.Authority = solana.PrivateKey(wallet).PublicKey().String()
+	}
+	if n.Relay != nil && n.Relay.Policy != nil {
+		p := n.Relay.Policy.Policy()
+		summary := p.Summary()
+		c.ExitPolicy = &summary
+		c.ActiveSessions = n.Relay.Policy.Sessions()
+		c.MaxSessions = p.MaxSessions
+	} else {
+		c.ActiveSessions = n.servedSeekers()
+	}
+	if c.MaxSessions > 0 {
+		c.FreeSessions = max(c.MaxSessions-c.ActiveSessions, 0)
+	}
+	if n.Advertise != nil {
+		n.Advertise(ctx, c)
+	}
+	return c, nil
+}
+
+// infoHandler answers ProtocolInfo requests with the node's signed capability document.
+func (n *P2PNode) infoHandler(s network.Stream) {
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(infoTimeout))
+	if _, _, err := readProxyMessage(bufio.NewReader(s)); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(n.context(), infoTimeout)
+	defer cancel()
+	c, err := n.localCapabilities(ctx)
+	if err != nil {
+		writeProxyMessage(s, proxyStatusFailed, []byte(err.Error()))
+		return
+	}
+	document, err := json.Marshal(c)
+	if err != nil {
+		writeProxyMessage(s, proxyStatusFailed, []byte(err.Error()))
+		return
+	}
+	h := n.GetHost()
+	if h == nil {
+		writeProxyMessage(s, proxyStatusFailed, []byte("node is not running"))
+		return
+	}
+	sig, err := h.Peerstore().PrivKey(h.ID()).Sign(signedInfo(document))
+	if err != nil {
+		writeProxyMessage(s, proxyStatusFailed, []byte(err.Error()))
+		return
+	}
+	body, err := json.Marshal(signedCapabilities{Document: document, Signature: sig})
+	if err != nil {
+		writeProxyMessage(s, proxyStatusFailed, []byte(err.Error()))
+		return
+	}
+	writeProxyMessage(s, proxyStatusOK, body)
+}
+
+// verifyCapabilities checks a document's signature against p's key and that it describes p.
+func verifyCapabilities(p peer.ID, body []byte) (*Capabilities, error) {
+	var signed signedCapabilities
+	if err := json.Unmarshal(body, &signed); err != nil {
+		return nil, fmt.Errorf("invalid capability document from %s: %w", p, err)
+	}
+	pub, err := p.ExtractPublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract public key of %s: %w", p, err)
+	}
+	ok, err := pub.Verify(signedInfo(signed.Document), signed.Signature)
+	if err != nil || !ok {
+		return nil, fmt.Errorf("capability document from %s has an invalid signature", p)
+	}
+	var c Capabilities
+	if err := json.Unmarshal(signed.Document, &c); err != nil {
+		return nil, fmt.Errorf("invalid capability document from %s: %w", p, err)
+	}
+	if c.Version < 1 {
+		return nil, fmt.Errorf("capability document from %s has unknown version %d", p, c.Version)
+	}
+	if c.Peer != p.String() {
+		return nil, fmt.Errorf("capability document from %s describes peer %s", p, c.Peer)
+	}
+	return &c, nil
+}
+
+// capabilityCache keeps the documents fetched from peers for infoCacheTTL.
+type capabilityCache struct {
+	mu      sync.Mutex
+	fetched map[peer.ID]cachedCapabilities
+}
+
+type cachedCapabilities struct {
+	caps *Capabilities
+	at   time.Time
+}
+
+func (c *capabilityCache) get(p peer.ID, now time.Time) (*Capabilities, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.fetched[p]
+	if !ok || now.Sub(cached.at) > infoCacheTTL {
+		return nil, false
+	}
+	return cached.caps, true
+}
+
+func (c *capabilityCache) set(p peer.ID, caps *Capabilities, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fetched == nil {
+		c.fetched = make(map[peer.ID]cachedCapabilities)
+	}
+	c.fetched[p] = cachedCapabilities{caps: caps, at: now}
+}
+
+// Capabilities asks a peer for its capability document and verifies it. A document
+// fetched in the last infoCacheTTL is reused.
+func (n *P2PNode) Capabilities(ctx context.Context, p peer.ID) (*Capabilities, error) {
+	if c, ok := n.capabilities.get(p, time.Now()); ok {
+		return c, nil
+	}
+	if err := n.connectPeer(ctx, p); err != nil {
+		return nil, err
+	}
+	h := n.GetHost()
+	if h == nil {
+		return nil, fmt.Errorf("node is not running")
+	}
+	s, err := h.NewStream(ctx, p, ProtocolInfo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open info stream to %s: %w", p, err)
+	}
+	defer s.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(infoTimeout)
+	}
+	s.SetDeadline(deadline)
+
+	if err := writeProxyMessage(s, InfoVersion, nil); err != nil {
+		s.Reset()
+		return nil, err
+	}
+	status, reply, err := readProxyMessage(bufio.NewReader(s))
+	if err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("peer %s did not answer info request: %w", p, err)
+	}
+	if status != proxyStatusOK {
+		return nil, fmt.Errorf("peer %s refused info request: %s", p, reply)
+	}
+	c, err := verifyCapabilities(p, reply)
+	if err != nil {
+		return nil, err
+	}
+	n.capabilities.set(p, c, time.Now())
+	return c, nil
+}
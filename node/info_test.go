@@ -0,0 +1,108 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"arkham-cli/policy"
+)
+
+func TestCapabilities(t *testing.T) {
+	loopback := Config{ListenAddrs: []string{"/ip4/127.0.0.1/tcp/0"}}
+	warden, seeker := NewP2PNode(), NewP2PNode()
+	warden.Relay.Policy = policy.NewEngine(&policy.Policy{
+		MaxSessions: 1,
+		DenySeekers: []string{"secret"},
+	})
+	warden.Advertise = func(ctx context.Context, c *Capabilities) {
+		c.Region = "eu"
+		c.RatePerMb = 42
+	}
+	for _, n := range []*P2PNode{warden, seeker} {
+		if err := n.SetConfig(loopback); err != nil {
+			t.Fatal(err)
+		}
+		if err := n.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer n.Stop()
+	}
+	wardenHost := warden.GetHost()
+	seeker.GetHost().Peerstore().AddAddrs(wardenHost.ID(), wardenHost.Addrs(), time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	caps, err := seeker.Capabilities(ctx, wardenHost.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.Version != InfoVersion || caps.Peer != wardenHost.ID().String() || caps.Region != "eu" || caps.RatePerMb != 42 {
+		t.Fatalf("capabilities = %+v", caps)
+	}
+	if caps.MaxSessions != 1 || caps.FreeSessions != 1 || caps.AtCapacity() || caps.ExitPolicy == nil {
+		t.Fatalf("load = %+v", caps)
+	}
+
+	// A full warden says so, once the cached document expires.
+	session, err := warden.Relay.Policy.Open(policy.Seeker{PeerID: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	seeker.capabilities.set(wardenHost.ID(), caps, time.Now().Add(-2*infoCacheTTL))
+	caps, err = seeker.Capabilities(ctx, wardenHost.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !caps.AtCapacity() || caps.FreeSessions != 0 {
+		t.Fatalf("full warden advertised %+v", caps)
+	}
+}
+
+func TestCapabilitiesListServedSessions(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		node *P2PNode
+		want []string
+	}{
+		{"seeker", newTestNode(t), []string{}},
+		{"warden", newTestRelay(t), []string{KindCircuit}},
+		{"exit", newTestExit(t), []string{KindProxy, KindCircuit}},
+	} {
+		caps, err := tt.node.localCapabilities(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(caps.Sessions, tt.want) {
+			t.Errorf("%s advertises %v, want %v", tt.name, caps.Sessions, tt.want)
+		}
+	}
+}
+
+func TestVerifyCapabilitiesRejectsForgeries(t *testing.T) {
+	n := NewP2PNode()
+	if err := n.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer n.Stop()
+	h := n.GetHost()
+
+	document, _ := json.Marshal(Capabilities{Version: InfoVersion, Peer: h.ID().String()})
+	sig, err := h.Peerstore().PrivKey(h.ID()).Sign(signedInfo(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(signedCapabilities{Document: document, Signature: sig})
+	if _, err := verifyCapabilities(h.ID(), body); err != nil {
+		t.Fatalf("genuine document rejected: %v", err)
+	}
+
+	tampered, _ := json.Marshal(Capabilities{Version: InfoVersion, Peer: h.ID().String(), RatePerMb: 1})
+	body, _ = json.Marshal(signedCapabilities{Document: tampered, Signature: sig})
+	if _, err := verifyCapabilities(h.ID(), body); err == nil {
+		t.Fatal("tampered document accepted")
+	}
+}
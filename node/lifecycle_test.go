@@ -0,0 +1,92 @@
+package node
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestStartStopRestart(t *testing.T) {
+	n := NewP2PNode()
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 3; i++ {
+		if err := n.Start(); err != nil {
+			t.Fatalf("start %d: %v", i, err)
+		}
+		if err := n.Start(); err != nil {
+			t.Fatalf("second start %d: %v", i, err)
+		}
+		status := n.Status()
+		if !status.IsRunning || status.PeerID == "" {
+			t.Fatalf("start %d: status = %+v", i, status)
+		}
+		if n.context().Err() != nil {
+			t.Fatalf("start %d: node context is already cancelled", i)
+		}
+
+		ctx := n.context()
+		if err := n.Stop(); err != nil {
+			t.Fatalf("stop %d: %v", i, err)
+		}
+		if err := n.Stop(); err != nil {
+			t.Fatalf("second stop %d: %v", i, err)
+		}
+		if ctx.Err() == nil {
+			t.Fatalf("stop %d: node context was not cancelled", i)
+		}
+		if n.Status().IsRunning || n.GetHost() != nil {
+			t.Fatalf("stop %d: node still running", i)
+		}
+	}
+
+	// libp2p winds down some of its own goroutines asynchronously after Close.
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before+5 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before+5 {
+		t.Errorf("goroutines grew from %d to %d across start/stop cycles", before, after)
+	}
+}
+
+func TestConcurrentStartStop(t *testing.T) {
+	n := NewP2PNode()
+	t.Cleanup(func() { n.Stop() })
+
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for j := 0; j < 3; j++ {
+				n.Start()
+				n.Peers()
+				n.Status()
+				n.Stop()
+			}
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+	if n.Status().IsRunning {
+		t.Error("node running after every goroutine stopped it")
+	}
+}
+
+func TestSpawnAfterStop(t *testing.T) {
+	n := NewP2PNode()
+	if err := n.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	ran := false
+	n.spawn(func(ctx context.Context) { ran = true })
+	n.wg.Wait()
+	if ran {
+		t.Error("spawn ran a goroutine on a stopped node")
+	}
+}
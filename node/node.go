@@ -2,11 +2,16 @@ package node
 
 import (
 	"context"
-	"log"
+	"crypto/ed25519"
+	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
+	"arkham-cli/events"
+
 	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -14,6 +19,8 @@ import (
 	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
 	"github.com/libp2p/go-libp2p/p2p/discovery/routing"
 	"github.com/libp2p/go-libp2p/p2p/discovery/util"
+	"github.com/libp2p/go-libp2p/p2p/transport/quicreuse"
+	"github.com/quic-go/quic-go"
 )
 
 const (
@@ -27,22 +34,97 @@ const (
 type PeerInfo struct {
 	ID      string   `json:"id"`
 	Addrs   []string `json:"addrs"`
-	Latency int64    `json:"latency"` // Latency in milliseconds
+	Latency int64    `json:"latency"` // Average round trip in milliseconds, 0 if never answered
+	Jitter  int64    `json:"jitter"`  // Average round trip variation in milliseconds
+	Loss    float64  `json:"loss"`    // Share of unanswered pings, from 0 to 1
+	// LastSeen is when the peer last answered a ping, if it ever did.
+	LastSeen *time.Time `json:"lastSeen,omitempty"`
 }
 
 type P2PNode struct {
+	// lifecycle serializes Start and Stop; mu guards the fields below it.
+	lifecycle sync.Mutex
 	mu        sync.Mutex
 	host      host.Host
 	dht       *kaddht.IpfsDHT
 	mdns      mdns.Service
+	quic      *quicreuse.ConnManager
+	cfg       Config
+	// authorityKey is the wallet the node attests to over ProtocolIdentity.
+	authorityKey ed25519.PrivateKey
 	IsRunning bool
+	// ctx is cancelled by Stop. Every goroutine the node starts derives from it and is
+	// tracked by wg, which Stop joins before returning.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// Relay controls how this node serves as a hop in seekers' circuits.
+	Relay *CircuitRelay
+	// SeekerKey is the seeker's wallet key. When set, proxied flows are attested with it so
+	// wardens can find the seeker's Connection and apply its exit policy tier.
+	SeekerKey ed25519.PrivateKey
+	// Events receives node lifecycle, peer and served session events. It may be nil.
+	Events *events.Bus
+	// Logger receives the node's diagnostics. When nil, slog.Default is used.
+	Logger *slog.Logger
+	// Identity is the node's libp2p key. When nil every start gets a fresh peer ID.
+	Identity crypto.PrivKey
+	// ChainPeers lists the peer IDs of the wardens registered on chain. Unless the config
+	// disables it, the node bootstraps the DHT from them, so the overlay sustains itself
+	// without fixed bootstrap peers.
+	ChainPeers func(ctx context.Context) ([]peer.ID, error)
+	// AddrBook is the file where the addresses of registered wardens are kept between
+	// runs. Empty keeps them in memory only.
+	AddrBook string
+	// Advertise fills in the parts of the capability document served over ProtocolInfo
+	// that come from the chain, such as the region and effective price.
+	Advertise func(ctx context.Context, c *Capabilities)
+
+	proxyUsage proxyUsage
+	served     servedSessions
+	attested   attestations
+	quality    qualityTracker
+	// capabilities caches the documents fetched from other peers.
+	capabilities capabilityCache
+	chain      chainPeers
 }
 
 func NewP2PNode() *P2PNode {
-	return &P2PNode{}
+	return &P2PNode{Relay: &CircuitRelay{}}
+}
+
+// Config returns the node's networking config.
+func (n *P2PNode) Config() Config {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.cfg
+}
+
+// SetConfig validates and replaces the node's networking config. It takes effect the next
+// time the node starts.
+func (n *P2PNode) SetConfig(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.cfg = cfg
+	return nil
+}
+
+// log returns the node's logger, defaulting to slog.Default.
+func (n *P2PNode) log() *slog.Logger {
+	if n.Logger != nil {
+		return n.Logger
+	}
+	return slog.Default()
 }
 
+// Start creates the libp2p host and starts discovery. A stopped node can be started again.
 func (n *P2PNode) Start() error {
+	n.lifecycle.Lock()
+	defer n.lifecycle.Unlock()
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
@@ -50,49 +132,138 @@ func (n *P2PNode) Start() error {
 		return nil
 	}
 
-	h, err := libp2p.New(libp2p.EnableRelay(), libp2p.EnableHolePunching())
+	opts, err := n.cfg.libp2pOptions()
 	if err != nil {
 		return err
 	}
+	if n.Identity != nil {
+		opts = append(opts, libp2p.Identity(n.Identity))
+	}
+	// libp2p does not close the QUIC connection manager with the host, so create it here
+	// and close it in Stop, or every restart leaks its sockets and goroutines.
+	opts = append(opts, libp2p.QUICReuse(func(reset quic.StatelessResetKey, token quic.TokenGeneratorKey) (*quicreuse.ConnManager, error) {
+		cm, err := quicreuse.NewConnManager(reset, token)
+		n.quic = cm
+		return cm, err
+	}))
+	h, err := libp2p.New(opts...)
+	if err != nil {
+		if n.quic != nil {
+			n.quic.Close()
+			n.quic = nil
+		}
+		return err
+	}
 	n.host = h
+	n.ctx, n.cancel = context.WithCancel(context.Background())
 
 	// Set stream handlers
 	h.SetStreamHandler(ProtocolStream, n.streamHandler)
 	h.SetStreamHandler(ProtocolPing, pingHandler)
-
-	if err := n.setupDiscovery(); err != nil {
-		h.Close()
+	h.SetStreamHandler(ProtocolCircuit, n.circuitHandler)
+	if n.Relay.exit() {
+		h.SetStreamHandler(ProtocolProxy, n.proxyHandler)
+	}
+	h.SetStreamHandler(ProtocolIdentity, n.identityHandler)
+	h.SetStreamHandler(ProtocolInfo, n.infoHandler)
+	h.Network().Notify(&network.NotifyBundle{
+		ConnectedF:    n.peerConnected,
+		DisconnectedF: n.peerDisconnected,
+	})
+
+	if err := n.setupDiscovery(n.ctx); err != nil {
+		n.cancel()
+		n.closeServicesLocked()
+		n.host = nil
 		return err
 	}
 
+	n.quality.reset()
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		n.probePeers(n.ctx, h)
+	}()
+
 	n.IsRunning = true
-	log.Println("P2P Node started. Peer ID:", h.ID().String())
+	n.log().Info("P2P node started", "peer", h.ID())
+	n.Events.Publish(events.TypeNode, n.statusLocked())
 	return nil
 }
 
+// Stop cancels the node's context, closes the host and waits for the node's goroutines to
+// exit.
 func (n *P2PNode) Stop() error {
+	n.lifecycle.Lock()
+	defer n.lifecycle.Unlock()
 	n.mu.Lock()
-	defer n.mu.Unlock()
-
 	if !n.IsRunning {
+		n.mu.Unlock()
 		return nil
 	}
+	n.IsRunning = false
+	n.cancel()
+	err := n.closeServicesLocked()
+	n.mu.Unlock()
+
+	// Goroutines may still take mu (GetHost), so join them without holding it.
+	n.wg.Wait()
 
+	n.mu.Lock()
+	n.host = nil
+	status := n.statusLocked()
+	n.mu.Unlock()
+	n.log().Info("P2P node stopped")
+	n.Events.Publish(events.TypeNode, status)
+	return err
+}
+
+// closeServicesLocked closes discovery and the host.
+func (n *P2PNode) closeServicesLocked() error {
 	if n.mdns != nil {
 		n.mdns.Close()
+		n.mdns = nil
 	}
 	if n.dht != nil {
 		n.dht.Close()
+		n.dht = nil
 	}
+	var err error
 	if n.host != nil {
-		if err := n.host.Close(); err != nil {
-			return err
-		}
+		err = n.host.Close()
 	}
+	if n.quic != nil {
+		n.quic.Close()
+		n.quic = nil
+	}
+	return err
+}
 
-	n.IsRunning = false
-	log.Println("P2P Node stopped.")
-	return nil
+// spawn runs fn in a goroutine tracked by Stop, with the node's context. It does nothing
+// once the node is stopping.
+func (n *P2PNode) spawn(fn func(ctx context.Context)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ctx == nil || n.ctx.Err() != nil {
+		return
+	}
+	ctx := n.ctx
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		fn(ctx)
+	}()
+}
+
+// context returns the node's context, which is cancelled once the node stops. A node that
+// was never started has no lifetime to bound, so it gets context.Background.
+func (n *P2PNode) context() context.Context {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ctx == nil {
+		return context.Background()
+	}
+	return n.ctx
 }
 
 type NodeStatus struct {
@@ -104,7 +275,10 @@ type NodeStatus struct {
 func (n *P2PNode) Status() NodeStatus {
 	n.mu.Lock()
 	defer n.mu.Unlock()
+	return n.statusLocked()
+}
 
+func (n *P2PNode) statusLocked() NodeStatus {
 	if !n.IsRunning || n.host == nil {
 		return NodeStatus{IsRunning: false}
 	}
@@ -127,56 +301,71 @@ func (n *P2PNode) GetHost() host.Host {
 	return n.host
 }
 
-func (n *P2PNode) streamHandler(s network.Stream) {
-	log.Printf("[WARDEN] Received VPN request from Seeker: %s", s.Conn().RemotePeer())
-	s.Close()
-}
-
-func pingHandler(s network.Stream) {
-	defer s.Close()
-	buf := make([]byte, 1)
-	_, _ = s.Read(buf)
-}
-
-func measureLatency(ctx context.Context, h host.Host, p peer.ID) {
-	start := time.Now()
-	s, err := h.NewStream(ctx, p, ProtocolPing)
-	if err != nil {
-		h.Peerstore().Put(p, "latency", int64(9999))
-		return
+// Peers lists the peers in the node's peerstore with their measured link quality.
+func (n *P2PNode) Peers() []PeerInfo {
+	peerInfos := []PeerInfo{}
+	host := n.GetHost()
+	if host == nil {
+		return peerInfos
 	}
-	defer s.Close()
 
-	_, err = s.Write([]byte("p"))
-	if err != nil {
-		h.Peerstore().Put(p, "latency", int64(9999))
-		return
-	}
+	for _, p := range host.Peerstore().Peers() {
+		if p == host.ID() {
+			continue
+		}
 
-	buf := make([]byte, 1)
-	_, err = s.Read(buf)
-	if err != nil {
-		// Error reading is fine, the stream might be closed already.
+		addrs := host.Peerstore().Addrs(p)
+		addrStrings := make([]string, len(addrs))
+		for i, addr := range addrs {
+			addrStrings[i] = addr.String()
+		}
+
+		info := PeerInfo{ID: p.String(), Addrs: addrStrings}
+		if q, ok := n.quality.get(p); ok {
+			info.Loss = q.Loss
+			if q.Answered() {
+				info.Latency = q.RTT.Milliseconds()
+				info.Jitter = q.Jitter.Milliseconds()
+				info.LastSeen = &q.LastSeen
+			}
+		}
+		peerInfos = append(peerInfos, info)
 	}
+	return peerInfos
+}
 
-	latency := time.Since(start).Milliseconds()
-	h.Peerstore().Put(p, "latency", latency)
-	log.Printf("Measured latency to %s: %dms", p.String(), latency)
+func (n *P2PNode) streamHandler(s network.Stream) {
+	n.log().Info("received VPN request", "seeker", s.Conn().RemotePeer())
+	s.Close()
 }
 
-func (n *P2PNode) setupDiscovery() error {
-	ctx := context.Background()
+// discoveryInterval is how long the DHT discovery loop waits between rounds.
+const discoveryInterval = time.Minute
+
+// setupDiscovery starts mDNS and the DHT. It is called with mu held; ctx is the node's
+// context.
+func (n *P2PNode) setupDiscovery(ctx context.Context) error {
 	if n.host == nil {
 		return nil
 	}
 
-	mdnsService := mdns.NewMdnsService(n.host, ProtocolMDNS, &discoveryNotifee{h: n.host})
+	mdnsService := mdns.NewMdnsService(n.host, ProtocolMDNS, &discoveryNotifee{h: n.host, node: n})
 	if err := mdnsService.Start(); err != nil {
 		return err
 	}
 	n.mdns = mdnsService
 
-	kdht, err := kaddht.New(ctx, n.host)
+	h := n.host
+	var chainPeers func() []peer.AddrInfo
+	if n.chainBootstrapEnabled() {
+		n.loadAddrBookInto(h)
+		chainPeers = func() []peer.AddrInfo { return n.knownChainPeers(h) }
+	}
+	dhtOpts, err := n.cfg.dhtOptions(n.dhtModeLocked(), chainPeers)
+	if err != nil {
+		return err
+	}
+	kdht, err := kaddht.New(ctx, h, dhtOpts...)
 	if err != nil {
 		return err
 	}
@@ -189,51 +378,132 @@ func (n *P2PNode) setupDiscovery() error {
 	routingDiscovery := routing.NewRoutingDiscovery(kdht)
 	util.Advertise(ctx, routingDiscovery, ProtocolDHT)
 
+	n.wg.Add(1)
 	go func() {
-		for {
-			if !n.IsRunning {
-				return
-			}
-			peers, err := routingDiscovery.FindPeers(ctx, ProtocolDHT)
-			if err != nil {
-				log.Printf("DHT FindPeers error: %v", err)
-				time.Sleep(1 * time.Minute)
-				continue
-			}
-			for p := range peers {
-				if p.ID == n.host.ID() {
-					continue
-				}
-				if n.host.Network().Connectedness(p.ID) != network.Connected {
-					log.Printf("Connecting to peer found via DHT: %s", p.ID)
-					if err := n.host.Connect(ctx, p); err != nil {
-						log.Printf("Failed to connect to %s: %v", p.ID, err)
-					} else {
-						go measureLatency(context.Background(), n.host, p.ID)
-					}
-				}
-			}
-			time.Sleep(1 * time.Minute)
-		}
+		defer n.wg.Done()
+		n.discoverDHT(ctx, h, routingDiscovery)
 	}()
+	if n.chainBootstrapEnabled() {
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			n.bootstrapFromChain(ctx, h)
+		}()
+	}
 
 	return nil
 }
 
+// discoverDHT connects to peers advertising on the DHT every discoveryInterval until ctx
+// is cancelled.
+func (n *P2PNode) discoverDHT(ctx context.Context, h host.Host, rd *routing.RoutingDiscovery) {
+	for {
+		if err := n.connectDHTPeers(ctx, h, rd); err != nil && ctx.Err() == nil {
+			n.log().Warn("DHT peer discovery failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(discoveryInterval):
+		}
+	}
+}
+
+// connectDHTPeers runs one discovery round, connecting to the peers found and measuring
+// their latency.
+func (n *P2PNode) connectDHTPeers(ctx context.Context, h host.Host, rd *routing.RoutingDiscovery) error {
+	peers, err := rd.FindPeers(ctx, ProtocolDHT)
+	if err != nil {
+		return err
+	}
+	for p := range peers {
+		if p.ID == h.ID() || h.Network().Connectedness(p.ID) == network.Connected {
+			continue
+		}
+		n.log().Debug("connecting to peer found via DHT", "peer", p.ID)
+		h.Peerstore().Put(p.ID, discoverySourceKey, SourceDHT)
+		if err := h.Connect(ctx, p); err != nil {
+			n.log().Debug("failed to connect to DHT peer", "peer", p.ID, "err", err)
+			continue
+		}
+		n.spawn(func(ctx context.Context) { n.measurePeer(ctx, p.ID) })
+	}
+	return nil
+}
+
 type discoveryNotifee struct {
-	h host.Host
+	h    host.Host
+	node *P2PNode
 }
 
 func (n *discoveryNotifee) HandlePeerFound(pi peer.AddrInfo) {
 	if pi.ID == n.h.ID() {
 		return
 	}
-	log.Printf("Found peer via mDNS: %s", pi.ID.String())
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	n.node.log().Debug("found peer via mDNS", "peer", pi.ID)
+	n.h.Peerstore().Put(pi.ID, discoverySourceKey, SourceMDNS)
+	ctx, cancel := context.WithTimeout(n.node.context(), 30*time.Second)
 	defer cancel()
 	if err := n.h.Connect(ctx, pi); err != nil {
-		log.Printf("Failed to connect to mDNS peer %s: %v", pi.ID, err)
+		n.node.log().Debug("failed to connect to mDNS peer", "peer", pi.ID, "err", err)
 	} else {
-		go measureLatency(context.Background(), n.h, pi.ID)
+		n.node.spawn(func(ctx context.Context) { n.node.measurePeer(ctx, pi.ID) })
+	}
+}
+
+// Discovery sources of peers.
+const (
+	SourceMDNS  = "mdns"
+	SourceDHT   = "dht"
+	SourceChain = "chain"
+	SourceOther = "other"
+
+	discoverySourceKey = "discovery"
+)
+
+// PeersBySource counts the connected peers by how they were discovered. Peers that dialled
+// in or were dialled directly count as SourceOther.
+func (n *P2PNode) PeersBySource() map[string]int {
+	counts := map[string]int{}
+	h := n.GetHost()
+	if h == nil {
+		return counts
 	}
+	for _, p := range h.Network().Peers() {
+		source := SourceOther
+		if v, err := h.Peerstore().Get(p, discoverySourceKey); err == nil {
+			if s, ok := v.(string); ok {
+				source = s
+			}
+		}
+		counts[source]++
+	}
+	return counts
+}
+
+// connectPeer makes sure the node is connected to a peer, looking it up in the DHT if the
+// peerstore has no addresses for it.
+func (n *P2PNode) connectPeer(ctx context.Context, p peer.ID) error {
+	n.mu.Lock()
+	h, dht := n.host, n.dht
+	n.mu.Unlock()
+	if h == nil {
+		return fmt.Errorf("node is not running")
+	}
+	if h.Network().Connectedness(p) == network.Connected {
+		return nil
+	}
+
+	info := h.Peerstore().PeerInfo(p)
+	if len(info.Addrs) == 0 && dht != nil {
+		found, err := dht.FindPeer(ctx, p)
+		if err != nil {
+			return fmt.Errorf("failed to find peer %s: %w", p, err)
+		}
+		info = found
+	}
+	if err := h.Connect(ctx, info); err != nil {
+		return fmt.Errorf("failed to connect to peer %s: %w", p, err)
+	}
+	return nil
 }
@@ -0,0 +1,315 @@
+package node
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"arkham-cli/metrics"
+	"arkham-cli/policy"
+	"arkham-cli/proxy"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ProtocolProxy carries one proxied TCP flow per libp2p stream from a seeker to a warden.
+// The stream opens with a request (kind, length-prefixed body) and the warden answers with
+// a status byte and a length-prefixed message before any payload flows.
+//
+// A connect request body is an attestation length byte, the attestation and the
+// destination. The attestation is empty or the seeker's wallet authority followed by its
+// signature over proxyAttestation, which lets the warden apply per-seeker exit policy.
+// Only exits serve the protocol, and only to seekers whose wallet it authorizes.
+const ProtocolProxy = "/arkham/proxy/1.0.0"
+
+const attestationLen = ed25519.PublicKeySize + ed25519.SignatureSize
+
+const bytesPerMb = 1024 * 1024
+
+const (
+	proxyKindConnect byte = 1
+	proxyKindProof   byte = 2
+
+	proxyStatusOK     byte = 0
+	proxyStatusFailed byte = 1
+)
+
+// proxyUsage counts the payload a warden relayed for each seeker over ProtocolProxy.
+type proxyUsage struct {
+	mu    sync.Mutex
+	bytes map[peer.ID]*atomic.Uint64
+}
+
+func (u *proxyUsage) counter(p peer.ID) *atomic.Uint64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.bytes == nil {
+		u.bytes = make(map[peer.ID]*atomic.Uint64)
+	}
+	c, ok := u.bytes[p]
+	if !ok {
+		c = new(atomic.Uint64)
+		u.bytes[p] = c
+	}
+	return c
+}
+
+// ProxyBytes returns the payload bytes this node relayed for a seeker over ProtocolProxy.
+func (n *P2PNode) ProxyBytes(seeker peer.ID) uint64 {
+	return n.proxyUsage.counter(seeker).Load()
+}
+
+func writeProxyMessage(w io.Writer, head byte, body []byte) error {
+	if len(body) > 0xffff {
+		return fmt.Errorf("proxy message too large")
+	}
+	buf := make([]byte, 3+len(body))
+	buf[0] = head
+	binary.BigEndian.PutUint16(buf[1:3], uint16(len(body)))
+	copy(buf[3:], body)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readProxyMessage(r io.Reader) (byte, []byte, error) {
+	var header [3]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	body := make([]byte, binary.BigEndian.Uint16(header[1:3]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header[0], body, nil
+}
+
+// proxyHandler serves ProtocolProxy streams on the warden side.
+func (n *P2PNode) proxyHandler(s network.Stream) {
+	defer s.Close()
+	seeker := s.Conn().RemotePeer()
+
+	s.SetReadDeadline(time.Now().Add(circuitDialTimeout))
+	reader := bufio.NewReader(s)
+	kind, body, err := readProxyMessage(reader)
+	if err != nil {
+		return
+	}
+	s.SetReadDeadline(time.Time{})
+
+	switch kind {
+	case proxyKindConnect:
+		identity, addr, err := n.proxySeeker(seeker, body)
+		if err == nil {
+			err = n.Relay.authorize(seeker, identity)
+		}
+		if err != nil {
+			writeProxyMessage(s, proxyStatusFailed, []byte(err.Error()))
+			return
+		}
+		n.proxyConnect(s, reader, identity, addr)
+	case proxyKindProof:
+		err := n.acceptProxyProof(seeker, body)
+		if err != nil {
+			writeProxyMessage(s, proxyStatusFailed, []byte(err.Error()))
+			return
+		}
+		writeProxyMessage(s, proxyStatusOK, nil)
+	default:
+		writeProxyMessage(s, proxyStatusFailed, []byte("unknown request"))
+	}
+}
+
+// proxyAttestation is the message a seeker signs with its wallet to bind it to its peer ID.
+func proxyAttestation(seeker peer.ID) []byte {
+	return append([]byte("arkham-proxy-seeker:"), []byte(seeker)...)
+}
+
+// proxySeeker splits a connect request into the seeker's policy identity and the
+// destination, verifying the seeker's attestation if it sent one.
+func (n *P2PNode) proxySeeker(seeker peer.ID, body []byte) (policy.Seeker, string, error) {
+	identity := policy.Seeker{PeerID: seeker.String()}
+	attestation, addr, ok := splitAttestation(body)
+	if !ok {
+		return identity, "", fmt.Errorf("malformed proxy request")
+	}
+	var authority solana.PublicKey
+	if len(attestation) == 0 {
+		// Fall back to the wallet the seeker proved over ProtocolIdentity.
+		attested, ok := n.PeerAuthority(seeker)
+		if !ok {
+			return identity, addr, nil
+		}
+		authority = attested
+	} else {
+		var err error
+		if authority, err = verifyAttestation(attestation, proxyAttestation(seeker)); err != nil {
+			return identity, "", err
+		}
+	}
+	return n.Relay.attestedSeeker(seeker, authority), addr, nil
+}
+
+// attestationBody opens a request body with the wallet's attestation over msg. Without a
+// wallet the attestation is empty.
+func attestationBody(wallet ed25519.PrivateKey, msg []byte) []byte {
+	if wallet == nil {
+		return []byte{0}
+	}
+	body := []byte{attestationLen}
+	body = append(body, wallet.Public().(ed25519.PublicKey)...)
+	return append(body, ed25519.Sign(wallet, msg)...)
+}
+
+// splitAttestation splits a request body into the attestation it opens with and the
+// destination that follows.
+func splitAttestation(body []byte) ([]byte, string, bool) {
+	if len(body) < 1 || len(body) < 1+int(body[0]) {
+		return nil, "", false
+	}
+	return body[1 : 1+body[0]], string(body[1+body[0]:]), true
+}
+
+// verifyAttestation checks a wallet's signature over msg and returns the wallet.
+func verifyAttestation(attestation, msg []byte) (solana.PublicKey, error) {
+	if len(attestation) != attestationLen {
+		return solana.PublicKey{}, fmt.Errorf("malformed seeker attestation")
+	}
+	if !ed25519.Verify(attestation[:ed25519.PublicKeySize], msg, attestation[ed25519.PublicKeySize:]) {
+		return solana.PublicKey{}, fmt.Errorf("invalid seeker attestation")
+	}
+	return solana.PublicKeyFromBytes(attestation[:ed25519.PublicKeySize]), nil
+}
+
+func (n *P2PNode) proxyConnect(s network.Stream, reader io.Reader, seeker policy.Seeker, addr string) {
+	session, err := n.Relay.openSession(seeker)
+	if err != nil {
+		writeProxyMessage(s, proxyStatusFailed, []byte(err.Error()))
+		return
+	}
+	if session != nil {
+		defer session.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(n.context(), circuitDialTimeout)
+	conn, err := n.Relay.dialExit(ctx, session, addr)
+	cancel()
+	if err != nil {
+		writeProxyMessage(s, proxyStatusFailed, []byte(err.Error()))
+		return
+	}
+	defer conn.Close()
+	if err := writeProxyMessage(s, proxyStatusOK, nil); err != nil {
+		return
+	}
+
+	remote := s.Conn().RemotePeer()
+	n.openFlow(remote)
+	defer n.closeFlow(remote)
+	counter := n.proxyUsage.counter(remote)
+	done := make(chan struct{}, 2)
+	go func() {
+		proxy.Copy(conn, metrics.CountReader(reader, metrics.WardenBytesIn), counter)
+		done <- struct{}{}
+	}()
+	go func() {
+		proxy.Copy(s, metrics.CountReader(conn, metrics.WardenBytesOut), counter)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// acceptProxyProof checks a seeker's proof against the bytes actually relayed before
+// handing it to Relay.OnProof.
+func (n *P2PNode) acceptProxyProof(seeker peer.ID, body []byte) error {
+	proof, err := unmarshalBandwidthProof(body)
+	if err != nil {
+		return err
+	}
+	relayedMb := (n.ProxyBytes(seeker) + bytesPerMb - 1) / bytesPerMb
+	if proof.MbConsumed > relayedMb {
+		return fmt.Errorf("proof claims %d MB but only %d MB were relayed", proof.MbConsumed, relayedMb)
+	}
+	if n.Relay == nil || n.Relay.OnProof == nil {
+		return fmt.Errorf("this warden does not accept bandwidth proofs")
+	}
+	return n.Relay.OnProof(seeker, proof)
+}
+
+// DialProxy opens a flow to addr through the warden's exit over ProtocolProxy. When
+// SeekerKey is set the flow is attested with it, so the warden applies the seeker's tier.
+func (n *P2PNode) DialProxy(ctx context.Context, warden peer.ID, addr string) (net.Conn, error) {
+	body := attestationBody(nil, nil)
+	if n.SeekerKey != nil {
+		h := n.GetHost()
+		if h == nil {
+			return nil, fmt.Errorf("node is not running")
+		}
+		body = attestationBody(n.SeekerKey, proxyAttestation(h.ID()))
+	}
+	s, err := n.openProxyStream(ctx, warden, proxyKindConnect, append(body, addr...))
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Stream: s, addr: addr}, nil
+}
+
+// SendProxyProof delivers a bandwidth proof for proxied traffic to the warden and waits
+// for it to be accepted.
+func (n *P2PNode) SendProxyProof(ctx context.Context, warden peer.ID, proof BandwidthProof) error {
+	s, err := n.openProxyStream(ctx, warden, proxyKindProof, proof.marshal())
+	if err != nil {
+		return err
+	}
+	s.Close()
+	return nil
+}
+
+func (n *P2PNode) openProxyStream(ctx context.Context, warden peer.ID, kind byte, body []byte) (network.Stream, error) {
+	if err := n.connectPeer(ctx, warden); err != nil {
+		return nil, err
+	}
+	h := n.GetHost()
+	if h == nil {
+		return nil, fmt.Errorf("node is not running")
+	}
+	s, err := h.NewStream(ctx, warden, ProtocolProxy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open proxy stream to %s: %w", warden, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetDeadline(deadline)
+	}
+	if err := writeProxyMessage(s, kind, body); err != nil {
+		s.Reset()
+		return nil, err
+	}
+	status, msg, err := readProxyMessage(s)
+	if err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("warden %s did not answer: %w", warden, err)
+	}
+	if status != proxyStatusOK {
+		s.Reset()
+		return nil, fmt.Errorf("warden %s refused: %s", warden, msg)
+	}
+	s.SetDeadline(time.Time{})
+	return s, nil
+}
+
+// proxyConn adapts a proxy stream to net.Conn.
+type proxyConn struct {
+	network.Stream
+	addr string
+}
+
+func (c *proxyConn) LocalAddr() net.Addr  { return circuitAddr("arkham-proxy") }
+func (c *proxyConn) RemoteAddr() net.Addr { return circuitAddr(c.addr) }
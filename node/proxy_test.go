@@ -0,0 +1,285 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"arkham-cli/policy"
+	"arkham-cli/proxy"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// newTestNode creates a node with a loopback TCP host and only the proxy and circuit
+// handlers, without the discovery services Start would bring up.
+func newTestNode(t *testing.T) *P2PNode {
+	t.Helper()
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+
+	n := NewP2PNode()
+	n.host = h
+	h.SetStreamHandler(ProtocolProxy, n.proxyHandler)
+	h.SetStreamHandler(ProtocolCircuit, n.circuitHandler)
+	return n
+}
+
+// loopbackPolicy lets seekers reach the loopback servers tests run.
+func loopbackPolicy(t *testing.T) *policy.Engine {
+	t.Helper()
+	p, err := policy.Parse([]byte(`{"allow": [{"cidr": "127.0.0.0/8"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy.NewEngine(p)
+}
+
+// startTestProxy runs a seeker proxy that tunnels every flow to warden. Unless the test set
+// them, the seeker attests a fresh wallet, the warden authorizes every seeker and its
+// policy allows loopback.
+func startTestProxy(t *testing.T, seeker, warden *P2PNode) (*proxy.Server, net.Listener) {
+	t.Helper()
+	if seeker.SeekerKey == nil {
+		_, seeker.SeekerKey, _ = ed25519.GenerateKey(nil)
+	}
+	if warden.Relay.Authorize == nil {
+		warden.Relay.Authorize = func(peer.ID, [32]byte) error { return nil }
+	}
+	if warden.Relay.Policy == nil {
+		warden.Relay.Policy = loopbackPolicy(t)
+	}
+	wardenHost := warden.GetHost()
+	seeker.GetHost().Peerstore().AddAddrs(wardenHost.ID(), wardenHost.Addrs(), time.Hour)
+
+	server := &proxy.Server{
+		Dial: func(ctx context.Context, addr string) (net.Conn, error) {
+			return seeker.DialProxy(ctx, wardenHost.ID(), addr)
+		},
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(l)
+	t.Cleanup(func() { server.Close() })
+	return server, l
+}
+
+func fetch(t *testing.T, client *http.Client, target string) string {
+	t.Helper()
+	resp, err := client.Get(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestProxySocks5(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello from the exit")
+	}))
+	defer target.Close()
+
+	seeker, warden := newTestNode(t), newTestNode(t)
+	server, l := startTestProxy(t, seeker, warden)
+
+	client := &http.Client{Transport: &http.Transport{
+		Proxy: http.ProxyURL(&url.URL{Scheme: "socks5", Host: l.Addr().String()}),
+	}}
+	if body := fetch(t, client, target.URL); body != "hello from the exit" {
+		t.Fatalf("unexpected body %q", body)
+	}
+
+	if server.BytesReceived() == 0 || server.BytesSent() == 0 {
+		t.Fatalf("seeker did not count bytes: sent %d, received %d", server.BytesSent(), server.BytesReceived())
+	}
+	relayed := warden.ProxyBytes(seeker.GetHost().ID())
+	if relayed != server.BytesTransferred() {
+		t.Fatalf("warden counted %d bytes, seeker counted %d", relayed, server.BytesTransferred())
+	}
+}
+
+func TestProxyHTTPConnect(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "tls through connect")
+	}))
+	defer target.Close()
+
+	seeker, warden := newTestNode(t), newTestNode(t)
+	_, l := startTestProxy(t, seeker, warden)
+
+	transport := target.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(&url.URL{Scheme: "http", Host: l.Addr().String()})
+	client := &http.Client{Transport: transport}
+
+	if body := fetch(t, client, target.URL); body != "tls through connect" {
+		t.Fatalf("unexpected body %q", body)
+	}
+	if warden.ProxyBytes(seeker.GetHost().ID()) == 0 {
+		t.Fatal("warden did not count relayed bytes")
+	}
+}
+
+func TestProxyExitRefusal(t *testing.T) {
+	seeker, warden := newTestNode(t), newTestNode(t)
+	warden.Relay.Dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, io.ErrClosedPipe
+	}
+	startTestProxy(t, seeker, warden)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := seeker.DialProxy(ctx, warden.GetHost().ID(), "127.0.0.1:1"); err == nil {
+		t.Fatal("expected the warden to refuse the flow")
+	}
+}
+
+func TestProxyProofChecksRelayedBytes(t *testing.T) {
+	seeker, warden := newTestNode(t), newTestNode(t)
+	var accepted []BandwidthProof
+	warden.Relay.OnProof = func(p peer.ID, proof BandwidthProof) error {
+		accepted = append(accepted, proof)
+		return nil
+	}
+	startTestProxy(t, seeker, warden)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := seeker.SendProxyProof(ctx, warden.GetHost().ID(), BandwidthProof{MbConsumed: 5}); err == nil {
+		t.Fatal("expected a proof for unrelayed traffic to be rejected")
+	}
+	if err := seeker.SendProxyProof(ctx, warden.GetHost().ID(), BandwidthProof{MbConsumed: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if len(accepted) != 1 {
+		t.Fatalf("expected one accepted proof, got %d", len(accepted))
+	}
+}
+
+func TestProxyExitPolicy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "allowed")
+	}))
+	defer target.Close()
+	_, port, _ := net.SplitHostPort(target.Listener.Addr().String())
+
+	exitPolicy, err := policy.Parse([]byte(`{"allow": [{"cidr": "127.0.0.0/8", "ports": ["` + port + `"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeker, warden := newTestNode(t), newTestNode(t)
+	warden.Relay.Policy = policy.NewEngine(exitPolicy)
+	seekerKey := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	seeker.SeekerKey = seekerKey
+	var attested [32]byte
+	warden.Relay.SeekerTier = func(authority [32]byte) string {
+		attested = authority
+		return policy.TierPremium
+	}
+	startTestProxy(t, seeker, warden)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	wardenID := warden.GetHost().ID()
+	if _, err := seeker.DialProxy(ctx, wardenID, "127.0.0.1:25"); err == nil {
+		t.Fatal("expected the exit policy to refuse port 25")
+	}
+	conn, err := seeker.DialProxy(ctx, wardenID, target.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if !bytes.Equal(attested[:], seekerKey.Public().(ed25519.PublicKey)) {
+		t.Fatal("warden did not verify the seeker's attestation")
+	}
+
+	// Deny the seeker without restarting the warden.
+	denied := *exitPolicy
+	denied.DenySeekers = []string{solana.PublicKeyFromBytes(attested[:]).String()}
+	warden.Relay.Policy.Set(&denied)
+	if _, err := seeker.DialProxy(ctx, wardenID, target.Listener.Addr().String()); err == nil {
+		t.Fatal("expected a denied seeker to be refused")
+	}
+}
+
+func TestProxyRequiresAuthorization(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+
+	seeker, warden := newTestNode(t), newTestNode(t)
+	seekerKey := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	seeker.SeekerKey = seekerKey
+	var authorized []peer.ID
+	warden.Relay.Authorize = func(p peer.ID, authority [32]byte) error {
+		if !bytes.Equal(authority[:], seekerKey.Public().(ed25519.PublicKey)) {
+			t.Errorf("authorized wallet %x, want the seeker's", authority)
+		}
+		authorized = append(authorized, p)
+		return errors.New("no active connection")
+	}
+	dialled := false
+	warden.Relay.Dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialled = true
+		return net.Dial(network, addr)
+	}
+	startTestProxy(t, seeker, warden)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	wardenID := warden.GetHost().ID()
+	if _, err := seeker.DialProxy(ctx, wardenID, target.Addr().String()); err == nil || !strings.Contains(err.Error(), "no active connection") {
+		t.Fatalf("expected a seeker without a connection to be refused, got %v", err)
+	}
+	if len(authorized) != 1 || authorized[0] != seeker.GetHost().ID() {
+		t.Fatalf("authorized %v, want the seeker's peer", authorized)
+	}
+
+	// A seeker that proves no wallet cannot be looked up, so it is refused outright.
+	seeker.SeekerKey = nil
+	if _, err := seeker.DialProxy(ctx, wardenID, target.Addr().String()); err == nil {
+		t.Fatal("expected an unattested seeker to be refused")
+	}
+	if len(authorized) != 1 || dialled {
+		t.Fatalf("refused seekers reached the exit: %d authorizations, dialled %v", len(authorized), dialled)
+	}
+}
+
+func TestOnlyExitsServeProxy(t *testing.T) {
+	for _, exit := range []bool{false, true} {
+		n := NewP2PNode()
+		if exit {
+			n.Relay.Authorize = func(peer.ID, [32]byte) error { return nil }
+		}
+		if err := n.Start(); err != nil {
+			t.Fatal(err)
+		}
+		if served := slices.Contains(n.GetHost().Mux().Protocols(), ProtocolProxy); served != exit {
+			t.Errorf("exit %v: serves %s = %v", exit, ProtocolProxy, served)
+		}
+		n.Stop()
+	}
+}
@@ -0,0 +1,302 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"arkham-cli/events"
+	"arkham-cli/metrics"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// qualityProbeInterval is how often connected peers are pinged.
+	qualityProbeInterval = 30 * time.Second
+	pingTimeout          = 5 * time.Second
+	// qualityProbeConcurrency bounds the pings in flight in one round.
+	qualityProbeConcurrency = 16
+	// qualityAlpha is the weight of a new sample in the moving averages.
+	qualityAlpha = 0.2
+
+	// A peer is dead once it has not answered for deadPeerTimeout, or once its loss rate
+	// exceeds deadPeerLoss over at least deadPeerSamples pings.
+	deadPeerTimeout = 5 * time.Minute
+	deadPeerLoss    = 0.9
+	deadPeerSamples = 5
+)
+
+// PeerQuality is the link quality measured to a peer by pinging it over ProtocolPing.
+// RTT, Jitter and Loss are exponentially weighted moving averages, so recent pings count
+// most.
+type PeerQuality struct {
+	RTT    time.Duration `json:"rtt"`
+	Jitter time.Duration `json:"jitter"`
+	// Loss is the share of pings that went unanswered, from 0 to 1.
+	Loss float64 `json:"loss"`
+	// LastSeen is when the peer last answered a ping. It is zero if it never did.
+	LastSeen time.Time `json:"lastSeen"`
+	// Samples counts the pings sent, answered or not.
+	Samples int `json:"samples"`
+}
+
+// Answered reports whether the peer has ever answered a ping.
+func (q PeerQuality) Answered() bool {
+	return !q.LastSeen.IsZero()
+}
+
+// qualityEntry is a peer's quality with the time its first ping was sent, which dates
+// peers that never answered.
+type qualityEntry struct {
+	PeerQuality
+	since time.Time
+}
+
+// qualityTracker holds the quality of the peers the node pings. It has its own lock so
+// pings never wait on the node's.
+type qualityTracker struct {
+	mu    sync.Mutex
+	peers map[peer.ID]*qualityEntry
+}
+
+// record folds one ping into a peer's averages. err is the ping's failure, if any.
+func (t *qualityTracker) record(p peer.ID, rtt time.Duration, err error, now time.Time) PeerQuality {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.peers == nil {
+		t.peers = make(map[peer.ID]*qualityEntry)
+	}
+	e, ok := t.peers[p]
+	if !ok {
+		e = &qualityEntry{since: now}
+		t.peers[p] = e
+	}
+
+	lost := 0.0
+	if err != nil {
+		lost = 1
+	}
+	if e.Samples == 0 {
+		e.Loss = lost
+	} else {
+		e.Loss += qualityAlpha * (lost - e.Loss)
+	}
+	e.Samples++
+	if err != nil {
+		return e.PeerQuality
+	}
+
+	if !e.Answered() {
+		e.RTT = rtt
+	} else {
+		delta := time.Duration(math.Abs(float64(rtt - e.RTT)))
+		e.Jitter += time.Duration(qualityAlpha * float64(delta-e.Jitter))
+		e.RTT += time.Duration(qualityAlpha * float64(rtt-e.RTT))
+	}
+	e.LastSeen = now
+	return e.PeerQuality
+}
+
+func (t *qualityTracker) get(p peer.ID) (PeerQuality, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.peers[p]
+	if !ok {
+		return PeerQuality{}, false
+	}
+	return e.PeerQuality, true
+}
+
+func (t *qualityTracker) all() map[peer.ID]PeerQuality {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	all := make(map[peer.ID]PeerQuality, len(t.peers))
+	for p, e := range t.peers {
+		all[p] = e.PeerQuality
+	}
+	return all
+}
+
+// dead removes and returns the peers that are dead as of now.
+func (t *qualityTracker) dead(now time.Time) []peer.ID {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var dead []peer.ID
+	for p, e := range t.peers {
+		last := e.since
+		if e.Answered() {
+			last = e.LastSeen
+		}
+		if now.Sub(last) > deadPeerTimeout || (e.Samples >= deadPeerSamples && e.Loss > deadPeerLoss) {
+			dead = append(dead, p)
+			delete(t.peers, p)
+		}
+	}
+	return dead
+}
+
+func (t *qualityTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.peers = nil
+}
+
+// PeerQuality returns the link quality measured to a peer, if it was ever pinged.
+func (n *P2PNode) PeerQuality(p peer.ID) (PeerQuality, bool) {
+	return n.quality.get(p)
+}
+
+// PeerQualities returns the link quality of every peer the node is measuring.
+func (n *P2PNode) PeerQualities() map[peer.ID]PeerQuality {
+	return n.quality.all()
+}
+
+// PeerLatency returns the average round trip to a peer, if it ever answered a ping.
+func (n *P2PNode) PeerLatency(p peer.ID) (time.Duration, bool) {
+	q, ok := n.quality.get(p)
+	if !ok || !q.Answered() {
+		return 0, false
+	}
+	return q.RTT, true
+}
+
+// ProbeLatency connects to a peer, looking it up in the DHT if needed, pings it and returns
+// its average round trip.
+func (n *P2PNode) ProbeLatency(ctx context.Context, p peer.ID) (time.Duration, error) {
+	if err := n.connectPeer(ctx, p); err != nil {
+		return 0, err
+	}
+	if err := n.measurePeer(ctx, p); err != nil {
+		return 0, fmt.Errorf("peer %s did not answer ping: %w", p, err)
+	}
+	latency, _ := n.PeerLatency(p)
+	return latency, nil
+}
+
+func pingHandler(s network.Stream) {
+	defer s.Close()
+	buf := make([]byte, 1)
+	if _, err := s.Read(buf); err != nil {
+		return
+	}
+	_, _ = s.Write(buf)
+}
+
+// ping measures one round trip to a peer over ProtocolPing.
+func ping(ctx context.Context, h host.Host, p peer.ID) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	start := time.Now()
+	s, err := h.NewStream(ctx, p, ProtocolPing)
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetDeadline(deadline)
+	}
+
+	if _, err := s.Write([]byte("p")); err != nil {
+		s.Reset()
+		return 0, err
+	}
+	// Nodes before the echo close the stream after reading the byte instead, which is
+	// still a full round trip.
+	buf := make([]byte, 1)
+	if _, err := s.Read(buf); err != nil && !errors.Is(err, io.EOF) {
+		s.Reset()
+		return 0, err
+	}
+
+	elapsed := time.Since(start)
+	metrics.PeerLatency.Observe(elapsed.Seconds())
+	return elapsed, nil
+}
+
+// measurePeer pings a peer, records the result and reports the peer's new quality. It
+// returns the ping's error.
+func (n *P2PNode) measurePeer(ctx context.Context, p peer.ID) error {
+	h := n.GetHost()
+	if h == nil {
+		return fmt.Errorf("node is not running")
+	}
+	rtt, err := ping(ctx, h, p)
+	if err != nil && ctx.Err() != nil {
+		// The node is stopping; that says nothing about the peer.
+		return err
+	}
+	q := n.quality.record(p, rtt, err, time.Now())
+	if err != nil {
+		n.log().Debug("peer did not answer ping", "peer", p, "loss", q.Loss, "err", err)
+		return err
+	}
+	n.log().Debug("measured peer latency", "peer", p, "rtt", rtt, "avg", q.RTT, "jitter", q.Jitter)
+	n.Events.Publish(events.TypePeer, PeerEvent{
+		ID:      p.String(),
+		State:   PeerLatency,
+		Latency: q.RTT.Milliseconds(),
+		Jitter:  q.Jitter.Milliseconds(),
+		Loss:    q.Loss,
+	})
+	return nil
+}
+
+// probePeers pings the connected peers every qualityProbeInterval and evicts dead ones
+// until ctx is cancelled.
+func (n *P2PNode) probePeers(ctx context.Context, h host.Host) {
+	ticker := time.NewTicker(qualityProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n.probeRound(ctx, h)
+	}
+}
+
+// probeRound pings every connected peer once, at most qualityProbeConcurrency at a time,
+// then evicts the dead ones.
+func (n *P2PNode) probeRound(ctx context.Context, h host.Host) {
+	sem := make(chan struct{}, qualityProbeConcurrency)
+	var wg sync.WaitGroup
+	for _, p := range h.Network().Peers() {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			n.measurePeer(ctx, p)
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() == nil {
+		n.evictDead(h, time.Now())
+	}
+}
+
+// evictDead disconnects the peers that stopped answering pings and forgets their
+// addresses, so they no longer show up as peers. A peer that comes back is found again by
+// discovery.
+func (n *P2PNode) evictDead(h host.Host, now time.Time) {
+	for _, p := range n.quality.dead(now) {
+		n.log().Info("evicting unresponsive peer", "peer", p)
+		h.Network().ClosePeer(p)
+		h.Peerstore().ClearAddrs(p)
+		h.Peerstore().RemovePeer(p)
+	}
+}
@@ -0,0 +1,88 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestQualityAverages(t *testing.T) {
+	var tracker qualityTracker
+	p := peer.ID("peer")
+	now := time.Unix(1000, 0)
+
+	q := tracker.record(p, 100*time.Millisecond, nil, now)
+	if q.RTT != 100*time.Millisecond || q.Jitter != 0 || q.Loss != 0 || q.LastSeen != now {
+		t.Fatalf("first sample = %+v", q)
+	}
+	q = tracker.record(p, 200*time.Millisecond, nil, now)
+	if q.RTT != 120*time.Millisecond || q.Jitter != 20*time.Millisecond {
+		t.Fatalf("second sample = %+v", q)
+	}
+
+	// A lost ping moves the loss rate but not the round trip or last-seen time.
+	q = tracker.record(p, 0, errors.New("timeout"), now.Add(time.Minute))
+	if q.RTT != 120*time.Millisecond || q.Loss != qualityAlpha || q.LastSeen != now || q.Samples != 3 {
+		t.Fatalf("lost sample = %+v", q)
+	}
+}
+
+func TestQualityEvictsDeadPeers(t *testing.T) {
+	var tracker qualityTracker
+	now := time.Unix(1000, 0)
+	alive, silent, lossy := peer.ID("alive"), peer.ID("silent"), peer.ID("lossy")
+
+	tracker.record(alive, time.Millisecond, nil, now)
+	tracker.record(silent, 0, errors.New("timeout"), now.Add(-deadPeerTimeout-time.Second))
+	tracker.record(lossy, time.Millisecond, nil, now)
+	for i := 0; i < 20; i++ {
+		tracker.record(lossy, 0, errors.New("timeout"), now)
+	}
+
+	dead := tracker.dead(now)
+	if len(dead) != 2 {
+		t.Fatalf("dead = %v, want silent and lossy", dead)
+	}
+	if _, ok := tracker.get(alive); !ok {
+		t.Fatal("responsive peer was evicted")
+	}
+	if _, ok := tracker.get(lossy); ok {
+		t.Fatal("evicted peer is still tracked")
+	}
+}
+
+func TestPingMeasuresQuality(t *testing.T) {
+	loopback := Config{ListenAddrs: []string{"/ip4/127.0.0.1/tcp/0"}}
+	a, b := NewP2PNode(), NewP2PNode()
+	for _, n := range []*P2PNode{a, b} {
+		if err := n.SetConfig(loopback); err != nil {
+			t.Fatal(err)
+		}
+		if err := n.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer n.Stop()
+	}
+	bHost := b.GetHost()
+	a.GetHost().Peerstore().AddAddrs(bHost.ID(), bHost.Addrs(), time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	rtt, err := a.ProbeLatency(ctx, bHost.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// mDNS discovery may have pinged the peer too, so only the average is known.
+	q, ok := a.PeerQuality(bHost.ID())
+	if !ok || !q.Answered() || rtt <= 0 || q.RTT <= 0 || q.Loss != 0 {
+		t.Fatalf("quality = %+v, %v", q, ok)
+	}
+	for _, info := range a.Peers() {
+		if info.ID == bHost.ID().String() && info.LastSeen == nil {
+			t.Fatal("peer list does not report the measured quality")
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package node
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"arkham-cli/events"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ServedSession is a peer this node is currently relaying traffic for.
+type ServedSession struct {
+	Peer string `json:"peer"`
+	// Kind is KindProxy for ProtocolProxy flows or KindCircuit for a circuit through this hop.
+	Kind    string    `json:"kind"`
+	Streams int       `json:"streams"`
+	Bytes   uint64    `json:"bytes"`
+	Since   time.Time `json:"since"`
+}
+
+// servedSessions tracks the proxy flows and circuits this node is serving.
+type servedSessions struct {
+	mu       sync.Mutex
+	proxy    map[peer.ID]*proxyFlows
+	circuits map[*hopCircuit]time.Time
+}
+
+type proxyFlows struct {
+	active int
+	since  time.Time
+}
+
+// openFlow records a proxy flow and reports whether it is the peer's first.
+func (s *servedSessions) openFlow(p peer.ID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.proxy == nil {
+		s.proxy = make(map[peer.ID]*proxyFlows)
+	}
+	flows, ok := s.proxy[p]
+	if !ok {
+		flows = &proxyFlows{since: time.Now()}
+		s.proxy[p] = flows
+	}
+	flows.active++
+	return !ok
+}
+
+// closeFlow ends a proxy flow and reports whether it was the peer's last.
+func (s *servedSessions) closeFlow(p peer.ID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if flows, ok := s.proxy[p]; ok {
+		flows.active--
+		if flows.active <= 0 {
+			delete(s.proxy, p)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *servedSessions) addCircuit(c *hopCircuit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.circuits == nil {
+		s.circuits = make(map[*hopCircuit]time.Time)
+	}
+	s.circuits[c] = time.Now()
+}
+
+func (s *servedSessions) removeCircuit(c *hopCircuit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.circuits, c)
+}
+
+func (n *P2PNode) openFlow(p peer.ID) {
+	if n.served.openFlow(p) {
+		n.Events.Publish(events.TypeSession, SessionEvent{Role: RoleWarden, Kind: "proxy", Peer: p.String(), State: SessionStart})
+	}
+}
+
+func (n *P2PNode) closeFlow(p peer.ID) {
+	if n.served.closeFlow(p) {
+		n.Events.Publish(events.TypeSession, SessionEvent{Role: RoleWarden, Kind: "proxy", Peer: p.String(), State: SessionStop, Bytes: n.ProxyBytes(p)})
+	}
+}
+
+func (n *P2PNode) addCircuit(c *hopCircuit) {
+	n.served.addCircuit(c)
+	n.Events.Publish(events.TypeSession, SessionEvent{Role: RoleWarden, Kind: "circuit", Peer: c.seeker.String(), State: SessionStart})
+}
+
+func (n *P2PNode) removeCircuit(c *hopCircuit) {
+	n.served.removeCircuit(c)
+	n.Events.Publish(events.TypeSession, SessionEvent{Role: RoleWarden, Kind: "circuit", Peer: c.seeker.String(), State: SessionStop, Bytes: c.relayed.Load()})
+}
+
+// ServedSessions lists the proxy seekers and circuits this node is relaying for, oldest
+// first.
+func (n *P2PNode) ServedSessions() []ServedSession {
+	n.served.mu.Lock()
+	sessions := make([]ServedSession, 0, len(n.served.proxy)+len(n.served.circuits))
+	for p, flows := range n.served.proxy {
+		sessions = append(sessions, ServedSession{
+			Peer:    p.String(),
+			Kind:    KindProxy,
+			Streams: flows.active,
+			Since:   flows.since,
+		})
+	}
+	circuits := make(map[*hopCircuit]time.Time, len(n.served.circuits))
+	for c, since := range n.served.circuits {
+		circuits[c] = since
+	}
+	n.served.mu.Unlock()
+
+	for i := range sessions {
+		p, _ := peer.Decode(sessions[i].Peer)
+		sessions[i].Bytes = n.ProxyBytes(p)
+	}
+	for c, since := range circuits {
+		c.mu.Lock()
+		streams := len(c.streams)
+		c.mu.Unlock()
+		sessions = append(sessions, ServedSession{
+			Peer:    c.seeker.String(),
+			Kind:    KindCircuit,
+			Streams: streams,
+			Bytes:   c.relayed.Load(),
+			Since:   since,
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Since.Before(sessions[j].Since) })
+	return sessions
+}
+
+// servedSeekers counts the distinct peers this node is relaying for.
+func (n *P2PNode) servedSeekers() int {
+	n.served.mu.Lock()
+	defer n.served.mu.Unlock()
+	seekers := make(map[peer.ID]bool, len(n.served.proxy)+len(n.served.circuits))
+	for p := range n.served.proxy {
+		seekers[p] = true
+	}
+	for c := range n.served.circuits {
+		seekers[c.seeker] = true
+	}
+	return len(seekers)
+}
@@ -0,0 +1,233 @@
+// Package oracle implements a self-hosted Arkham price oracle that signs quotes in the same
+// format as the hosted oracle API, so wardens can register against a local validator.
+package oracle
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	ap "arkham-cli/solana"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// Feed supplies unsigned USD prices in oracle units (micro-USD).
+type Feed interface {
+	Price(ctx context.Context, token ap.StakeToken) (uint64, error)
+}
+
+// StaticFeed serves prices from a fixed table.
+type StaticFeed map[ap.StakeToken]uint64
+
+// Price implements Feed.
+func (f StaticFeed) Price(ctx context.Context, token ap.StakeToken) (uint64, error) {
+	price, ok := f[token]
+	if !ok {
+		return 0, fmt.Errorf("no price configured for %s", token)
+	}
+	return price, nil
+}
+
+// CoinGeckoFeed reads prices from a CoinGecko-compatible /simple/price endpoint.
+type CoinGeckoFeed struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewCoinGeckoFeed creates a feed for the API at baseURL, e.g. https://api.coingecko.com/api/v3.
+func NewCoinGeckoFeed(baseURL string) *CoinGeckoFeed {
+	return &CoinGeckoFeed{
+		BaseURL:    baseURL,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Price implements Feed.
+func (f *CoinGeckoFeed) Price(ctx context.Context, token ap.StakeToken) (uint64, error) {
+	id, err := ap.OracleTokenID(token)
+	if err != nil {
+		return 0, err
+	}
+
+	reqURL := fmt.Sprintf("%s/simple/price?ids=%s&vs_currencies=usd", f.BaseURL, id)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build feed request: %w", err)
+	}
+	resp, err := f.HTTPClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to call price feed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("price feed returned non-200 status: %s", resp.Status)
+	}
+
+	var prices map[string]struct {
+		Usd float64 `json:"usd"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&prices); err != nil {
+		return 0, fmt.Errorf("failed to decode price feed response: %w", err)
+	}
+	usd := prices[id].Usd
+	if usd <= 0 {
+		return 0, fmt.Errorf("price feed has no price for %s", id)
+	}
+	return uint64(math.Round(usd * math.Pow10(ap.OraclePriceDecimals))), nil
+}
+
+// AuditRecord is one line of the audit log, written for every signed quote.
+type AuditRecord struct {
+	Time       time.Time `json:"time"`
+	Remote     string    `json:"remote"`
+	ClientKey  string    `json:"clientKey"` // sha256 fingerprint, never the key itself
+	Token      string    `json:"token"`
+	Price      uint64    `json:"price"`
+	Timestamp  int64     `json:"timestamp"`
+	Signature  string    `json:"signature"`
+	OracleAuth string    `json:"oracleAuthority"`
+}
+
+// AuditLog appends JSON records to a file, syncing after each write.
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenAuditLog opens (or creates) an append-only audit log.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &AuditLog{file: file}, nil
+}
+
+// Write appends a record to the log.
+func (a *AuditLog) Write(record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	return a.file.Sync()
+}
+
+// Close closes the underlying file.
+func (a *AuditLog) Close() error {
+	return a.file.Close()
+}
+
+// KeyFingerprint identifies a trusted client key in logs without revealing it.
+func KeyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Server signs price quotes for authenticated clients. It serves GET requests with the
+// query parameters token and trustedClientKey, like the hosted oracle API.
+type Server struct {
+	Key         solana.PrivateKey
+	Feed        Feed
+	TrustedKeys []string
+	Audit       *AuditLog
+	Now         func() time.Time
+	// Logger receives audit failures. When nil, slog.Default is used.
+	Logger *slog.Logger
+}
+
+func (s *Server) log() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return slog.Default()
+}
+
+func (s *Server) isTrusted(key string) bool {
+	if key == "" {
+		return false
+	}
+	trusted := false
+	for _, candidate := range s.TrustedKeys {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+			trusted = true
+		}
+	}
+	return trusted
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	clientKey := r.URL.Query().Get("trustedClientKey")
+	if !s.isTrusted(clientKey) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := ap.ParseStakeToken(r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	price, err := s.Feed.Price(r.Context(), token)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get price: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	quote, err := ap.SignPriceQuote(s.Key, price, now().Unix())
+	if err != nil {
+		http.Error(w, "Failed to sign price", http.StatusInternalServerError)
+		return
+	}
+	body := ap.NewOracleQuoteResponse(quote)
+
+	if s.Audit != nil {
+		remote, _, _ := net.SplitHostPort(r.RemoteAddr)
+		err := s.Audit.Write(AuditRecord{
+			Time:       time.Now().UTC(),
+			Remote:     remote,
+			ClientKey:  KeyFingerprint(clientKey),
+			Token:      token.String(),
+			Price:      quote.Price,
+			Timestamp:  quote.Timestamp,
+			Signature:  body.Signature,
+			OracleAuth: s.Key.PublicKey().String(),
+		})
+		if err != nil {
+			// Never hand out a quote that was not recorded.
+			s.log().Error("oracle audit log failure", "err", err)
+			http.Error(w, "Audit log unavailable", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,160 @@
+package oracle
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ap "arkham-cli/solana"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+const trustedKey = "client-secret"
+
+type failingFeed struct{}
+
+func (failingFeed) Price(ctx context.Context, token ap.StakeToken) (uint64, error) {
+	return 0, errors.New("feed down")
+}
+
+// serveOracle starts an oracle signing at a fixed time and returns its URL, key and audit
+// log path.
+func serveOracle(t *testing.T, feed Feed) (string, solana.PrivateKey, *AuditLog, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { audit.Close() })
+	key := solana.NewWallet().PrivateKey
+	srv := httptest.NewServer(&Server{
+		Key:         key,
+		Feed:        feed,
+		TrustedKeys: []string{"other-client", trustedKey},
+		Audit:       audit,
+		Now:         func() time.Time { return time.Unix(1_700_000_000, 0) },
+		Logger:      slog.New(slog.DiscardHandler),
+	})
+	t.Cleanup(srv.Close)
+	return srv.URL, key, audit, path
+}
+
+func readAudit(t *testing.T, path string) []AuditRecord {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var records []AuditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("audit line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestServerRejectsRequests(t *testing.T) {
+	base, _, _, path := serveOracle(t, StaticFeed{ap.StakeToken_Sol: 150_000_000})
+	failing, _, _, failingPath := serveOracle(t, failingFeed{})
+
+	for _, tt := range []struct {
+		name   string
+		base   string
+		method string
+		query  url.Values
+		status int
+	}{
+		{"no client key", base, http.MethodGet, url.Values{"token": {"solana"}}, http.StatusUnauthorized},
+		{"wrong client key", base, http.MethodGet, url.Values{"token": {"solana"}, "trustedClientKey": {"client"}}, http.StatusUnauthorized},
+		{"empty client key", base, http.MethodGet, url.Values{"token": {"solana"}, "trustedClientKey": {""}}, http.StatusUnauthorized},
+		{"post", base, http.MethodPost, url.Values{"token": {"solana"}, "trustedClientKey": {trustedKey}}, http.StatusMethodNotAllowed},
+		{"unknown token", base, http.MethodGet, url.Values{"token": {"doge"}, "trustedClientKey": {trustedKey}}, http.StatusBadRequest},
+		{"no price", base, http.MethodGet, url.Values{"token": {"usd-coin"}, "trustedClientKey": {trustedKey}}, http.StatusBadGateway},
+		{"feed failure", failing, http.MethodGet, url.Values{"token": {"solana"}, "trustedClientKey": {trustedKey}}, http.StatusBadGateway},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.base+"?"+tt.query.Encode(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %s, want %d", resp.Status, tt.status)
+			}
+		})
+	}
+	if records := append(readAudit(t, path), readAudit(t, failingPath)...); len(records) != 0 {
+		t.Fatalf("audited rejected requests: %+v", records)
+	}
+}
+
+func TestServerSignsAndAuditsQuotes(t *testing.T) {
+	base, key, _, path := serveOracle(t, StaticFeed{ap.StakeToken_Sol: 150_000_000})
+
+	source := ap.NewArkhamOraclePriceSource(base, trustedKey)
+	quote, err := source.Quote(context.Background(), ap.StakeToken_Sol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.Price != 150_000_000 || quote.Timestamp != 1_700_000_000 {
+		t.Fatalf("quote = %d at %d", quote.Price, quote.Timestamp)
+	}
+	signedAt := time.Unix(quote.Timestamp, 0)
+	if err := ap.VerifyPriceQuote(quote, key.PublicKey(), time.Minute, signedAt.Add(time.Second)); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if err := ap.VerifyPriceQuote(quote, solana.NewWallet().PublicKey(), time.Minute, signedAt); err == nil {
+		t.Fatal("quote verified against another oracle authority")
+	}
+
+	records := readAudit(t, path)
+	if len(records) != 1 {
+		t.Fatalf("audit log has %d records, want 1", len(records))
+	}
+	record := records[0]
+	if record.ClientKey != KeyFingerprint(trustedKey) || strings.Contains(record.ClientKey, trustedKey) {
+		t.Errorf("audited client key %q, want its fingerprint", record.ClientKey)
+	}
+	want := ap.NewOracleQuoteResponse(quote)
+	if record.Token != "Sol" || record.Price != quote.Price || record.Timestamp != quote.Timestamp ||
+		record.Signature != want.Signature || record.OracleAuth != key.PublicKey().String() {
+		t.Errorf("audit record = %+v", record)
+	}
+	if record.Remote != "127.0.0.1" {
+		t.Errorf("audited remote %q", record.Remote)
+	}
+}
+
+func TestServerWithholdsUnauditedQuotes(t *testing.T) {
+	base, _, audit, path := serveOracle(t, StaticFeed{ap.StakeToken_Sol: 150_000_000})
+	audit.Close()
+
+	_, err := ap.NewArkhamOraclePriceSource(base, trustedKey).Quote(context.Background(), ap.StakeToken_Sol)
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("quote = %v, want a 500", err)
+	}
+	if records := readAudit(t, path); len(records) != 0 {
+		t.Fatalf("audit log = %+v", records)
+	}
+}
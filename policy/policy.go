@@ -0,0 +1,602 @@
+// Package policy implements the warden exit policy: which destinations seekers may reach,
+// how much bandwidth each seeker tier gets, how many seekers may be served at once and
+// which seeker authorities are refused. The policy is a JSON file that is reloaded while
+// the node runs.
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Seeker tiers. Seekers whose tier is unknown are served as TierStandard.
+const (
+	TierStandard = "standard"
+	TierPremium  = "premium"
+)
+
+// Policy is the declarative exit policy, as read from the policy file.
+//
+//	{
+//	  "allow": [{"cidr": "0.0.0.0/0", "ports": ["80", "443", "8000-9000"]}],
+//	  "block": [{"cidr": "10.0.0.0/8"}, {"ports": ["25"]}],
+//	  "maxSessions": 64,
+//	  "denySeekers": ["<seeker authority or peer ID>"],
+//	  "tiers": {
+//	    "standard": {"maxMbPerSession": 1024, "rateKbps": 2048},
+//	    "premium":  {"rateKbps": 20480}
+//	  }
+//	}
+type Policy struct {
+	// Allow lists the destinations seekers may reach. An empty list allows everything
+	// that Block does not refuse. Internal networks are refused unless an allow rule names
+	// a network inside them.
+	Allow []Rule `json:"allow,omitempty"`
+	// Block lists destinations that are always refused. It takes precedence over Allow.
+	Block []Rule `json:"block,omitempty"`
+	// MaxSessions caps the number of seekers served at once. Zero means no limit.
+	MaxSessions int `json:"maxSessions,omitempty"`
+	// DenySeekers lists seeker authorities (or libp2p peer IDs) that are refused.
+	DenySeekers []string `json:"denySeekers,omitempty"`
+	// Tiers maps a seeker tier to its limits. A missing tier is unlimited.
+	Tiers map[string]TierLimits `json:"tiers,omitempty"`
+
+	allow []rule
+	block []rule
+}
+
+// Rule matches destinations by network and port. An empty CIDR matches every address and
+// an empty port list matches every port.
+type Rule struct {
+	CIDR  string   `json:"cidr,omitempty"`
+	Ports []string `json:"ports,omitempty"`
+}
+
+// TierLimits are the bandwidth limits of a seeker tier. Zero means no limit.
+type TierLimits struct {
+	// MaxMbPerSession caps the MB relayed for a seeker while its session is open.
+	MaxMbPerSession uint64 `json:"maxMbPerSession,omitempty"`
+	// RateKbps caps the throughput of a seeker's session, across all of its flows.
+	RateKbps uint64 `json:"rateKbps,omitempty"`
+}
+
+type rule struct {
+	network *net.IPNet
+	ports   [][2]uint16
+}
+
+// internalNetworks are refused by default, so an exit cannot be used to reach the warden's
+// own host or its private network: "this network", loopback, RFC 1918, carrier-grade NAT,
+// link-local and their IPv6 counterparts.
+var internalNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"127.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"169.254.0.0/16",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// isInternal reports whether ip is in a network the policy refuses by default.
+func isInternal(ip net.IP) bool {
+	for _, network := range internalNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// optsIn reports whether the rule names a network inside an internal one, which lets
+// seekers reach it.
+func (r rule) optsIn() bool {
+	if r.network == nil {
+		return false
+	}
+	ones, bits := r.network.Mask.Size()
+	for _, internal := range internalNetworks {
+		internalOnes, internalBits := internal.Mask.Size()
+		if bits == internalBits && ones >= internalOnes && internal.Contains(r.network.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse reads a policy from its JSON form and validates it.
+func Parse(data []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("invalid exit policy: %w", err)
+	}
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Load reads and validates the policy file at path.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exit policy: %w", err)
+	}
+	return Parse(data)
+}
+
+func (p *Policy) compile() error {
+	var err error
+	if p.allow, err = compileRules(p.Allow); err != nil {
+		return err
+	}
+	if p.block, err = compileRules(p.Block); err != nil {
+		return err
+	}
+	if p.MaxSessions < 0 {
+		return fmt.Errorf("invalid exit policy: maxSessions cannot be negative")
+	}
+	return nil
+}
+
+func compileRules(rules []Rule) ([]rule, error) {
+	compiled := make([]rule, 0, len(rules))
+	for _, r := range rules {
+		var c rule
+		if r.CIDR != "" {
+			_, network, err := net.ParseCIDR(r.CIDR)
+			if err != nil {
+				return nil, fmt.Errorf("invalid exit policy CIDR %q: %w", r.CIDR, err)
+			}
+			c.network = network
+		}
+		for _, ports := range r.Ports {
+			span, err := parsePorts(ports)
+			if err != nil {
+				return nil, err
+			}
+			c.ports = append(c.ports, span)
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// parsePorts accepts a single port ("25") or an inclusive range ("8000-9000").
+func parsePorts(s string) ([2]uint16, error) {
+	lo, hi, isRange := strings.Cut(strings.TrimSpace(s), "-")
+	first, err := strconv.ParseUint(lo, 10, 16)
+	if err != nil {
+		return [2]uint16{}, fmt.Errorf("invalid exit policy port %q", s)
+	}
+	last := first
+	if isRange {
+		if last, err = strconv.ParseUint(hi, 10, 16); err != nil || last < first {
+			return [2]uint16{}, fmt.Errorf("invalid exit policy port range %q", s)
+		}
+	}
+	return [2]uint16{uint16(first), uint16(last)}, nil
+}
+
+func (r rule) matches(ip net.IP, port uint16) bool {
+	if r.network != nil && !r.network.Contains(ip) {
+		return false
+	}
+	if len(r.ports) == 0 {
+		return true
+	}
+	for _, span := range r.ports {
+		if port >= span[0] && port <= span[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// Permits reports whether the policy lets seekers reach ip:port. The unspecified addresses
+// are never permitted: dialling them reaches the warden's own listeners.
+func (p *Policy) Permits(ip net.IP, port uint16) bool {
+	if ip.IsUnspecified() {
+		return false
+	}
+	for _, r := range p.block {
+		if r.matches(ip, port) {
+			return false
+		}
+	}
+	if isInternal(ip) {
+		for _, r := range p.allow {
+			if r.optsIn() && r.matches(ip, port) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(p.allow) == 0 {
+		return true
+	}
+	for _, r := range p.allow {
+		if r.matches(ip, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// Denies reports whether the seeker is on the deny list.
+func (p *Policy) Denies(s Seeker) bool {
+	for _, denied := range p.DenySeekers {
+		if denied == "" {
+			continue
+		}
+		if denied == s.Authority || denied == s.PeerID {
+			return true
+		}
+	}
+	return false
+}
+
+// Limits returns the limits for a seeker tier.
+func (p *Policy) Limits(tier string) TierLimits {
+	if tier == "" {
+		tier = TierStandard
+	}
+	return p.Tiers[tier]
+}
+
+// Summary is the part of a policy a warden advertises to seekers. It leaves out the deny
+// list.
+type Summary struct {
+	Allow       []Rule                `json:"allow,omitempty"`
+	Block       []Rule                `json:"block,omitempty"`
+	MaxSessions int                   `json:"maxSessions,omitempty"`
+	Tiers       map[string]TierLimits `json:"tiers,omitempty"`
+}
+
+// Summary returns the advertised part of the policy.
+func (p *Policy) Summary() Summary {
+	return Summary{Allow: p.Allow, Block: p.Block, MaxSessions: p.MaxSessions, Tiers: p.Tiers}
+}
+
+// Seeker identifies who a session is relaying for.
+type Seeker struct {
+	// PeerID is the libp2p peer the traffic arrives from.
+	PeerID string
+	// Authority is the seeker's wallet, when the seeker proved it. Empty otherwise.
+	Authority string
+	// Tier selects the bandwidth limits. Empty means TierStandard.
+	Tier string
+}
+
+func (s Seeker) key() string {
+	if s.Authority != "" {
+		return s.Authority
+	}
+	return s.PeerID
+}
+
+func (s Seeker) String() string {
+	if s.Authority != "" {
+		return s.Authority
+	}
+	return "peer " + s.PeerID
+}
+
+// Engine enforces the current policy. The zero value is not usable; use NewEngine.
+type Engine struct {
+	policy atomic.Pointer[Policy]
+
+	// Resolver looks up destination host names. It defaults to net.DefaultResolver.
+	Resolver *net.Resolver
+	// Logger receives policy reloads. When nil, slog.Default is used.
+	Logger *slog.Logger
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+
+	path    string
+	modTime time.Time
+}
+
+// NewEngine creates an engine enforcing p.
+func NewEngine(p *Policy) *Engine {
+	e := &Engine{sessions: make(map[string]*Session)}
+	e.policy.Store(p)
+	return e
+}
+
+// LoadEngine creates an engine from the policy file at path. Reload and Watch re-read it.
+func LoadEngine(path string) (*Engine, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exit policy: %w", err)
+	}
+	p, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	e := NewEngine(p)
+	e.path = path
+	e.modTime = info.ModTime()
+	return e, nil
+}
+
+// Policy returns the policy currently enforced.
+func (e *Engine) Policy() *Policy {
+	return e.policy.Load()
+}
+
+// Set replaces the enforced policy. Open sessions pick up the new limits immediately, and
+// sessions of seekers the new policy denies are cut off at their next read or write.
+func (e *Engine) Set(p *Policy) {
+	e.policy.Store(p)
+}
+
+// Reload re-reads the policy file. An invalid file leaves the current policy in place.
+func (e *Engine) Reload() error {
+	if e.path == "" {
+		return fmt.Errorf("exit policy was not loaded from a file")
+	}
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return fmt.Errorf("failed to read exit policy: %w", err)
+	}
+	p, err := Load(e.path)
+	if err != nil {
+		return err
+	}
+	e.Set(p)
+	e.mu.Lock()
+	e.modTime = info.ModTime()
+	e.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the policy file whenever it changes, checking every interval until ctx is
+// done.
+func (e *Engine) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(e.path)
+		if err != nil {
+			continue
+		}
+		e.mu.Lock()
+		changed := !info.ModTime().Equal(e.modTime)
+		e.mu.Unlock()
+		if !changed {
+			continue
+		}
+		if err := e.Reload(); err != nil {
+			e.log().Warn("keeping the previous exit policy", "path", e.path, "err", err)
+			continue
+		}
+		e.log().Info("reloaded exit policy", "path", e.path)
+	}
+}
+
+func (e *Engine) log() *slog.Logger {
+	if e.Logger != nil {
+		return e.Logger
+	}
+	return slog.Default()
+}
+
+// ResolveDestination resolves addr ("host:port") and checks it against the policy. It
+// returns an "ip:port" address to dial, so the address that was checked is the one used.
+func (e *Engine) ResolveDestination(ctx context.Context, addr string) (string, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid destination %q: %w", addr, err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return "", fmt.Errorf("invalid destination port %q", portStr)
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		resolver := e.Resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+		addrs, err := resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve %s: %w", host, err)
+		}
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+
+	p := e.Policy()
+	for _, ip := range ips {
+		if p.Permits(ip, uint16(port)) {
+			return net.JoinHostPort(ip.String(), portStr), nil
+		}
+	}
+	return "", fmt.Errorf("exit policy does not allow %s", addr)
+}
+
+// Open starts or joins the session of a seeker. Every flow relayed for the seeker holds
+// the session open until it calls Close; the seeker's limits apply across all its flows.
+func (e *Engine) Open(s Seeker) (*Session, error) {
+	p := e.Policy()
+	if p.Denies(s) {
+		return nil, fmt.Errorf("seeker %s is denied by the exit policy", s)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	session, ok := e.sessions[s.key()]
+	if !ok {
+		if p.MaxSessions > 0 && len(e.sessions) >= p.MaxSessions {
+			return nil, fmt.Errorf("warden is serving its maximum of %d sessions", p.MaxSessions)
+		}
+		session = &Session{engine: e, seeker: s, last: time.Now()}
+		e.sessions[s.key()] = session
+	}
+	session.refs++
+	return session, nil
+}
+
+// Sessions returns the number of seekers currently being served.
+func (e *Engine) Sessions() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.sessions)
+}
+
+// ErrCapReached is returned once a session has relayed its tier's MaxMbPerSession.
+var ErrCapReached = fmt.Errorf("session bandwidth cap reached")
+
+// Session tracks one seeker's usage against its tier limits.
+type Session struct {
+	engine *Engine
+	seeker Seeker
+
+	// refs and the fields below are guarded by engine.mu.
+	refs   int
+	closed bool
+	bytes  uint64
+	tokens float64
+	last   time.Time
+}
+
+// Seeker returns the seeker the session belongs to.
+func (s *Session) Seeker() Seeker { return s.seeker }
+
+// Bytes returns the bytes relayed for the seeker in this session.
+func (s *Session) Bytes() uint64 {
+	s.engine.mu.Lock()
+	defer s.engine.mu.Unlock()
+	return s.bytes
+}
+
+// Close releases this holder's reference. The session ends when the last flow closes.
+func (s *Session) Close() {
+	e := s.engine
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.refs--
+	if s.refs <= 0 {
+		s.closed = true
+		if e.sessions[s.seeker.key()] == s {
+			delete(e.sessions, s.seeker.key())
+		}
+	}
+}
+
+// Take accounts for n bytes relayed for the seeker. It returns an error once the seeker is
+// denied or over its cap, and otherwise the time to wait to stay within its rate limit.
+func (s *Session) Take(n int) (time.Duration, error) {
+	p := s.engine.Policy()
+	if p.Denies(s.seeker) {
+		return 0, fmt.Errorf("seeker %s is denied by the exit policy", s.seeker)
+	}
+	limits := p.Limits(s.seeker.Tier)
+
+	e := s.engine
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if limits.MaxMbPerSession > 0 && s.bytes+uint64(n) > limits.MaxMbPerSession*1024*1024 {
+		return 0, ErrCapReached
+	}
+	s.bytes += uint64(n)
+
+	if limits.RateKbps == 0 {
+		s.tokens = 0
+		return 0, nil
+	}
+	// Token bucket holding up to one second of traffic; it may go negative, which is the
+	// debt the caller waits off.
+	rate := float64(limits.RateKbps) * 1024 / 8
+	now := time.Now()
+	s.tokens += now.Sub(s.last).Seconds() * rate
+	if s.tokens > rate {
+		s.tokens = rate
+	}
+	s.last = now
+	s.tokens -= float64(n)
+	if s.tokens >= 0 {
+		return 0, nil
+	}
+	return time.Duration(-s.tokens / rate * float64(time.Second)), nil
+}
+
+// Conn wraps a destination connection so everything read from or written to it counts
+// against the session.
+func (s *Session) Conn(conn net.Conn) net.Conn {
+	return &sessionConn{Conn: conn, session: s}
+}
+
+type sessionConn struct {
+	net.Conn
+	session *Session
+}
+
+func (c *sessionConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		if terr := c.take(n); terr != nil {
+			c.Conn.Close()
+			return 0, terr
+		}
+	}
+	return n, err
+}
+
+func (c *sessionConn) Write(b []byte) (int, error) {
+	if err := c.take(len(b)); err != nil {
+		c.Conn.Close()
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *sessionConn) take(n int) error {
+	wait, err := c.session.Take(n)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package policy
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPermits(t *testing.T) {
+	p, err := Parse([]byte(`{
+		"allow": [{"cidr": "0.0.0.0/0", "ports": ["80", "443", "8000-9000"]}],
+		"block": [{"cidr": "10.0.0.0/8"}, {"ports": ["25"]}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		ip   string
+		port uint16
+		want bool
+	}{
+		{"93.184.216.34", 443, true},
+		{"93.184.216.34", 8500, true},
+		{"93.184.216.34", 22, false},
+		{"10.1.2.3", 443, false},
+		{"93.184.216.34", 25, false},
+		{"2001:db8::1", 443, false},
+	}
+	for _, c := range cases {
+		if got := p.Permits(net.ParseIP(c.ip), c.port); got != c.want {
+			t.Errorf("Permits(%s, %d) = %v, want %v", c.ip, c.port, got, c.want)
+		}
+	}
+}
+
+func TestPermitsRefusesInternalNetworksByDefault(t *testing.T) {
+	open, err := Parse([]byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	optedIn, err := Parse([]byte(`{
+		"allow": [
+			{"cidr": "0.0.0.0/0"},
+			{"cidr": "192.168.1.0/24", "ports": ["8080"]},
+			{"cidr": "127.0.0.1/32"},
+			{"cidr": "fd00::/8"}
+		],
+		"block": [{"cidr": "127.0.0.1/32", "ports": ["22"]}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		ip            string
+		port          uint16
+		open, optedIn bool
+	}{
+		{"93.184.216.34", 443, true, true},
+		{"127.0.0.1", 80, false, true},
+		{"127.0.0.1", 22, false, false},
+		{"127.0.0.2", 80, false, false},
+		{"10.1.2.3", 443, false, false},
+		{"172.16.0.1", 443, false, false},
+		{"172.32.0.1", 443, true, true},
+		{"192.168.1.5", 8080, false, true},
+		{"192.168.1.5", 80, false, false},
+		{"192.168.2.5", 8080, false, false},
+		{"169.254.169.254", 80, false, false},
+		{"::ffff:169.254.169.254", 80, false, false},
+		{"::1", 80, false, false},
+		{"fe80::1", 80, false, false},
+		{"fd12::1", 80, false, true},
+		{"2001:db8::1", 443, true, false},
+		{"0.0.0.0", 80, false, false},
+		{"0.1.2.3", 80, false, false},
+		{"::", 80, false, false},
+		{"::ffff:0.0.0.0", 80, false, false},
+		{"100.64.0.1", 443, false, false},
+		{"100.127.255.254", 443, false, false},
+		{"100.128.0.1", 443, true, true},
+	}
+	for _, c := range cases {
+		ip := net.ParseIP(c.ip)
+		if got := open.Permits(ip, c.port); got != c.open {
+			t.Errorf("empty policy: Permits(%s, %d) = %v, want %v", c.ip, c.port, got, c.open)
+		}
+		if got := optedIn.Permits(ip, c.port); got != c.optedIn {
+			t.Errorf("opted-in policy: Permits(%s, %d) = %v, want %v", c.ip, c.port, got, c.optedIn)
+		}
+	}
+}
+
+func TestResolveDestinationRefusesUnspecifiedAddresses(t *testing.T) {
+	// Even a policy that opts into "this network" cannot reach the warden's listeners
+	// through the unspecified address.
+	p, err := Parse([]byte(`{"allow": [{"cidr": "0.0.0.0/8"}, {"cidr": "::/128"}, {"cidr": "100.64.0.0/10"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(p)
+	for _, addr := range []string{"0.0.0.0:80", "[::]:80", "[::ffff:0.0.0.0]:80"} {
+		if resolved, err := e.ResolveDestination(context.Background(), addr); err == nil {
+			t.Errorf("ResolveDestination(%s) = %s, want an error", addr, resolved)
+		}
+	}
+	if _, err := e.ResolveDestination(context.Background(), "100.64.0.1:80"); err != nil {
+		t.Errorf("opted-in CGNAT address refused: %v", err)
+	}
+	if _, err := NewEngine(&Policy{}).ResolveDestination(context.Background(), "100.64.0.1:80"); err == nil {
+		t.Error("CGNAT address permitted by an empty policy")
+	}
+}
+
+func TestParseRejectsBadRules(t *testing.T) {
+	for _, doc := range []string{
+		`{"allow": [{"cidr": "not-a-cidr"}]}`,
+		`{"block": [{"ports": ["70000"]}]}`,
+		`{"block": [{"ports": ["90-80"]}]}`,
+		`{"maxSessions": -1}`,
+	} {
+		if _, err := Parse([]byte(doc)); err == nil {
+			t.Errorf("expected %s to be rejected", doc)
+		}
+	}
+}
+
+func TestOpenEnforcesDenyListAndSessionLimit(t *testing.T) {
+	p, err := Parse([]byte(`{"maxSessions": 1, "denySeekers": ["BadSeeker"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(p)
+
+	if _, err := e.Open(Seeker{PeerID: "peer-a", Authority: "BadSeeker"}); err == nil {
+		t.Fatal("expected a denied seeker to be refused")
+	}
+
+	first, err := e.Open(Seeker{PeerID: "peer-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A second flow of the same seeker joins its session.
+	again, err := e.Open(Seeker{PeerID: "peer-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Open(Seeker{PeerID: "peer-b"}); err == nil {
+		t.Fatal("expected the session limit to refuse a second seeker")
+	}
+
+	first.Close()
+	again.Close()
+	if e.Sessions() != 0 {
+		t.Fatalf("expected no open sessions, got %d", e.Sessions())
+	}
+	if _, err := e.Open(Seeker{PeerID: "peer-b"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTakeEnforcesTierCap(t *testing.T) {
+	p, err := Parse([]byte(`{"tiers": {"standard": {"maxMbPerSession": 1}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(p)
+
+	standard, _ := e.Open(Seeker{PeerID: "peer-a"})
+	if _, err := standard.Take(1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := standard.Take(1); err != ErrCapReached {
+		t.Fatalf("expected ErrCapReached, got %v", err)
+	}
+
+	premium, _ := e.Open(Seeker{PeerID: "peer-b", Tier: TierPremium})
+	if _, err := premium.Take(2 * 1024 * 1024); err != nil {
+		t.Fatalf("premium tier has no cap: %v", err)
+	}
+}
+
+func TestTakeEnforcesRateLimit(t *testing.T) {
+	p, err := Parse([]byte(`{"tiers": {"standard": {"rateKbps": 8}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, _ := NewEngine(p).Open(Seeker{PeerID: "peer-a"})
+
+	// 8 kbps is 1024 bytes per second; the bucket starts empty.
+	wait, err := session.Take(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait < 400*time.Millisecond || wait > 600*time.Millisecond {
+		t.Fatalf("expected to wait about half a second, got %s", wait)
+	}
+}
+
+func TestReloadAppliesToOpenSessions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exit-policy.json")
+	if err := os.WriteFile(path, []byte(`{}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	e, err := LoadEngine(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := e.Open(Seeker{PeerID: "peer-a", Authority: "Seeker1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"block": [{"ports": ["25"]}], "denySeekers": ["Seeker1"]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.Take(1); err == nil {
+		t.Fatal("expected a newly denied seeker to be cut off")
+	}
+	if _, err := e.ResolveDestination(context.Background(), "127.0.0.1:25"); err == nil {
+		t.Fatal("expected port 25 to be blocked after reload")
+	}
+
+	// A broken file keeps the previous policy.
+	if err := os.WriteFile(path, []byte(`{`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Reload(); err == nil {
+		t.Fatal("expected an invalid policy to be rejected")
+	}
+	if len(e.Policy().DenySeekers) != 1 {
+		t.Fatal("expected the previous policy to stay in place")
+	}
+}
@@ -0,0 +1,141 @@
+// Package pricing computes connection cost quotes from the on-chain ProtocolConfig and a
+// Warden account, using the same integer arithmetic as the Arkham program.
+package pricing
+
+import (
+	"fmt"
+	"math/big"
+
+	ap "arkham-cli/solana"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// BpsDenominator is the basis-point scale used by all protocol rates.
+const BpsDenominator = 10_000
+
+// EscrowBufferBps is the buffer start_connection reserves on top of the estimated cost.
+const EscrowBufferBps = 1_000
+
+// MbPerGb is the number of megabytes the protocol bills per gigabyte.
+const MbPerGb = 1024
+
+// Quote is the cost of a connection to one warden. All amounts are in lamports.
+type Quote struct {
+	Warden            solana.PublicKey `json:"warden"`
+	RegionCode        uint8            `json:"regionCode"`
+	Tier              ap.Tier          `json:"tier"`
+	BaseRatePerMb     uint64           `json:"baseRatePerMb"`
+	GeoPremiumBps     uint16           `json:"geoPremiumBps"`
+	TierMultiplierBps uint16           `json:"tierMultiplierBps"`
+	RatePerMb         uint64           `json:"ratePerMb"`
+	Mb                uint64           `json:"mb"`
+	Cost              uint64           `json:"cost"`
+	ProtocolFeeBps    uint16           `json:"protocolFeeBps"`
+	ProtocolFee       uint64           `json:"protocolFee"`
+	WardenEarnings    uint64           `json:"wardenEarnings"`
+	EscrowRequired    uint64           `json:"escrowRequired"`
+}
+
+// GeoPremiumBps returns the premium for a region, or zero if it has none.
+func GeoPremiumBps(config *ap.ProtocolConfig, regionCode uint8) uint16 {
+	for _, premium := range config.GeoPremiums {
+		if premium.RegionCode == regionCode {
+			return premium.PremiumBps
+		}
+	}
+	return 0
+}
+
+// TierMultiplierBps returns the rate multiplier of a warden tier.
+func TierMultiplierBps(config *ap.ProtocolConfig, tier ap.Tier) uint16 {
+	if int(tier) >= len(config.TierMultipliers) {
+		return 0
+	}
+	return config.TierMultipliers[tier]
+}
+
+// RatePerMb is the warden's effective rate in lamports per MB:
+// base_rate * (10000 + geo_premium) / 10000 * tier_multiplier / 10000.
+func RatePerMb(config *ap.ProtocolConfig, warden *ap.Warden) (uint64, error) {
+	rate := new(big.Int).SetUint64(config.BaseRatePerMb)
+	rate.Mul(rate, big.NewInt(BpsDenominator+int64(GeoPremiumBps(config, warden.RegionCode))))
+	rate.Quo(rate, big.NewInt(BpsDenominator))
+	rate.Mul(rate, big.NewInt(int64(TierMultiplierBps(config, warden.Tier))))
+	rate.Quo(rate, big.NewInt(BpsDenominator))
+	return toUint64(rate, "rate per MB")
+}
+
+// QuoteConnection prices mb megabytes served by warden, including the protocol fee split
+// and the escrow that start_connection will require.
+func QuoteConnection(config *ap.ProtocolConfig, warden *ap.Warden, mb uint64) (*Quote, error) {
+	rate, err := RatePerMb(config, warden)
+	if err != nil {
+		return nil, err
+	}
+
+	cost, err := toUint64(new(big.Int).Mul(new(big.Int).SetUint64(rate), new(big.Int).SetUint64(mb)), "cost")
+	if err != nil {
+		return nil, err
+	}
+	fee := bps(cost, config.ProtocolFeeBps)
+	escrow, err := toUint64(new(big.Int).Add(new(big.Int).SetUint64(cost), new(big.Int).SetUint64(bps(cost, EscrowBufferBps))), "escrow")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Quote{
+		Warden:            warden.Authority,
+		RegionCode:        warden.RegionCode,
+		Tier:              warden.Tier,
+		BaseRatePerMb:     config.BaseRatePerMb,
+		GeoPremiumBps:     GeoPremiumBps(config, warden.RegionCode),
+		TierMultiplierBps: TierMultiplierBps(config, warden.Tier),
+		RatePerMb:         rate,
+		Mb:                mb,
+		Cost:              cost,
+		ProtocolFeeBps:    config.ProtocolFeeBps,
+		ProtocolFee:       fee,
+		WardenEarnings:    cost - fee,
+		EscrowRequired:    escrow,
+	}, nil
+}
+
+// AffordableMb is the largest number of MB whose escrow requirement fits in budget lamports.
+func AffordableMb(config *ap.ProtocolConfig, warden *ap.Warden, budget uint64) (uint64, error) {
+	rate, err := RatePerMb(config, warden)
+	if err != nil {
+		return 0, err
+	}
+	if rate == 0 {
+		return 0, fmt.Errorf("warden has a zero rate")
+	}
+	// The escrow for a cost c is c + floor(c * buffer / 10000) = floor(c * (10000 + buffer) / 10000),
+	// which fits in budget exactly when c * (10000 + buffer) < (budget + 1) * 10000.
+	maxCost := new(big.Int).SetUint64(budget)
+	maxCost.Add(maxCost, big.NewInt(1))
+	maxCost.Mul(maxCost, big.NewInt(BpsDenominator))
+	maxCost.Sub(maxCost, big.NewInt(1))
+	maxCost.Quo(maxCost, big.NewInt(BpsDenominator+EscrowBufferBps))
+	return maxCost.Quo(maxCost, new(big.Int).SetUint64(rate)).Uint64(), nil
+}
+
+// PricePerGbUSD converts a rate in lamports per MB to USD per GB at solPriceUSD. It is for
+// display only.
+func PricePerGbUSD(ratePerMb uint64, solPriceUSD float64) float64 {
+	return float64(ratePerMb) * MbPerGb / float64(solana.LAMPORTS_PER_SOL) * solPriceUSD
+}
+
+func bps(amount uint64, basisPoints uint16) uint64 {
+	v := new(big.Int).SetUint64(amount)
+	v.Mul(v, big.NewInt(int64(basisPoints)))
+	v.Quo(v, big.NewInt(BpsDenominator))
+	return v.Uint64()
+}
+
+func toUint64(v *big.Int, what string) (uint64, error) {
+	if !v.IsUint64() {
+		return 0, fmt.Errorf("%s overflows u64", what)
+	}
+	return v.Uint64(), nil
+}
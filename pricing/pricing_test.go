@@ -0,0 +1,132 @@
+package pricing
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	ap "arkham-cli/solana"
+)
+
+func testConfig() *ap.ProtocolConfig {
+	return &ap.ProtocolConfig{
+		BaseRatePerMb:   1000,
+		ProtocolFeeBps:  1000,
+		TierMultipliers: [3]uint16{10_000, 15_000, 20_000},
+		GeoPremiums:     []ap.GeoPremium{{RegionCode: 1, PremiumBps: 2500}},
+	}
+}
+
+func TestRatePerMb(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		base   uint64
+		region uint8
+		tier   ap.Tier
+		want   uint64
+		err    string
+	}{
+		{"bronze without premium", 1000, 0, ap.Tier_Bronze, 1000, ""},
+		{"silver with premium", 1000, 1, ap.Tier_Silver, 1875, ""},
+		{"gold with premium", 1000, 1, ap.Tier_Gold, 2500, ""},
+		// 7 * 1.25 = 8.75 rounds down to 8 before the tier applies: 8 * 1.5 = 12, not 13.
+		{"rounds down after each step", 7, 1, ap.Tier_Silver, 12, ""},
+		{"zero base rate", 0, 1, ap.Tier_Gold, 0, ""},
+		{"unknown tier", 1000, 0, ap.Tier(3), 0, ""},
+		{"overflow", math.MaxUint64, 1, ap.Tier_Gold, 0, "rate per MB overflows u64"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig()
+			config.BaseRatePerMb = tt.base
+			rate, err := RatePerMb(config, &ap.Warden{RegionCode: tt.region, Tier: tt.tier})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil || rate != tt.want {
+				t.Fatalf("rate = %d, %v, want %d", rate, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuoteConnection(t *testing.T) {
+	silver := &ap.Warden{RegionCode: 1, Tier: ap.Tier_Silver}
+	for _, tt := range []struct {
+		name   string
+		base   uint64
+		mb     uint64
+		cost   uint64
+		fee    uint64
+		escrow uint64
+		err    string
+	}{
+		{"even split", 1000, 100, 187_500, 18_750, 206_250, ""},
+		// A cost of 1875 makes a fee of 187.5 and a buffer of 187.5; both round down.
+		{"fee rounds down", 1000, 1, 1875, 187, 2062, ""},
+		{"zero MB", 1000, 0, 0, 0, 0, ""},
+		{"cost overflow", 1000, math.MaxUint64, 0, 0, 0, "cost overflows u64"},
+		{"escrow overflow", 8, math.MaxUint64 / 15, 0, 0, 0, "escrow overflows u64"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig()
+			config.BaseRatePerMb = tt.base
+			quote, err := QuoteConnection(config, silver, tt.mb)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if quote.Cost != tt.cost || quote.ProtocolFee != tt.fee || quote.EscrowRequired != tt.escrow {
+				t.Fatalf("quote = %+v, want cost %d, fee %d, escrow %d", quote, tt.cost, tt.fee, tt.escrow)
+			}
+			if quote.ProtocolFee+quote.WardenEarnings != quote.Cost {
+				t.Fatalf("fee %d and earnings %d do not add up to the cost %d", quote.ProtocolFee, quote.WardenEarnings, quote.Cost)
+			}
+			if quote.GeoPremiumBps != 2500 || quote.TierMultiplierBps != 15_000 || quote.Mb != tt.mb {
+				t.Fatalf("quote = %+v", quote)
+			}
+		})
+	}
+}
+
+func TestAffordableMb(t *testing.T) {
+	silver := &ap.Warden{RegionCode: 1, Tier: ap.Tier_Silver}
+	for _, tt := range []struct {
+		name   string
+		budget uint64
+		want   uint64
+	}{
+		{"exact escrow", 206_250, 100},
+		{"one lamport short", 206_249, 99},
+		{"escrow buffer rounding", 4124, 1}, // two MB need 3750 + 375 = 4125
+		{"below one MB", 2061, 0},
+		{"zero budget", 0, 0},
+		{"largest budget", math.MaxUint64, 8_943_875_914_525_843},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mb, err := AffordableMb(testConfig(), silver, tt.budget)
+			if err != nil || mb != tt.want {
+				t.Fatalf("affordable = %d, %v, want %d", mb, err, tt.want)
+			}
+			if quote, err := QuoteConnection(testConfig(), silver, mb); err != nil || quote.EscrowRequired > tt.budget {
+				t.Fatalf("escrow for %d MB exceeds the budget: %+v, %v", mb, quote, err)
+			}
+			if quote, err := QuoteConnection(testConfig(), silver, mb+1); err == nil && quote.EscrowRequired <= tt.budget {
+				t.Fatalf("%d MB also fit in the budget", mb+1)
+			}
+		})
+	}
+
+	config := testConfig()
+	config.BaseRatePerMb = 0
+	if _, err := AffordableMb(config, silver, 1000); err == nil {
+		t.Fatal("a zero rate was affordable")
+	}
+}
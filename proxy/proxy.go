@@ -0,0 +1,285 @@
+// Package proxy implements a local SOCKS5 and HTTP CONNECT proxy front-end. Each accepted
+// flow is handed to a DialFunc, which carries it to a warden over libp2p.
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DialFunc opens a connection to addr ("host:port") through the tunnel.
+type DialFunc func(ctx context.Context, addr string) (net.Conn, error)
+
+// DialTimeout bounds how long a flow may take to be established.
+const DialTimeout = 30 * time.Second
+
+const (
+	socks5Version = 0x05
+
+	socksAuthNone         = 0x00
+	socksAuthUnacceptable = 0xff
+
+	socksCmdConnect = 0x01
+
+	socksAtypIPv4   = 0x01
+	socksAtypDomain = 0x03
+	socksAtypIPv6   = 0x04
+
+	socksReplySucceeded          = 0x00
+	socksReplyGeneralFailure     = 0x01
+	socksReplyHostUnreachable    = 0x04
+	socksReplyCommandUnsupported = 0x07
+	socksReplyAddressUnsupported = 0x08
+)
+
+// Server accepts SOCKS5 and HTTP CONNECT clients on the same listener.
+type Server struct {
+	Dial DialFunc
+	// Logger receives failed client requests. When nil, slog.Default is used.
+	Logger *slog.Logger
+
+	bytesSent     atomic.Uint64
+	bytesReceived atomic.Uint64
+
+	mu       sync.Mutex
+	listener net.Listener
+}
+
+// ListenAndServe listens on addr and serves until Close is called.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until it is closed.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// Close stops accepting new flows. Flows already established keep running.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// BytesSent is the number of payload bytes sent to the tunnel.
+func (s *Server) BytesSent() uint64 { return s.bytesSent.Load() }
+
+// BytesReceived is the number of payload bytes received from the tunnel.
+func (s *Server) BytesReceived() uint64 { return s.bytesReceived.Load() }
+
+// BytesTransferred is the total payload in both directions.
+func (s *Server) BytesTransferred() uint64 { return s.BytesSent() + s.BytesReceived() }
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(DialTimeout))
+
+	reader := bufio.NewReader(conn)
+	first, err := reader.Peek(1)
+	if err != nil {
+		return
+	}
+
+	var upstream net.Conn
+	if first[0] == socks5Version {
+		upstream, err = s.handleSocks5(conn, reader)
+	} else {
+		upstream, err = s.handleConnect(conn, reader)
+	}
+	if err != nil {
+		s.log().Info("proxy request failed", "client", conn.RemoteAddr(), "err", err)
+		return
+	}
+	defer upstream.Close()
+
+	conn.SetDeadline(time.Time{})
+	s.pipe(conn, reader, upstream)
+}
+
+func (s *Server) log() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return slog.Default()
+}
+
+func (s *Server) dial(addr string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DialTimeout)
+	defer cancel()
+	return s.Dial(ctx, addr)
+}
+
+func (s *Server) handleSocks5(conn net.Conn, reader *bufio.Reader) (net.Conn, error) {
+	// Greeting: VER NMETHODS METHODS...
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(reader, methods); err != nil {
+		return nil, err
+	}
+	noAuth := false
+	for _, m := range methods {
+		if m == socksAuthNone {
+			noAuth = true
+		}
+	}
+	if !noAuth {
+		conn.Write([]byte{socks5Version, socksAuthUnacceptable})
+		return nil, fmt.Errorf("socks5 client does not support unauthenticated access")
+	}
+	if _, err := conn.Write([]byte{socks5Version, socksAuthNone}); err != nil {
+		return nil, err
+	}
+
+	// Request: VER CMD RSV ATYP DST.ADDR DST.PORT
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(reader, request); err != nil {
+		return nil, err
+	}
+	if request[1] != socksCmdConnect {
+		writeSocksReply(conn, socksReplyCommandUnsupported)
+		return nil, fmt.Errorf("unsupported socks5 command %d", request[1])
+	}
+
+	var host string
+	switch request[3] {
+	case socksAtypIPv4, socksAtypIPv6:
+		size := net.IPv4len
+		if request[3] == socksAtypIPv6 {
+			size = net.IPv6len
+		}
+		ip := make([]byte, size)
+		if _, err := io.ReadFull(reader, ip); err != nil {
+			return nil, err
+		}
+		host = net.IP(ip).String()
+	case socksAtypDomain:
+		length, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		domain := make([]byte, length)
+		if _, err := io.ReadFull(reader, domain); err != nil {
+			return nil, err
+		}
+		host = string(domain)
+	default:
+		writeSocksReply(conn, socksReplyAddressUnsupported)
+		return nil, fmt.Errorf("unsupported socks5 address type %d", request[3])
+	}
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(reader, portBytes); err != nil {
+		return nil, err
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(portBytes))))
+
+	upstream, err := s.dial(addr)
+	if err != nil {
+		writeSocksReply(conn, socksReplyHostUnreachable)
+		return nil, fmt.Errorf("failed to open %s: %w", addr, err)
+	}
+	if err := writeSocksReply(conn, socksReplySucceeded); err != nil {
+		upstream.Close()
+		return nil, err
+	}
+	return upstream, nil
+}
+
+func writeSocksReply(conn net.Conn, reply byte) error {
+	// The bound address is not meaningful for a tunnelled flow, so report 0.0.0.0:0.
+	_, err := conn.Write([]byte{socks5Version, reply, 0x00, socksAtypIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+func (s *Server) handleConnect(conn net.Conn, reader *bufio.Reader) (net.Conn, error) {
+	req, err := http.ReadRequest(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read proxy request: %w", err)
+	}
+	if req.Method != http.MethodConnect {
+		io.WriteString(conn, "HTTP/1.1 405 Method Not Allowed\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+		return nil, fmt.Errorf("unsupported proxy method %s", req.Method)
+	}
+
+	upstream, err := s.dial(req.Host)
+	if err != nil {
+		io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+		return nil, fmt.Errorf("failed to open %s: %w", req.Host, err)
+	}
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		upstream.Close()
+		return nil, err
+	}
+	return upstream, nil
+}
+
+// pipe copies data both ways until either side is done, counting the payload.
+func (s *Server) pipe(conn net.Conn, reader io.Reader, upstream net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		Copy(upstream, reader, &s.bytesSent)
+		done <- struct{}{}
+	}()
+	go func() {
+		Copy(conn, upstream, &s.bytesReceived)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// Copy copies src to dst like io.Copy, adding the bytes written to counter as it goes.
+func Copy(dst io.Writer, src io.Reader, counter *atomic.Uint64) (int64, error) {
+	buf := make([]byte, 32*1024)
+	var total int64
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			written, werr := dst.Write(buf[:n])
+			total += int64(written)
+			counter.Add(uint64(written))
+			if werr != nil {
+				return total, werr
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return total, nil
+			}
+			return total, err
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Package selection ranks wardens for a seeker by price, reputation, uptime, load and
+// measured link quality.
+package selection
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"arkham-cli/geo"
+	"arkham-cli/pricing"
+	ap "arkham-cli/solana"
+)
+
+// Score weights. They sum to 1, so a score is always between 0 and 1.
+const (
+	WeightPrice      = 0.35
+	WeightReputation = 0.30
+	WeightUptime     = 0.10
+	WeightLatency    = 0.15
+	WeightLoad       = 0.10
+)
+
+// LatencyReference is the latency at which the latency score of a lossless link drops to
+// one half.
+const LatencyReference = 100 * time.Millisecond
+
+// JitterWeight is how many times a link's jitter is added to its round trip to get the
+// latency it is scored on.
+const JitterWeight = 2
+
+// UnknownLatencyScore is used for wardens that could not be pinged. It ranks them below any
+// reachable warden with a sub-second latency without excluding them outright.
+const UnknownLatencyScore = 0.1
+
+// Regions maps the on-chain region codes to the names accepted by --region.
+var Regions = geo.Regions
+
+// ParseRegion accepts a region name ("eu") or a numeric region code ("1").
+func ParseRegion(s string) (uint8, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for code, name := range Regions {
+		if name == s {
+			return code, nil
+		}
+	}
+	code, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("unknown region %q", s)
+	}
+	return uint8(code), nil
+}
+
+// RegionName returns the display name of a region code.
+func RegionName(code uint8) string {
+	if name, ok := Regions[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("region-%d", code)
+}
+
+// Criteria filters the wardens that may be selected. Zero values disable a filter.
+type Criteria struct {
+	Region *uint8
+	// MaxRatePerMb is the highest acceptable rate in lamports per MB.
+	MaxRatePerMb uint64
+	// MinReputation is the lowest acceptable reputation on the 0-5 scale shown in the GUI.
+	MinReputation float64
+}
+
+// Quality is the link quality measured to a warden's peer.
+type Quality struct {
+	RTT    time.Duration
+	Jitter time.Duration
+	// Loss is the share of pings that went unanswered, from 0 to 1.
+	Loss float64
+}
+
+// QualityFunc returns the link quality measured to a warden's peer ID, if the peer ever
+// answered a ping.
+type QualityFunc func(peerID string) (Quality, bool)
+
+// Candidate is a warden that passed the criteria, with its score broken down.
+type Candidate struct {
+	Warden     *ap.Warden
+	RatePerMb  uint64
+	Quality    Quality
+	HasQuality bool
+
+	PriceScore      float64
+	ReputationScore float64
+	UptimeScore     float64
+	LatencyScore    float64
+	LoadScore       float64
+	Score           float64
+}
+
+// Reputation returns the warden's reputation on the 0-5 scale.
+func Reputation(warden *ap.Warden) float64 {
+	return float64(warden.ReputationScore) / 2000.0
+}
+
+// Rank filters wardens by criteria and orders them best first.
+//
+// Each component is normalised to [0, 1]:
+//   - price:      cheapest eligible rate / warden rate
+//   - reputation: ReputationScore / 10000
+//   - uptime:     UptimePercentage / 10000
+//   - latency:    (1 - loss) / (1 + (rtt + JitterWeight × jitter) / LatencyReference),
+//     UnknownLatencyScore if never measured
+//   - load:       1 / (1 + ActiveConnections)
+//
+// and the score is their weighted sum using the Weight constants. Ties are broken by the
+// lower rate. Wardens that have requested to unstake are never selected.
+func Rank(config *ap.ProtocolConfig, wardens []*ap.Warden, criteria Criteria, quality QualityFunc) []*Candidate {
+	candidates := make([]*Candidate, 0, len(wardens))
+	var minRate uint64
+	for _, warden := range wardens {
+		if warden.UnstakeRequestedAt != nil {
+			continue
+		}
+		if criteria.Region != nil && warden.RegionCode != *criteria.Region {
+			continue
+		}
+		if Reputation(warden) < criteria.MinReputation {
+			continue
+		}
+		rate, err := pricing.RatePerMb(config, warden)
+		if err != nil || rate == 0 {
+			continue
+		}
+		if criteria.MaxRatePerMb > 0 && rate > criteria.MaxRatePerMb {
+			continue
+		}
+		if minRate == 0 || rate < minRate {
+			minRate = rate
+		}
+
+		candidate := &Candidate{Warden: warden, RatePerMb: rate}
+		if quality != nil {
+			candidate.Quality, candidate.HasQuality = quality(warden.PeerId)
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	for _, c := range candidates {
+		c.PriceScore = float64(minRate) / float64(c.RatePerMb)
+		c.ReputationScore = clamp(float64(c.Warden.ReputationScore) / 10000.0)
+		c.UptimeScore = clamp(float64(c.Warden.UptimePercentage) / 10000.0)
+		c.LatencyScore = UnknownLatencyScore
+		if c.HasQuality {
+			latency := c.Quality.RTT + JitterWeight*c.Quality.Jitter
+			c.LatencyScore = clamp(1-c.Quality.Loss) / (1 + float64(latency)/float64(LatencyReference))
+		}
+		c.LoadScore = 1 / (1 + float64(c.Warden.ActiveConnections))
+		c.Score = WeightPrice*c.PriceScore +
+			WeightReputation*c.ReputationScore +
+			WeightUptime*c.UptimeScore +
+			WeightLatency*c.LatencyScore +
+			WeightLoad*c.LoadScore
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].RatePerMb < candidates[j].RatePerMb
+	})
+	return candidates
+}
+
+// Explain describes why a candidate scored the way it did.
+func (c *Candidate) Explain() string {
+	latency := "unreachable"
+	if c.HasQuality {
+		latency = fmt.Sprintf("%s ±%s, %.0f%% loss",
+			c.Quality.RTT.Round(time.Millisecond), c.Quality.Jitter.Round(time.Millisecond), c.Quality.Loss*100)
+	}
+	return fmt.Sprintf(
+		"score %.3f = price %.2f×%.2f + reputation %.2f×%.2f + uptime %.2f×%.2f + latency %.2f×%.2f + load %.2f×%.2f "+
+			"(%d lamports/MB, %.1f★, latency %s, %s, %d active connections)",
+		c.Score,
+		c.PriceScore, WeightPrice,
+		c.ReputationScore, WeightReputation,
+		c.UptimeScore, WeightUptime,
+		c.LatencyScore, WeightLatency,
+		c.LoadScore, WeightLoad,
+		c.RatePerMb, Reputation(c.Warden), latency, RegionName(c.Warden.RegionCode), c.Warden.ActiveConnections,
+	)
+}
+
+// Connect tries the candidates in order and returns the first one for which try succeeds.
+// onFailure, if set, is told about each candidate that was skipped.
+func Connect(candidates []*Candidate, try func(*Candidate) error, onFailure func(*Candidate, error)) (*Candidate, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no warden matches the selection criteria")
+	}
+	var lastErr error
+	for _, c := range candidates {
+		if err := try(c); err != nil {
+			lastErr = err
+			if onFailure != nil {
+				onFailure(c, err)
+			}
+			continue
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("all %d candidate wardens failed, last error: %w", len(candidates), lastErr)
+}
+
+func clamp(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
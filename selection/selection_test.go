@@ -0,0 +1,202 @@
+package selection
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	ap "arkham-cli/solana"
+)
+
+func testConfig() *ap.ProtocolConfig {
+	return &ap.ProtocolConfig{
+		BaseRatePerMb:   1000,
+		TierMultipliers: [3]uint16{10_000, 15_000, 20_000},
+		GeoPremiums:     []ap.GeoPremium{{RegionCode: 1, PremiumBps: 2500}},
+	}
+}
+
+// warden returns a bronze warden in region 0 with a perfect record and no connections.
+func warden(peerID string) *ap.Warden {
+	return &ap.Warden{PeerId: peerID, ReputationScore: 10_000, UptimePercentage: 10_000}
+}
+
+func peerIDs(candidates []*Candidate) string {
+	ids := make([]string, len(candidates))
+	for i, c := range candidates {
+		ids[i] = c.Warden.PeerId
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestRankScoresAndOrders(t *testing.T) {
+	cheap := warden("cheap")
+	gold := warden("gold")
+	gold.Tier = ap.Tier_Gold
+	busy := warden("busy")
+	busy.ActiveConnections = 3
+	unreliable := warden("unreliable")
+	unreliable.ReputationScore = 2000
+	unreliable.UptimePercentage = 5000
+
+	candidates := Rank(testConfig(), []*ap.Warden{unreliable, gold, busy, cheap}, Criteria{}, nil)
+	if got := peerIDs(candidates); got != "cheap,busy,gold,unreliable" {
+		t.Fatalf("order = %s", got)
+	}
+
+	for _, c := range candidates {
+		want := WeightPrice*c.PriceScore + WeightReputation*c.ReputationScore + WeightUptime*c.UptimeScore +
+			WeightLatency*c.LatencyScore + WeightLoad*c.LoadScore
+		if math.Abs(c.Score-want) > 1e-12 || c.Score < 0 || c.Score > 1 {
+			t.Errorf("%s: score %v, want %v", c.Warden.PeerId, c.Score, want)
+		}
+	}
+	g := candidates[2]
+	if g.RatePerMb != 2000 || g.PriceScore != 0.5 {
+		t.Errorf("gold: rate %d, price score %v, want 2000, 0.5", g.RatePerMb, g.PriceScore)
+	}
+	b := candidates[1]
+	if b.LoadScore != 0.25 {
+		t.Errorf("busy: load score %v, want 0.25", b.LoadScore)
+	}
+	u := candidates[3]
+	if u.ReputationScore != 0.2 || u.UptimeScore != 0.5 {
+		t.Errorf("unreliable: reputation %v, uptime %v, want 0.2, 0.5", u.ReputationScore, u.UptimeScore)
+	}
+}
+
+func TestRankBreaksTiesByRate(t *testing.T) {
+	// The gold warden costs twice as much, which its better record makes up for exactly:
+	// 0.35 × 0.5 = 0.30 × 0.5 + 0.10 × 0.25.
+	pricey := warden("pricey")
+	pricey.Tier = ap.Tier_Gold
+	cheap := warden("cheap")
+	cheap.ReputationScore = 5000
+	cheap.UptimePercentage = 7500
+
+	candidates := Rank(testConfig(), []*ap.Warden{pricey, cheap}, Criteria{}, nil)
+	if candidates[0].Score != candidates[1].Score {
+		t.Fatalf("scores %v and %v are not tied", candidates[0].Score, candidates[1].Score)
+	}
+	if got := peerIDs(candidates); got != "cheap,pricey" {
+		t.Fatalf("order = %s, want the cheaper warden first", got)
+	}
+}
+
+func TestRankExcludesWardens(t *testing.T) {
+	requested := int64(1)
+	unstaking := warden("unstaking")
+	unstaking.UnstakeRequestedAt = &requested
+	europe := warden("europe")
+	europe.RegionCode = 1
+	disreputable := warden("disreputable")
+	disreputable.ReputationScore = 5000
+	expensive := warden("expensive")
+	expensive.Tier = ap.Tier_Gold
+	unpriced := warden("unpriced")
+	unpriced.Tier = ap.Tier(3)
+	wardens := []*ap.Warden{unstaking, europe, disreputable, expensive, unpriced, warden("ok")}
+
+	region := uint8(0)
+	for _, tt := range []struct {
+		name     string
+		criteria Criteria
+		want     string
+	}{
+		{"no criteria", Criteria{}, "ok,europe,disreputable,expensive"},
+		{"region", Criteria{Region: &region}, "ok,disreputable,expensive"},
+		{"max rate", Criteria{MaxRatePerMb: 1250}, "ok,europe,disreputable"},
+		{"min reputation", Criteria{MinReputation: 4}, "ok,europe,expensive"},
+		{"nothing matches", Criteria{MaxRatePerMb: 999}, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := peerIDs(Rank(testConfig(), wardens, tt.criteria, nil)); got != tt.want {
+				t.Fatalf("selected %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRankScoresLinkQuality(t *testing.T) {
+	measured := map[string]Quality{
+		"near":  {RTT: 20 * time.Millisecond},
+		"far":   {RTT: 80 * time.Millisecond, Jitter: 10 * time.Millisecond},
+		"lossy": {RTT: 20 * time.Millisecond, Loss: 0.5},
+	}
+	quality := func(peerID string) (Quality, bool) {
+		q, ok := measured[peerID]
+		return q, ok
+	}
+	wardens := []*ap.Warden{warden("unreachable"), warden("lossy"), warden("far"), warden("near")}
+
+	candidates := Rank(testConfig(), wardens, Criteria{}, quality)
+	if got := peerIDs(candidates); got != "near,far,lossy,unreachable" {
+		t.Fatalf("order = %s", got)
+	}
+	// 100ms of latency (80ms + 2 × 10ms jitter) halves the score.
+	if far := candidates[1]; !far.HasQuality || far.LatencyScore != 0.5 {
+		t.Errorf("far: latency score %v, %v, want 0.5", far.LatencyScore, far.HasQuality)
+	}
+	if unreachable := candidates[3]; unreachable.HasQuality || unreachable.LatencyScore != UnknownLatencyScore {
+		t.Errorf("unreachable: latency score %v, %v, want %v", unreachable.LatencyScore, unreachable.HasQuality, UnknownLatencyScore)
+	}
+	if !strings.Contains(candidates[3].Explain(), "latency unreachable") {
+		t.Errorf("explain = %q", candidates[3].Explain())
+	}
+}
+
+func TestConnectFallsBack(t *testing.T) {
+	candidates := Rank(testConfig(), []*ap.Warden{warden("a"), warden("b"), warden("c")}, Criteria{}, nil)
+	errRefused := errors.New("refused")
+
+	var tried, skipped []string
+	got, err := Connect(candidates, func(c *Candidate) error {
+		tried = append(tried, c.Warden.PeerId)
+		if c.Warden.PeerId != "c" {
+			return errRefused
+		}
+		return nil
+	}, func(c *Candidate, err error) {
+		if err != errRefused {
+			t.Errorf("skipped %s with %v", c.Warden.PeerId, err)
+		}
+		skipped = append(skipped, c.Warden.PeerId)
+	})
+	if err != nil || got.Warden.PeerId != "c" {
+		t.Fatalf("connected to %v, %v, want c", got, err)
+	}
+	if strings.Join(tried, ",") != "a,b,c" || strings.Join(skipped, ",") != "a,b" {
+		t.Fatalf("tried %v, skipped %v", tried, skipped)
+	}
+
+	got, err = Connect(candidates, func(*Candidate) error { return errRefused }, nil)
+	if got != nil || !errors.Is(err, errRefused) || !strings.Contains(err.Error(), "all 3 candidate wardens failed") {
+		t.Fatalf("all failing = %v, %v", got, err)
+	}
+
+	called := false
+	if _, err := Connect(nil, func(*Candidate) error { called = true; return nil }, nil); err == nil || called {
+		t.Fatalf("no candidates = %v, tried %v", err, called)
+	}
+}
+
+func TestParseRegion(t *testing.T) {
+	for code, name := range Regions {
+		if got, err := ParseRegion(" " + strings.ToUpper(name) + " "); err != nil || got != code {
+			t.Errorf("ParseRegion(%q) = %d, %v, want %d", name, got, err, code)
+		}
+		if RegionName(code) != name {
+			t.Errorf("RegionName(%d) = %q, want %q", code, RegionName(code), name)
+		}
+	}
+	if got, err := ParseRegion("200"); err != nil || got != 200 || RegionName(got) != "region-200" {
+		t.Errorf("ParseRegion(200) = %d, %v", got, err)
+	}
+	for _, s := range []string{"atlantis", "256", "-1"} {
+		if _, err := ParseRegion(s); err == nil {
+			t.Errorf("ParseRegion(%q) succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package arkham_protocol
+
+import (
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// SetOracleAuthority points ProtocolConfig.OracleAuthority at a new key.
+// The client's signer must be the protocol authority.
+func (c *Client) SetOracleAuthority(oracleAuthority solana.PublicKey) (*solana.Signature, error) {
+	protocolConfigPDA, _, err := c.GetProtocolConfigPDA()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get protocol config PDA: %w", err)
+	}
+
+	instruction, err := NewUpdateProtocolConfigInstruction(
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		&oracleAuthority,
+		protocolConfigPDA,
+		c.Signer.PublicKey(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create UpdateProtocolConfig instruction: %w", err)
+	}
+
+	sig, err := c.sendInstructions(instruction)
+	if err != nil {
+		return nil, err
+	}
+
+	c.invalidateOnConfirm(*sig, protocolConfigPDA)
+
+	return sig, nil
+}
+
+// UpdateReputation reports whether a warden was reachable and the share of the reporting
+// period it was up, in basis points. The client's signer must be the protocol's
+// ReputationUpdater.
+func (c *Client) UpdateReputation(wardenAuthority solana.PublicKey, connectionSuccess bool, uptimeReport uint16) (*solana.Signature, error) {
+	protocolConfigPDA, _, err := c.GetProtocolConfigPDA()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get protocol config PDA: %w", err)
+	}
+	wardenPDA, _, err := GetWardenPDAForAuthority(wardenAuthority)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get warden PDA: %w", err)
+	}
+
+	instruction, err := NewUpdateReputationInstruction(
+		connectionSuccess,
+		uptimeReport,
+		wardenPDA,
+		protocolConfigPDA,
+		wardenAuthority,
+		c.Signer.PublicKey(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create UpdateReputation instruction: %w", err)
+	}
+
+	sig, err := c.sendInstructions(instruction)
+	if err != nil {
+		return nil, err
+	}
+
+	c.invalidateOnConfirm(*sig, wardenPDA)
+
+	return sig, nil
+}
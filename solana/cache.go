@@ -0,0 +1,296 @@
+package arkham_protocol
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+)
+
+// maxAccountsPerRequest is the getMultipleAccounts limit enforced by Solana RPC nodes.
+const maxAccountsPerRequest = 100
+
+// Default time-to-live values for cached accounts, chosen by how often each account type changes.
+const (
+	ProtocolConfigTTL = 5 * time.Minute
+	WardenTTL         = 30 * time.Second
+	SeekerTTL         = 15 * time.Second
+	ConnectionTTL     = 10 * time.Second
+	MissingAccountTTL = 10 * time.Second
+	DefaultAccountTTL = 15 * time.Second
+)
+
+type cacheEntry struct {
+	data      []byte // nil when the account does not exist on-chain
+	expiresAt time.Time
+}
+
+// AccountCache is a concurrency-safe cache of raw on-chain account data with a per-account TTL.
+type AccountCache struct {
+	mu          sync.RWMutex
+	entries     map[solana.PublicKey]cacheEntry
+	wardenKeys  []solana.PublicKey
+	wardensTill time.Time
+}
+
+// DefaultAccountCache is the process-wide cache shared by every Client created with NewClient.
+var DefaultAccountCache = NewAccountCache()
+
+// NewAccountCache creates an empty AccountCache.
+func NewAccountCache() *AccountCache {
+	return &AccountCache{
+		entries: make(map[solana.PublicKey]cacheEntry),
+	}
+}
+
+// ttlFor picks the TTL for an account based on its Anchor discriminator.
+func ttlFor(data []byte) time.Duration {
+	if data == nil {
+		return MissingAccountTTL
+	}
+	if len(data) < 8 {
+		return DefaultAccountTTL
+	}
+	var disc [8]byte
+	copy(disc[:], data[:8])
+	switch disc {
+	case Account_ProtocolConfig:
+		return ProtocolConfigTTL
+	case Account_Warden:
+		return WardenTTL
+	case Account_Seeker:
+		return SeekerTTL
+	case Account_Connection:
+		return ConnectionTTL
+	default:
+		return DefaultAccountTTL
+	}
+}
+
+// Get returns the cached data for an account. The second value reports whether a live entry
+// was found; a live entry with nil data means the account is known not to exist.
+func (ac *AccountCache) Get(key solana.PublicKey) ([]byte, bool) {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+
+	entry, ok := ac.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.data, true
+}
+
+// Put stores account data using the TTL for its account type.
+func (ac *AccountCache) Put(key solana.PublicKey, data []byte) {
+	ac.PutWithTTL(key, data, ttlFor(data))
+}
+
+// PutWithTTL stores account data with an explicit TTL.
+func (ac *AccountCache) PutWithTTL(key solana.PublicKey, data []byte, ttl time.Duration) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	ac.entries[key] = cacheEntry{data: data, expiresAt: time.Now().Add(ttl)}
+}
+
+// Invalidate drops the given accounts so the next read goes to the RPC node.
+func (ac *AccountCache) Invalidate(keys ...solana.PublicKey) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	for _, key := range keys {
+		delete(ac.entries, key)
+	}
+}
+
+// InvalidateWardenList forces the next FetchAllWardens call to rescan the program accounts.
+func (ac *AccountCache) InvalidateWardenList() {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	ac.wardenKeys = nil
+	ac.wardensTill = time.Time{}
+}
+
+// Clear removes every cached entry.
+func (ac *AccountCache) Clear() {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	ac.entries = make(map[solana.PublicKey]cacheEntry)
+	ac.wardenKeys = nil
+	ac.wardensTill = time.Time{}
+}
+
+func (ac *AccountCache) getWardenList() ([]solana.PublicKey, bool) {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+	if ac.wardenKeys == nil || time.Now().After(ac.wardensTill) {
+		return nil, false
+	}
+	return ac.wardenKeys, true
+}
+
+func (ac *AccountCache) putWardenList(keys []solana.PublicKey) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	ac.wardenKeys = keys
+	ac.wardensTill = time.Now().Add(WardenTTL)
+}
+
+// GetMultipleAccounts returns the raw data for each key, serving what it can from the cache and
+// loading the rest with batched getMultipleAccounts calls. Missing accounts map to nil data.
+func (c *Client) GetMultipleAccounts(ctx context.Context, keys []solana.PublicKey) (map[solana.PublicKey][]byte, error) {
+	result := make(map[solana.PublicKey][]byte, len(keys))
+
+	var misses []solana.PublicKey
+	for _, key := range keys {
+		if _, seen := result[key]; seen {
+			continue
+		}
+		if c.Cache != nil {
+			if data, ok := c.Cache.Get(key); ok {
+				result[key] = data
+				continue
+			}
+		}
+		result[key] = nil
+		misses = append(misses, key)
+	}
+
+	for start := 0; start < len(misses); start += maxAccountsPerRequest {
+		end := start + maxAccountsPerRequest
+		if end > len(misses) {
+			end = len(misses)
+		}
+		batch := misses[start:end]
+
+		resp, err := c.RpcClient.GetMultipleAccountsWithOpts(ctx, batch, &rpc.GetMultipleAccountsOpts{
+			Encoding:   solana.EncodingBase64,
+			Commitment: rpc.CommitmentConfirmed,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get multiple accounts: %w", err)
+		}
+		if len(resp.Value) != len(batch) {
+			return nil, fmt.Errorf("getMultipleAccounts returned %d accounts, expected %d", len(resp.Value), len(batch))
+		}
+
+		for i, account := range resp.Value {
+			var data []byte
+			if account != nil {
+				data = account.Data.GetBinary()
+			}
+			result[batch[i]] = data
+			if c.Cache != nil {
+				c.Cache.Put(batch[i], data)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// getAccountData loads a single account through the cache. It returns nil data when the
+// account does not exist.
+func (c *Client) getAccountData(key solana.PublicKey) ([]byte, error) {
+	accounts, err := c.GetMultipleAccounts(context.Background(), []solana.PublicKey{key})
+	if err != nil {
+		return nil, err
+	}
+	return accounts[key], nil
+}
+
+// invalidateOnConfirm drops accounts touched by one of our own transactions once the
+// transaction is confirmed, or has failed to confirm in time. Dropping them as soon as it is
+// sent would let the next read cache the old state again for a full TTL.
+func (c *Client) invalidateOnConfirm(sig solana.Signature, keys ...solana.PublicKey) {
+	c.onConfirm(sig, func(cache *AccountCache) {
+		cache.Invalidate(keys...)
+	})
+}
+
+// onConfirm waits for a sent transaction in the background and then calls drop with the
+// client's cache.
+func (c *Client) onConfirm(sig solana.Signature, drop func(*AccountCache)) {
+	cache := c.Cache
+	if cache == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), confirmTimeout)
+		defer cancel()
+		if err := c.AwaitConfirmation(ctx, sig); err != nil {
+			c.log().Debug("dropping cached accounts of an unconfirmed transaction", "signature", sig, "err", err)
+		}
+		drop(cache)
+	}()
+}
+
+// WatchAccounts subscribes to the given accounts over the RPC websocket and refreshes the cache
+// whenever the node reports a change. It blocks until ctx is cancelled or the connection fails.
+func (c *Client) WatchAccounts(ctx context.Context, wsEndpoint string, keys ...solana.PublicKey) error {
+	if c.Cache == nil {
+		return fmt.Errorf("client has no account cache to keep up to date")
+	}
+
+	wsClient, err := ws.Connect(ctx, wsEndpoint)
+	if err != nil {
+		return fmt.Errorf("failed to connect to websocket endpoint: %w", err)
+	}
+	defer wsClient.Close()
+
+	errCh := make(chan error, len(keys))
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		sub, err := wsClient.AccountSubscribeWithOpts(key, rpc.CommitmentConfirmed, solana.EncodingBase64)
+		if err != nil {
+			return fmt.Errorf("failed to subscribe to account %s: %w", key, err)
+		}
+
+		wg.Add(1)
+		go func(key solana.PublicKey, sub *ws.AccountSubscription) {
+			defer wg.Done()
+			defer sub.Unsubscribe()
+			for {
+				got, err := sub.Recv(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						errCh <- fmt.Errorf("subscription for %s ended: %w", key, err)
+					}
+					return
+				}
+				account := notifiedAccount(got)
+				if account == nil || account.Data == nil {
+					c.Cache.Invalidate(key)
+					continue
+				}
+				c.Cache.Put(key, account.Data.GetBinary())
+			}
+		}(key, sub)
+	}
+
+	select {
+	case <-ctx.Done():
+		wg.Wait()
+		return nil
+	case err := <-errCh:
+		return err
+	}
+}
+
+// notifiedAccount returns the account carried by a subscription notification, or nil for
+// a closed account. Older solana-go releases notify with an embedded account value rather
+// than a pointer, and this module still builds against one of them.
+func notifiedAccount(got *ws.AccountResult) *rpc.Account {
+	if got == nil {
+		return nil
+	}
+	switch value := any(got.Value).(type) {
+	case *rpc.Account:
+		return value
+	case struct{ rpc.Account }:
+		return &value.Account
+	}
+	return nil
+}
@@ -3,21 +3,18 @@ package arkham_protocol
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/binary"
-	"encoding/hex"
-	"encoding/json"
 	"fmt"
-	"io"
+	"log/slog"
 	"net/http"
-	"net/url"
-	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/programs/system"
 	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
 	"golang.org/x/crypto/sha3"
 )
 
@@ -28,16 +25,48 @@ var Ed25519ProgramID = solana.MustPublicKeyFromBase58("Ed25519SigVerify111111111
 type Client struct {
 	RpcClient *rpc.Client
 	Signer    solana.PrivateKey
+	// PriceSource supplies signed oracle prices. When nil, NewPriceSourceFromEnv is used.
+	PriceSource PriceSource
+	// MaxPriceAge bounds how old an oracle quote may be. Zero means DefaultMaxPriceAge.
+	MaxPriceAge time.Duration
+	// Cache holds recently read account data. It defaults to DefaultAccountCache and can be
+	// set to nil to always read through to the RPC node.
+	Cache *AccountCache
+	// Mints are the SPL stake mints of the cluster behind RpcClient.
+	Mints StakeMints
+	// OnTransaction, when set, is called with the signature of every transaction the client
+	// sends.
+	OnTransaction func(solana.Signature)
+	// Logger receives the client's diagnostics. When nil, slog.Default is used.
+	Logger *slog.Logger
+}
+
+// RPCTransport, when set, carries the JSON-RPC requests of clients created afterwards, so
+// callers can instrument RPC traffic.
+var RPCTransport http.RoundTripper
+
+// rpcTimeout matches the timeout of the default RPC HTTP client.
+const rpcTimeout = 5 * time.Minute
+
+func newRPCClient(rpcEndpoint string) *rpc.Client {
+	if RPCTransport == nil {
+		return rpc.New(rpcEndpoint)
+	}
+	return rpc.NewWithCustomRPCClient(jsonrpc.NewClientWithOpts(rpcEndpoint, &jsonrpc.RPCClientOpts{
+		HTTPClient: &http.Client{Transport: RPCTransport, Timeout: rpcTimeout},
+	}))
 }
 
 // NewClient creates a new Client for the Arkham Protocol with a specific signer.
 func NewClient(rpcEndpoint string, signer solana.PrivateKey) (*Client, error) {
 	// Create a new RPC client.
-	rpcClient := rpc.New(rpcEndpoint)
+	rpcClient := newRPCClient(rpcEndpoint)
 
 	return &Client{
 		RpcClient: rpcClient,
 		Signer:    signer,
+		Cache:     DefaultAccountCache,
+		Mints:     StakeMintsForEndpoint(rpcEndpoint),
 	}, nil
 }
 
@@ -45,7 +74,7 @@ func NewClient(rpcEndpoint string, signer solana.PrivateKey) (*Client, error) {
 // It uses a dummy keypair internally.
 func NewReadOnlyClient(rpcEndpoint string) (*Client, error) {
 	// Create a new RPC client.
-	rpcClient := rpc.New(rpcEndpoint)
+	rpcClient := newRPCClient(rpcEndpoint)
 
 	// Create a dummy wallet for read-only operations.
 	dummyWallet := solana.NewWallet()
@@ -53,6 +82,8 @@ func NewReadOnlyClient(rpcEndpoint string) (*Client, error) {
 	return &Client{
 		RpcClient: rpcClient,
 		Signer:    dummyWallet.PrivateKey,
+		Cache:     DefaultAccountCache,
+		Mints:     StakeMintsForEndpoint(rpcEndpoint),
 	}, nil
 }
 
@@ -73,23 +104,22 @@ func (c *Client) FetchProtocolConfig() (*ProtocolConfig, error) {
 		return nil, fmt.Errorf("failed to get protocol config PDA: %w", err)
 	}
 
-	resp, err := c.RpcClient.GetAccountInfoWithOpts(context.Background(), protocolConfigPDA, &rpc.GetAccountInfoOpts{
-		Commitment: rpc.CommitmentConfirmed,
-	})
+	data, err := c.getAccountData(protocolConfigPDA)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get protocol config account info: %w", err)
 	}
-	if resp.Value == nil {
+	if data == nil {
 		return nil, fmt.Errorf("protocol config account not found")
 	}
 
-	return ParseAccount_ProtocolConfig(resp.Value.Data.GetBinary())
+	return ParseAccount_ProtocolConfig(data)
 }
 
 // Devnet Addresses:
 var (
 	DevnetUsdcMint = solana.MustPublicKeyFromBase58("4zMMC9srt5Ri5X14GAgXhaHii3GnPAEERYPJgZJDncDU")
 	// Using USDC mint as a placeholder for USDT as there is no official one on devnet.
+	// Set ARKHAM_USDT_MINT to stake a real test USDT mint.
 	DevnetUsdtMint = solana.MustPublicKeyFromBase58("4zMMC9srt5Ri5X14GAgXhaHii3GnPAEERYPJgZJDncDU")
 )
 
@@ -102,87 +132,22 @@ func (c *Client) InitializeWarden(
 	ipHash [32]uint8,
 ) (*solana.Signature, error) {
 
-	// 1. Fetch price data from the oracle API
-	// -----------------------------------------
-	trustedKey := os.Getenv("TRUSTED_CLIENT_KEY")
-	if trustedKey == "" {
-		return nil, fmt.Errorf("TRUSTED_CLIENT_KEY not set in .env file")
-	}
-
-	tokenStr := ""
-	switch stakeToken {
-	case StakeToken_Sol:
-		tokenStr = "solana"
-	case StakeToken_Usdc:
-		tokenStr = "usd-coin"
-	case StakeToken_Usdt:
-		tokenStr = "tether"
-	default:
-		return nil, fmt.Errorf("unsupported stake token")
-	}
-
-	// TODO: Make the base URL configurable
-	baseURL := "https://arkham-dvpn.vercel.app/api/price"
-	params := url.Values{}
-	params.Add("token", tokenStr)
-	params.Add("trustedClientKey", trustedKey)
-	reqURL := fmt.Sprintf("%s?%s", baseURL, params.Encode())
-
-	resp, err := http.Get(reqURL)
+	// 1. Fetch and verify a signed price from the configured oracle
+	// ---------------------------------------------------------------
+	protocolConfig, err := c.FetchProtocolConfig()
 	if err != nil {
-		return nil, fmt.Errorf("failed to call price API: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("price API returned non-200 status: %s - %s", resp.Status, string(body))
-	}
-
-	var priceResp struct {
-		Price     string `json:"price"`
-		Timestamp string `json:"timestamp"`
-		Signature string `json:"signature"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&priceResp); err != nil {
-		return nil, fmt.Errorf("failed to decode price API response: %w", err)
+		return nil, fmt.Errorf("could not fetch protocol config to get oracle authority: %w", err)
 	}
+	oracleAuthority := protocolConfig.OracleAuthority
 
-	price, err := strconv.ParseUint(priceResp.Price, 10, 64)
+	quote, err := c.FetchVerifiedPrice(context.Background(), stakeToken, oracleAuthority)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse price from API: %w", err)
+		return nil, err
 	}
-	timestamp, err := strconv.ParseInt(priceResp.Timestamp, 10, 64)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse timestamp from API: %w", err)
-	}
-	signature, err := hex.DecodeString(priceResp.Signature)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode signature from API: %w", err)
-	}
-	if len(signature) != 64 {
-		return nil, fmt.Errorf("invalid signature length from API: expected 64, got %d", len(signature))
-	}
-	var finalSignature [64]byte
-	copy(finalSignature[:], signature)
 
-	// 2. Recreate the oracle message hash to ensure integrity
-	// -------------------------------------------------------
-	oracleMsgBuffer := new(bytes.Buffer)
-	binary.Write(oracleMsgBuffer, binary.LittleEndian, price)
-	binary.Write(oracleMsgBuffer, binary.LittleEndian, timestamp)
-
-	hasher := sha3.NewLegacyKeccak256()
-	hasher.Write(oracleMsgBuffer.Bytes())
-	messageHash := hasher.Sum(nil)
-
-	// 3. Build the Ed25519 instruction
+	// 2. Build the Ed25519 instruction
 	// ---------------------------------
-	protocolConfig, err := c.FetchProtocolConfig()
-	if err != nil {
-		return nil, fmt.Errorf("could not fetch protocol config to get oracle authority: %w", err)
-	}
-	oracleAuthority := protocolConfig.OracleAuthority
+	messageHash := OracleMessageHash(quote.Price, quote.Timestamp)
 
 	// Manually construct the Ed25519 instruction data payload
 	// The header is 16 bytes long, so the signature starts at offset 16.
@@ -199,7 +164,7 @@ func (c *Client) InitializeWarden(
 	ed25519InstrData = binary.LittleEndian.AppendUint16(ed25519InstrData, uint16(len(messageHash)))
 	ed25519InstrData = binary.LittleEndian.AppendUint16(ed25519InstrData, 0xFFFF) // msg instruction index
 
-	ed25519InstrData = append(ed25519InstrData, signature...)
+	ed25519InstrData = append(ed25519InstrData, quote.Signature[:]...)
 	ed25519InstrData = append(ed25519InstrData, oracleAuthority[:]...)
 	ed25519InstrData = append(ed25519InstrData, messageHash...)
 
@@ -209,7 +174,7 @@ func (c *Client) InitializeWarden(
 		ed25519InstrData,
 	)
 
-	// 4. Build the InitializeWarden instruction
+	// 3. Build the InitializeWarden instruction
 	// -----------------------------------------
 	wardenPDA, _, err := c.GetWardenPDA()
 	if err != nil {
@@ -236,9 +201,9 @@ func (c *Client) InitializeWarden(
 	if stakeToken == StakeToken_Sol {
 		stakeFromAccount = c.Signer.PublicKey()
 	} else {
-		mint := DevnetUsdcMint
-		if stakeToken == StakeToken_Usdt {
-			mint = DevnetUsdtMint
+		mint, err := c.Mints.MintFor(stakeToken)
+		if err != nil {
+			return nil, err
 		}
 		stakeFromAccount, _, err = solana.FindAssociatedTokenAddress(c.Signer.PublicKey(), mint)
 		if err != nil {
@@ -252,9 +217,9 @@ func (c *Client) InitializeWarden(
 		peerId,
 		regionCode,
 		ipHash,
-		price,
-		timestamp,
-		finalSignature,
+		quote.Price,
+		quote.Timestamp,
+		quote.Signature,
 		wardenPDA,
 		c.Signer.PublicKey(),
 		protocolConfigPDA,
@@ -263,8 +228,8 @@ func (c *Client) InitializeWarden(
 		solVaultPDA,
 		usdcVaultATA,
 		usdtVaultATA,
-		DevnetUsdcMint,
-		DevnetUsdtMint,
+		c.Mints.Usdc,
+		c.Mints.Usdt,
 		solana.SystemProgramID,
 		solana.TokenProgramID,
 		AssociatedTokenProgramID,
@@ -273,7 +238,7 @@ func (c *Client) InitializeWarden(
 		return nil, fmt.Errorf("failed to create InitializeWarden instruction: %w", err)
 	}
 
-	// 5. Build and send the transaction
+	// 4. Build and send the transaction
 	// ---------------------------------
 	latestBlockhash, err := c.RpcClient.GetLatestBlockhash(context.Background(), rpc.CommitmentFinalized)
 	if err != nil {
@@ -304,11 +269,16 @@ func (c *Client) InitializeWarden(
 		return nil, fmt.Errorf("failed to sign transaction: %w", err)
 	}
 
-	sig, err := c.RpcClient.SendTransaction(context.Background(), tx)
+	sig, err := c.sendTransaction(tx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send transaction: %w", err)
 	}
 
+	c.onConfirm(sig, func(cache *AccountCache) {
+		cache.Invalidate(wardenPDA)
+		cache.InvalidateWardenList()
+	})
+
 	return &sig, nil
 }
 
@@ -466,11 +436,13 @@ func (c *Client) SubmitBandwidthProof(
 		return nil, fmt.Errorf("failed to sign transaction: %w", err)
 	}
 
-	sig, err := c.RpcClient.SendTransaction(context.Background(), tx)
+	sig, err := c.sendTransaction(tx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send transaction: %w", err)
 	}
 
+	c.invalidateOnConfirm(sig, connectionPDA, wardenPDA, seekerPDA)
+
 	return &sig, nil
 }
 
@@ -480,25 +452,39 @@ func (c *Client) GenerateBandwidthProofSignature(
 	mbConsumed uint64,
 	timestamp int64,
 ) (solana.Signature, error) {
-	seekerAuthority := c.Signer.PublicKey()
+	messageHash, err := BandwidthProofMessage(c.Signer.PublicKey(), wardenAuthority, mbConsumed, timestamp)
+	if err != nil {
+		return solana.Signature{}, err
+	}
+
+	seekerSignature, err := c.Signer.Sign(messageHash)
+	if err != nil {
+		return solana.Signature{}, fmt.Errorf("failed to sign message as seeker: %w", err)
+	}
 
+	return seekerSignature, nil
+}
+
+// BandwidthProofMessage returns the message a seeker signs to prove mbConsumed MB on its
+// Connection with a warden: keccak256(connection PDA || mb_le || timestamp_le), exactly as
+// the smart contract checks it.
+func BandwidthProofMessage(seekerAuthority, wardenAuthority solana.PublicKey, mbConsumed uint64, timestamp int64) ([]byte, error) {
 	// FIX: Get the actual PDAs first
 	seekerPDA, _, err := GetSeekerPDA(seekerAuthority)
 	if err != nil {
-		return solana.Signature{}, fmt.Errorf("failed to get seeker PDA: %w", err)
+		return nil, fmt.Errorf("failed to get seeker PDA: %w", err)
 	}
 	wardenPDA, _, err := GetWardenPDAForAuthority(wardenAuthority)
 	if err != nil {
-		return solana.Signature{}, fmt.Errorf("failed to get warden PDA: %w", err)
+		return nil, fmt.Errorf("failed to get warden PDA: %w", err)
 	}
 
 	// FIX: Use PDAs (not authorities) for connection PDA
 	connectionPDA, _, err := GetConnectionPDA(seekerPDA, wardenPDA)
 	if err != nil {
-		return solana.Signature{}, fmt.Errorf("failed to get connection PDA: %w", err)
+		return nil, fmt.Errorf("failed to get connection PDA: %w", err)
 	}
 
-	// Construct the exact same message as the smart contract expects
 	msgBuffer := new(bytes.Buffer)
 	msgBuffer.Write(connectionPDA.Bytes())
 	binary.Write(msgBuffer, binary.LittleEndian, mbConsumed)
@@ -506,14 +492,17 @@ func (c *Client) GenerateBandwidthProofSignature(
 
 	hasher := sha3.NewLegacyKeccak256()
 	hasher.Write(msgBuffer.Bytes())
-	messageHash := hasher.Sum(nil)
+	return hasher.Sum(nil), nil
+}
 
-	seekerSignature, err := c.Signer.Sign(messageHash)
+// VerifyBandwidthProofSignature reports whether signature is the seeker's signature over
+// the bandwidth proof for its Connection with wardenAuthority.
+func VerifyBandwidthProofSignature(seekerAuthority, wardenAuthority solana.PublicKey, mbConsumed uint64, timestamp int64, signature solana.Signature) bool {
+	message, err := BandwidthProofMessage(seekerAuthority, wardenAuthority, mbConsumed, timestamp)
 	if err != nil {
-		return solana.Signature{}, fmt.Errorf("failed to sign message as seeker: %w", err)
+		return false
 	}
-
-	return seekerSignature, nil
+	return signature.Verify(seekerAuthority, message)
 }
 
 // SendSol sends a specified amount of SOL to a recipient.
@@ -550,7 +539,7 @@ func (c *Client) SendSol(recipient solana.PublicKey, amountLamports uint64) (*so
 		return nil, fmt.Errorf("failed to sign transaction: %w", err)
 	}
 
-	sig, err := c.RpcClient.SendTransaction(context.Background(), tx)
+	sig, err := c.sendTransaction(tx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send transaction: %w", err)
 	}
@@ -656,7 +645,7 @@ func (c *Client) GetSolVaultPDA() (solana.PublicKey, uint8, error) {
 func (c *Client) GetUsdcVaultATA(solVaultPDA solana.PublicKey) (solana.PublicKey, uint8, error) {
 	return solana.FindAssociatedTokenAddress(
 		solVaultPDA,
-		DevnetUsdcMint,
+		c.Mints.Usdc,
 	)
 }
 
@@ -664,7 +653,7 @@ func (c *Client) GetUsdcVaultATA(solVaultPDA solana.PublicKey) (solana.PublicKey
 func (c *Client) GetUsdtVaultATA(solVaultPDA solana.PublicKey) (solana.PublicKey, uint8, error) {
 	return solana.FindAssociatedTokenAddress(
 		solVaultPDA,
-		DevnetUsdtMint,
+		c.Mints.Usdt,
 	)
 }
 
@@ -675,27 +664,13 @@ func (c *Client) IsWardenRegistered() (bool, error) {
 		return false, fmt.Errorf("failed to get warden PDA for check: %w", err)
 	}
 
-	resp, err := c.RpcClient.GetAccountInfoWithOpts(context.Background(), wardenPDA, &rpc.GetAccountInfoOpts{
-		Commitment: rpc.CommitmentConfirmed,
-	})
+	// Going through the account cache means a following FetchWardenAccount is free.
+	data, err := c.getAccountData(wardenPDA)
 	if err != nil {
-		// The account not being found is an error from the RPC client's perspective,
-		// but for our logic, it's a valid state meaning "not registered".
-		// We check if the response value is nil, which is true when the account is not found.
-		// Any other error (network, etc.) is a real problem.
-		if resp == nil {
-			return false, nil
-		}
 		return false, fmt.Errorf("failed to get warden account info: %w", err)
 	}
 
-	// If there was no RPC error and the account value is nil, it also means not found.
-	if resp.Value == nil {
-		return false, nil
-	}
-
-	// If we have the account, the user is registered.
-	return true, nil
+	return data != nil, nil
 }
 
 // IsSeekerRegistered checks if a Seeker account exists for the client's public key.
@@ -705,18 +680,16 @@ func (c *Client) IsSeekerRegistered() (bool, error) {
 		return false, fmt.Errorf("failed to get seeker PDA: %w", err)
 	}
 
-	_, err = c.RpcClient.GetAccountInfo(context.Background(), seekerPDA)
+	data, err := c.getAccountData(seekerPDA)
 	if err != nil {
-		if err == rpc.ErrNotFound {
-			return false, nil
-		}
 		return false, fmt.Errorf("failed to check for seeker account: %w", err)
 	}
-	return true, nil
+	return data != nil, nil
 }
 
-// DepositEscrow deposits SOL into the seeker's on-chain escrow account.
-func (c *Client) DepositEscrow(amountLamports uint64) (*solana.Signature, error) {
+// DepositEscrow deposits SOL into the seeker's on-chain escrow account, or into its private
+// escrow when usePrivate is set.
+func (c *Client) DepositEscrow(amountLamports uint64, usePrivate bool) (*solana.Signature, error) {
 	// The Seeker is the signer for this transaction.
 	seekerAuthority := c.Signer.PublicKey()
 	seekerPDA, _, err := GetSeekerPDA(seekerAuthority)
@@ -728,7 +701,7 @@ func (c *Client) DepositEscrow(amountLamports uint64) (*solana.Signature, error)
 	// We just need to call the single instruction.
 	depositInstruction, err := NewDepositEscrowInstruction(
 		amountLamports,
-		false, // usePrivate is false for now
+		usePrivate,
 		seekerPDA,
 		seekerAuthority,
 		solana.SystemProgramID,
@@ -763,11 +736,13 @@ func (c *Client) DepositEscrow(amountLamports uint64) (*solana.Signature, error)
 		return nil, fmt.Errorf("failed to sign transaction: %w", err)
 	}
 
-	sig, err := c.RpcClient.SendTransaction(context.Background(), tx)
+	sig, err := c.sendTransaction(tx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send transaction: %w", err)
 	}
 
+	c.invalidateOnConfirm(sig, seekerPDA)
+
 	return &sig, nil
 }
 
@@ -834,11 +809,13 @@ func (c *Client) StartConnection(wardenAuthority solana.PublicKey, estimatedMb u
 		return nil, fmt.Errorf("failed to sign transaction: %w", err)
 	}
 
-	sig, err := c.RpcClient.SendTransaction(context.Background(), tx)
+	sig, err := c.sendTransaction(tx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send transaction: %w", err)
 	}
 
+	c.invalidateOnConfirm(sig, connectionPDA, seekerPDA, wardenPDA)
+
 	return &sig, nil
 }
 
@@ -910,23 +887,14 @@ func (c *Client) EndConnection(wardenAuthority solana.PublicKey) (*solana.Signat
 		return nil, fmt.Errorf("failed to sign transaction: %w", err)
 	}
 
-	// --- DEBUGGING: PRINT RAW TRANSACTION ---
-	txBytes, err := tx.MarshalBinary()
-	if err != nil {
-		fmt.Println("DEBUG: Failed to marshal tx for debugging:", err)
-	} else {
-		fmt.Println("\n\n--- DEBUG: RAW TRANSACTION (COPY AND PASTE INTO SOLANA INSPECTOR) ---")
-		fmt.Println(base64.StdEncoding.EncodeToString(txBytes))
-		fmt.Println("--- END DEBUG ---\\n\n")
-	}
-	// --- END DEBUGGING ---
-
 	// Send transaction
-	sig, err := c.RpcClient.SendTransaction(context.Background(), tx)
+	sig, err := c.sendTransaction(tx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send transaction: %w", err)
 	}
 
+	c.invalidateOnConfirm(sig, connectionPDA, seekerPDA, wardenPDA)
+
 	return &sig, nil
 }
 
@@ -986,11 +954,13 @@ func (c *Client) ClaimEarnings(usePrivate bool) (*solana.Signature, error) {
 	}
 
 	// Send transaction
-	sig, err := c.RpcClient.SendTransaction(context.Background(), tx)
+	sig, err := c.sendTransaction(tx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send transaction: %w", err)
 	}
 
+	c.invalidateOnConfirm(sig, wardenPDA)
+
 	return &sig, nil
 }
 
@@ -1092,11 +1062,13 @@ func (c *Client) ClaimArkhamTokens() (*solana.Signature, error) {
 	}
 
 	// Send transaction
-	sig, err := c.RpcClient.SendTransaction(context.Background(), tx)
+	sig, err := c.sendTransaction(tx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send transaction: %w", err)
 	}
 
+	c.invalidateOnConfirm(sig, wardenPDA)
+
 	return &sig, nil
 }
 
@@ -1107,17 +1079,15 @@ func (c *Client) FetchWardenAccount() (*Warden, error) {
 		return nil, fmt.Errorf("failed to get warden PDA: %w", err)
 	}
 
-	resp, err := c.RpcClient.GetAccountInfoWithOpts(context.Background(), wardenPDA, &rpc.GetAccountInfoOpts{
-		Commitment: rpc.CommitmentConfirmed,
-	})
+	data, err := c.getAccountData(wardenPDA)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get warden account info: %w", err)
 	}
-	if resp.Value == nil {
+	if data == nil {
 		return nil, fmt.Errorf("warden account not found on-chain")
 	}
 
-	warden, err := ParseAccount_Warden(resp.Value.Data.GetBinary())
+	warden, err := ParseAccount_Warden(data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse warden account data: %w", err)
 	}
@@ -1125,6 +1095,27 @@ func (c *Client) FetchWardenAccount() (*Warden, error) {
 	return warden, nil
 }
 
+// FetchSeekerByAuthority fetches the Seeker account of another wallet. It returns an error
+// if the seeker has no account.
+func (c *Client) FetchSeekerByAuthority(seekerAuthority solana.PublicKey) (*Seeker, error) {
+	seekerPDA, _, err := GetSeekerPDA(seekerAuthority)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get seeker PDA: %w", err)
+	}
+	data, err := c.getAccountData(seekerPDA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch seeker account: %w", err)
+	}
+	if data == nil {
+		return nil, fmt.Errorf("seeker %s has no account", seekerAuthority)
+	}
+	seeker, err := ParseAccount_Seeker(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse seeker account data: %w", err)
+	}
+	return seeker, nil
+}
+
 // FetchSeekerAccount fetches and parses the on-chain Seeker account data.
 func (c *Client) FetchSeekerAccount() (*Seeker, error) {
 	seekerPDA, _, err := GetSeekerPDA(c.Signer.PublicKey())
@@ -1132,9 +1123,7 @@ func (c *Client) FetchSeekerAccount() (*Seeker, error) {
 		return nil, fmt.Errorf("failed to get seeker PDA: %w", err)
 	}
 
-	resp, err := c.RpcClient.GetAccountInfoWithOpts(context.Background(), seekerPDA, &rpc.GetAccountInfoOpts{
-		Commitment: rpc.CommitmentConfirmed,
-	})
+	data, err := c.getAccountData(seekerPDA)
 	if err != nil {
 		// If the account is not found, it's not a fatal error.
 		// We can treat it as a seeker with a zero balance.
@@ -1144,7 +1133,7 @@ func (c *Client) FetchSeekerAccount() (*Seeker, error) {
 		},
 		nil
 	}
-	if resp.Value == nil {
+	if data == nil {
 		return &Seeker{
 			Authority:     c.Signer.PublicKey(),
 			EscrowBalance: 0,
@@ -1152,7 +1141,7 @@ func (c *Client) FetchSeekerAccount() (*Seeker, error) {
 		nil
 	}
 
-	seeker, err := ParseAccount_Seeker(resp.Value.Data.GetBinary())
+	seeker, err := ParseAccount_Seeker(data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse seeker account data: %w", err)
 	}
@@ -1160,6 +1149,35 @@ func (c *Client) FetchSeekerAccount() (*Seeker, error) {
 	return seeker, nil
 }
 
+// FetchConnection fetches the Connection between a seeker and a warden, given their
+// authorities. It returns nil if the connection is not open.
+func (c *Client) FetchConnection(seekerAuthority, wardenAuthority solana.PublicKey) (*Connection, error) {
+	seekerPDA, _, err := GetSeekerPDA(seekerAuthority)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get seeker PDA: %w", err)
+	}
+	wardenPDA, _, err := GetWardenPDAForAuthority(wardenAuthority)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get warden PDA: %w", err)
+	}
+	connectionPDA, _, err := GetConnectionPDA(seekerPDA, wardenPDA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection PDA: %w", err)
+	}
+	data, err := c.getAccountData(connectionPDA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch connection account: %w", err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	connection, err := ParseAccount_Connection(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse connection account data: %w", err)
+	}
+	return connection, nil
+}
+
 // ConnectionResult wraps a Connection account with its public key.
 type ConnectionResult struct {
 	PublicKey solana.PublicKey
@@ -1167,7 +1185,8 @@ type ConnectionResult struct {
 }
 
 // FetchMyConnections fetches Connection accounts specific to the client's signer by filtering locally.
-func (c *Client) FetchMyConnections(profileType string) ([]*ConnectionResult, error) {
+// Accounts that cannot be parsed are skipped and reported as warnings.
+func (c *Client) FetchMyConnections(profileType string) ([]*ConnectionResult, []Warning, error) {
 	// 1. Get all connection accounts, filtering only by the account type discriminator.
 	resp, err := c.RpcClient.GetProgramAccountsWithOpts(
 		context.Background(),
@@ -1185,7 +1204,7 @@ func (c *Client) FetchMyConnections(profileType string) ([]*ConnectionResult, er
 		},
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get program accounts for connections: %w", err)
+		return nil, nil, fmt.Errorf("failed to get program accounts for connections: %w", err)
 	}
 
 	// 2. Get the user's PDA to filter against locally.
@@ -1196,15 +1215,16 @@ func (c *Client) FetchMyConnections(profileType string) ([]*ConnectionResult, er
 		userPDA, _, err = c.GetWardenPDA()
 	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to derive user PDA for filter: %w", err)
+		return nil, nil, fmt.Errorf("failed to derive user PDA for filter: %w", err)
 	}
 
 	// 3. Parse and filter the results locally.
 	var myConnections []*ConnectionResult
+	var warnings []Warning
 	for _, item := range resp {
 		account, err := ParseAccount_Connection(item.Account.Data.GetBinary())
 		if err != nil {
-			fmt.Printf("Warning: failed to parse a Connection account at %s: %v\n", item.Pubkey.String(), err)
+			c.warn(&warnings, item.Pubkey, "failed to parse connection account", err)
 			continue
 		}
 
@@ -1223,5 +1243,41 @@ func (c *Client) FetchMyConnections(profileType string) ([]*ConnectionResult, er
 			})
 		}
 	}
-	return myConnections, nil
+	return myConnections, warnings, nil
+}
+
+// sendInstructions signs the instructions with the client's signer as fee payer and sends them.
+func (c *Client) sendInstructions(instructions ...solana.Instruction) (*solana.Signature, error) {
+	latestBlockhash, err := c.RpcClient.GetLatestBlockhash(context.Background(), rpc.CommitmentFinalized)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest blockhash: %w", err)
+	}
+
+	tx, err := solana.NewTransaction(
+		instructions,
+		latestBlockhash.Value.Blockhash,
+		solana.TransactionPayer(c.Signer.PublicKey()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transaction: %w", err)
+	}
+
+	_, err = tx.Sign(
+		func(key solana.PublicKey) *solana.PrivateKey {
+			if c.Signer.PublicKey().Equals(key) {
+				return &c.Signer
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign transaction: %w", err)
+	}
+
+	sig, err := c.sendTransaction(tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send transaction: %w", err)
+	}
+
+	return &sig, nil
 }
@@ -3,7 +3,6 @@ package arkham_protocol
 import (
 	"context"
 	"encoding/base64"
-	"encoding/hex"
 	"fmt"
 	"strings"
 	"sync"
@@ -30,6 +29,8 @@ type GenericEvent struct {
 	Sender     *solana.PublicKey `json:"sender,omitempty"`
 	Recipient  *solana.PublicKey `json:"recipient,omitempty"`
 	MbConsumed *uint64           `json:"mbConsumed,omitempty"`
+	// Private is set on escrow deposits and earnings claims made with use_private.
+	Private bool `json:"private,omitempty"`
 }
 
 // ConnectionEvent represents a completed dVPN connection.
@@ -49,6 +50,9 @@ type HistoryResult struct {
 	ArkhamHistory       []GenericEvent    `json:"arkhamHistory"`
 	ConnectionHistory   []ConnectionEvent `json:"connectionHistory"`
 	ThroughputHistory   []GenericEvent    `json:"throughputHistory"`
+	// Warnings lists the transactions and accounts that could not be read; the history is
+	// complete except for them.
+	Warnings []Warning `json:"warnings,omitempty"`
 }
 
 // initializeIDL loads and parses the IDL data once
@@ -86,7 +90,7 @@ func (c *Client) GetHistory(publicKey solana.PublicKey) (*HistoryResult, error)
 	ctx := context.Background()
 	
 	// Step 1: Get all signatures to process
-	allSignatures, err := c.gatherAllRelevantSignatures(ctx, publicKey)
+	allSignatures, err := c.gatherAllRelevantSignatures(ctx, publicKey, &result.Warnings)
 	if err != nil {
 		return nil, fmt.Errorf("failed to gather signatures: %w", err)
 	}
@@ -122,7 +126,9 @@ func (c *Client) GetHistory(publicKey solana.PublicKey) (*HistoryResult, error)
 					},
 				)
 				if err != nil {
-					fmt.Printf("Warning: failed to fetch transaction %s: %v\n", sig, err)
+					mu.Lock()
+					c.warn(&result.Warnings, sig, "failed to fetch transaction", err)
+					mu.Unlock()
 					return
 				}
 
@@ -138,7 +144,7 @@ func (c *Client) GetHistory(publicKey solana.PublicKey) (*HistoryResult, error)
 
 // gatherAllRelevantSignatures collects signatures from both the user's wallet
 // and all related Connection accounts (where user is seeker or warden).
-func (c *Client) gatherAllRelevantSignatures(ctx context.Context, publicKey solana.PublicKey) ([]solana.Signature, error) {
+func (c *Client) gatherAllRelevantSignatures(ctx context.Context, publicKey solana.PublicKey, warnings *[]Warning) ([]solana.Signature, error) {
 	signatureSet := make(map[solana.Signature]bool)
 	limit := 1000
 
@@ -174,7 +180,7 @@ func (c *Client) gatherAllRelevantSignatures(ctx context.Context, publicKey sola
 			},
 		)
 		if err != nil {
-			fmt.Printf("Warning: failed to fetch signatures for seeker PDA %s: %v\n", seekerPDA, err)
+			c.warn(warnings, seekerPDA, "failed to fetch signatures for seeker account", err)
 		} else {
 			for _, sigInfo := range seekerPdaSigs {
 				signatureSet[sigInfo.Signature] = true
@@ -183,9 +189,9 @@ func (c *Client) gatherAllRelevantSignatures(ctx context.Context, publicKey sola
 	}
 
 	// 3. Fetch all Connection accounts from the program
-	connections, err := c.fetchAllConnections(ctx)
+	connections, err := c.fetchAllConnections(ctx, warnings)
 	if err != nil {
-		fmt.Printf("Warning: failed to fetch connections: %v\n", err)
+		c.warn(warnings, nil, "failed to fetch connections", err)
 		// Continue with just user signatures
 		return mapKeysToSlice(signatureSet), nil
 	}
@@ -209,7 +215,7 @@ func (c *Client) gatherAllRelevantSignatures(ctx context.Context, publicKey sola
 			},
 		)
 		if err != nil {
-			fmt.Printf("Warning: failed to fetch signatures for connection %s: %v\n", connPDA, err)
+			c.warn(warnings, connPDA, "failed to fetch signatures for connection", err)
 			continue
 		}
 
@@ -224,8 +230,9 @@ func (c *Client) gatherAllRelevantSignatures(ctx context.Context, publicKey sola
 
 
 
-// fetchAllConnections retrieves all Connection accounts from the program.
-func (c *Client) fetchAllConnections(ctx context.Context) (map[solana.PublicKey]*Connection, error) {
+// fetchAllConnections retrieves all Connection accounts from the program. Accounts that
+// cannot be parsed are added to warnings.
+func (c *Client) fetchAllConnections(ctx context.Context, warnings *[]Warning) (map[solana.PublicKey]*Connection, error) {
 	resp, err := c.RpcClient.GetProgramAccountsWithOpts(
 		ctx,
 		ProgramID,
@@ -249,7 +256,7 @@ func (c *Client) fetchAllConnections(ctx context.Context) (map[solana.PublicKey]
 	for _, item := range resp {
 		conn, err := ParseAccount_Connection(item.Account.Data.GetBinary())
 		if err != nil {
-			fmt.Printf("Warning: failed to parse connection at %s: %v\n", item.Pubkey, err)
+			c.warn(warnings, item.Pubkey, "failed to parse connection account", err)
 			continue
 		}
 		connections[item.Pubkey] = conn
@@ -392,9 +399,9 @@ func parseConnectionStartedEvent(eventData []byte, self solana.PublicKey, timest
 func parseBandwidthProofEvent(eventData []byte, self solana.PublicKey, timestamp time.Time, signature solana.Signature, result *HistoryResult, mu *sync.Mutex) {
 	event, err := ParseEvent_BandwidthProofSubmitted(eventData)
 	if err != nil {
-		fmt.Printf("ERROR: Failed to parse BandwidthProofSubmitted event. Error: %v. Data (hex): %s\n", err, hex.EncodeToString(eventData))
-		// DON'T return early - we already found this transaction is relevant
-		// Just log the error and skip
+		mu.Lock()
+		result.Warnings = append(result.Warnings, newWarning(signature, "failed to parse BandwidthProofSubmitted event", err))
+		mu.Unlock()
 		return
 	}
 
@@ -428,6 +435,7 @@ func parseEscrowDepositedEvent(eventData []byte, self solana.PublicKey, timestam
 		Type:      "EscrowDeposited",
 		Amount:    event.Amount,
 		Sender:    &event.Authority,
+		Private:   event.UsePrivate,
 	}
 
 	mu.Lock()
@@ -451,6 +459,7 @@ func parseEarningsClaimedEvent(eventData []byte, self solana.PublicKey, timestam
 		Type:      "EarningsClaimed",
 		Amount:    event.Amount,
 		Recipient: &event.Authority,
+		Private:   event.UsePrivate,
 	}
 
 	mu.Lock()
@@ -0,0 +1,39 @@
+package arkham_protocol
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Warning describes a partial failure: one account or transaction that could not be read
+// while the rest of a result was still returned.
+type Warning struct {
+	// Account is the account or transaction signature the warning is about, if any.
+	Account string `json:"account,omitempty"`
+	Message string `json:"message"`
+	Error   string `json:"error"`
+}
+
+func newWarning(account fmt.Stringer, message string, err error) Warning {
+	w := Warning{Message: message, Error: err.Error()}
+	if account != nil {
+		w.Account = account.String()
+	}
+	return w
+}
+
+// log returns the client's logger, defaulting to slog.Default.
+func (c *Client) log() *slog.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return slog.Default()
+}
+
+// warn records a partial failure in warnings and logs it at debug level; callers decide
+// whether to surface the returned warnings.
+func (c *Client) warn(warnings *[]Warning, account fmt.Stringer, message string, err error) {
+	w := newWarning(account, message, err)
+	*warnings = append(*warnings, w)
+	c.log().Debug(message, "account", w.Account, "err", err)
+}
@@ -0,0 +1,392 @@
+package arkham_protocol
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"golang.org/x/crypto/sha3"
+)
+
+// DefaultOracleURL is the hosted Arkham price oracle endpoint.
+const DefaultOracleURL = "https://arkham-dvpn.vercel.app/api/price"
+
+// OraclePriceDecimals is the number of decimal places in oracle prices (micro-USD).
+const OraclePriceDecimals = 6
+
+// DefaultMaxPriceAge is how old a signed quote may be before the client refuses to use it.
+const DefaultMaxPriceAge = 60 * time.Second
+
+// maxPriceClockSkew tolerates oracles whose clock runs slightly ahead of ours.
+const maxPriceClockSkew = 30 * time.Second
+
+// PriceQuote is a signed USD price for a stake token, as consumed by InitializeWarden.
+type PriceQuote struct {
+	Price     uint64
+	Timestamp int64
+	Signature [64]byte
+}
+
+// PriceSource supplies signed price quotes for stake tokens.
+type PriceSource interface {
+	Quote(ctx context.Context, token StakeToken) (*PriceQuote, error)
+}
+
+// OracleTokenID returns the token identifier used by the oracle API for a stake token.
+func OracleTokenID(token StakeToken) (string, error) {
+	switch token {
+	case StakeToken_Sol:
+		return "solana", nil
+	case StakeToken_Usdc:
+		return "usd-coin", nil
+	case StakeToken_Usdt:
+		return "tether", nil
+	default:
+		return "", fmt.Errorf("unsupported stake token")
+	}
+}
+
+// ParseStakeToken accepts either an oracle token ID ("solana") or a ticker ("SOL").
+func ParseStakeToken(s string) (StakeToken, error) {
+	switch strings.ToLower(s) {
+	case "sol", "solana":
+		return StakeToken_Sol, nil
+	case "usdc", "usd-coin":
+		return StakeToken_Usdc, nil
+	case "usdt", "tether":
+		return StakeToken_Usdt, nil
+	default:
+		return 0, fmt.Errorf("unknown stake token %q", s)
+	}
+}
+
+// OracleMessageHash returns keccak256(price_le || timestamp_le), the message the oracle signs.
+func OracleMessageHash(price uint64, timestamp int64) []byte {
+	msg := new(bytes.Buffer)
+	binary.Write(msg, binary.LittleEndian, price)
+	binary.Write(msg, binary.LittleEndian, timestamp)
+
+	hasher := sha3.NewLegacyKeccak256()
+	hasher.Write(msg.Bytes())
+	return hasher.Sum(nil)
+}
+
+// SignPriceQuote signs a price with an oracle key, producing a quote InitializeWarden accepts.
+func SignPriceQuote(oracleKey solana.PrivateKey, price uint64, timestamp int64) (*PriceQuote, error) {
+	sig, err := oracleKey.Sign(OracleMessageHash(price, timestamp))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign price quote: %w", err)
+	}
+	return &PriceQuote{Price: price, Timestamp: timestamp, Signature: sig}, nil
+}
+
+// VerifyPriceQuote checks the quote signature against the oracle authority and rejects quotes
+// older than maxAge or dated in the future.
+func VerifyPriceQuote(quote *PriceQuote, oracleAuthority solana.PublicKey, maxAge time.Duration, now time.Time) error {
+	if quote.Price == 0 {
+		return fmt.Errorf("oracle returned a zero price")
+	}
+	if !ed25519.Verify(ed25519.PublicKey(oracleAuthority[:]), OracleMessageHash(quote.Price, quote.Timestamp), quote.Signature[:]) {
+		return fmt.Errorf("price signature does not match oracle authority %s", oracleAuthority)
+	}
+
+	quotedAt := time.Unix(quote.Timestamp, 0)
+	if quotedAt.After(now.Add(maxPriceClockSkew)) {
+		return fmt.Errorf("price timestamp %s is in the future", quotedAt.Format(time.RFC3339))
+	}
+	if age := now.Sub(quotedAt); age > maxAge {
+		return fmt.Errorf("price is stale: quoted %s ago, limit is %s", age.Round(time.Second), maxAge)
+	}
+	return nil
+}
+
+// QuoteUSD converts a quote price into US dollars for display.
+func QuoteUSD(quote *PriceQuote) float64 {
+	return float64(quote.Price) / math.Pow10(OraclePriceDecimals)
+}
+
+// --- Arkham oracle API ---
+
+// ArkhamOraclePriceSource fetches quotes from an HTTP oracle speaking the Arkham price API.
+type ArkhamOraclePriceSource struct {
+	BaseURL          string
+	TrustedClientKey string
+	HTTPClient       *http.Client
+}
+
+// NewArkhamOraclePriceSource creates a source for the oracle API at baseURL.
+// An empty baseURL selects DefaultOracleURL.
+func NewArkhamOraclePriceSource(baseURL, trustedClientKey string) *ArkhamOraclePriceSource {
+	if baseURL == "" {
+		baseURL = DefaultOracleURL
+	}
+	return &ArkhamOraclePriceSource{
+		BaseURL:          baseURL,
+		TrustedClientKey: trustedClientKey,
+		HTTPClient:       &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Quote implements PriceSource.
+func (s *ArkhamOraclePriceSource) Quote(ctx context.Context, token StakeToken) (*PriceQuote, error) {
+	if s.TrustedClientKey == "" {
+		return nil, fmt.Errorf("TRUSTED_CLIENT_KEY not set in .env file")
+	}
+	tokenStr, err := OracleTokenID(token)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Add("token", tokenStr)
+	params.Add("trustedClientKey", s.TrustedClientKey)
+	reqURL := fmt.Sprintf("%s?%s", s.BaseURL, params.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build price API request: %w", err)
+	}
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call price API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("price API returned non-200 status: %s - %s", resp.Status, string(body))
+	}
+
+	var priceResp OracleQuoteResponse
+	if err := json.NewDecoder(resp.Body).Decode(&priceResp); err != nil {
+		return nil, fmt.Errorf("failed to decode price API response: %w", err)
+	}
+	return priceResp.PriceQuote()
+}
+
+// OracleQuoteResponse is the JSON shape returned by the oracle API. All fields are strings;
+// the signature is hex encoded.
+type OracleQuoteResponse struct {
+	Price     string `json:"price"`
+	Timestamp string `json:"timestamp"`
+	Signature string `json:"signature"`
+}
+
+// NewOracleQuoteResponse encodes a quote in the oracle API JSON shape.
+func NewOracleQuoteResponse(quote *PriceQuote) OracleQuoteResponse {
+	return OracleQuoteResponse{
+		Price:     strconv.FormatUint(quote.Price, 10),
+		Timestamp: strconv.FormatInt(quote.Timestamp, 10),
+		Signature: hex.EncodeToString(quote.Signature[:]),
+	}
+}
+
+// PriceQuote decodes the response into a PriceQuote.
+func (r OracleQuoteResponse) PriceQuote() (*PriceQuote, error) {
+	price, err := strconv.ParseUint(r.Price, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse price from API: %w", err)
+	}
+	timestamp, err := strconv.ParseInt(r.Timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse timestamp from API: %w", err)
+	}
+	signature, err := hex.DecodeString(r.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode signature from API: %w", err)
+	}
+	if len(signature) != 64 {
+		return nil, fmt.Errorf("invalid signature length from API: expected 64, got %d", len(signature))
+	}
+
+	quote := &PriceQuote{Price: price, Timestamp: timestamp}
+	copy(quote.Signature[:], signature)
+	return quote, nil
+}
+
+// --- Static fixtures ---
+
+// StaticPriceSource returns fixed, pre-signed quotes. It is meant for tests and fixtures.
+type StaticPriceSource struct {
+	Quotes map[StakeToken]PriceQuote
+}
+
+// Quote implements PriceSource.
+func (s *StaticPriceSource) Quote(ctx context.Context, token StakeToken) (*PriceQuote, error) {
+	quote, ok := s.Quotes[token]
+	if !ok {
+		return nil, fmt.Errorf("no static price for %s", token)
+	}
+	return &quote, nil
+}
+
+// LoadStaticPriceSource reads a fixture file mapping token names to oracle API responses,
+// e.g. {"sol": {"price": "150000000", "timestamp": "...", "signature": "..."}}.
+func LoadStaticPriceSource(path string) (*StaticPriceSource, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price fixture: %w", err)
+	}
+	var entries map[string]OracleQuoteResponse
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse price fixture: %w", err)
+	}
+
+	source := &StaticPriceSource{Quotes: make(map[StakeToken]PriceQuote)}
+	for name, entry := range entries {
+		token, err := ParseStakeToken(name)
+		if err != nil {
+			return nil, err
+		}
+		quote, err := entry.PriceQuote()
+		if err != nil {
+			return nil, fmt.Errorf("invalid fixture entry %q: %w", name, err)
+		}
+		source.Quotes[token] = *quote
+	}
+	return source, nil
+}
+
+// --- Local oracle ---
+
+// LocalOraclePriceSource signs configured prices with a local oracle key. Point the
+// protocol's OracleAuthority at the key's public key to use it on a local validator.
+type LocalOraclePriceSource struct {
+	Key    solana.PrivateKey
+	Prices map[StakeToken]uint64
+	Now    func() time.Time
+}
+
+// Quote implements PriceSource.
+func (s *LocalOraclePriceSource) Quote(ctx context.Context, token StakeToken) (*PriceQuote, error) {
+	price, ok := s.Prices[token]
+	if !ok {
+		return nil, fmt.Errorf("local oracle has no price for %s", token)
+	}
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	return SignPriceQuote(s.Key, price, now().Unix())
+}
+
+// ParsePriceTable parses "sol=150000000,usdc=1000000" into oracle prices in micro-USD.
+func ParsePriceTable(s string) (map[StakeToken]uint64, error) {
+	prices := make(map[StakeToken]uint64)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid price entry %q, expected token=price", pair)
+		}
+		token, err := ParseStakeToken(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		price, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid price for %s: %w", name, err)
+		}
+		prices[token] = price
+	}
+	return prices, nil
+}
+
+// --- Configuration ---
+
+// NewPriceSourceFromEnv builds a PriceSource from environment variables:
+//
+//	ARKHAM_PRICE_SOURCE    oracle (default), local or static
+//	ARKHAM_ORACLE_URL      oracle API base URL (oracle)
+//	TRUSTED_CLIENT_KEY     oracle API client key (oracle)
+//	ARKHAM_ORACLE_KEYPAIR  solana-keygen file holding the oracle key (local)
+//	ARKHAM_STATIC_PRICES   price table such as "sol=150000000,usdc=1000000" (local)
+//	ARKHAM_PRICE_FIXTURE   JSON file of pre-signed quotes (static)
+func NewPriceSourceFromEnv() (PriceSource, error) {
+	switch kind := os.Getenv("ARKHAM_PRICE_SOURCE"); kind {
+	case "", "oracle":
+		return NewArkhamOraclePriceSource(os.Getenv("ARKHAM_ORACLE_URL"), os.Getenv("TRUSTED_CLIENT_KEY")), nil
+	case "local":
+		keyPath := os.Getenv("ARKHAM_ORACLE_KEYPAIR")
+		if keyPath == "" {
+			return nil, fmt.Errorf("ARKHAM_ORACLE_KEYPAIR must be set for the local price source")
+		}
+		key, err := solana.PrivateKeyFromSolanaKeygenFile(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load oracle keypair: %w", err)
+		}
+		prices, err := ParsePriceTable(os.Getenv("ARKHAM_STATIC_PRICES"))
+		if err != nil {
+			return nil, err
+		}
+		return &LocalOraclePriceSource{Key: key, Prices: prices}, nil
+	case "static":
+		fixture := os.Getenv("ARKHAM_PRICE_FIXTURE")
+		if fixture == "" {
+			return nil, fmt.Errorf("ARKHAM_PRICE_FIXTURE must be set for the static price source")
+		}
+		return LoadStaticPriceSource(fixture)
+	default:
+		return nil, fmt.Errorf("unknown ARKHAM_PRICE_SOURCE %q", kind)
+	}
+}
+
+// priceSource returns the client's configured source, falling back to the environment.
+func (c *Client) priceSource() (PriceSource, error) {
+	if c.PriceSource != nil {
+		return c.PriceSource, nil
+	}
+	return NewPriceSourceFromEnv()
+}
+
+// FetchVerifiedPrice gets a quote for the stake token and verifies it against the protocol's
+// oracle authority before it is used on-chain.
+func (c *Client) FetchVerifiedPrice(ctx context.Context, token StakeToken, oracleAuthority solana.PublicKey) (*PriceQuote, error) {
+	source, err := c.priceSource()
+	if err != nil {
+		return nil, err
+	}
+	quote, err := source.Quote(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	maxAge := c.MaxPriceAge
+	if maxAge == 0 {
+		maxAge = DefaultMaxPriceAge
+	}
+	if err := VerifyPriceQuote(quote, oracleAuthority, maxAge, time.Now()); err != nil {
+		return nil, fmt.Errorf("rejected oracle price: %w", err)
+	}
+	return quote, nil
+}
+
+// GetUSDPrice returns the current USD price of a stake token from the client's price source.
+// The quote is not verified; use it for display only.
+func (c *Client) GetUSDPrice(ctx context.Context, token StakeToken) (float64, error) {
+	source, err := c.priceSource()
+	if err != nil {
+		return 0, err
+	}
+	quote, err := source.Quote(ctx, token)
+	if err != nil {
+		return 0, err
+	}
+	return QuoteUSD(quote), nil
+}
@@ -0,0 +1,148 @@
+package arkham_protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"golang.org/x/crypto/sha3"
+)
+
+func TestOracleMessageHashIsKeccakOfLittleEndianFields(t *testing.T) {
+	var msg []byte
+	msg = binary.LittleEndian.AppendUint64(msg, 150_000_000)
+	msg = binary.LittleEndian.AppendUint64(msg, uint64(1_700_000_000))
+	hasher := sha3.NewLegacyKeccak256()
+	hasher.Write(msg)
+
+	if got := OracleMessageHash(150_000_000, 1_700_000_000); !bytes.Equal(got, hasher.Sum(nil)) {
+		t.Fatalf("hash = %x, want keccak256(price_le || ts_le)", got)
+	}
+}
+
+func TestVerifyPriceQuote(t *testing.T) {
+	oracle := solana.NewWallet().PrivateKey
+	now := time.Unix(1_700_000_000, 0)
+	sign := func(price uint64, at time.Time) *PriceQuote {
+		t.Helper()
+		quote, err := SignPriceQuote(oracle, price, at.Unix())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return quote
+	}
+	tampered := sign(150_000_000, now)
+	tampered.Price++
+	zero := sign(0, now)
+
+	for _, tt := range []struct {
+		name      string
+		quote     *PriceQuote
+		authority solana.PublicKey
+		err       string
+	}{
+		{"valid", sign(150_000_000, now), oracle.PublicKey(), ""},
+		{"at the age limit", sign(150_000_000, now.Add(-DefaultMaxPriceAge)), oracle.PublicKey(), ""},
+		{"within the clock skew", sign(150_000_000, now.Add(maxPriceClockSkew)), oracle.PublicKey(), ""},
+		{"wrong key", sign(150_000_000, now), solana.NewWallet().PublicKey(), "does not match oracle authority"},
+		{"tampered price", tampered, oracle.PublicKey(), "does not match oracle authority"},
+		{"zero price", zero, oracle.PublicKey(), "zero price"},
+		{"stale", sign(150_000_000, now.Add(-DefaultMaxPriceAge-time.Second)), oracle.PublicKey(), "stale"},
+		{"future", sign(150_000_000, now.Add(maxPriceClockSkew+time.Second)), oracle.PublicKey(), "in the future"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyPriceQuote(tt.quote, tt.authority, DefaultMaxPriceAge, now)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("rejected a valid quote: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNewPriceSourceFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	oracle := solana.NewWallet().PrivateKey
+
+	keypair := filepath.Join(dir, "oracle.json")
+	raw, _ := json.Marshal([]byte(oracle))
+	if err := os.WriteFile(keypair, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	quote, _ := SignPriceQuote(oracle, 1_000_000, time.Now().Unix())
+	fixture := filepath.Join(dir, "prices.json")
+	raw, _ = json.Marshal(map[string]OracleQuoteResponse{"usdc": NewOracleQuoteResponse(quote)})
+	if err := os.WriteFile(fixture, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		env  map[string]string
+		want string // the source's type, or the error
+	}{
+		{"default", nil, "*arkham_protocol.ArkhamOraclePriceSource"},
+		{"oracle", map[string]string{"ARKHAM_PRICE_SOURCE": "oracle", "ARKHAM_ORACLE_URL": "http://oracle.test"}, "*arkham_protocol.ArkhamOraclePriceSource"},
+		{"local", map[string]string{"ARKHAM_PRICE_SOURCE": "local", "ARKHAM_ORACLE_KEYPAIR": keypair, "ARKHAM_STATIC_PRICES": "sol=150000000"}, "*arkham_protocol.LocalOraclePriceSource"},
+		{"local without a key", map[string]string{"ARKHAM_PRICE_SOURCE": "local"}, "ARKHAM_ORACLE_KEYPAIR must be set"},
+		{"local with a bad table", map[string]string{"ARKHAM_PRICE_SOURCE": "local", "ARKHAM_ORACLE_KEYPAIR": keypair, "ARKHAM_STATIC_PRICES": "sol"}, "expected token=price"},
+		{"static", map[string]string{"ARKHAM_PRICE_SOURCE": "static", "ARKHAM_PRICE_FIXTURE": fixture}, "*arkham_protocol.StaticPriceSource"},
+		{"static without a fixture", map[string]string{"ARKHAM_PRICE_SOURCE": "static"}, "ARKHAM_PRICE_FIXTURE must be set"},
+		{"unknown", map[string]string{"ARKHAM_PRICE_SOURCE": "coingecko"}, "unknown ARKHAM_PRICE_SOURCE"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"ARKHAM_PRICE_SOURCE", "ARKHAM_ORACLE_URL", "ARKHAM_ORACLE_KEYPAIR", "ARKHAM_STATIC_PRICES", "ARKHAM_PRICE_FIXTURE"} {
+				t.Setenv(key, tt.env[key])
+			}
+			source, err := NewPriceSourceFromEnv()
+			got := ""
+			if err != nil {
+				got = err.Error()
+			} else {
+				got = fmt.Sprintf("%T", source)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Fatalf("source = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	t.Setenv("ARKHAM_PRICE_SOURCE", "oracle")
+	t.Setenv("ARKHAM_ORACLE_URL", "")
+	source, _ := NewPriceSourceFromEnv()
+	if url := source.(*ArkhamOraclePriceSource).BaseURL; url != DefaultOracleURL {
+		t.Fatalf("oracle URL = %s, want the default", url)
+	}
+
+	t.Setenv("ARKHAM_PRICE_SOURCE", "local")
+	t.Setenv("ARKHAM_ORACLE_KEYPAIR", keypair)
+	t.Setenv("ARKHAM_STATIC_PRICES", "sol=150000000")
+	source, _ = NewPriceSourceFromEnv()
+	local, err := source.Quote(t.Context(), StakeToken_Sol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyPriceQuote(local, oracle.PublicKey(), DefaultMaxPriceAge, time.Now()); err != nil {
+		t.Fatalf("local source signed an invalid quote: %v", err)
+	}
+
+	t.Setenv("ARKHAM_PRICE_SOURCE", "static")
+	t.Setenv("ARKHAM_PRICE_FIXTURE", fixture)
+	source, _ = NewPriceSourceFromEnv()
+	static, err := source.Quote(t.Context(), StakeToken_Usdc)
+	if err != nil || *static != *quote {
+		t.Fatalf("static quote = %+v, %v, want %+v", static, err, quote)
+	}
+}
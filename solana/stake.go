@@ -0,0 +1,293 @@
+package arkham_protocol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	associatedtokenaccount "github.com/gagliardetto/solana-go/programs/associated-token-account"
+	"github.com/gagliardetto/solana-go/programs/token"
+)
+
+// Mainnet stablecoin mints.
+var (
+	MainnetUsdcMint = solana.MustPublicKeyFromBase58("EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v")
+	MainnetUsdtMint = solana.MustPublicKeyFromBase58("Es9vMFrzaCERmJfrF4H2FYD4KCoNkY11McCe8BenwNYB")
+)
+
+// SolDecimals is the number of decimals of a lamport amount.
+const SolDecimals = 9
+
+// ErrStakeBelowMinimum is returned when a stake is worth less than the Bronze tier threshold.
+var ErrStakeBelowMinimum = errors.New("stake value is below the minimum tier threshold")
+
+// StakeMints are the SPL mints the protocol accepts as warden stake on one cluster.
+type StakeMints struct {
+	Usdc solana.PublicKey
+	Usdt solana.PublicKey
+}
+
+var (
+	DevnetStakeMints  = StakeMints{Usdc: DevnetUsdcMint, Usdt: DevnetUsdtMint}
+	MainnetStakeMints = StakeMints{Usdc: MainnetUsdcMint, Usdt: MainnetUsdtMint}
+)
+
+// StakeMintsForEndpoint picks the stake mints for the cluster behind an RPC endpoint.
+// ARKHAM_USDC_MINT and ARKHAM_USDT_MINT override them, e.g. for a localnet with test mints.
+func StakeMintsForEndpoint(rpcEndpoint string) StakeMints {
+	mints := DevnetStakeMints
+	if strings.Contains(rpcEndpoint, "mainnet") {
+		mints = MainnetStakeMints
+	}
+	if mint, err := solana.PublicKeyFromBase58(os.Getenv("ARKHAM_USDC_MINT")); err == nil {
+		mints.Usdc = mint
+	}
+	if mint, err := solana.PublicKeyFromBase58(os.Getenv("ARKHAM_USDT_MINT")); err == nil {
+		mints.Usdt = mint
+	}
+	return mints
+}
+
+// MintFor returns the SPL mint for a stake token. SOL has no mint.
+func (m StakeMints) MintFor(stakeToken StakeToken) (solana.PublicKey, error) {
+	switch stakeToken {
+	case StakeToken_Usdc:
+		return m.Usdc, nil
+	case StakeToken_Usdt:
+		// Devnet has no official USDT, so the default devnet config reuses the USDC mint.
+		// Staking "USDT" there would really stake USDC.
+		if m.Usdt.Equals(m.Usdc) {
+			return solana.PublicKey{}, fmt.Errorf("no USDT mint is configured for this cluster; set ARKHAM_USDT_MINT")
+		}
+		return m.Usdt, nil
+	default:
+		return solana.PublicKey{}, fmt.Errorf("%s is not an SPL stake token", stakeToken)
+	}
+}
+
+// FetchMintDecimals reads the number of decimals from an SPL mint account.
+func (c *Client) FetchMintDecimals(mint solana.PublicKey) (uint8, error) {
+	data, err := c.getAccountData(mint)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get mint account %s: %w", mint, err)
+	}
+	if data == nil {
+		return 0, fmt.Errorf("mint account %s not found", mint)
+	}
+
+	var mintAccount token.Mint
+	if err := bin.NewBinDecoder(data).Decode(&mintAccount); err != nil {
+		return 0, fmt.Errorf("failed to parse mint account %s: %w", mint, err)
+	}
+	return mintAccount.Decimals, nil
+}
+
+// StakeTokenDecimals returns the number of decimals used for amounts of a stake token.
+func (c *Client) StakeTokenDecimals(stakeToken StakeToken) (uint8, error) {
+	if stakeToken == StakeToken_Sol {
+		return SolDecimals, nil
+	}
+	mint, err := c.Mints.MintFor(stakeToken)
+	if err != nil {
+		return 0, err
+	}
+	return c.FetchMintDecimals(mint)
+}
+
+// StakePreflight describes whether the signer can stake an amount, and what it is worth.
+type StakePreflight struct {
+	StakeToken StakeToken
+	// Mint is the SPL mint of the stake token. It is the zero key for SOL.
+	Mint solana.PublicKey
+	// Account is the account the stake is taken from: the wallet for SOL, otherwise its ATA.
+	Account       solana.PublicKey
+	AccountExists bool
+	Decimals      uint8
+	Balance       uint64
+	Amount        uint64
+	// Price is the oracle price of one whole token in micro-USD.
+	Price         uint64
+	StakeValueUsd uint64
+	Tier          Tier
+	// TierErr is set when the stake does not reach any tier.
+	TierErr error
+}
+
+// Sufficient reports whether the stake account exists and holds at least Amount.
+func (p *StakePreflight) Sufficient() bool {
+	return p.AccountExists && p.Balance >= p.Amount
+}
+
+// Check returns an error describing the first problem that would make registration fail.
+func (p *StakePreflight) Check() error {
+	if !p.AccountExists {
+		return fmt.Errorf("token account %s for %s does not exist", p.Account, p.StakeToken)
+	}
+	if p.Balance < p.Amount {
+		return fmt.Errorf("insufficient %s balance: have %s, need %s",
+			p.StakeToken, FormatTokenAmount(p.Balance, p.Decimals), FormatTokenAmount(p.Amount, p.Decimals))
+	}
+	return p.TierErr
+}
+
+// PreflightWardenStake checks the signer's balance of the stake token and values the stake
+// with the current (unverified) oracle price.
+func (c *Client) PreflightWardenStake(ctx context.Context, stakeToken StakeToken, amount uint64) (*StakePreflight, error) {
+	preflight := &StakePreflight{
+		StakeToken: stakeToken,
+		Amount:     amount,
+	}
+	owner := c.Signer.PublicKey()
+
+	if stakeToken == StakeToken_Sol {
+		balance, err := c.GetBalance(owner)
+		if err != nil {
+			return nil, err
+		}
+		preflight.Account = owner
+		preflight.AccountExists = true
+		preflight.Decimals = SolDecimals
+		preflight.Balance = balance
+	} else {
+		mint, err := c.Mints.MintFor(stakeToken)
+		if err != nil {
+			return nil, err
+		}
+		decimals, err := c.FetchMintDecimals(mint)
+		if err != nil {
+			return nil, err
+		}
+		ata, _, err := solana.FindAssociatedTokenAddress(owner, mint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find associated token address: %w", err)
+		}
+		data, err := c.getAccountData(ata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get token account %s: %w", ata, err)
+		}
+		preflight.Mint = mint
+		preflight.Account = ata
+		preflight.Decimals = decimals
+		if data != nil {
+			var account token.Account
+			if err := bin.NewBinDecoder(data).Decode(&account); err != nil {
+				return nil, fmt.Errorf("failed to parse token account %s: %w", ata, err)
+			}
+			preflight.AccountExists = true
+			preflight.Balance = account.Amount
+		}
+	}
+
+	source, err := c.priceSource()
+	if err != nil {
+		return nil, err
+	}
+	quote, err := source.Quote(ctx, stakeToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s price: %w", stakeToken, err)
+	}
+	protocolConfig, err := c.FetchProtocolConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	preflight.Price = quote.Price
+	preflight.StakeValueUsd = StakeValueUSD(amount, preflight.Decimals, quote.Price)
+	preflight.Tier, preflight.TierErr = TierForStake(protocolConfig, preflight.StakeValueUsd)
+
+	return preflight, nil
+}
+
+// CreateStakeTokenAccount creates the signer's associated token account for an SPL stake token.
+func (c *Client) CreateStakeTokenAccount(stakeToken StakeToken) (*solana.Signature, error) {
+	mint, err := c.Mints.MintFor(stakeToken)
+	if err != nil {
+		return nil, err
+	}
+	instruction, err := associatedtokenaccount.NewCreateInstruction(
+		c.Signer.PublicKey(),
+		c.Signer.PublicKey(),
+		mint,
+	).ValidateAndBuild()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create associated token account instruction: %w", err)
+	}
+
+	sig, err := c.sendInstructions(instruction)
+	if err != nil {
+		return nil, err
+	}
+
+	ata, _, err := solana.FindAssociatedTokenAddress(c.Signer.PublicKey(), mint)
+	if err == nil {
+		c.invalidateOnConfirm(*sig, ata)
+	}
+	return sig, nil
+}
+
+// StakeValueUSD values amount base units of a token with the given decimals at price
+// micro-USD per whole token. The result is in micro-USD, saturating at the uint64 maximum.
+func StakeValueUSD(amount uint64, decimals uint8, price uint64) uint64 {
+	value := new(big.Int).Mul(new(big.Int).SetUint64(amount), new(big.Int).SetUint64(price))
+	value.Quo(value, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	if !value.IsUint64() {
+		return ^uint64(0)
+	}
+	return value.Uint64()
+}
+
+// TierForStake returns the tier a stake of valueUsd reaches under the protocol thresholds.
+// TierThresholds holds the minimum stake value of Bronze, Silver and Gold.
+func TierForStake(config *ProtocolConfig, valueUsd uint64) (Tier, error) {
+	switch {
+	case valueUsd >= config.TierThresholds[2]:
+		return Tier_Gold, nil
+	case valueUsd >= config.TierThresholds[1]:
+		return Tier_Silver, nil
+	case valueUsd >= config.TierThresholds[0]:
+		return Tier_Bronze, nil
+	default:
+		return Tier_Bronze, ErrStakeBelowMinimum
+	}
+}
+
+// ParseTokenAmount converts a decimal string such as "12.5" into base units without going
+// through floating point.
+func ParseTokenAmount(s string, decimals uint8) (uint64, error) {
+	s = strings.TrimSpace(s)
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" {
+		whole = "0"
+	}
+	if len(frac) > int(decimals) {
+		return 0, fmt.Errorf("amount %q has more than %d decimal places", s, decimals)
+	}
+	frac += strings.Repeat("0", int(decimals)-len(frac))
+
+	amount, ok := new(big.Int).SetString(whole+frac, 10)
+	if !ok || amount.Sign() < 0 {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if !amount.IsUint64() {
+		return 0, fmt.Errorf("amount %q is too large", s)
+	}
+	return amount.Uint64(), nil
+}
+
+// FormatTokenAmount renders base units as a decimal string.
+func FormatTokenAmount(amount uint64, decimals uint8) string {
+	if decimals == 0 {
+		return fmt.Sprintf("%d", amount)
+	}
+	digits := fmt.Sprintf("%0*d", int(decimals)+1, amount)
+	whole, frac := digits[:len(digits)-int(decimals)], strings.TrimRight(digits[len(digits)-int(decimals):], "0")
+	if frac == "" {
+		return whole
+	}
+	return whole + "." + frac
+}
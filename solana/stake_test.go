@@ -0,0 +1,151 @@
+package arkham_protocol
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+func TestParseTokenAmount(t *testing.T) {
+	for _, tt := range []struct {
+		in       string
+		decimals uint8
+		want     uint64
+		err      string
+	}{
+		{"12.5", 6, 12_500_000, ""},
+		{"1", SolDecimals, 1_000_000_000, ""},
+		{".5", 6, 500_000, ""},
+		{" 3. ", 2, 300, ""},
+		{"0", 6, 0, ""},
+		{"0.000000001", SolDecimals, 1, ""},
+		{"42", 0, 42, ""},
+		{"18446744073709551615", 0, math.MaxUint64, ""},
+		{"18446744073.709551615", SolDecimals, math.MaxUint64, ""},
+		{"0.0000001", 6, 0, "more than 6 decimal places"},
+		{"1.5", 0, 0, "more than 0 decimal places"},
+		{"18446744073709551616", 0, 0, "too large"},
+		{"18446744074", SolDecimals, 0, "too large"},
+		{"-1", 6, 0, "invalid amount"},
+		{"1e6", 6, 0, "invalid amount"},
+		{"1.2.3", 6, 0, "invalid amount"},
+		{"abc", 6, 0, "invalid amount"},
+	} {
+		got, err := ParseTokenAmount(tt.in, tt.decimals)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseTokenAmount(%q, %d) = %d, %v, want %q", tt.in, tt.decimals, got, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseTokenAmount(%q, %d) = %d, %v, want %d", tt.in, tt.decimals, got, err, tt.want)
+		}
+	}
+}
+
+func TestFormatTokenAmount(t *testing.T) {
+	for _, tt := range []struct {
+		amount   uint64
+		decimals uint8
+		want     string
+	}{
+		{12_500_000, 6, "12.5"},
+		{1_000_000_000, SolDecimals, "1"},
+		{1, SolDecimals, "0.000000001"},
+		{0, 6, "0"},
+		{42, 0, "42"},
+		{math.MaxUint64, SolDecimals, "18446744073.709551615"},
+		{math.MaxUint64, 0, "18446744073709551615"},
+	} {
+		got := FormatTokenAmount(tt.amount, tt.decimals)
+		if got != tt.want {
+			t.Errorf("FormatTokenAmount(%d, %d) = %q, want %q", tt.amount, tt.decimals, got, tt.want)
+		}
+		if back, err := ParseTokenAmount(got, tt.decimals); err != nil || back != tt.amount {
+			t.Errorf("ParseTokenAmount(%q, %d) = %d, %v, want %d", got, tt.decimals, back, err, tt.amount)
+		}
+	}
+}
+
+func TestStakeValueUSD(t *testing.T) {
+	for _, tt := range []struct {
+		amount   uint64
+		decimals uint8
+		price    uint64
+		want     uint64
+	}{
+		{2 * solana.LAMPORTS_PER_SOL, SolDecimals, 150_000_000, 300_000_000},
+		{1, SolDecimals, 150_000_000, 0}, // rounds down
+		{500_000_000, 6, 1_000_000, 500_000_000},
+		{0, 6, 1_000_000, 0},
+		{math.MaxUint64, 0, 2, math.MaxUint64}, // saturates
+	} {
+		if got := StakeValueUSD(tt.amount, tt.decimals, tt.price); got != tt.want {
+			t.Errorf("StakeValueUSD(%d, %d, %d) = %d, want %d", tt.amount, tt.decimals, tt.price, got, tt.want)
+		}
+	}
+}
+
+func TestTierForStake(t *testing.T) {
+	config := &ProtocolConfig{TierThresholds: [3]uint64{100, 1000, 10_000}}
+	for _, tt := range []struct {
+		value uint64
+		want  Tier
+		err   error
+	}{
+		{0, Tier_Bronze, ErrStakeBelowMinimum},
+		{99, Tier_Bronze, ErrStakeBelowMinimum},
+		{100, Tier_Bronze, nil},
+		{999, Tier_Bronze, nil},
+		{1000, Tier_Silver, nil},
+		{10_000, Tier_Gold, nil},
+		{math.MaxUint64, Tier_Gold, nil},
+	} {
+		got, err := TierForStake(config, tt.value)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("TierForStake(%d) = %s, %v, want %s, %v", tt.value, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestMintFor(t *testing.T) {
+	usdc, usdt := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	for _, tt := range []struct {
+		name  string
+		mints StakeMints
+		token StakeToken
+		want  solana.PublicKey
+		err   string
+	}{
+		{"usdc", StakeMints{Usdc: usdc, Usdt: usdt}, StakeToken_Usdc, usdc, ""},
+		{"usdt", StakeMints{Usdc: usdc, Usdt: usdt}, StakeToken_Usdt, usdt, ""},
+		{"mainnet usdt", MainnetStakeMints, StakeToken_Usdt, MainnetUsdtMint, ""},
+		{"sol has no mint", StakeMints{Usdc: usdc, Usdt: usdt}, StakeToken_Sol, solana.PublicKey{}, "not an SPL stake token"},
+		{"placeholder usdt", DevnetStakeMints, StakeToken_Usdt, solana.PublicKey{}, "set ARKHAM_USDT_MINT"},
+		{"usdt reusing usdc", StakeMints{Usdc: usdc, Usdt: usdc}, StakeToken_Usdt, solana.PublicKey{}, "no USDT mint"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.mints.MintFor(tt.token)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil || !got.Equals(tt.want) {
+				t.Fatalf("mint = %s, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+
+	// ARKHAM_USDT_MINT replaces the placeholder.
+	t.Setenv("ARKHAM_USDC_MINT", "")
+	t.Setenv("ARKHAM_USDT_MINT", usdt.String())
+	if got, err := StakeMintsForEndpoint("https://api.devnet.solana.com").MintFor(StakeToken_Usdt); err != nil || !got.Equals(usdt) {
+		t.Fatalf("mint = %s, %v, want %s", got, err, usdt)
+	}
+}
@@ -0,0 +1,113 @@
+package arkham_protocol
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+)
+
+// confirmPollInterval is how often AwaitConfirmation asks for a signature's status.
+const confirmPollInterval = 2 * time.Second
+
+// confirmTimeout is how long the client waits for its own transactions before dropping the
+// cached accounts they touch. A blockhash expires after about as long.
+const confirmTimeout = 90 * time.Second
+
+// sendTransaction sends a signed transaction and reports it to OnTransaction.
+func (c *Client) sendTransaction(tx *solana.Transaction) (solana.Signature, error) {
+	sig, err := c.RpcClient.SendTransaction(context.Background(), tx)
+	if err != nil {
+		c.log().Debug("transaction rejected", "err", err)
+		return sig, err
+	}
+	c.log().Debug("transaction sent", "signature", sig)
+	if c.OnTransaction != nil {
+		c.OnTransaction(sig)
+	}
+	return sig, nil
+}
+
+// AwaitConfirmation polls a transaction until it is confirmed, fails on chain or ctx ends.
+func (c *Client) AwaitConfirmation(ctx context.Context, sig solana.Signature) error {
+	ticker := time.NewTicker(confirmPollInterval)
+	defer ticker.Stop()
+	for {
+		statuses, err := c.RpcClient.GetSignatureStatuses(ctx, true, sig)
+		if err == nil && len(statuses.Value) > 0 && statuses.Value[0] != nil {
+			status := statuses.Value[0]
+			if status.Err != nil {
+				return fmt.Errorf("transaction %s failed: %v", sig, status.Err)
+			}
+			if status.ConfirmationStatus == rpc.ConfirmationStatusConfirmed ||
+				status.ConfirmationStatus == rpc.ConfirmationStatusFinalized {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("transaction %s not confirmed: %w", sig, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// TransactionEvents fetches a transaction and decodes the Arkham events, SOL and token
+// transfers in it, as seen from self.
+func (c *Client) TransactionEvents(ctx context.Context, sig solana.Signature, self solana.PublicKey) (*HistoryResult, error) {
+	if err := initializeIDL(); err != nil {
+		return nil, fmt.Errorf("failed to initialize IDL: %w", err)
+	}
+	version := uint64(0)
+	tx, err := c.RpcClient.GetTransaction(ctx, sig, &rpc.GetTransactionOpts{
+		Encoding:                       solana.EncodingBase64,
+		Commitment:                     rpc.CommitmentConfirmed,
+		MaxSupportedTransactionVersion: &version,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch transaction %s: %w", sig, err)
+	}
+
+	result := &HistoryResult{
+		SolHistory:        make([]GenericEvent, 0),
+		ArkhamHistory:     make([]GenericEvent, 0),
+		ConnectionHistory: make([]ConnectionEvent, 0),
+		ThroughputHistory: make([]GenericEvent, 0),
+	}
+	var mu sync.Mutex
+	parseTransactionForHistory(tx, self, result, &mu)
+	return result, nil
+}
+
+// WatchTransactions subscribes to confirmed transactions that mention account and calls
+// onTx with each signature. It blocks until ctx is cancelled or the connection fails.
+func (c *Client) WatchTransactions(ctx context.Context, wsEndpoint string, account solana.PublicKey, onTx func(solana.Signature)) error {
+	wsClient, err := ws.Connect(ctx, wsEndpoint)
+	if err != nil {
+		return fmt.Errorf("failed to connect to websocket endpoint: %w", err)
+	}
+	defer wsClient.Close()
+
+	sub, err := wsClient.LogsSubscribeMentions(account, rpc.CommitmentConfirmed)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to logs for %s: %w", account, err)
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		got, err := sub.Recv(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("log subscription for %s ended: %w", account, err)
+		}
+		if got != nil {
+			onTx(got.Value.Signature)
+		}
+	}
+}
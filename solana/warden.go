@@ -4,13 +4,22 @@ import (
 	"context"
 	"fmt"
 
-	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/rpc"
 )
 
-// FetchAllWardens fetches all Warden accounts from the blockchain.
-func (client *Client) FetchAllWardens() ([]*Warden, error) {
+// FetchAllWardens fetches all Warden accounts from the blockchain. Accounts that cannot be
+// decoded are skipped and reported as warnings.
+// The list of warden addresses and their data are served from the account cache when fresh.
+func (client *Client) FetchAllWardens() ([]*Warden, []Warning, error) {
+	if client.Cache != nil {
+		if keys, ok := client.Cache.getWardenList(); ok {
+			return client.FetchWardenAccounts(keys)
+		}
+	}
+
 	var wardenAccounts []*Warden
+	var warnings []Warning
 
 	// Get all accounts owned by the program, filtered by the Warden discriminator.
 	resp, err := client.RpcClient.GetProgramAccountsWithOpts(
@@ -28,20 +37,78 @@ func (client *Client) FetchAllWardens() ([]*Warden, error) {
 		},
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get program accounts: %w", err)
+		return nil, nil, fmt.Errorf("failed to get program accounts: %w", err)
 	}
 
+	keys := make([]solana.PublicKey, 0, len(resp))
+
 	// Deserialize each account
 	for _, account := range resp {
-		var warden Warden
-		err := warden.UnmarshalWithDecoder(bin.NewBorshDecoder(account.Account.Data.GetBinary()))
+		data := account.Account.Data.GetBinary()
+		keys = append(keys, account.Pubkey)
+		if client.Cache != nil {
+			client.Cache.Put(account.Pubkey, data)
+		}
+
+		warden, err := ParseAccount_Warden(data)
+		if err != nil {
+			client.warn(&warnings, account.Pubkey, "failed to deserialize warden account", err)
+			continue
+		}
+		wardenAccounts = append(wardenAccounts, warden)
+	}
+
+	if client.Cache != nil {
+		client.Cache.putWardenList(keys)
+	}
+
+	return wardenAccounts, warnings, nil
+}
+
+// FetchWardenAccounts loads the given Warden PDAs with batched getMultipleAccounts calls.
+// Accounts that no longer exist are skipped; accounts that cannot be decoded are skipped and
+// reported as warnings.
+func (client *Client) FetchWardenAccounts(wardenPDAs []solana.PublicKey) ([]*Warden, []Warning, error) {
+	accounts, err := client.GetMultipleAccounts(context.Background(), wardenPDAs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load warden accounts: %w", err)
+	}
+
+	wardens := make([]*Warden, 0, len(wardenPDAs))
+	var warnings []Warning
+	for _, key := range wardenPDAs {
+		data := accounts[key]
+		if data == nil {
+			continue
+		}
+		warden, err := ParseAccount_Warden(data)
 		if err != nil {
-			// Log the error but continue with other accounts
-			fmt.Printf("failed to deserialize warden account %s: %v\n", account.Pubkey.String(), err)
+			client.warn(&warnings, key, "failed to deserialize warden account", err)
 			continue
 		}
-		wardenAccounts = append(wardenAccounts, &warden)
+		wardens = append(wardens, warden)
+	}
+	return wardens, warnings, nil
+}
+
+// FetchWardenByAuthority fetches the Warden account registered by a wallet.
+func (client *Client) FetchWardenByAuthority(wardenAuthority solana.PublicKey) (*Warden, error) {
+	wardenPDA, _, err := GetWardenPDAForAuthority(wardenAuthority)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get warden PDA: %w", err)
 	}
 
-	return wardenAccounts, nil
-}
\ No newline at end of file
+	data, err := client.getAccountData(wardenPDA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get warden account info: %w", err)
+	}
+	if data == nil {
+		return nil, fmt.Errorf("warden %s is not registered", wardenAuthority)
+	}
+
+	warden, err := ParseAccount_Warden(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse warden account data: %w", err)
+	}
+	return warden, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"arkham-cli/apiv1"
+	"arkham-cli/events"
+)
+
+const (
+	sseHeartbeatInterval = 15 * time.Second
+	// sseRetryMillis is how long browsers wait before reconnecting a dropped stream.
+	sseRetryMillis = 3000
+)
+
+// handleEvents streams daemon events as server-sent events. A reconnecting EventSource
+// sends Last-Event-ID and receives what it missed; a refreshed page can pass the last ID it
+// saw as ?lastEventId=. When events were lost a "reset" event tells the page to reload its
+// state. ?profile= limits transaction and chain events to one wallet profile and starts
+// watching it.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("lastEventId")
+	}
+	var resumeFrom uint64
+	if lastID != "" {
+		id, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid last event ID", http.StatusBadRequest)
+			return
+		}
+		resumeFrom = id
+	}
+
+	profile := r.URL.Query().Get("profile")
+	if profile != "" {
+		if fields := apiv1.ValidateProfileName("profile", profile); len(fields) > 0 {
+			http.Error(w, "Invalid 'profile' query parameter", http.StatusBadRequest)
+			return
+		}
+		if _, err := clientForProfile(profile); err != nil {
+			http.Error(w, fmt.Sprintf("Profile '%s' not found", profile), http.StatusNotFound)
+			return
+		}
+	}
+
+	sub := arkhamd.Events.Subscribe(resumeFrom)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetryMillis)
+	if sub.Missed {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, e := range sub.Backlog {
+		writeEvent(w, e, profile)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				// Dropped for falling behind; the browser reconnects and resumes.
+				return
+			}
+			writeEvent(w, e, profile)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes one event, skipping events of other profiles when the stream is scoped
+// to one.
+func writeEvent(w http.ResponseWriter, e events.Event, profile string) {
+	if profile != "" && e.Profile != "" && e.Profile != profile {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+}
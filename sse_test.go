@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"arkham-cli/daemon"
+	"arkham-cli/events"
+)
+
+func TestEventStreamResumes(t *testing.T) {
+	bus := events.NewBus(0)
+	arkhamd = &daemon.Daemon{Events: bus}
+	defer func() { arkhamd = nil }()
+
+	bus.Publish(events.TypeNode, "started")
+	first := bus.Subscribe(0)
+	bus.Publish(events.TypePeer, "connected")
+	seen := <-first.C
+	first.Close()
+	bus.Publish(events.TypePeer, "latency")
+
+	server := httptest.NewServer(http.HandlerFunc(handleEvents))
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	req.Header.Set("Last-Event-ID", strconv.FormatUint(seen.ID-1, 10))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	// The backlog after the resume ID arrives first, then live events.
+	go bus.Publish(events.TypeSession, "live")
+	var got []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() && len(got) < 3 {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			got = append(got, data)
+		}
+	}
+	want := []string{`"connected"`, `"latency"`, `"live"`}
+	for i, w := range want {
+		if i >= len(got) || !strings.Contains(got[i], w) {
+			t.Fatalf("expected events %v in order, got %v", want, got)
+		}
+	}
+}
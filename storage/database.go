@@ -133,3 +133,8 @@ func (ws *WalletStorage) GetAllWallets() (map[string]solana.PrivateKey, error) {
 	}
 	return data.Wallets, nil
 }
+
+// ConfigDir returns the directory that holds the wallet file and other local state.
+func ConfigDir() string {
+	return configDir
+}